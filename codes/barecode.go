@@ -0,0 +1,140 @@
+package codes
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultBarecodeTemplate is the storage barecode numbering template
+// used for entities without template: [prefix]major.minor
+// with
+// prefix: the store location (or parents, or entity) barecode prefix, or "_"
+// major: unique uid identical for the differents storages of the same product in an entity
+// minor: incremental number for the differents storages of the same product in an entity
+const DefaultBarecodeTemplate = "{prefix}{major}.{minor}"
+
+// DefaultBarecodePrefix is the prefix used when no store location
+// or entity prefix is defined
+const DefaultBarecodePrefix = "_"
+
+var (
+	barecodePrefixRegex = regexp.MustCompile(`^[_a-zA-Z]{1,5}$`)
+	placeholderRegex    = regexp.MustCompile(`{[a-z]+}`)
+
+	// ErrInvalidBarecodePrefix is returned for prefixes not made of 1 to 5 letters or _
+	ErrInvalidBarecodePrefix = errors.New("invalid barecode prefix, 1 to 5 letters or _ expected")
+	// ErrInvalidBarecodeTemplate is returned for templates with unknown placeholders,
+	// without {minor} or without {major} nor {product}
+	ErrInvalidBarecodeTemplate = errors.New("invalid barecode template, {minor} and {major} or {product} required, allowed placeholders: {prefix} {major} {minor} {product} {entity}")
+)
+
+// BarecodeValues are the values of a barecode template placeholders
+type BarecodeValues struct {
+	Prefix  string
+	Major   int
+	Minor   int
+	Product int
+	Entity  int
+}
+
+// ValidateBarecodePrefix returns an error if the prefix p is not valid
+func ValidateBarecodePrefix(p string) error {
+	if !barecodePrefixRegex.MatchString(p) {
+		return ErrInvalidBarecodePrefix
+	}
+	return nil
+}
+
+// ValidateBarecodeTemplate returns an error if the template t is not valid.
+// {minor} is incremented per product, {major} or {product} is required
+// so that the storages of different products do not get the same barecode.
+func ValidateBarecodeTemplate(t string) error {
+	if !strings.Contains(t, "{minor}") {
+		return ErrInvalidBarecodeTemplate
+	}
+	if !strings.Contains(t, "{major}") && !strings.Contains(t, "{product}") {
+		return ErrInvalidBarecodeTemplate
+	}
+	for _, p := range placeholderRegex.FindAllString(t, -1) {
+		switch p {
+		case "{prefix}", "{major}", "{minor}", "{product}", "{entity}":
+		default:
+			return ErrInvalidBarecodeTemplate
+		}
+	}
+	return nil
+}
+
+// BuildBarecode returns the barecode built from the template t and the values v
+func BuildBarecode(t string, v BarecodeValues) string {
+	return strings.NewReplacer(
+		"{prefix}", v.Prefix,
+		"{major}", strconv.Itoa(v.Major),
+		"{minor}", strconv.Itoa(v.Minor),
+		"{product}", strconv.Itoa(v.Product),
+		"{entity}", strconv.Itoa(v.Entity),
+	).Replace(t)
+}
+
+// ParseBarecode extracts the major and minor numbers of the barecode b
+// built from the template t for the given product and entity.
+// ok is false if b does not match the template.
+// major is the product id if the template has no {major} placeholder.
+func ParseBarecode(t string, product int, entity int, b string) (major int, minor int, ok bool) {
+
+	var (
+		err error
+		re  strings.Builder
+	)
+
+	// building a regex from the template
+	re.WriteString("^")
+	last := 0
+	for _, loc := range placeholderRegex.FindAllStringIndex(t, -1) {
+		re.WriteString(regexp.QuoteMeta(t[last:loc[0]]))
+		switch t[loc[0]:loc[1]] {
+		case "{prefix}":
+			re.WriteString(`[_a-zA-Z]{0,5}`)
+		case "{major}":
+			re.WriteString(`(?P<major>[0-9]+)`)
+		case "{minor}":
+			re.WriteString(`(?P<minor>[0-9]+)`)
+		case "{product}":
+			re.WriteString(strconv.Itoa(product))
+		case "{entity}":
+			re.WriteString(strconv.Itoa(entity))
+		}
+		last = loc[1]
+	}
+	re.WriteString(regexp.QuoteMeta(t[last:]))
+	re.WriteString("$")
+
+	var r *regexp.Regexp
+	if r, err = regexp.Compile(re.String()); err != nil {
+		return 0, 0, false
+	}
+
+	matches := r.FindStringSubmatch(b)
+	if matches == nil {
+		return 0, 0, false
+	}
+
+	major = product
+	for i, name := range r.SubexpNames() {
+		switch name {
+		case "major":
+			if major, err = strconv.Atoi(matches[i]); err != nil {
+				return 0, 0, false
+			}
+		case "minor":
+			if minor, err = strconv.Atoi(matches[i]); err != nil {
+				return 0, 0, false
+			}
+		}
+	}
+
+	return major, minor, true
+
+}
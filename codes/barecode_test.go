@@ -0,0 +1,113 @@
+package codes
+
+import "testing"
+
+func TestValidateBarecodePrefix(t *testing.T) {
+
+	tests := []struct {
+		prefix string
+		err    error
+	}{
+		{"_", nil},
+		{"AB", nil},
+		{"abcde", nil},
+		{"", ErrInvalidBarecodePrefix},
+		{"abcdef", ErrInvalidBarecodePrefix},
+		{"A1", ErrInvalidBarecodePrefix},
+		{"A-B", ErrInvalidBarecodePrefix},
+	}
+
+	for _, test := range tests {
+		t.Run(test.prefix, func(t *testing.T) {
+			if err := ValidateBarecodePrefix(test.prefix); err != test.err {
+				t.Errorf("ValidateBarecodePrefix(%q) = %v, want %v", test.prefix, err, test.err)
+			}
+		})
+	}
+
+}
+
+func TestValidateBarecodeTemplate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		template string
+		err      error
+	}{
+		{"default", DefaultBarecodeTemplate, nil},
+		{"product instead of major", "{prefix}{product}-{minor}", nil},
+		{"all placeholders", "{entity}/{prefix}{major}.{product}.{minor}", nil},
+		{"no prefix", "{major}.{minor}", nil},
+		{"missing minor", "{prefix}{major}", ErrInvalidBarecodeTemplate},
+		{"missing major and product", "{prefix}{entity}.{minor}", ErrInvalidBarecodeTemplate},
+		{"unknown placeholder", "{prefix}{major}.{minor}{foo}", ErrInvalidBarecodeTemplate},
+		{"uppercase braces are literal", "{prefix}{major}.{minor}{MAJOR}", nil},
+		{"empty", "", ErrInvalidBarecodeTemplate},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateBarecodeTemplate(test.template); err != test.err {
+				t.Errorf("ValidateBarecodeTemplate(%q) = %v, want %v", test.template, err, test.err)
+			}
+		})
+	}
+
+}
+
+func TestBuildBarecode(t *testing.T) {
+
+	v := BarecodeValues{Prefix: "AB", Major: 12, Minor: 3, Product: 45, Entity: 6}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"default", DefaultBarecodeTemplate, "AB12.3"},
+		{"product", "{prefix}{product}-{minor}", "AB45-3"},
+		{"entity", "{entity}/{major}.{minor}", "6/12.3"},
+		{"repeated placeholder", "{major}.{minor}.{minor}", "12.3.3"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := BuildBarecode(test.template, v); got != test.want {
+				t.Errorf("BuildBarecode(%q) = %q, want %q", test.template, got, test.want)
+			}
+		})
+	}
+
+}
+
+func TestParseBarecode(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		template string
+		barecode string
+		major    int
+		minor    int
+		ok       bool
+	}{
+		{"default", DefaultBarecodeTemplate, "AB12.3", 12, 3, true},
+		{"default prefix", DefaultBarecodeTemplate, "_12.3", 12, 3, true},
+		{"product", "{prefix}{product}-{minor}", "AB45-3", 45, 3, true},
+		{"other product", "{prefix}{product}-{minor}", "AB46-3", 0, 0, false},
+		{"entity", "{entity}/{major}.{minor}", "6/12.3", 12, 3, true},
+		{"other entity", "{entity}/{major}.{minor}", "7/12.3", 0, 0, false},
+		{"regex characters in template", "{major}.{minor}", "12x3", 0, 0, false},
+		{"not matching", DefaultBarecodeTemplate, "AB12", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			major, minor, ok := ParseBarecode(test.template, 45, 6, test.barecode)
+			if major != test.major || minor != test.minor || ok != test.ok {
+				t.Errorf("ParseBarecode(%q, %q) = %d, %d, %t, want %d, %d, %t",
+					test.template, test.barecode, major, minor, ok, test.major, test.minor, test.ok)
+			}
+		})
+	}
+
+}
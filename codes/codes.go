@@ -0,0 +1,172 @@
+package codes
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/datamatrix"
+	qrcode "github.com/skip2/go-qrcode"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+const (
+	// FormatQRCode is the QR code format
+	FormatQRCode = "qrcode"
+	// FormatCode128 is the Code 128 linear barcode format
+	FormatCode128 = "code128"
+	// FormatDataMatrix is the Data Matrix format
+	FormatDataMatrix = "datamatrix"
+
+	// DefaultSize is the default image size in pixels
+	DefaultSize = 512
+	// MaxSize is the maximum image size in pixels
+	MaxSize = 2048
+)
+
+var (
+	// QRCodePayload is the storage QR code content template
+	// with the placeholders:
+	// {id}: the storage id
+	// {barecode}: the storage barecode
+	// {url}: the application full URL
+	// example: {url}v/storages?storage={id}
+	QRCodePayload = "{id}"
+	// ApplicationFullURL is the application full URL
+	// used for the {url} placeholder
+	ApplicationFullURL string
+)
+
+// ErrUnknownFormat is returned for unsupported code formats
+var ErrUnknownFormat = errors.New("unknown code format")
+
+// StorageQRCodeContent returns the QR code content of the storage s
+// built from QRCodePayload
+func StorageQRCodeContent(s models.Storage) string {
+	return strings.NewReplacer(
+		"{id}", strconv.FormatInt(s.StorageID.Int64, 10),
+		"{barecode}", s.StorageBarecode.String,
+		"{url}", ApplicationFullURL,
+	).Replace(QRCodePayload)
+}
+
+// ParseStorageQRCodeContent extracts the storage id and barecode
+// from the content c of a storage QR code built from QRCodePayload.
+// Plain integers are always accepted as storage ids
+// for the QR codes generated before the payload was configurable.
+// ok is false if c does not match the payload.
+func ParseStorageQRCodeContent(c string) (id int64, barecode string, ok bool) {
+
+	var (
+		err error
+		re  strings.Builder
+	)
+
+	re.WriteString("^")
+	last := 0
+	for _, loc := range placeholderRegex.FindAllStringIndex(QRCodePayload, -1) {
+		re.WriteString(regexp.QuoteMeta(QRCodePayload[last:loc[0]]))
+		switch QRCodePayload[loc[0]:loc[1]] {
+		case "{id}":
+			re.WriteString(`(?P<id>[0-9]+)`)
+		case "{barecode}":
+			re.WriteString(`(?P<barecode>.+?)`)
+		case "{url}":
+			re.WriteString(regexp.QuoteMeta(ApplicationFullURL))
+		default:
+			re.WriteString(regexp.QuoteMeta(QRCodePayload[loc[0]:loc[1]]))
+		}
+		last = loc[1]
+	}
+	re.WriteString(regexp.QuoteMeta(QRCodePayload[last:]))
+	re.WriteString("$")
+
+	var r *regexp.Regexp
+	if r, err = regexp.Compile(re.String()); err == nil {
+		if matches := r.FindStringSubmatch(c); matches != nil {
+			for i, name := range r.SubexpNames() {
+				switch name {
+				case "id":
+					if id, err = strconv.ParseInt(matches[i], 10, 64); err != nil {
+						return 0, "", false
+					}
+				case "barecode":
+					barecode = matches[i]
+				}
+			}
+			return id, barecode, true
+		}
+	}
+
+	if id, err = strconv.ParseInt(c, 10, 64); err != nil {
+		return 0, "", false
+	}
+
+	return id, "", true
+
+}
+
+// StorageQRCode returns the PNG QR code of the storage s
+func StorageQRCode(s models.Storage) ([]byte, error) {
+	return qrcode.Encode(StorageQRCodeContent(s), qrcode.Medium, DefaultSize)
+}
+
+// Encode returns the PNG image of content in the given format.
+// size is the image width in pixels, the Code 128 height is a third of its width.
+// Images are never rendered smaller than their number of modules.
+func Encode(format string, content string, size int) ([]byte, error) {
+
+	var (
+		err error
+		bc  barcode.Barcode
+		buf bytes.Buffer
+	)
+
+	if size <= 0 {
+		size = DefaultSize
+	}
+	if size > MaxSize {
+		size = MaxSize
+	}
+
+	switch format {
+	case FormatQRCode:
+		return qrcode.Encode(content, qrcode.Medium, size)
+	case FormatCode128:
+		if bc, err = code128.Encode(content); err != nil {
+			return nil, err
+		}
+	case FormatDataMatrix:
+		if bc, err = datamatrix.Encode(content); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	width, height := size, size
+	if format == FormatCode128 {
+		height = size / 3
+	}
+	if width < bc.Bounds().Dx() {
+		width = bc.Bounds().Dx()
+	}
+	if height < bc.Bounds().Dy() {
+		height = bc.Bounds().Dy()
+	}
+
+	if bc, err = barcode.Scale(bc, width, height); err != nil {
+		return nil, err
+	}
+	if err = png.Encode(&buf, bc); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+
+}
@@ -0,0 +1,129 @@
+package codes
+
+import (
+	"bytes"
+	"database/sql"
+	"image/png"
+	"testing"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// setQRCodePayload sets the QR code payload and the application URL
+// for the test t.
+func setQRCodePayload(t *testing.T, payload string, url string) {
+
+	formerPayload, formerURL := QRCodePayload, ApplicationFullURL
+	QRCodePayload, ApplicationFullURL = payload, url
+	t.Cleanup(func() {
+		QRCodePayload, ApplicationFullURL = formerPayload, formerURL
+	})
+
+}
+
+func TestStorageQRCodeContent(t *testing.T) {
+
+	s := models.Storage{
+		StorageID:       sql.NullInt64{Valid: true, Int64: 42},
+		StorageBarecode: sql.NullString{Valid: true, String: "AB12.3"},
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{"default", "{id}", "42"},
+		{"url", "{url}v/storages?storage={id}", "https://chimitheque.example.com/v/storages?storage=42"},
+		{"barecode", "{barecode}", "AB12.3"},
+		{"id and barecode", "S{id}-{barecode}", "S42-AB12.3"},
+		{"unknown placeholder", "{foo}{id}", "{foo}42"},
+		{"no placeholder", "storage", "storage"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setQRCodePayload(t, test.payload, "https://chimitheque.example.com/")
+			if got := StorageQRCodeContent(s); got != test.want {
+				t.Errorf("StorageQRCodeContent with %q = %q, want %q", test.payload, got, test.want)
+			}
+		})
+	}
+
+}
+
+func TestParseStorageQRCodeContent(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		payload  string
+		content  string
+		id       int64
+		barecode string
+		ok       bool
+	}{
+		{"default", "{id}", "42", 42, "", true},
+		{"url", "{url}v/storages?storage={id}", "https://chimitheque.example.com/v/storages?storage=42", 42, "", true},
+		{"url of another instance", "{url}v/storages?storage={id}", "https://other.example.com/v/storages?storage=42", 0, "", false},
+		{"barecode", "{barecode}", "AB12.3", 0, "AB12.3", true},
+		{"id and barecode", "S{id}-{barecode}", "S42-AB12.3", 42, "AB12.3", true},
+		{"regex characters in payload", "s.{id}?", "s.42?", 42, "", true},
+		{"regex characters not matching", "s.{id}?", "sx42?", 0, "", false},
+		{"unknown placeholder", "{foo}{id}", "{foo}42", 42, "", true},
+		{"former plain id", "{url}v/storages?storage={id}", "42", 42, "", true},
+		{"not a storage code", "{url}v/storages?storage={id}", "hello", 0, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setQRCodePayload(t, test.payload, "https://chimitheque.example.com/")
+			id, barecode, ok := ParseStorageQRCodeContent(test.content)
+			if id != test.id || barecode != test.barecode || ok != test.ok {
+				t.Errorf("ParseStorageQRCodeContent(%q) with %q = %d, %q, %t, want %d, %q, %t",
+					test.content, test.payload, id, barecode, ok, test.id, test.barecode, test.ok)
+			}
+		})
+	}
+
+}
+
+func TestEncode(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		format string
+		size   int
+		width  int
+		height int
+		err    error
+	}{
+		{"QR code", FormatQRCode, 256, 256, 256, nil},
+		{"Code 128", FormatCode128, 600, 600, 200, nil},
+		{"DataMatrix", FormatDataMatrix, 0, DefaultSize, DefaultSize, nil},
+		{"size capped", FormatDataMatrix, 10 * MaxSize, MaxSize, MaxSize, nil},
+		{"unknown format", "ean13", 256, 0, 0, ErrUnknownFormat},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			b, err := Encode(test.format, "AB12.3", test.size)
+			if err != test.err {
+				t.Fatalf("Encode(%q) error = %v, want %v", test.format, err, test.err)
+			}
+			if err != nil {
+				return
+			}
+
+			img, err := png.Decode(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds().Dx() != test.width || img.Bounds().Dy() != test.height {
+				t.Errorf("Encode(%q) image is %dx%d, want %dx%d", test.format, img.Bounds().Dx(), img.Bounds().Dy(), test.width, test.height)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,371 @@
+package codes
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// GS1 application identifiers
+const (
+	AIGTIN       = "01"
+	AIBatchLot   = "10"
+	AIExpiryDate = "17"
+)
+
+// gs1GroupSeparator is the FNC1 character ending variable length fields
+const gs1GroupSeparator = '\x1d'
+
+// gs1FixedLengths are the data lengths of the predefined length
+// application identifiers, by two first digits
+var gs1FixedLengths = map[string]int{
+	"00": 18,
+	"01": 14,
+	"02": 14,
+	"03": 14,
+	"04": 16,
+	"11": 6,
+	"12": 6,
+	"13": 6,
+	"14": 6,
+	"15": 6,
+	"16": 6,
+	"17": 6,
+	"18": 6,
+	"19": 6,
+	"20": 2,
+	// measures, 4 digits AIs
+	"31": 6,
+	"32": 6,
+	"33": 6,
+	"34": 6,
+	"35": 6,
+	"36": 6,
+	// GLNs, 3 digits AIs
+	"41": 13,
+}
+
+// gs1AIFixedLengths are the data lengths of the other fixed length
+// 4 digits application identifiers, not in the predefined length table
+// but sometimes encoded without FNC1 separator
+var gs1AIFixedLengths = map[string]int{
+	// shipping and logistic
+	"4321": 1,
+	"4322": 1,
+	"4323": 1,
+	"4324": 10,
+	"4325": 10,
+	"4326": 6,
+	// NSN, expiration date and time, first freeze date
+	"7001": 13,
+	"7003": 10,
+	"7006": 6,
+	// healthcare, 72xx
+	"7241": 2,
+	"7250": 8,
+	"7251": 12,
+	"7252": 1,
+	// coupons and identification, 80xx and 81xx
+	"8001": 14,
+	"8005": 6,
+	"8006": 18,
+	"8017": 18,
+	"8018": 18,
+	"8026": 18,
+	"8111": 4,
+}
+
+// gs1HumanReadableAIRegex matches the (AI) of human readable element strings
+var gs1HumanReadableAIRegex = regexp.MustCompile(`\(([0-9]{2,4})\)`)
+
+// ErrInvalidGS1 is returned for codes that are not GS1 element strings
+var ErrInvalidGS1 = errors.New("invalid GS1 code")
+
+// GS1 is a parsed GS1 element string
+type GS1 struct {
+	GTIN   string    // 14 digits
+	Lot    string    // AI 10
+	Expiry time.Time // AI 17, zero if missing
+	// all the application identifiers
+	AIs map[string]string
+}
+
+// NormalizeGTIN returns the 14 digits form of the GTIN-8, GTIN-12,
+// GTIN-13 or GTIN-14 g.
+// ok is false if g is not a GTIN or if its check digit is wrong.
+func NormalizeGTIN(g string) (gtin string, ok bool) {
+
+	switch len(g) {
+	case 8, 12, 13, 14:
+	default:
+		return "", false
+	}
+
+	for _, c := range g {
+		if c < '0' || c > '9' {
+			return "", false
+		}
+	}
+
+	gtin = strings.Repeat("0", 14-len(g)) + g
+
+	// check digit: weights 3 and 1 alternately from the right,
+	// the check digit excluded
+	sum := 0
+	for i := 0; i < 13; i++ {
+		d := int(gtin[i] - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	if (10-sum%10)%10 != int(gtin[13]-'0') {
+		return "", false
+	}
+
+	return gtin, true
+
+}
+
+// GTINVariants returns the GTIN-14 gtin and its shorter forms
+// obtained by removing the leading zeros
+// as they may be recorded as supplier references.
+func GTINVariants(gtin string) []string {
+
+	variants := []string{gtin}
+	for _, l := range []int{13, 12, 8} {
+		if strings.HasPrefix(gtin, strings.Repeat("0", 14-l)) {
+			variants = append(variants, gtin[14-l:])
+		}
+	}
+
+	return variants
+
+}
+
+// gs1AILength returns the length of the application identifier
+// at the beginning of s
+func gs1AILength(s string) int {
+
+	if len(s) < 2 {
+		return 0
+	}
+
+	switch {
+	case s[0] == '3' && s[1] >= '1' && s[1] <= '6',
+		strings.HasPrefix(s, "39"),
+		strings.HasPrefix(s, "43"),
+		strings.HasPrefix(s, "70"),
+		strings.HasPrefix(s, "72"),
+		strings.HasPrefix(s, "80"),
+		strings.HasPrefix(s, "81"),
+		strings.HasPrefix(s, "82"):
+		return 4
+	case s[0] == '2' && s[1] >= '3' && s[1] <= '5',
+		s[0] == '4' && s[1] >= '0' && s[1] <= '2',
+		strings.HasPrefix(s, "71"):
+		return 3
+	}
+
+	return 2
+
+}
+
+// gs1DataLength returns the data length of the application identifier ai.
+// fixed is false for variable length application identifiers.
+func gs1DataLength(ai string) (n int, fixed bool) {
+
+	if n, fixed = gs1AIFixedLengths[ai]; fixed {
+		return n, true
+	}
+	n, fixed = gs1FixedLengths[ai[:2]]
+
+	return n, fixed
+
+}
+
+// isGS1AI returns true if ai is a known application identifier
+func isGS1AI(ai string) bool {
+
+	if gs1AILength(ai) != len(ai) {
+		return false
+	}
+	if len(ai) > 2 {
+		return true
+	}
+	if _, ok := gs1FixedLengths[ai]; ok {
+		return true
+	}
+	switch ai {
+	case AIBatchLot, "21", "22", "30", "37":
+		return true
+	}
+
+	return ai[0] == '9'
+
+}
+
+// isDigits returns true if s starts with n digits
+func isDigits(s string, n int) bool {
+
+	if len(s) < n {
+		return false
+	}
+	for _, c := range s[:n] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+
+}
+
+// gs1HumanReadableToRaw returns the raw content with FNC1 separators
+// of the human readable element string s.
+// Only the (AI) of known application identifiers following
+// complete predefined length data, and followed by their digits
+// for predefined length ones, start a new field, so that
+// parentheses in variable length data such as lots are kept.
+// ok is false if s does not start with a known (AI).
+func gs1HumanReadableToRaw(s string) (raw string, ok bool) {
+
+	var (
+		b   strings.Builder
+		ai  string // current application identifier
+		pos int    // current data start
+	)
+
+	for _, m := range gs1HumanReadableAIRegex.FindAllStringSubmatchIndex(s, -1) {
+		next := s[m[2]:m[3]]
+		if ai == "" {
+			if m[0] != 0 || !isGS1AI(next) {
+				return "", false
+			}
+		} else {
+			if !isGS1AI(next) {
+				continue
+			}
+			if n, fixed := gs1DataLength(ai); fixed && m[0]-pos != n {
+				continue
+			}
+			if n, fixed := gs1DataLength(next); fixed && !isDigits(s[m[1]:], n) {
+				continue
+			}
+			b.WriteString(ai)
+			b.WriteString(s[pos:m[0]])
+			b.WriteRune(gs1GroupSeparator)
+		}
+		ai, pos = next, m[1]
+	}
+	if ai == "" {
+		return "", false
+	}
+	b.WriteString(ai)
+	b.WriteString(s[pos:])
+
+	return b.String(), true
+
+}
+
+// ParseGS1 parses the GS1 element string s.
+// s can be a human readable string "(01)03453120000011(17)250101(10)AB-123",
+// a GS1-128 or GS1 DataMatrix raw content with FNC1 separators
+// with or without symbology identifier, or a plain GTIN.
+func ParseGS1(s string) (GS1, error) {
+
+	var g GS1
+
+	s = strings.TrimSpace(s)
+
+	// plain GTIN
+	if gtin, ok := NormalizeGTIN(s); ok {
+		g.GTIN = gtin
+		g.AIs = map[string]string{AIGTIN: gtin}
+		return g, nil
+	}
+
+	// symbology identifiers: ]C1 GS1-128, ]d2 DataMatrix, ]Q3 QR code, ]e0 DataBar
+	for _, id := range []string{"]C1", "]d2", "]Q3", "]e0"} {
+		s = strings.TrimPrefix(s, id)
+	}
+	s = strings.TrimPrefix(s, string(gs1GroupSeparator))
+
+	// human readable form: each AI starts a new field
+	if strings.HasPrefix(s, "(") {
+		var ok bool
+		if s, ok = gs1HumanReadableToRaw(s); !ok {
+			return GS1{}, ErrInvalidGS1
+		}
+	}
+
+	g.AIs = make(map[string]string)
+	for s != "" {
+
+		l := gs1AILength(s)
+		if l == 0 || len(s) < l {
+			return GS1{}, ErrInvalidGS1
+		}
+		ai := s[:l]
+		for _, c := range ai {
+			if c < '0' || c > '9' {
+				return GS1{}, ErrInvalidGS1
+			}
+		}
+		s = s[l:]
+
+		var data string
+		if n, ok := gs1DataLength(ai); ok {
+			if len(s) < n {
+				return GS1{}, ErrInvalidGS1
+			}
+			data, s = s[:n], s[n:]
+		} else if i := strings.IndexRune(s, gs1GroupSeparator); i != -1 {
+			data, s = s[:i], s[i:]
+		} else {
+			data, s = s, ""
+		}
+		s = strings.TrimPrefix(s, string(gs1GroupSeparator))
+
+		g.AIs[ai] = data
+
+	}
+
+	if gtin, ok := g.AIs[AIGTIN]; ok {
+		var valid bool
+		if g.GTIN, valid = NormalizeGTIN(gtin); !valid {
+			return GS1{}, ErrInvalidGS1
+		}
+	}
+	g.Lot = g.AIs[AIBatchLot]
+	if expiry, ok := g.AIs[AIExpiryDate]; ok {
+		var err error
+		if g.Expiry, err = parseGS1Date(expiry); err != nil {
+			return GS1{}, ErrInvalidGS1
+		}
+	}
+
+	if g.GTIN == "" {
+		return GS1{}, ErrInvalidGS1
+	}
+
+	return g, nil
+
+}
+
+// parseGS1Date parses the YYMMDD date d.
+// A 00 day is the last day of the month.
+func parseGS1Date(d string) (time.Time, error) {
+
+	if strings.HasSuffix(d, "00") {
+		t, err := time.Parse("060102", d[:4]+"01")
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.AddDate(0, 1, -1), nil
+	}
+
+	return time.Parse("060102", d)
+
+}
@@ -0,0 +1,241 @@
+package codes
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeGTIN(t *testing.T) {
+
+	tests := []struct {
+		name string
+		g    string
+		want string
+		ok   bool
+	}{
+		{"GTIN-8", "73513537", "00000073513537", true},
+		{"GTIN-12", "036000291452", "00036000291452", true},
+		{"GTIN-13", "4006381333931", "04006381333931", true},
+		{"GTIN-14", "03453120000011", "03453120000011", true},
+		{"wrong check digit", "4006381333932", "", false},
+		{"wrong length", "40063813339", "", false},
+		{"not digits", "400638133393A", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := NormalizeGTIN(test.g)
+			if got != test.want || ok != test.ok {
+				t.Errorf("NormalizeGTIN(%q) = %q, %t, want %q, %t", test.g, got, ok, test.want, test.ok)
+			}
+		})
+	}
+
+}
+
+func TestGTINVariants(t *testing.T) {
+
+	tests := []struct {
+		name string
+		gtin string
+		want []string
+	}{
+		{"GTIN-8", "00000073513537", []string{"00000073513537", "0000073513537", "000073513537", "73513537"}},
+		{"GTIN-12", "00036000291452", []string{"00036000291452", "0036000291452", "036000291452"}},
+		{"GTIN-13", "04006381333931", []string{"04006381333931", "4006381333931"}},
+		{"GTIN-14", "13453120000018", []string{"13453120000018"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := GTINVariants(test.gtin); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("GTINVariants(%q) = %v, want %v", test.gtin, got, test.want)
+			}
+		})
+	}
+
+}
+
+func TestParseGS1(t *testing.T) {
+
+	const gtin = "03453120000011"
+
+	tests := []struct {
+		name   string
+		s      string
+		gtin   string
+		lot    string
+		expiry time.Time
+		ais    map[string]string
+		err    error
+	}{
+		// plain GTINs
+		{
+			name: "plain GTIN-13",
+			s:    "4006381333931",
+			gtin: "04006381333931",
+			ais:  map[string]string{"01": "04006381333931"},
+		},
+		{
+			name: "plain GTIN-8 with spaces",
+			s:    " 73513537 ",
+			gtin: "00000073513537",
+			ais:  map[string]string{"01": "00000073513537"},
+		},
+		// human readable
+		{
+			name:   "human readable",
+			s:      "(01)03453120000011(17)250101(10)AB-123",
+			gtin:   gtin,
+			lot:    "AB-123",
+			expiry: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			ais:    map[string]string{"01": gtin, "17": "250101", "10": "AB-123"},
+		},
+		{
+			name: "human readable lot with parentheses",
+			s:    "(01)03453120000011(10)AB(12)3",
+			gtin: gtin,
+			lot:  "AB(12)3",
+			ais:  map[string]string{"01": gtin, "10": "AB(12)3"},
+		},
+		{
+			name: "human readable 4 digits fixed length AIs",
+			s:    "(01)03453120000011(7241)05(8005)000120(10)L1",
+			gtin: gtin,
+			lot:  "L1",
+			ais:  map[string]string{"01": gtin, "7241": "05", "8005": "000120", "10": "L1"},
+		},
+		{
+			name: "human readable unknown first AI",
+			s:    "(ab)03453120000011",
+			err:  ErrInvalidGS1,
+		},
+		// raw contents
+		{
+			name:   "FNC1 separators",
+			s:      "0103453120000011" + "10ABC\x1d" + "17250100",
+			gtin:   gtin,
+			lot:    "ABC",
+			expiry: time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC),
+			ais:    map[string]string{"01": gtin, "10": "ABC", "17": "250100"},
+		},
+		{
+			name: "leading FNC1 and separator after fixed length AI",
+			s:    "\x1d0103453120000011\x1d10LOT1",
+			gtin: gtin,
+			lot:  "LOT1",
+			ais:  map[string]string{"01": gtin, "10": "LOT1"},
+		},
+		{
+			name: "DataMatrix symbology identifier",
+			s:    "]d20103453120000011" + "21SER\x1d" + "10L",
+			gtin: gtin,
+			lot:  "L",
+			ais:  map[string]string{"01": gtin, "21": "SER", "10": "L"},
+		},
+		{
+			name:   "GS1-128 symbology identifier, fixed length AIs without separator",
+			s:      "]C10103453120000011" + "17250101" + "10LOT",
+			gtin:   gtin,
+			lot:    "LOT",
+			expiry: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			ais:    map[string]string{"01": gtin, "17": "250101", "10": "LOT"},
+		},
+		{
+			name: "3 digits AI",
+			s:    "0103453120000011" + "4109501101020917" + "10L",
+			gtin: gtin,
+			lot:  "L",
+			ais:  map[string]string{"01": gtin, "410": "9501101020917", "10": "L"},
+		},
+		{
+			name: "measure AI",
+			s:    "0103453120000011" + "3103000500",
+			gtin: gtin,
+			ais:  map[string]string{"01": gtin, "3103": "000500"},
+		},
+		{
+			name: "72xx fixed length AI",
+			s:    "0103453120000011" + "725019800101" + "10LOT",
+			gtin: gtin,
+			lot:  "LOT",
+			ais:  map[string]string{"01": gtin, "7250": "19800101", "10": "LOT"},
+		},
+		{
+			name: "72xx variable length AI",
+			s:    "0103453120000011" + "7240REF-1\x1d" + "10LOT",
+			gtin: gtin,
+			lot:  "LOT",
+			ais:  map[string]string{"01": gtin, "7240": "REF-1", "10": "LOT"},
+		},
+		{
+			name: "82xx variable length AI",
+			s:    "0103453120000011" + "8200http://example.com\x1d" + "10LOT",
+			gtin: gtin,
+			lot:  "LOT",
+			ais:  map[string]string{"01": gtin, "8200": "http://example.com", "10": "LOT"},
+		},
+		{
+			name: "80xx fixed length AI",
+			s:    "0103453120000011" + "8005000120" + "10LOT",
+			gtin: gtin,
+			lot:  "LOT",
+			ais:  map[string]string{"01": gtin, "8005": "000120", "10": "LOT"},
+		},
+		// errors
+		{
+			name: "truncated fixed length AI",
+			s:    "010345312000",
+			err:  ErrInvalidGS1,
+		},
+		{
+			name: "wrong GTIN check digit",
+			s:    "(01)03453120000012(10)L",
+			err:  ErrInvalidGS1,
+		},
+		{
+			name: "invalid expiry date",
+			s:    "(01)03453120000011(17)251301",
+			err:  ErrInvalidGS1,
+		},
+		{
+			name: "no GTIN",
+			s:    "(10)LOT",
+			err:  ErrInvalidGS1,
+		},
+		{
+			name: "not a GS1 code",
+			s:    "hello",
+			err:  ErrInvalidGS1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			g, err := ParseGS1(test.s)
+			if err != test.err {
+				t.Fatalf("ParseGS1(%q) error = %v, want %v", test.s, err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			if g.GTIN != test.gtin {
+				t.Errorf("ParseGS1(%q) GTIN = %q, want %q", test.s, g.GTIN, test.gtin)
+			}
+			if g.Lot != test.lot {
+				t.Errorf("ParseGS1(%q) Lot = %q, want %q", test.s, g.Lot, test.lot)
+			}
+			if !g.Expiry.Equal(test.expiry) {
+				t.Errorf("ParseGS1(%q) Expiry = %v, want %v", test.s, g.Expiry, test.expiry)
+			}
+			if !reflect.DeepEqual(g.AIs, test.ais) {
+				t.Errorf("ParseGS1(%q) AIs = %v, want %v", test.s, g.AIs, test.ais)
+			}
+
+		})
+	}
+
+}
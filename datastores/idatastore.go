@@ -1,7 +1,9 @@
 package datastores
 
 import (
+	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/steambap/captcha"
 	. "github.com/tbellembois/gochimitheque/models"
@@ -71,6 +73,7 @@ type Datastore interface {
 	GetProductsTags(Dbselectparam) ([]Tag, int, error)
 	GetProductsSuppliers(Dbselectparam) ([]Supplier, int, error)
 	GetProductsSupplierRefs(DbselectparamSupplierRef) ([]SupplierRef, int, error)
+	GetSupplierRefsProductIDs(labels []string) ([]int, error)
 
 	GetProduct(id int) (Product, error)
 	CountProductStorages(id int) (int, error)
@@ -93,23 +96,140 @@ type Datastore interface {
 	GetStorageEntity(id int) (Entity, error)
 	DeleteStorage(id int) error
 	ArchiveStorage(id int) error
+	ArchiveStorages(ids []int) error
 	RestoreStorage(id int) error
 	CreateStorage(s Storage, itemNumber int) (int, error)
 	UpdateStorage(s Storage) error
+	UpdateStorages(ss []Storage) error
 	ToogleStorageBorrowing(s Storage) error
+	IsStorageBorrowed(id int) (bool, error)
 	UpdateAllQRCodes() error
 
 	// store locations
 	GetStoreLocations(DbselectparamStoreLocation) ([]StoreLocation, int, error)
 	GetStoreLocation(id int) (StoreLocation, error)
 	GetStoreLocationChildren(id int) ([]StoreLocation, error)
+	GetStoreLocationsByBarecodePrefix(prefix string) ([]StoreLocation, error)
 	DeleteStoreLocation(id int) error
 	CreateStoreLocation(s StoreLocation) (int64, error)
 	UpdateStoreLocation(s StoreLocation) error
+	RebuildStoreLocationFullPaths() (int64, error)
+	GetStoreLocationRollups(entities []int, level string) ([]StoreLocationRollup, error)
 	HasStorelocationStorage(id int) (bool, error)
 
+	// inventories
+	GetInventories(DbselectparamInventory) ([]Inventory, int, error)
+	GetInventory(id int) (Inventory, error)
+	GetInventoryEntity(id int) (Entity, error)
+	GetInventoryReport(id int) (InventoryReport, error)
+	CreateInventory(i Inventory) (int64, error)
+	CreateInventoryScan(s InventoryScan) (InventoryScan, error)
+	CloseInventory(id int) error
+
+	// waste pickups
+	GetWastePickups(DbselectparamWastePickup) ([]WastePickup, int, error)
+	GetWastePickup(id int) (WastePickup, error)
+	GetWastePickupEntity(id int) (Entity, error)
+	CreateWastePickup(w WastePickup) (int64, error)
+	UpdateWastePickup(w WastePickup) error
+	CompleteWastePickup(id int) error
+	DeleteWastePickup(id int) error
+
+	// storage transfers
+	GetStorageTransfers(DbselectparamStorageTransfer) ([]StorageTransfer, int, error)
+	GetStorageTransfer(id int) (StorageTransfer, error)
+	GetStorageTransferEntities(id int) ([]Entity, error)
+	CreateStorageTransfer(t StorageTransfer) (int64, error)
+	AcceptStorageTransfer(id int, personID int) error
+	RefuseStorageTransfer(id int, personID int) error
+	CancelStorageTransfer(id int, personID int) error
+
+	// storage aliquots
+	SplitStorage(id int, quantities []float64, personID int) ([]int, error)
+	GetStorageLineage(id int) (StorageLineage, error)
+
+	// prepared solutions
+	GetSolutionStorage(s Solution, personID int) (Storage, error)
+	PrepareSolution(s Solution, personID int) (int, error)
+	GetStorageSources(id int) ([]StorageSource, error)
+
+	// storage versions
+	GetStorageVersions(id int) ([]StorageVersion, error)
+	RestoreStorageVersion(id int, versionID int, personID int) error
+
+	// reservations
+	GetReservations(DbselectparamReservation) ([]Reservation, int, error)
+	GetReservation(id int) (Reservation, error)
+	GetStorageReservations(id int) ([]Reservation, error)
+	GetReservationConflicts(id int, personID int, withdrawn sql.NullFloat64) ([]Reservation, error)
+	CreateReservation(r Reservation) (int64, error)
+	DeleteReservation(id int) error
+
+	// purchase requests
+	GetPurchaseRequests(DbselectparamPurchaseRequest) ([]PurchaseRequest, int, error)
+	GetPurchaseRequest(id int) (PurchaseRequest, error)
+	CreatePurchaseRequest(p PurchaseRequest) (int64, error)
+	ApprovePurchaseRequest(id int, personID int) error
+	RefusePurchaseRequest(id int, personID int) error
+	OrderPurchaseRequest(id int, reference sql.NullString) error
+	CancelPurchaseRequest(id int) error
+	ReceivePurchaseRequest(id int, r PurchaseReception, personID int) ([]int, error)
+
+	// stock thresholds
+	GetStockThresholds(DbselectparamStockThreshold) ([]StockThreshold, int, error)
+	GetStockThreshold(id int) (StockThreshold, error)
+	SetStockThreshold(t StockThreshold) (int64, error)
+	DeleteStockThreshold(id int) error
+	GetStockThresholdAlerts(entityID int) ([]StockThreshold, error)
+
+	// spendings
+	GetSpendings(f SpendingFilter) ([]SpendingLine, error)
+
+	// stock snapshots
+	SnapshotStocks(d time.Time) (int64, error)
+	GetStockTrends(f StockTrendFilter) ([]StockTrend, error)
+
+	// store location limits
+	GetStoreLocationLimitStatuses(entities []int) ([]StoreLocationLimitStatus, error)
+	GetStoreLocationLimit(id int) (StoreLocationLimit, error)
+	CreateStoreLocationLimit(l StoreLocationLimit) (int64, error)
+	UpdateStoreLocationLimit(l StoreLocationLimit) error
+	DeleteStoreLocationLimit(id int) error
+	CheckStoreLocationLimits(s Storage, count int) ([]StoreLocationLimitStatus, error)
+	CheckStoreLocationBatchLimits(ss []Storage) ([]StoreLocationLimitStatus, error)
+
+	// storage classes
+	GetStorageClasses() ([]StorageClass, error)
+	SetStorageClassIncompatibilities(id int, ids []int) error
+	GetProductStorageClasses(id int) (ProductStorageClasses, error)
+	SetProductStorageClasses(id int, classes []StorageClass) error
+	GetStorageClassIncompatibilities(s Storage) ([]StorageClassConflict, error)
+	GetStorageClassConflicts(entities []int) ([]StorageClassConflict, error)
+
+	// store location temperatures
+	GetTemperatureMismatches(entities []int) ([]TemperatureMismatch, error)
+
+	// sensors
+	GetSensors(entities []int) ([]Sensor, error)
+	GetSensor(id int) (Sensor, error)
+	GetSensorByTokenHash(hash string) (Sensor, error)
+	CreateSensor(s Sensor, hash string) (int64, error)
+	DeleteSensor(id int) error
+	GetLastSensorReading(id int) (SensorReading, bool, error)
+	GetSensorReadings(id int, from string, to string) ([]SensorReading, error)
+	CreateSensorReading(r SensorReading, reason string) (int64, error)
+	GetSensorAlert(id int) (SensorAlert, error)
+	GetSensorAlerts(entities []int) ([]SensorAlert, error)
+
+	// gtins
+	GetGTIN(label string) (GTIN, error)
+	GetProductGTINs(id int) ([]GTIN, error)
+	CreateGTIN(g GTIN) (int64, error)
+	DeleteGTIN(id int) error
+
 	// entities
 	ComputeStockEntity(p Product, r *http.Request) []StoreLocation
+	ComputeStockTotals(p Product, r *http.Request) (StockTotals, error)
 
 	GetEntities(DbselectparamEntity) ([]Entity, int, error)
 	GetEntity(id int) (Entity, error)
@@ -64,6 +64,8 @@ func (db *SQLiteDataStore) GetEntities(p DbselectparamEntity) ([]Entity, int, er
 		goqu.I("e.entity_id"),
 		goqu.I("e.entity_name"),
 		goqu.I("e.entity_description"),
+		goqu.I("e.entity_barecodeprefix"),
+		goqu.I("e.entity_barecodetemplate"),
 	).GroupBy(goqu.I("e.entity_id")).Order(orderClause).Limit(uint(p.GetLimit())).Offset(uint(p.GetOffset())).ToSQL(); err != nil {
 		return nil, 0, err
 	}
@@ -196,6 +198,8 @@ func (db *SQLiteDataStore) GetEntity(id int) (Entity, error) {
 		goqu.I("e.entity_id"),
 		goqu.I("e.entity_name"),
 		goqu.I("e.entity_description"),
+		goqu.I("e.entity_barecodeprefix"),
+		goqu.I("e.entity_barecodetemplate"),
 	)
 
 	if sqlr, args, err = sQuery.ToSQL(); err != nil {
@@ -337,8 +341,10 @@ func (db *SQLiteDataStore) CreateEntity(e Entity) (lastInsertId int64, err error
 
 	iQuery := dialect.Insert(tableEntity).Rows(
 		goqu.Record{
-			"entity_name":        e.EntityName,
-			"entity_description": e.EntityDescription,
+			"entity_name":             e.EntityName,
+			"entity_description":      e.EntityDescription,
+			"entity_barecodeprefix":   e.EntityBarecodePrefix,
+			"entity_barecodetemplate": e.EntityBarecodeTemplate,
 		},
 	)
 
@@ -469,8 +475,10 @@ func (db *SQLiteDataStore) UpdateEntity(e Entity) (err error) {
 
 	if sqlr, args, err = dialect.Update(tableEntity).Set(
 		goqu.Record{
-			"entity_name":        e.EntityName,
-			"entity_description": e.EntityDescription,
+			"entity_name":             e.EntityName,
+			"entity_description":      e.EntityDescription,
+			"entity_barecodeprefix":   e.EntityBarecodePrefix,
+			"entity_barecodetemplate": e.EntityBarecodeTemplate,
 		},
 	).Where(
 		goqu.I("entity_id").Eq(e.EntityID),
@@ -0,0 +1,169 @@
+package datastores
+
+import (
+	"database/sql"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// gtinSelect returns the GTIN select query.
+func gtinSelect() *goqu.SelectDataset {
+
+	dialect := goqu.Dialect("sqlite3")
+
+	return dialect.From(goqu.T("gtin")).LeftJoin(
+		goqu.T("supplierref"),
+		goqu.On(goqu.Ex{"gtin.supplierref": goqu.I("supplierref.supplierref_id")}),
+	).LeftJoin(
+		goqu.T("supplier"),
+		goqu.On(goqu.Ex{"supplierref.supplier": goqu.I("supplier.supplier_id")}),
+	).Select(
+		goqu.I("gtin.gtin_id"),
+		goqu.I("gtin.gtin_label"),
+		goqu.I("gtin.product"),
+		goqu.I("supplierref.supplierref_id"),
+		goqu.I("supplierref.supplierref_label"),
+		goqu.I("supplier.supplier_id").As(goqu.C("supplier.supplier_id")),
+		goqu.I("supplier.supplier_label").As(goqu.C("supplier.supplier_label")),
+	)
+
+}
+
+// GetGTIN returns the GTIN mapping with the label.
+// sql.ErrNoRows is returned if the GTIN is not mapped.
+func (db *SQLiteDataStore) GetGTIN(label string) (GTIN, error) {
+
+	var (
+		err  error
+		sqlr string
+		args []interface{}
+		gtin GTIN
+	)
+
+	if sqlr, args, err = gtinSelect().Where(
+		goqu.I("gtin.gtin_label").Eq(label),
+	).ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return GTIN{}, err
+	}
+
+	if err = db.Get(&gtin, sqlr, args...); err != nil {
+		return GTIN{}, err
+	}
+
+	logger.Log.WithFields(logrus.Fields{"label": label, "gtin": gtin}).Debug("GetGTIN")
+
+	return gtin, nil
+
+}
+
+// GetProductGTINs returns the GTIN mappings of the product id.
+func (db *SQLiteDataStore) GetProductGTINs(id int) ([]GTIN, error) {
+
+	var (
+		err   error
+		sqlr  string
+		args  []interface{}
+		gtins []GTIN
+	)
+
+	if sqlr, args, err = gtinSelect().Where(
+		goqu.I("gtin.product").Eq(id),
+	).Order(goqu.I("gtin.gtin_label").Asc()).ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return nil, err
+	}
+
+	if err = db.Select(&gtins, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return gtins, nil
+
+}
+
+// CreateGTIN creates the GTIN mapping g.
+// A GTIN is mapped once, nothing is done if it already exists.
+func (db *SQLiteDataStore) CreateGTIN(g GTIN) (lastInsertID int64, err error) {
+
+	var (
+		sqlr string
+		args []interface{}
+		res  sql.Result
+		tx   *sql.Tx
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+	tableGTIN := goqu.T("gtin")
+
+	if tx, err = db.Begin(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	record := goqu.Record{
+		"gtin_label": g.GTINLabel,
+		"product":    g.ProductID,
+	}
+	if g.SupplierRefID.Valid {
+		record["supplierref"] = g.SupplierRefID.Int64
+	}
+
+	if sqlr, args, err = dialect.Insert(tableGTIN).Rows(record).OnConflict(goqu.DoNothing()).ToSQL(); err != nil {
+		return
+	}
+
+	if res, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	if lastInsertID, err = res.LastInsertId(); err != nil {
+		return
+	}
+
+	return
+
+}
+
+// DeleteGTIN deletes the GTIN mapping with the id.
+func (db *SQLiteDataStore) DeleteGTIN(id int) error {
+
+	var (
+		err  error
+		sqlr string
+		args []interface{}
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+	tableGTIN := goqu.T("gtin")
+
+	if sqlr, args, err = dialect.Delete(tableGTIN).Where(
+		goqu.I("gtin_id").Eq(id),
+	).ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return err
+	}
+
+	if _, err = db.Exec(sqlr, args...); err != nil {
+		return err
+	}
+
+	return nil
+
+}
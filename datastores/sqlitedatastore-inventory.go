@@ -0,0 +1,509 @@
+package datastores
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/codes"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// inventoryStorageColumns are the storage columns returned
+// by the inventory reconciliation queries.
+const inventoryStorageColumns = `storage.storage_id,
+	storage.storage_barecode,
+	storage.storage_batchnumber,
+	storage.storage_quantity,
+	storage.storage_creationdate,
+	storage.storage_modificationdate,
+	uq.unit_id AS "unit_quantity.unit_id",
+	uq.unit_label AS "unit_quantity.unit_label",
+	product.product_id AS "product.product_id",
+	name.name_id AS "product.name.name_id",
+	name.name_label AS "product.name.name_label",
+	casnumber.casnumber_id AS "product.casnumber.casnumber_id",
+	casnumber.casnumber_label AS "product.casnumber.casnumber_label",
+	storelocation.storelocation_id AS "storelocation.storelocation_id",
+	storelocation.storelocation_name AS "storelocation.storelocation_name",
+	storelocation.storelocation_color AS "storelocation.storelocation_color",
+	storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath",
+	storelocation.entity AS "storelocation.entity.entity_id"`
+
+// inventoryStorageJoins are the joins matching inventoryStorageColumns.
+const inventoryStorageJoins = `JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	LEFT JOIN casnumber ON product.casnumber = casnumber.casnumber_id
+	LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id`
+
+// GetInventories returns the inventory campaigns matching p.
+func (db *SQLiteDataStore) GetInventories(p DbselectparamInventory) ([]Inventory, int, error) {
+
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("GetInventories")
+
+	var err error
+
+	dialect := goqu.Dialect("sqlite3")
+	tableInventory := goqu.T("inventory")
+
+	// Build orderby/order clause.
+	orderClause := goqu.I(p.GetOrderBy()).Asc()
+	if strings.ToLower(p.GetOrder()) == "desc" {
+		orderClause = goqu.I(p.GetOrderBy()).Desc()
+	}
+
+	// Build join clause.
+	joinClause := dialect.From(tableInventory).Join(
+		goqu.T("entity"),
+		goqu.On(goqu.Ex{"inventory.entity": goqu.I("entity.entity_id")}),
+	).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{"inventory.person": goqu.I("person.person_id")}),
+	).LeftJoin(
+		goqu.T("storelocation"),
+		goqu.On(goqu.Ex{"inventory.storelocation": goqu.I("storelocation.storelocation_id")}),
+	).LeftJoin(
+		goqu.T("inventoryscan"),
+		goqu.On(goqu.Ex{"inventoryscan.inventory": goqu.I("inventory.inventory_id")}),
+	).Join(
+		goqu.T("permission").As("perm"),
+		goqu.On(
+			goqu.Ex{
+				"perm.person":               p.GetLoggedPersonID(),
+				"perm.permission_item_name": []string{"all", "storages"},
+				"perm.permission_perm_name": []string{"r", "w", "all"},
+				"perm.permission_entity_id": []interface{}{-1, goqu.I("entity.entity_id")},
+			},
+		),
+	)
+
+	// Build where AND expression.
+	whereAnd := []goqu.Expression{
+		goqu.I("inventory.inventory_name").Like(p.GetSearch()),
+	}
+	if p.GetEntity() != -1 {
+		whereAnd = append(whereAnd, goqu.I("inventory.entity").Eq(p.GetEntity()))
+	}
+	if p.GetOpen() {
+		whereAnd = append(whereAnd, goqu.I("inventory.inventory_closedate").IsNull())
+	}
+
+	joinClause = joinClause.Where(goqu.And(whereAnd...))
+
+	// Building final count.
+	var (
+		countSql  string
+		countArgs []interface{}
+	)
+	if countSql, countArgs, err = joinClause.Select(
+		goqu.COUNT(goqu.I("inventory.inventory_id").Distinct()),
+	).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	// Building final select.
+	var (
+		selectSql  string
+		selectArgs []interface{}
+	)
+	if selectSql, selectArgs, err = joinClause.Select(
+		goqu.I("inventory.inventory_id"),
+		goqu.I("inventory.inventory_name"),
+		goqu.I("inventory.inventory_creationdate"),
+		goqu.I("inventory.inventory_closedate"),
+		goqu.COUNT(goqu.I("inventoryscan.inventoryscan_id").Distinct()).As("inventory_sc"),
+		goqu.I("person.person_id").As(goqu.C("person.person_id")),
+		goqu.I("person.person_email").As(goqu.C("person.person_email")),
+		goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
+		goqu.I("entity.entity_name").As(goqu.C("entity.entity_name")),
+		goqu.I("storelocation.storelocation_id").As(goqu.C("storelocation.storelocation_id")),
+		goqu.I("storelocation.storelocation_name").As(goqu.C("storelocation.storelocation_name")),
+		goqu.COALESCE(goqu.I("storelocation.storelocation_fullpath"), "").As(goqu.C("storelocation.storelocation_fullpath")),
+	).GroupBy(goqu.I("inventory.inventory_id")).Order(orderClause).Limit(uint(p.GetLimit())).Offset(uint(p.GetOffset())).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		inventories []Inventory
+		count       int
+	)
+
+	if err = db.Select(&inventories, selectSql, selectArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	if err = db.Get(&count, countSql, countArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	return inventories, count, nil
+
+}
+
+// GetInventory returns the inventory campaign with id "id".
+func (db *SQLiteDataStore) GetInventory(id int) (Inventory, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetInventory")
+
+	dialect := goqu.Dialect("sqlite3")
+	tableInventory := goqu.T("inventory")
+
+	sQuery := dialect.From(tableInventory).Join(
+		goqu.T("entity"),
+		goqu.On(goqu.Ex{"inventory.entity": goqu.I("entity.entity_id")}),
+	).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{"inventory.person": goqu.I("person.person_id")}),
+	).LeftJoin(
+		goqu.T("storelocation"),
+		goqu.On(goqu.Ex{"inventory.storelocation": goqu.I("storelocation.storelocation_id")}),
+	).LeftJoin(
+		goqu.T("inventoryscan"),
+		goqu.On(goqu.Ex{"inventoryscan.inventory": goqu.I("inventory.inventory_id")}),
+	).Where(
+		goqu.I("inventory.inventory_id").Eq(id),
+	).Select(
+		goqu.I("inventory.inventory_id"),
+		goqu.I("inventory.inventory_name"),
+		goqu.I("inventory.inventory_creationdate"),
+		goqu.I("inventory.inventory_closedate"),
+		goqu.COUNT(goqu.I("inventoryscan.inventoryscan_id").Distinct()).As("inventory_sc"),
+		goqu.I("person.person_id").As(goqu.C("person.person_id")),
+		goqu.I("person.person_email").As(goqu.C("person.person_email")),
+		goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
+		goqu.I("entity.entity_name").As(goqu.C("entity.entity_name")),
+		goqu.I("storelocation.storelocation_id").As(goqu.C("storelocation.storelocation_id")),
+		goqu.I("storelocation.storelocation_name").As(goqu.C("storelocation.storelocation_name")),
+		goqu.COALESCE(goqu.I("storelocation.storelocation_fullpath"), "").As(goqu.C("storelocation.storelocation_fullpath")),
+	).GroupBy(goqu.I("inventory.inventory_id"))
+
+	var (
+		err       error
+		sqlr      string
+		args      []interface{}
+		inventory Inventory
+	)
+
+	if sqlr, args, err = sQuery.ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return Inventory{}, err
+	}
+
+	if err = db.Get(&inventory, sqlr, args...); err != nil {
+		return Inventory{}, err
+	}
+
+	return inventory, nil
+
+}
+
+// GetInventoryEntity returns the entity of the inventory campaign with id "id".
+func (db *SQLiteDataStore) GetInventoryEntity(id int) (Entity, error) {
+
+	var (
+		entity Entity
+		sqlr   string
+		err    error
+	)
+
+	sqlr = `SELECT
+	entity.entity_id AS "entity_id",
+	entity.entity_name AS "entity_name"
+	FROM inventory
+	JOIN entity ON inventory.entity = entity.entity_id
+	WHERE inventory.inventory_id = ?`
+	if err = db.Get(&entity, sqlr, id); err != nil {
+		return Entity{}, err
+	}
+
+	return entity, nil
+
+}
+
+// CreateInventory inserts the inventory campaign i.
+func (db *SQLiteDataStore) CreateInventory(i Inventory) (lastInsertId int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"i": fmt.Sprintf("%+v", i)}).Debug("CreateInventory")
+
+	dialect := goqu.Dialect("sqlite3")
+	tableInventory := goqu.T("inventory")
+
+	setClause := goqu.Record{
+		"inventory_name":         i.InventoryName,
+		"inventory_creationdate": time.Now(),
+		"person":                 i.PersonID,
+		"entity":                 i.EntityID,
+	}
+	if i.StoreLocation.StoreLocationID.Valid {
+		setClause["storelocation"] = i.StoreLocation.StoreLocationID.Int64
+	}
+
+	var (
+		sqlr      string
+		args      []interface{}
+		sqlResult sql.Result
+	)
+
+	if sqlr, args, err = dialect.Insert(tableInventory).Rows(setClause).ToSQL(); err != nil {
+		return
+	}
+
+	if sqlResult, err = db.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	return sqlResult.LastInsertId()
+
+}
+
+// CloseInventory closes the inventory campaign with id "id".
+// No more scans can be added to a closed campaign.
+func (db *SQLiteDataStore) CloseInventory(id int) error {
+
+	dialect := goqu.Dialect("sqlite3")
+	tableInventory := goqu.T("inventory")
+
+	var (
+		err  error
+		sqlr string
+		args []interface{}
+	)
+
+	if sqlr, args, err = dialect.Update(tableInventory).Set(
+		goqu.Record{"inventory_closedate": time.Now()},
+	).Where(
+		goqu.I("inventory_id").Eq(id),
+	).ToSQL(); err != nil {
+		return err
+	}
+
+	if _, err = db.Exec(sqlr, args...); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// CreateInventoryScan records the scan s and resolves its code
+// against the current (non archived) storages of the inventory entity.
+// The code is either a storage id (QR code) or a storage barecode.
+// Storages not yet scanned during the campaign are matched first
+// so that identical barecodes are counted once each.
+// s.Storage.StorageID is not valid if the code is unknown.
+func (db *SQLiteDataStore) CreateInventoryScan(s InventoryScan) (scan InventoryScan, err error) {
+
+	var (
+		tx        *sqlx.Tx
+		sqlr      string
+		args      []interface{}
+		storageID sql.NullInt64
+		sqlResult sql.Result
+		lastID    int64
+	)
+
+	logger.Log.WithFields(logrus.Fields{"s": fmt.Sprintf("%+v", s)}).Debug("CreateInventoryScan")
+
+	if tx, err = db.Beginx(); err != nil {
+		return InventoryScan{}, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	s.InventoryScanCode = strings.TrimSpace(s.InventoryScanCode)
+	s.InventoryScanDate = time.Now()
+
+	// the code is a storage id or barecode, or a storage QR code content
+	idCode, barecode := s.InventoryScanCode, s.InventoryScanCode
+	if id, b, isqr := codes.ParseStorageQRCodeContent(s.InventoryScanCode); isqr {
+		if id != 0 {
+			idCode = strconv.FormatInt(id, 10)
+		}
+		if b != "" {
+			barecode = b
+		}
+	}
+
+	sqlr = `SELECT storage.storage_id FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storage.storage IS NULL
+	AND (storage.storage_archive IS NULL OR storage.storage_archive = false)
+	AND storelocation.entity = ?
+	AND (CAST(storage.storage_id AS TEXT) = ? OR storage.storage_barecode = ?)
+	ORDER BY storage.storage_id IN (SELECT inventoryscan.storage FROM inventoryscan WHERE inventoryscan.inventory = ? AND inventoryscan.storage IS NOT NULL),
+	storage.storage_id
+	LIMIT 1`
+	if err = tx.Get(&storageID, sqlr, s.Inventory.EntityID, idCode, barecode, s.Inventory.InventoryID); err != nil && err != sql.ErrNoRows {
+		return
+	}
+	err = nil
+
+	dialect := goqu.Dialect("sqlite3")
+	tableInventoryScan := goqu.T("inventoryscan")
+
+	setClause := goqu.Record{
+		"inventoryscan_code": s.InventoryScanCode,
+		"inventoryscan_date": s.InventoryScanDate,
+		"inventory":          s.Inventory.InventoryID,
+		"person":             s.PersonID,
+		"storelocation":      s.StoreLocationID.Int64,
+	}
+	if storageID.Valid {
+		setClause["storage"] = storageID.Int64
+	}
+
+	if sqlr, args, err = dialect.Insert(tableInventoryScan).Rows(setClause).ToSQL(); err != nil {
+		return
+	}
+
+	if sqlResult, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+	if lastID, err = sqlResult.LastInsertId(); err != nil {
+		return
+	}
+
+	s.InventoryScanID = int(lastID)
+	s.Storage.StorageID = storageID
+
+	return s, nil
+
+}
+
+// GetInventoryReport reconciles the scans of the inventory campaign
+// with id "id" against the storages expected in its entity
+// (or in its store location and children).
+func (db *SQLiteDataStore) GetInventoryReport(id int) (InventoryReport, error) {
+
+	var (
+		err      error
+		sqlr     string
+		args     []interface{}
+		report   InventoryReport
+		expected []Storage
+		scans    []InventoryScan
+	)
+
+	if report.Inventory, err = db.GetInventory(id); err != nil {
+		return InventoryReport{}, err
+	}
+
+	// Expected storages.
+	sqlr = `SELECT ` + inventoryStorageColumns + `
+	FROM storage
+	` + inventoryStorageJoins + `
+	WHERE storage.storage IS NULL
+	AND (storage.storage_archive IS NULL OR storage.storage_archive = false)
+	AND storelocation.entity = ?`
+	args = []interface{}{report.Inventory.EntityID}
+
+	if report.Inventory.StoreLocation.StoreLocationID.Valid {
+		sqlr += ` AND storelocation.storelocation_id IN (
+		WITH RECURSIVE children(id) AS (
+			SELECT ?
+			UNION
+			SELECT storelocation_id FROM storelocation, children WHERE storelocation.storelocation = children.id
+		)
+		SELECT id FROM children)`
+		args = append(args, report.Inventory.StoreLocation.StoreLocationID.Int64)
+	}
+	sqlr += ` ORDER BY storelocation.storelocation_fullpath, storage.storage_barecode`
+
+	if err = db.Select(&expected, sqlr, args...); err != nil {
+		return InventoryReport{}, err
+	}
+
+	// Scans.
+	sqlr = `SELECT inventoryscan.inventoryscan_id,
+	inventoryscan.inventoryscan_code,
+	inventoryscan.inventoryscan_date,
+	person.person_id AS "person.person_id",
+	person.person_email AS "person.person_email",
+	sl.storelocation_id AS "storelocation.storelocation_id",
+	sl.storelocation_name AS "storelocation.storelocation_name",
+	sl.storelocation_color AS "storelocation.storelocation_color",
+	sl.storelocation_fullpath AS "storelocation.storelocation_fullpath",
+	inventoryscan.storage AS "storage.storage_id"
+	FROM inventoryscan
+	JOIN person ON inventoryscan.person = person.person_id
+	JOIN storelocation sl ON inventoryscan.storelocation = sl.storelocation_id
+	WHERE inventoryscan.inventory = ?
+	ORDER BY inventoryscan.inventoryscan_date`
+	if err = db.Select(&scans, sqlr, id); err != nil {
+		return InventoryReport{}, err
+	}
+
+	expectedByID := make(map[int64]Storage)
+	for _, s := range expected {
+		expectedByID[s.StorageID.Int64] = s
+	}
+
+	// Reconciliation.
+	scanned := make(map[int64]bool)
+	for _, sc := range scans {
+
+		if !sc.Storage.StorageID.Valid {
+			report.Unknown = append(report.Unknown, sc)
+			continue
+		}
+
+		sid := sc.Storage.StorageID.Int64
+		if scanned[sid] {
+			continue
+		}
+		scanned[sid] = true
+
+		s, ok := expectedByID[sid]
+		if !ok {
+			// Storage of the entity recorded out of the inventory store location.
+			sqlr = `SELECT ` + inventoryStorageColumns + `
+			FROM storage
+			` + inventoryStorageJoins + `
+			WHERE storage.storage_id = ?`
+			if err = db.Get(&s, sqlr, sid); err != nil {
+				return InventoryReport{}, err
+			}
+		}
+
+		if s.StoreLocationID.Int64 == sc.StoreLocationID.Int64 {
+			report.Found = append(report.Found, s)
+		} else {
+			report.Misplaced = append(report.Misplaced, InventoryMisplaced{Storage: s, FoundIn: sc.StoreLocation})
+		}
+
+	}
+
+	for _, s := range expected {
+		if !scanned[s.StorageID.Int64] {
+			report.Missing = append(report.Missing, s)
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"found":     len(report.Found),
+		"misplaced": len(report.Misplaced),
+		"missing":   len(report.Missing),
+		"unknown":   len(report.Unknown)}).Debug("GetInventoryReport")
+
+	return report, nil
+
+}
@@ -706,6 +706,29 @@ func (db *SQLiteDataStore) GetProductsProducerRefs(p DbselectparamProducerRef) (
 	return prefs, count, nil
 }
 
+// GetSupplierRefsProductIDs return the ids of the products having one of the supplierref labels
+func (db *SQLiteDataStore) GetSupplierRefsProductIDs(labels []string) ([]int, error) {
+	var (
+		err  error
+		sqlr string
+		args []interface{}
+		ids  []int
+	)
+
+	sqlr = `SELECT DISTINCT productsupplierrefs_product_id FROM productsupplierrefs
+	JOIN supplierref ON productsupplierrefs.productsupplierrefs_supplierref_id = supplierref.supplierref_id
+	WHERE supplierref.supplierref_label IN (?)`
+	if sqlr, args, err = sqlx.In(sqlr, labels); err != nil {
+		return nil, err
+	}
+
+	if err = db.Select(&ids, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
 // GetProductsSupplierRefs return the supplierrefs matching the search criteria
 func (db *SQLiteDataStore) GetProductsSupplierRefs(p DbselectparamSupplierRef) ([]SupplierRef, int, error) {
 	var (
@@ -725,6 +748,8 @@ func (db *SQLiteDataStore) GetProductsSupplierRefs(p DbselectparamSupplierRef) (
 	precreq.WriteString(" SELECT count(DISTINCT supplierref.supplierref_id)")
 	presreq.WriteString(` SELECT supplierref_id, 
 								 supplierref_label, 
+								 supplierref_unitprice,
+								 supplierref_currency,
 								 supplier_id AS "supplier.supplier_id",
 								 supplier_label AS "supplier.supplier_label"`)
 
@@ -1753,6 +1778,8 @@ func (db *SQLiteDataStore) GetProducts(p DbselectparamProduct) ([]Product, int,
 	p.product_temperature,
 	p.product_number_per_carton,
 	p.product_number_per_bag,
+	p.product_density,
+	p.product_molarmass,
 	linearformula.linearformula_id AS "linearformula.linearformula_id",
 	linearformula.linearformula_label AS "linearformula.linearformula_label",
 	empiricalformula.empiricalformula_id AS "empiricalformula.empiricalformula_id",
@@ -1878,7 +1905,11 @@ func (db *SQLiteDataStore) GetProducts(p DbselectparamProduct) ([]Product, int,
 		comreq.WriteString(" AND entity.entity_id = :entity")
 	}
 	if p.GetStorelocation() != -1 {
-		comreq.WriteString(" AND storelocation.storelocation_id = :storelocation")
+		if p.GetStorelocationSubtree() {
+			comreq.WriteString(" AND " + storeLocationSubtreeFilter)
+		} else {
+			comreq.WriteString(" AND storelocation.storelocation_id = :storelocation")
+		}
 	}
 	if p.GetProductSpecificity() != "" {
 		comreq.WriteString(" AND p.product_specificity = :product_specificity")
@@ -2063,6 +2094,8 @@ func (db *SQLiteDataStore) GetProducts(p DbselectparamProduct) ([]Product, int,
 			reqSupplierref.Reset()
 			reqSupplierref.WriteString(`SELECT supplierref_id, 
 			supplierref_label,
+			supplierref_unitprice,
+			supplierref_currency,
 			supplier.supplier_id AS "supplier.supplier_id",
 			supplier.supplier_label AS "supplier.supplier_label"
 			FROM supplierref`)
@@ -2313,6 +2346,8 @@ func (db *SQLiteDataStore) GetProduct(id int) (Product, error) {
 	product_temperature,
 	product_number_per_carton,
 	product_number_per_bag,
+	product_density,
+	product_molarmass,
 	linearformula.linearformula_id AS "linearformula.linearformula_id",
 	linearformula.linearformula_label AS "linearformula.linearformula_label",
 	empiricalformula.empiricalformula_id AS "empiricalformula.empiricalformula_id",
@@ -2361,6 +2396,8 @@ func (db *SQLiteDataStore) GetProduct(id int) (Product, error) {
 	//
 	sqlr = `SELECT supplierref_id, 
 	supplierref_label,
+	supplierref_unitprice,
+	supplierref_currency,
 	supplier.supplier_id AS "supplier.supplier_id",
 	supplier.supplier_label AS "supplier.supplier_label"
 	FROM supplierref
@@ -2477,6 +2514,12 @@ func (db *SQLiteDataStore) DeleteProduct(id int) error {
 		return err
 	}
 
+	// deleting gtins
+	sqlr = `DELETE FROM gtin WHERE gtin.product = (?)`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+
 	// deleting product
 	sqlr = `DELETE FROM product WHERE product_id = ?`
 	if _, err = db.Exec(sqlr, id); err != nil {
@@ -2485,6 +2528,25 @@ func (db *SQLiteDataStore) DeleteProduct(id int) error {
 	return nil
 }
 
+// productMolarMass returns the molar mass of p computed from its empirical formula,
+// or the molar mass of p for the products without a computable formula.
+func productMolarMass(tx *sql.Tx, p Product) (sql.NullFloat64, error) {
+
+	if p.EmpiricalFormulaID.Valid && !p.EmpiricalFormulaLabel.Valid {
+		sqlr := `SELECT empiricalformula_label FROM empiricalformula WHERE empiricalformula_id = ?`
+		if err := tx.QueryRow(sqlr, p.EmpiricalFormulaID.Int64).Scan(&p.EmpiricalFormulaLabel); err != nil && err != sql.ErrNoRows {
+			return sql.NullFloat64{}, err
+		}
+	}
+
+	if m, err := MolarMass(p.EmpiricalFormulaLabel.String); err == nil {
+		return sql.NullFloat64{Valid: true, Float64: m}, nil
+	}
+
+	return p.ProductMolarMass, nil
+
+}
+
 // CreateProduct insert the new product p into the database
 func (db *SQLiteDataStore) CreateProduct(p Product) (int, error) {
 	var (
@@ -2614,8 +2676,8 @@ func (db *SQLiteDataStore) CreateProduct(p Product) (int, error) {
 	for i, sr := range p.SupplierRefs {
 		if sr.SupplierRefID == -1 {
 			logger.Log.Debug("new supplierref " + sr.SupplierRefLabel)
-			sqlr = `INSERT INTO supplierref (supplierref_label, supplier) VALUES (?, ?)`
-			if res, err = tx.Exec(sqlr, sr.SupplierRefLabel, sr.Supplier.SupplierID); err != nil {
+			sqlr = `INSERT INTO supplierref (supplierref_label, supplier, supplierref_unitprice, supplierref_currency) VALUES (?, ?, ?, ?)`
+			if res, err = tx.Exec(sqlr, sr.SupplierRefLabel, sr.Supplier.SupplierID, sr.SupplierRefUnitPrice, sr.SupplierRefCurrency); err != nil {
 				if errr := tx.Rollback(); errr != nil {
 					return 0, errr
 				}
@@ -2629,6 +2691,15 @@ func (db *SQLiteDataStore) CreateProduct(p Product) (int, error) {
 				return 0, err
 			}
 			p.SupplierRefs[i].SupplierRefID = int(lastid)
+		} else if sr.SupplierRefUnitPrice.Valid {
+			// updating the unit price of the existing supplier ref
+			sqlr = `UPDATE supplierref SET supplierref_unitprice = ?, supplierref_currency = ? WHERE supplierref_id = ?`
+			if _, err = tx.Exec(sqlr, sr.SupplierRefUnitPrice, sr.SupplierRefCurrency, sr.SupplierRefID); err != nil {
+				if errr := tx.Rollback(); errr != nil {
+					return 0, errr
+				}
+				return 0, err
+			}
 		}
 	}
 	// if TagID = -1 then it is a new tag
@@ -2798,6 +2869,17 @@ func (db *SQLiteDataStore) CreateProduct(p Product) (int, error) {
 	if p.ProductNumberPerBag.Valid {
 		s["product_number_per_bag"] = p.ProductNumberPerBag.Int64
 	}
+	if p.ProductDensity.Valid {
+		s["product_density"] = p.ProductDensity.Float64
+	}
+	if molarmass, err := productMolarMass(tx, p); err != nil {
+		if errr := tx.Rollback(); errr != nil {
+			return 0, errr
+		}
+		return 0, err
+	} else if molarmass.Valid {
+		s["product_molarmass"] = molarmass.Float64
+	}
 	if p.EmpiricalFormulaID.Valid {
 		s["empiricalformula"] = int(p.EmpiricalFormulaID.Int64)
 	}
@@ -3095,8 +3177,8 @@ func (db *SQLiteDataStore) UpdateProduct(p Product) error {
 	for i, sr := range p.SupplierRefs {
 		if sr.SupplierRefID == -1 {
 			logger.Log.Debug("new supplierref " + sr.SupplierRefLabel)
-			sqlr = `INSERT INTO supplierref (supplierref_label, supplier) VALUES (?, ?)`
-			if res, err = tx.Exec(sqlr, sr.SupplierRefLabel, sr.Supplier.SupplierID); err != nil {
+			sqlr = `INSERT INTO supplierref (supplierref_label, supplier, supplierref_unitprice, supplierref_currency) VALUES (?, ?, ?, ?)`
+			if res, err = tx.Exec(sqlr, sr.SupplierRefLabel, sr.Supplier.SupplierID, sr.SupplierRefUnitPrice, sr.SupplierRefCurrency); err != nil {
 				if errr := tx.Rollback(); errr != nil {
 					return errr
 				}
@@ -3110,6 +3192,15 @@ func (db *SQLiteDataStore) UpdateProduct(p Product) error {
 				return err
 			}
 			p.SupplierRefs[i].SupplierRefID = int(lastid)
+		} else if sr.SupplierRefUnitPrice.Valid {
+			// updating the unit price of the existing supplier ref
+			sqlr = `UPDATE supplierref SET supplierref_unitprice = ?, supplierref_currency = ? WHERE supplierref_id = ?`
+			if _, err = tx.Exec(sqlr, sr.SupplierRefUnitPrice, sr.SupplierRefCurrency, sr.SupplierRefID); err != nil {
+				if errr := tx.Rollback(); errr != nil {
+					return errr
+				}
+				return err
+			}
 		}
 	}
 	// if TagID = -1 then it is a new tag
@@ -3136,7 +3227,7 @@ func (db *SQLiteDataStore) UpdateProduct(p Product) error {
 	// if EmpiricalFormulaID = -1 then it is a new empirical formula
 	if v, err := p.EmpiricalFormula.EmpiricalFormulaID.Value(); p.EmpiricalFormula.EmpiricalFormulaID.Valid && err == nil && v.(int64) == -1 {
 		logger.Log.Debug("new empiricalformula " + p.EmpiricalFormulaLabel.String)
-		sqlr = `INSERT INTO empiricalformula (p.EmpiricalFormulaLabel) VALUES (?)`
+		sqlr = `INSERT INTO empiricalformula (empiricalformula_label) VALUES (?)`
 		if res, err = tx.Exec(sqlr, p.EmpiricalFormulaLabel); err != nil {
 			if errr := tx.Rollback(); errr != nil {
 				return errr
@@ -3279,6 +3370,17 @@ func (db *SQLiteDataStore) UpdateProduct(p Product) error {
 	if p.ProductNumberPerBag.Valid {
 		s["product_number_per_bag"] = p.ProductNumberPerBag.Int64
 	}
+	if p.ProductDensity.Valid {
+		s["product_density"] = p.ProductDensity.Float64
+	}
+	if molarmass, err := productMolarMass(tx, p); err != nil {
+		if errr := tx.Rollback(); errr != nil {
+			return errr
+		}
+		return err
+	} else if molarmass.Valid {
+		s["product_molarmass"] = molarmass.Float64
+	}
 	if p.EmpiricalFormulaID.Valid {
 		s["empiricalformula"] = int(p.EmpiricalFormulaID.Int64)
 	}
@@ -0,0 +1,485 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+var (
+	// ErrPurchaseRequestStatus is returned when a purchase request
+	// is approved, refused, ordered, received or cancelled
+	// while not in a status allowing it
+	ErrPurchaseRequestStatus = errors.New("invalid purchase request status")
+	// ErrPurchaseRequestSupplierRef is returned when the purchase request
+	// supplier reference is not one of the product
+	ErrPurchaseRequestSupplierRef = errors.New("supplier reference not in the product ones")
+	// ErrPurchaseRequestStoreLocation is returned when the purchase request
+	// is received in a store location that can not store
+	// or does not belong to the request entity
+	ErrPurchaseRequestStoreLocation = errors.New("store location can not store or not in the request entity")
+)
+
+// purchaseRequestSelect returns the purchase requests select clause
+func purchaseRequestSelect() *goqu.SelectDataset {
+
+	dialect := goqu.Dialect("sqlite3")
+	tablePurchaseRequest := goqu.T("purchaserequest")
+
+	return dialect.From(tablePurchaseRequest).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{"purchaserequest.person": goqu.I("person.person_id")}),
+	).Join(
+		goqu.T("entity"),
+		goqu.On(goqu.Ex{"purchaserequest.entity": goqu.I("entity.entity_id")}),
+	).Join(
+		goqu.T("product"),
+		goqu.On(goqu.Ex{"purchaserequest.product": goqu.I("product.product_id")}),
+	).Join(
+		goqu.T("name"),
+		goqu.On(goqu.Ex{"product.name": goqu.I("name.name_id")}),
+	).LeftJoin(
+		goqu.T("supplierref"),
+		goqu.On(goqu.Ex{"purchaserequest.supplierref": goqu.I("supplierref.supplierref_id")}),
+	).LeftJoin(
+		goqu.T("supplier"),
+		goqu.On(goqu.Ex{"supplierref.supplier": goqu.I("supplier.supplier_id")}),
+	).LeftJoin(
+		goqu.T("unit"),
+		goqu.On(goqu.Ex{"purchaserequest.unit_quantity": goqu.I("unit.unit_id")}),
+	).LeftJoin(
+		goqu.T("person").As("dp"),
+		goqu.On(goqu.Ex{"purchaserequest.decision_person": goqu.I("dp.person_id")}),
+	)
+
+}
+
+// purchaseRequestColumns are the columns of the purchase requests select clause
+var purchaseRequestColumns = []interface{}{
+	goqu.I("purchaserequest.purchaserequest_id"),
+	goqu.I("purchaserequest.purchaserequest_creationdate"),
+	goqu.I("purchaserequest.purchaserequest_status"),
+	goqu.I("purchaserequest.purchaserequest_quantity"),
+	goqu.I("purchaserequest.purchaserequest_nbitem"),
+	goqu.I("purchaserequest.purchaserequest_comment"),
+	goqu.I("purchaserequest.purchaserequest_decisiondate"),
+	goqu.I("purchaserequest.purchaserequest_orderdate"),
+	goqu.I("purchaserequest.purchaserequest_orderreference"),
+	goqu.I("purchaserequest.purchaserequest_receptiondate"),
+	goqu.I("person.person_id").As(goqu.C("person.person_id")),
+	goqu.I("person.person_email").As(goqu.C("person.person_email")),
+	goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
+	goqu.I("entity.entity_name").As(goqu.C("entity.entity_name")),
+	goqu.I("product.product_id").As(goqu.C("product.product_id")),
+	goqu.I("name.name_label").As(goqu.C("product.name.name_label")),
+	goqu.COALESCE(goqu.I("supplierref.supplierref_id"), 0).As(goqu.C("supplierref.supplierref_id")),
+	goqu.COALESCE(goqu.I("supplierref.supplierref_label"), "").As(goqu.C("supplierref.supplierref_label")),
+	goqu.I("supplier.supplier_id").As(goqu.C("supplierref.supplier.supplier_id")),
+	goqu.I("supplier.supplier_label").As(goqu.C("supplierref.supplier.supplier_label")),
+	goqu.I("unit.unit_id").As(goqu.C("unit_quantity.unit_id")),
+	goqu.I("unit.unit_label").As(goqu.C("unit_quantity.unit_label")),
+	goqu.COALESCE(goqu.I("dp.person_id"), 0).As(goqu.C("decision_person.person_id")),
+	goqu.COALESCE(goqu.I("dp.person_email"), "").As(goqu.C("decision_person.person_email")),
+}
+
+// GetPurchaseRequests returns the purchase requests matching p
+// for the entities of the logged person.
+func (db *SQLiteDataStore) GetPurchaseRequests(p DbselectparamPurchaseRequest) ([]PurchaseRequest, int, error) {
+
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("GetPurchaseRequests")
+
+	var err error
+
+	// Build orderby/order clause.
+	orderClause := goqu.I(p.GetOrderBy()).Asc()
+	if strings.ToLower(p.GetOrder()) == "desc" {
+		orderClause = goqu.I(p.GetOrderBy()).Desc()
+	}
+
+	// Build join clause.
+	joinClause := purchaseRequestSelect().Join(
+		goqu.T("permission").As("perm"),
+		goqu.On(
+			goqu.Ex{
+				"perm.person":               p.GetLoggedPersonID(),
+				"perm.permission_item_name": []string{"all", "storages"},
+				"perm.permission_perm_name": []string{"r", "w", "all"},
+				"perm.permission_entity_id": []interface{}{-1, goqu.I("entity.entity_id")},
+			},
+		),
+	)
+
+	// Build where AND expression.
+	whereAnd := []goqu.Expression{
+		goqu.I("name.name_label").Like(p.GetSearch()),
+	}
+	if p.GetEntity() != -1 {
+		whereAnd = append(whereAnd, goqu.I("purchaserequest.entity").Eq(p.GetEntity()))
+	}
+	if p.GetProduct() != -1 {
+		whereAnd = append(whereAnd, goqu.I("purchaserequest.product").Eq(p.GetProduct()))
+	}
+	if p.GetStatus() != "" {
+		whereAnd = append(whereAnd, goqu.I("purchaserequest.purchaserequest_status").Eq(p.GetStatus()))
+	}
+
+	joinClause = joinClause.Where(goqu.And(whereAnd...))
+
+	// Building final count.
+	var (
+		countSql  string
+		countArgs []interface{}
+	)
+	if countSql, countArgs, err = joinClause.Select(
+		goqu.COUNT(goqu.I("purchaserequest.purchaserequest_id").Distinct()),
+	).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	// Building final select.
+	var (
+		selectSql  string
+		selectArgs []interface{}
+	)
+	if selectSql, selectArgs, err = joinClause.Select(
+		purchaseRequestColumns...,
+	).GroupBy(goqu.I("purchaserequest.purchaserequest_id")).Order(orderClause).Limit(uint(p.GetLimit())).Offset(uint(p.GetOffset())).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		requests []PurchaseRequest
+		count    int
+	)
+
+	if err = db.Select(&requests, selectSql, selectArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	if err = db.Get(&count, countSql, countArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	return requests, count, nil
+
+}
+
+// GetPurchaseRequest returns the purchase request with id "id".
+func (db *SQLiteDataStore) GetPurchaseRequest(id int) (PurchaseRequest, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetPurchaseRequest")
+
+	var (
+		err     error
+		sqlr    string
+		args    []interface{}
+		request PurchaseRequest
+	)
+
+	if sqlr, args, err = purchaseRequestSelect().Where(
+		goqu.I("purchaserequest.purchaserequest_id").Eq(id),
+	).Select(
+		purchaseRequestColumns...,
+	).ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return PurchaseRequest{}, err
+	}
+
+	if err = db.Get(&request, sqlr, args...); err != nil {
+		return PurchaseRequest{}, err
+	}
+
+	return request, nil
+
+}
+
+// CreatePurchaseRequest inserts the purchase request p with the requested status.
+// The supplier reference, if any, must be one of the product.
+func (db *SQLiteDataStore) CreatePurchaseRequest(p PurchaseRequest) (lastInsertId int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"p": fmt.Sprintf("%+v", p)}).Debug("CreatePurchaseRequest")
+
+	var (
+		sqlr      string
+		args      []interface{}
+		sqlResult sql.Result
+		count     int
+	)
+
+	if p.SupplierRef.SupplierRefID != 0 {
+		sqlr = `SELECT count(*) FROM productsupplierrefs
+		WHERE productsupplierrefs_product_id = ? AND productsupplierrefs_supplierref_id = ?`
+		if err = db.Get(&count, sqlr, p.Product.ProductID, p.SupplierRef.SupplierRefID); err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			return 0, ErrPurchaseRequestSupplierRef
+		}
+	}
+
+	dialect := goqu.Dialect("sqlite3")
+	tablePurchaseRequest := goqu.T("purchaserequest")
+
+	setClause := goqu.Record{
+		"purchaserequest_creationdate": time.Now(),
+		"purchaserequest_status":       PurchaseRequestRequested,
+		"purchaserequest_nbitem":       p.PurchaseRequestNbItem,
+		"person":                       p.PersonID,
+		"entity":                       p.EntityID,
+		"product":                      p.Product.ProductID,
+	}
+	if p.PurchaseRequestQuantity.Valid {
+		setClause["purchaserequest_quantity"] = p.PurchaseRequestQuantity.Float64
+	}
+	if p.PurchaseRequestComment.Valid && p.PurchaseRequestComment.String != "" {
+		setClause["purchaserequest_comment"] = p.PurchaseRequestComment.String
+	}
+	if p.SupplierRef.SupplierRefID != 0 {
+		setClause["supplierref"] = p.SupplierRef.SupplierRefID
+	}
+	if p.UnitQuantity.UnitID.Valid {
+		setClause["unit_quantity"] = p.UnitQuantity.UnitID.Int64
+	}
+
+	if sqlr, args, err = dialect.Insert(tablePurchaseRequest).Rows(setClause).ToSQL(); err != nil {
+		return 0, err
+	}
+
+	if sqlResult, err = db.Exec(sqlr, args...); err != nil {
+		return 0, err
+	}
+
+	return sqlResult.LastInsertId()
+
+}
+
+// setPurchaseRequestStatus sets the record "set" of the purchase request with id "id"
+// if its status is one of "from".
+// ErrPurchaseRequestStatus is returned otherwise.
+// The caller is responsible of opening and commiting the tx transaction.
+func (db *SQLiteDataStore) setPurchaseRequestStatus(tx *sqlx.Tx, id int, from []string, set goqu.Record) error {
+
+	var (
+		err          error
+		sqlr         string
+		args         []interface{}
+		sqlResult    sql.Result
+		rowsAffected int64
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+	tablePurchaseRequest := goqu.T("purchaserequest")
+
+	if sqlr, args, err = dialect.Update(tablePurchaseRequest).Set(
+		set,
+	).Where(
+		goqu.I("purchaserequest_id").Eq(id),
+		goqu.I("purchaserequest_status").In(from),
+	).ToSQL(); err != nil {
+		return err
+	}
+
+	if sqlResult, err = tx.Exec(sqlr, args...); err != nil {
+		return err
+	}
+	if rowsAffected, err = sqlResult.RowsAffected(); err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrPurchaseRequestStatus
+	}
+
+	return nil
+
+}
+
+// updatePurchaseRequestStatus sets the record "set" of the purchase request with id "id"
+// in its own transaction if its status is one of "from"
+func (db *SQLiteDataStore) updatePurchaseRequestStatus(id int, from []string, set goqu.Record) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "from": from, "set": set}).Debug("updatePurchaseRequestStatus")
+
+	var tx *sqlx.Tx
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	err = db.setPurchaseRequestStatus(tx, id, from, set)
+
+	return
+
+}
+
+// ApprovePurchaseRequest approves the requested purchase request with id "id"
+// on behalf of the person with id "personID".
+func (db *SQLiteDataStore) ApprovePurchaseRequest(id int, personID int) error {
+	return db.updatePurchaseRequestStatus(id, []string{PurchaseRequestRequested}, goqu.Record{
+		"purchaserequest_status":       PurchaseRequestApproved,
+		"purchaserequest_decisiondate": time.Now(),
+		"decision_person":              personID,
+	})
+}
+
+// RefusePurchaseRequest refuses the requested purchase request with id "id"
+// on behalf of the person with id "personID".
+func (db *SQLiteDataStore) RefusePurchaseRequest(id int, personID int) error {
+	return db.updatePurchaseRequestStatus(id, []string{PurchaseRequestRequested}, goqu.Record{
+		"purchaserequest_status":       PurchaseRequestRefused,
+		"purchaserequest_decisiondate": time.Now(),
+		"decision_person":              personID,
+	})
+}
+
+// OrderPurchaseRequest sets the approved purchase request with id "id" as ordered
+// with the supplier order reference "reference".
+func (db *SQLiteDataStore) OrderPurchaseRequest(id int, reference sql.NullString) error {
+
+	set := goqu.Record{
+		"purchaserequest_status":    PurchaseRequestOrdered,
+		"purchaserequest_orderdate": time.Now(),
+	}
+	if reference.Valid && reference.String != "" {
+		set["purchaserequest_orderreference"] = reference.String
+	}
+
+	return db.updatePurchaseRequestStatus(id, []string{PurchaseRequestApproved}, set)
+
+}
+
+// CancelPurchaseRequest cancels the purchase request with id "id"
+// if it has not been refused or received yet.
+func (db *SQLiteDataStore) CancelPurchaseRequest(id int) error {
+	return db.updatePurchaseRequestStatus(id, []string{PurchaseRequestRequested, PurchaseRequestApproved, PurchaseRequestOrdered}, goqu.Record{
+		"purchaserequest_status": PurchaseRequestCancelled,
+	})
+}
+
+// ReceivePurchaseRequest sets the approved or ordered purchase request with id "id" as received
+// on behalf of the person with id "personID" and creates one storage per requested item
+// in the reception store location with the request product, quantity and supplier.
+// It returns the created storages ids.
+func (db *SQLiteDataStore) ReceivePurchaseRequest(id int, r PurchaseReception, personID int) (ids []int, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "r": r, "personID": personID}).Debug("ReceivePurchaseRequest")
+
+	var (
+		tx        *sqlx.Tx
+		sqlr      string
+		storageID int
+		now       = time.Now()
+		request   struct {
+			EntityID         int             `db:"entity"`
+			ProductID        int             `db:"product"`
+			Quantity         sql.NullFloat64 `db:"purchaserequest_quantity"`
+			NbItem           int             `db:"purchaserequest_nbitem"`
+			UnitQuantity     sql.NullInt64   `db:"unit_quantity"`
+			SupplierRefLabel sql.NullString  `db:"supplierref_label"`
+			SupplierID       sql.NullInt64   `db:"supplier"`
+			UnitPrice        sql.NullFloat64 `db:"supplierref_unitprice"`
+			Currency         sql.NullString  `db:"supplierref_currency"`
+		}
+		storelocation struct {
+			EntityID int          `db:"entity"`
+			CanStore sql.NullBool `db:"storelocation_canstore"`
+		}
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if err = db.setPurchaseRequestStatus(tx, id, []string{PurchaseRequestApproved, PurchaseRequestOrdered}, goqu.Record{
+		"purchaserequest_status":        PurchaseRequestReceived,
+		"purchaserequest_receptiondate": now,
+	}); err != nil {
+		return
+	}
+
+	sqlr = `SELECT purchaserequest.entity, purchaserequest.product,
+	purchaserequest.purchaserequest_quantity, purchaserequest.purchaserequest_nbitem,
+	purchaserequest.unit_quantity,
+	supplierref.supplierref_label, supplierref.supplier,
+	supplierref.supplierref_unitprice, supplierref.supplierref_currency
+	FROM purchaserequest
+	LEFT JOIN supplierref ON purchaserequest.supplierref = supplierref.supplierref_id
+	WHERE purchaserequest.purchaserequest_id = ?`
+	if err = tx.Get(&request, sqlr, id); err != nil {
+		return
+	}
+
+	sqlr = `SELECT entity, storelocation_canstore FROM storelocation WHERE storelocation_id = ?`
+	if err = tx.Get(&storelocation, sqlr, r.StoreLocation.StoreLocationID.Int64); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrPurchaseRequestStoreLocation
+		}
+		return
+	}
+	if storelocation.EntityID != request.EntityID || !storelocation.CanStore.Valid || !storelocation.CanStore.Bool {
+		err = ErrPurchaseRequestStoreLocation
+		return
+	}
+
+	s := Storage{
+		StorageCreationDate:     now,
+		StorageModificationDate: now,
+		StorageEntryDate:        sql.NullTime{Valid: true, Time: now},
+		StorageExpirationDate:   r.StorageExpirationDate,
+		StorageBatchNumber:      r.StorageBatchNumber,
+		StorageComment:          r.StorageComment,
+		StorageReference:        request.SupplierRefLabel,
+		StorageQuantity:         request.Quantity,
+		Person:                  Person{PersonID: personID},
+		Product:                 Product{ProductID: request.ProductID},
+		StoreLocation:           StoreLocation{StoreLocationID: r.StoreLocation.StoreLocationID},
+		UnitQuantity:            Unit{UnitID: request.UnitQuantity},
+		Supplier:                Supplier{SupplierID: request.SupplierID},
+		// storages are priced at the supplier ref unit price
+		StoragePrice:    request.UnitPrice,
+		StorageCurrency: request.Currency,
+	}
+	for i := 1; i <= request.NbItem; i++ {
+		if storageID, err = db.createStorage(tx.Tx, s, i); err != nil {
+			return
+		}
+		ids = append(ids, storageID)
+	}
+
+	return
+
+}
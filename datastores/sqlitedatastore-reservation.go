@@ -0,0 +1,423 @@
+package datastores
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// reservationSelect returns the reservations select clause
+func reservationSelect() *goqu.SelectDataset {
+
+	dialect := goqu.Dialect("sqlite3")
+	tableReservation := goqu.T("reservation")
+
+	return dialect.From(tableReservation).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{"reservation.person": goqu.I("person.person_id")}),
+	).Join(
+		goqu.T("entity"),
+		goqu.On(goqu.Ex{"reservation.entity": goqu.I("entity.entity_id")}),
+	).Join(
+		goqu.T("product"),
+		goqu.On(goqu.Ex{"reservation.product": goqu.I("product.product_id")}),
+	).Join(
+		goqu.T("name"),
+		goqu.On(goqu.Ex{"product.name": goqu.I("name.name_id")}),
+	).LeftJoin(
+		goqu.T("storage"),
+		goqu.On(goqu.Ex{"reservation.storage": goqu.I("storage.storage_id")}),
+	).LeftJoin(
+		goqu.T("unit"),
+		goqu.On(goqu.Ex{"reservation.unit_quantity": goqu.I("unit.unit_id")}),
+	)
+
+}
+
+// reservationColumns are the columns of the reservations select clause
+var reservationColumns = []interface{}{
+	goqu.I("reservation.reservation_id"),
+	goqu.I("reservation.reservation_creationdate"),
+	goqu.I("reservation.reservation_startdate"),
+	goqu.I("reservation.reservation_enddate"),
+	goqu.I("reservation.reservation_quantity"),
+	goqu.I("reservation.reservation_comment"),
+	goqu.I("person.person_id").As(goqu.C("person.person_id")),
+	goqu.I("person.person_email").As(goqu.C("person.person_email")),
+	goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
+	goqu.I("entity.entity_name").As(goqu.C("entity.entity_name")),
+	goqu.I("product.product_id").As(goqu.C("product.product_id")),
+	goqu.I("name.name_label").As(goqu.C("product.name.name_label")),
+	goqu.I("storage.storage_id").As(goqu.C("storage.storage_id")),
+	goqu.I("storage.storage_barecode").As(goqu.C("storage.storage_barecode")),
+	goqu.I("unit.unit_id").As(goqu.C("unit_quantity.unit_id")),
+	goqu.I("unit.unit_label").As(goqu.C("unit_quantity.unit_label")),
+}
+
+// GetReservations returns the reservations matching p
+// in the entities of the logged person.
+func (db *SQLiteDataStore) GetReservations(p DbselectparamReservation) ([]Reservation, int, error) {
+
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("GetReservations")
+
+	var err error
+
+	// Build orderby/order clause.
+	orderClause := goqu.I(p.GetOrderBy()).Asc()
+	if strings.ToLower(p.GetOrder()) == "desc" {
+		orderClause = goqu.I(p.GetOrderBy()).Desc()
+	}
+
+	// Build where AND expression.
+	whereAnd := []goqu.Expression{
+		goqu.I("name.name_label").Like(p.GetSearch()),
+	}
+	if p.GetStorage() != -1 {
+		whereAnd = append(whereAnd, goqu.I("reservation.storage").Eq(p.GetStorage()))
+	}
+	if p.GetProduct() != -1 {
+		whereAnd = append(whereAnd, goqu.I("reservation.product").Eq(p.GetProduct()))
+	}
+	if p.GetEntity() != -1 {
+		whereAnd = append(whereAnd, goqu.I("reservation.entity").Eq(p.GetEntity()))
+	}
+	if p.GetActive() {
+		whereAnd = append(whereAnd, goqu.I("reservation.reservation_enddate").Gte(time.Now()))
+	}
+
+	joinClause := reservationSelect().Join(
+		goqu.T("permission").As("perm"),
+		goqu.On(
+			goqu.Ex{
+				"perm.person":               p.GetLoggedPersonID(),
+				"perm.permission_item_name": []string{"all", "storages"},
+				"perm.permission_perm_name": []string{"r", "w", "all"},
+				"perm.permission_entity_id": []interface{}{-1, goqu.I("reservation.entity")},
+			},
+		),
+	).Where(goqu.And(whereAnd...))
+
+	// Building final count.
+	var (
+		countSql  string
+		countArgs []interface{}
+	)
+	if countSql, countArgs, err = joinClause.Select(
+		goqu.COUNT(goqu.I("reservation.reservation_id").Distinct()),
+	).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	// Building final select.
+	var (
+		selectSql  string
+		selectArgs []interface{}
+	)
+	if selectSql, selectArgs, err = joinClause.Select(
+		reservationColumns...,
+	).GroupBy(goqu.I("reservation.reservation_id")).Order(orderClause).Limit(uint(p.GetLimit())).Offset(uint(p.GetOffset())).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		reservations []Reservation
+		count        int
+	)
+
+	if err = db.Select(&reservations, selectSql, selectArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	if err = db.Get(&count, countSql, countArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	return reservations, count, nil
+
+}
+
+// getActiveReservations returns the running and upcoming reservations matching ex
+// ordered by start date.
+func (db *SQLiteDataStore) getActiveReservations(ex goqu.Ex) ([]Reservation, error) {
+
+	var (
+		err          error
+		sqlr         string
+		args         []interface{}
+		reservations []Reservation
+	)
+
+	if sqlr, args, err = reservationSelect().Where(
+		ex,
+		goqu.I("reservation.reservation_enddate").Gte(time.Now()),
+	).Select(
+		reservationColumns...,
+	).Order(goqu.I("reservation.reservation_startdate").Asc()).ToSQL(); err != nil {
+		return nil, err
+	}
+
+	if err = db.Select(&reservations, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+
+}
+
+// GetStorageReservations returns the running and upcoming reservations
+// of the storage with id "id".
+func (db *SQLiteDataStore) GetStorageReservations(id int) ([]Reservation, error) {
+	return db.getActiveReservations(goqu.Ex{"reservation.storage": id})
+}
+
+// GetReservation returns the reservation with id "id".
+func (db *SQLiteDataStore) GetReservation(id int) (Reservation, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetReservation")
+
+	var (
+		err         error
+		sqlr        string
+		args        []interface{}
+		reservation Reservation
+	)
+
+	if sqlr, args, err = reservationSelect().Where(
+		goqu.I("reservation.reservation_id").Eq(id),
+	).Select(
+		reservationColumns...,
+	).ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return Reservation{}, err
+	}
+
+	if err = db.Get(&reservation, sqlr, args...); err != nil {
+		return Reservation{}, err
+	}
+
+	return reservation, nil
+
+}
+
+// CreateReservation inserts the reservation r.
+// The product, entity and unit of a storage reservation are the storage ones.
+func (db *SQLiteDataStore) CreateReservation(r Reservation) (lastInsertId int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"r": r}).Debug("CreateReservation")
+
+	var (
+		sqlr string
+		args []interface{}
+		res  sql.Result
+	)
+
+	if r.IsStorageReservation() {
+		sqlr = `SELECT storage.product, storelocation.entity, storage.unit_quantity
+		FROM storage
+		JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+		WHERE storage.storage_id = ?`
+		if err = db.QueryRowx(sqlr, r.Storage.StorageID.Int64).Scan(&r.ProductID, &r.EntityID, &r.UnitQuantity.UnitID); err != nil {
+			return 0, err
+		}
+	}
+
+	insertRecord := goqu.Record{
+		"reservation_creationdate": time.Now(),
+		"reservation_startdate":    r.ReservationStartDate,
+		"reservation_enddate":      r.ReservationEndDate,
+		"person":                   r.PersonID,
+		"entity":                   r.EntityID,
+		"product":                  r.ProductID,
+	}
+	if r.ReservationQuantity.Valid {
+		insertRecord["reservation_quantity"] = r.ReservationQuantity.Float64
+	}
+	if r.ReservationComment.Valid {
+		insertRecord["reservation_comment"] = r.ReservationComment.String
+	}
+	if r.IsStorageReservation() {
+		insertRecord["storage"] = r.Storage.StorageID.Int64
+	}
+	if r.UnitQuantity.UnitID.Valid {
+		insertRecord["unit_quantity"] = r.UnitQuantity.UnitID.Int64
+	}
+
+	dialect := goqu.Dialect("sqlite3")
+	if sqlr, args, err = dialect.Insert(goqu.T("reservation")).Rows(insertRecord).ToSQL(); err != nil {
+		return 0, err
+	}
+
+	if res, err = db.Exec(sqlr, args...); err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+
+}
+
+// DeleteReservation deletes the reservation with id "id".
+func (db *SQLiteDataStore) DeleteReservation(id int) error {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteReservation")
+
+	var err error
+
+	sqlr := `DELETE FROM reservation WHERE reservation_id = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// reservedQuantity is a quantity with its unit reduced to its reference unit.
+// Quantities without unit have an empty reference and a multiplier of 1.
+type reservedQuantity struct {
+	Quantity   sql.NullFloat64 `db:"quantity"`
+	Reference  string          `db:"reference"`
+	Multiplier float64         `db:"multiplier"`
+}
+
+// GetReservationConflicts returns the running and upcoming reservations
+// of people other than the person with id "personID" that would be broken
+// by withdrawing the quantity "withdrawn" from the storage with id "id".
+// An invalid "withdrawn" quantity means that the whole storage leaves
+// (borrowing).
+// A reservation without quantity is always broken, a reservation with a quantity
+// is broken when the quantity left is lower than the quantity reserved
+// by the reservations overlapping it in time.
+func (db *SQLiteDataStore) GetReservationConflicts(id int, personID int, withdrawn sql.NullFloat64) ([]Reservation, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "personID": personID, "withdrawn": withdrawn}).Debug("GetReservationConflicts")
+
+	var (
+		err       error
+		sqlr      string
+		args      []interface{}
+		conflicts []Reservation
+		storage   struct {
+			reservedQuantity
+			ProductID int `db:"product"`
+			EntityID  int `db:"entity"`
+		}
+	)
+
+	sqlr = `SELECT storage.storage_quantity AS quantity,
+	COALESCE(ref.unit_label, '') AS reference,
+	COALESCE(uq.unit_multiplier, 1) AS multiplier,
+	storage.product,
+	storelocation.entity
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id
+	LEFT JOIN unit ref ON ref.unit_id = COALESCE(uq.unit, uq.unit_id)
+	WHERE storage.storage_id = ?`
+	if err = db.Get(&storage, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	// quantity withdrawn from the storage, in its unit
+	taken := storage.Quantity.Float64
+	if withdrawn.Valid && withdrawn.Float64 < taken {
+		taken = withdrawn.Float64
+	}
+
+	// product stock left in the storage entity, in the storage reference unit
+	var stock sql.NullFloat64
+	sqlr = `SELECT SUM(storage.storage_quantity * COALESCE(uq.unit_multiplier, 1)) AS quantity
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id
+	LEFT JOIN unit ref ON ref.unit_id = COALESCE(uq.unit, uq.unit_id)
+	WHERE storage.product = ? AND storelocation.entity = ?
+	AND storage.storage IS NULL AND (storage.storage_archive IS NULL OR storage.storage_archive = false)
+	AND COALESCE(ref.unit_label, '') = ?`
+	if err = db.Get(&stock, sqlr, storage.ProductID, storage.EntityID, storage.Reference); err != nil {
+		return nil, err
+	}
+
+	dialect := goqu.Dialect("sqlite3")
+	now := time.Now()
+
+	// overlapping returns the active reservations "o" of other people
+	// overlapping the selected reservation in time
+	overlapping := func(ex goqu.Ex) *goqu.SelectDataset {
+		return dialect.From(goqu.T("reservation").As("o")).LeftJoin(
+			goqu.T("unit").As("ou"),
+			goqu.On(goqu.Ex{"o.unit_quantity": goqu.I("ou.unit_id")}),
+		).LeftJoin(
+			goqu.T("unit").As("oref"),
+			goqu.On(goqu.Ex{"oref.unit_id": goqu.L("COALESCE(ou.unit, ou.unit_id)")}),
+		).Where(
+			ex,
+			goqu.I("o.person").Neq(personID),
+			goqu.I("o.reservation_enddate").Gte(now),
+			goqu.I("o.reservation_startdate").Lte(goqu.I("reservation.reservation_enddate")),
+			goqu.I("o.reservation_enddate").Gte(goqu.I("reservation.reservation_startdate")),
+		)
+	}
+
+	// storage reservations
+	storageConflict := goqu.And(
+		goqu.I("reservation.storage").Eq(id),
+	)
+	if withdrawn.Valid {
+		// the storage reservations quantities are in the storage unit
+		storageConflict = storageConflict.Append(goqu.Or(
+			goqu.I("reservation.reservation_quantity").IsNull(),
+			goqu.L("? < ?",
+				storage.Quantity.Float64-taken,
+				overlapping(goqu.Ex{"o.storage": id}).Select(goqu.SUM(goqu.I("o.reservation_quantity")))),
+		))
+	}
+
+	// product reservations in the storage entity, compared to the product stock
+	// in the storage reference unit, the only one withdrawn
+	productConflict := goqu.And(
+		goqu.I("reservation.storage").IsNull(),
+		goqu.I("reservation.product").Eq(storage.ProductID),
+		goqu.I("reservation.entity").Eq(storage.EntityID),
+		goqu.Or(
+			goqu.I("reservation.reservation_quantity").IsNull(),
+			goqu.And(
+				goqu.L("COALESCE(ref.unit_label, '')").Eq(storage.Reference),
+				goqu.L("? < ?",
+					stock.Float64-taken*storage.Multiplier,
+					overlapping(goqu.Ex{
+						"o.storage": nil,
+						"o.product": storage.ProductID,
+						"o.entity":  storage.EntityID,
+					}).Where(
+						goqu.L("COALESCE(oref.unit_label, '')").Eq(storage.Reference),
+					).Select(goqu.SUM(goqu.L("o.reservation_quantity * COALESCE(ou.unit_multiplier, 1)")))),
+			),
+		),
+	)
+
+	if sqlr, args, err = reservationSelect().LeftJoin(
+		goqu.T("unit").As("ref"),
+		goqu.On(goqu.Ex{"ref.unit_id": goqu.L("COALESCE(unit.unit, unit.unit_id)")}),
+	).Where(
+		goqu.I("reservation.person").Neq(personID),
+		goqu.I("reservation.reservation_enddate").Gte(now),
+		goqu.Or(storageConflict, productConflict),
+	).Select(
+		reservationColumns...,
+	).Order(goqu.I("reservation.reservation_startdate").Asc()).ToSQL(); err != nil {
+		return nil, err
+	}
+
+	if err = db.Select(&conflicts, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+
+}
@@ -0,0 +1,387 @@
+package datastores
+
+import (
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// sensorColumns are the columns of the sensors select
+const sensorColumns = `sensor.sensor_id,
+	sensor.sensor_label,
+	storelocation.storelocation_id AS "storelocation.storelocation_id",
+	storelocation.storelocation_name AS "storelocation.storelocation_name",
+	storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath",
+	storelocation.storelocation_mintemperature AS "storelocation.storelocation_mintemperature",
+	storelocation.storelocation_maxtemperature AS "storelocation.storelocation_maxtemperature",
+	entity.entity_id AS "storelocation.entity.entity_id",
+	entity.entity_name AS "storelocation.entity.entity_name"
+	FROM sensor
+	JOIN storelocation ON sensor.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id`
+
+// sensorReadingColumns are the columns of the sensor readings select
+const sensorReadingColumns = `sensorreading.sensorreading_id,
+	sensorreading.sensorreading_date,
+	sensorreading.sensorreading_temperature,
+	sensorreading.sensorreading_humidity,
+	sensor.sensor_id AS "sensor.sensor_id",
+	sensor.sensor_label AS "sensor.sensor_label",
+	storelocation.storelocation_id AS "sensor.storelocation.storelocation_id",
+	storelocation.storelocation_name AS "sensor.storelocation.storelocation_name",
+	storelocation.storelocation_fullpath AS "sensor.storelocation.storelocation_fullpath",
+	entity.entity_id AS "sensor.storelocation.entity.entity_id",
+	entity.entity_name AS "sensor.storelocation.entity.entity_name"
+	FROM sensorreading
+	JOIN sensor ON sensorreading.sensor = sensor.sensor_id
+	JOIN storelocation ON sensorreading.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id`
+
+// GetSensors returns the sensors of the store locations of the entities,
+// all of them if entities is nil.
+func (db *SQLiteDataStore) GetSensors(entities []int) ([]Sensor, error) {
+
+	logger.Log.WithFields(logrus.Fields{"entities": entities}).Debug("GetSensors")
+
+	var (
+		err     error
+		args    []interface{}
+		sensors = []Sensor{}
+	)
+
+	sqlr := `SELECT ` + sensorColumns
+	if entities != nil {
+		if len(entities) == 0 {
+			return sensors, nil
+		}
+		sqlr += ` WHERE storelocation.entity IN (?)`
+		args = append(args, entities)
+	}
+	sqlr += ` ORDER BY entity.entity_name, storelocation.storelocation_fullpath, sensor.sensor_label`
+
+	if sqlr, args, err = sqlx.In(sqlr, args...); err != nil {
+		return nil, err
+	}
+	if err = db.Select(&sensors, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
+	}
+
+	return sensors, nil
+
+}
+
+// GetSensor returns the sensor with id "id".
+func (db *SQLiteDataStore) GetSensor(id int) (Sensor, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetSensor")
+
+	var (
+		err    error
+		sensor Sensor
+	)
+
+	sqlr := `SELECT ` + sensorColumns + ` WHERE sensor.sensor_id = ?`
+	if err = db.Get(&sensor, sqlr, id); err != nil {
+		return Sensor{}, err
+	}
+
+	return sensor, nil
+
+}
+
+// GetSensorByTokenHash returns the sensor with the token hash "hash".
+func (db *SQLiteDataStore) GetSensorByTokenHash(hash string) (Sensor, error) {
+
+	var (
+		err    error
+		sensor Sensor
+	)
+
+	sqlr := `SELECT ` + sensorColumns + ` WHERE sensor.sensor_tokenhash = ?`
+	if err = db.Get(&sensor, sqlr, hash); err != nil {
+		return Sensor{}, err
+	}
+
+	return sensor, nil
+
+}
+
+// CreateSensor inserts the sensor s with the token hash "hash".
+func (db *SQLiteDataStore) CreateSensor(s Sensor, hash string) (int64, error) {
+
+	logger.Log.WithFields(logrus.Fields{"s": s}).Debug("CreateSensor")
+
+	var (
+		err error
+		res sql.Result
+	)
+
+	sqlr := `INSERT INTO sensor (sensor_label, sensor_tokenhash, storelocation) VALUES (?, ?, ?)`
+	if res, err = db.Exec(sqlr, s.SensorLabel, hash, s.StoreLocationID.Int64); err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+
+}
+
+// DeleteSensor deletes the sensor with id "id" and its readings.
+func (db *SQLiteDataStore) DeleteSensor(id int) error {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteSensor")
+
+	var err error
+
+	sqlr := `DELETE FROM sensor WHERE sensor_id = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// GetLastSensorReading returns the last temperature reading of the store location with id "id",
+// false if there is none.
+func (db *SQLiteDataStore) GetLastSensorReading(id int) (SensorReading, bool, error) {
+
+	var (
+		err     error
+		reading SensorReading
+	)
+
+	sqlr := `SELECT ` + sensorReadingColumns + `
+	WHERE sensorreading.storelocation = ?
+	AND sensorreading.sensorreading_temperature IS NOT NULL
+	ORDER BY sensorreading.sensorreading_date DESC, sensorreading.sensorreading_id DESC
+	LIMIT 1`
+	if err = db.Get(&reading, sqlr, id); err != nil {
+		if err == sql.ErrNoRows {
+			return SensorReading{}, false, nil
+		}
+		return SensorReading{}, false, err
+	}
+
+	return reading, true, nil
+
+}
+
+// GetSensorReadings returns the readings of the store location with id "id"
+// between the dates "from" and "to" as 2006-01-02, ignored if empty.
+func (db *SQLiteDataStore) GetSensorReadings(id int, from string, to string) ([]SensorReading, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "from": from, "to": to}).Debug("GetSensorReadings")
+
+	var (
+		err      error
+		readings = []SensorReading{}
+	)
+
+	sqlr := `SELECT ` + sensorReadingColumns + `
+	WHERE sensorreading.storelocation = ?`
+	args := []interface{}{id}
+	if from != "" {
+		sqlr += ` AND date(sensorreading.sensorreading_date) >= ?`
+		args = append(args, from)
+	}
+	if to != "" {
+		sqlr += ` AND date(sensorreading.sensorreading_date) <= ?`
+		args = append(args, to)
+	}
+	sqlr += ` ORDER BY sensorreading.sensorreading_date`
+
+	if err = db.Select(&readings, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return readings, nil
+
+}
+
+// CreateSensorReading inserts the reading r of its sensor store location.
+// If "reason" is not empty an alert is raised with the current storages
+// of the store location and its children, and its id is returned.
+func (db *SQLiteDataStore) CreateSensorReading(r SensorReading, reason string) (alertID int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"r": r, "reason": reason}).Debug("CreateSensorReading")
+
+	var (
+		tx        *sqlx.Tx
+		res       sql.Result
+		readingID int64
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				logger.Log.Error(errr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr := `INSERT INTO sensorreading (sensorreading_date, sensorreading_temperature, sensorreading_humidity, sensor, storelocation)
+	VALUES (?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr,
+		r.SensorReadingDate,
+		r.SensorReadingTemperature,
+		r.SensorReadingHumidity,
+		r.SensorID,
+		r.StoreLocationID.Int64); err != nil {
+		return 0, err
+	}
+	if reason == "" {
+		return 0, nil
+	}
+	if readingID, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	sqlr = `INSERT INTO sensoralert (sensoralert_reason, sensorreading) VALUES (?, ?)`
+	if res, err = tx.Exec(sqlr, reason, readingID); err != nil {
+		return 0, err
+	}
+	if alertID, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	sqlr = `WITH RECURSIVE closure(storelocation_id) AS (
+		SELECT ?
+		UNION ALL
+		SELECT storelocation.storelocation_id FROM closure
+		JOIN storelocation ON storelocation.storelocation = closure.storelocation_id
+	)
+	INSERT INTO sensoralertstorages (sensoralertstorages_sensoralert_id, sensoralertstorages_storage_id)
+	SELECT ?, storage.storage_id FROM storage
+	JOIN closure ON storage.storelocation = closure.storelocation_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE`
+	if _, err = tx.Exec(sqlr, r.StoreLocationID.Int64, alertID); err != nil {
+		return 0, err
+	}
+
+	return alertID, nil
+
+}
+
+// getSensorAlertsStorages sets the storages of the alerts with their owner.
+func (db *SQLiteDataStore) getSensorAlertsStorages(alerts []SensorAlert) error {
+
+	var err error
+
+	for i := range alerts {
+		alerts[i].Storages = []Storage{}
+
+		sqlr := `SELECT storage.storage_id,
+		storage.storage_barecode,
+		storage.storage_quantity,
+		uq.unit_id AS "unit_quantity.unit_id",
+		uq.unit_label AS "unit_quantity.unit_label",
+		person.person_id AS "person.person_id",
+		person.person_email AS "person.person_email",
+		product.product_id AS "product.product_id",
+		name.name_label AS "product.name.name_label",
+		storelocation.storelocation_id AS "storelocation.storelocation_id",
+		storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath"
+		FROM sensoralertstorages
+		JOIN storage ON sensoralertstorages_storage_id = storage.storage_id
+		JOIN person ON storage.person = person.person_id
+		JOIN product ON storage.product = product.product_id
+		JOIN name ON product.name = name.name_id
+		JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+		LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id
+		WHERE sensoralertstorages_sensoralert_id = ?
+		ORDER BY storelocation.storelocation_fullpath, name.name_label, storage.storage_barecode`
+		if err = db.Select(&alerts[i].Storages, sqlr, alerts[i].SensorAlertID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// sensorAlertColumns are the columns of the sensor alerts select
+const sensorAlertColumns = `sensoralert.sensoralert_id,
+	sensoralert.sensoralert_reason,
+	sensorreading.sensorreading_id AS "sensorreading.sensorreading_id",
+	sensorreading.sensorreading_date AS "sensorreading.sensorreading_date",
+	sensorreading.sensorreading_temperature AS "sensorreading.sensorreading_temperature",
+	sensorreading.sensorreading_humidity AS "sensorreading.sensorreading_humidity",
+	sensor.sensor_id AS "sensorreading.sensor.sensor_id",
+	sensor.sensor_label AS "sensorreading.sensor.sensor_label",
+	storelocation.storelocation_id AS "sensorreading.sensor.storelocation.storelocation_id",
+	storelocation.storelocation_name AS "sensorreading.sensor.storelocation.storelocation_name",
+	storelocation.storelocation_fullpath AS "sensorreading.sensor.storelocation.storelocation_fullpath",
+	entity.entity_id AS "sensorreading.sensor.storelocation.entity.entity_id",
+	entity.entity_name AS "sensorreading.sensor.storelocation.entity.entity_name"
+	FROM sensoralert
+	JOIN sensorreading ON sensoralert.sensorreading = sensorreading.sensorreading_id
+	JOIN sensor ON sensorreading.sensor = sensor.sensor_id
+	JOIN storelocation ON sensorreading.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id`
+
+// GetSensorAlert returns the sensor alert with id "id" with its storages.
+func (db *SQLiteDataStore) GetSensorAlert(id int) (SensorAlert, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetSensorAlert")
+
+	var (
+		err    error
+		alerts = make([]SensorAlert, 1)
+	)
+
+	sqlr := `SELECT ` + sensorAlertColumns + ` WHERE sensoralert.sensoralert_id = ?`
+	if err = db.Get(&alerts[0], sqlr, id); err != nil {
+		return SensorAlert{}, err
+	}
+	if err = db.getSensorAlertsStorages(alerts); err != nil {
+		return SensorAlert{}, err
+	}
+
+	return alerts[0], nil
+
+}
+
+// GetSensorAlerts returns the sensor alerts of the store locations of the entities
+// with their storages, all of them if entities is nil, the latest first.
+func (db *SQLiteDataStore) GetSensorAlerts(entities []int) ([]SensorAlert, error) {
+
+	logger.Log.WithFields(logrus.Fields{"entities": entities}).Debug("GetSensorAlerts")
+
+	var (
+		err    error
+		args   []interface{}
+		alerts = []SensorAlert{}
+	)
+
+	sqlr := `SELECT ` + sensorAlertColumns
+	if entities != nil {
+		if len(entities) == 0 {
+			return alerts, nil
+		}
+		sqlr += ` WHERE storelocation.entity IN (?)`
+		args = append(args, entities)
+	}
+	sqlr += ` ORDER BY sensorreading.sensorreading_date DESC`
+
+	if sqlr, args, err = sqlx.In(sqlr, args...); err != nil {
+		return nil, err
+	}
+	if err = db.Select(&alerts, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
+	}
+	if err = db.getSensorAlertsStorages(alerts); err != nil {
+		return nil, err
+	}
+
+	return alerts, nil
+
+}
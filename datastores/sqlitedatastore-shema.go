@@ -281,3 +281,32 @@ var inssymbol = `INSERT INTO symbol (symbol_label, symbol_image) VALUES
 	("SGH09", "image/png;base64,iVBORw0KGgoAAAANSUhEUgAAACYAAAAmCAYAAACoPemuAAAABHNCSVQICAgIfAhkiAAAAAlwSFlzAAAN1wAADdcBQiibeAAAABl0RVh0U29mdHdhcmUAd3d3Lmlua3NjYXBlLm9yZ5vuPBoAAAI8SURBVFiFzdi7a1VBEMDhb0EjYhFfaCEICopBi4haWUiqqGgQW1OKaBpNIQEVvREi2lhaWCiC/4CSImgv2IgQELSSdKKlMUKEtTgr3jxuPI+9iQMD5+y9u/NjdmbO7IYYoywSQgvE2MqyXoyxudKKxKStHGvmhsoGl9dTGT2Xf/syweWFygiXHyoTXHegMsDVgprjLk5hS4wRenLD1fYUhjGans9jF/rRlwOuMhS2Yz924F0CO4EBjOTyXK0YwUVcwAcEHMJr9OaKudqLYBA/cQx7cT+NB1xrCld5cvLOGA7gqSIRricv7sED9Df1XB1PbcVOXMZnzOA7pvEcg3UTqjNY1QDlKmLSsRX+14NNlXamLlQyeDJBfenw+xmcxQ3cxunSCVYpINmYatUfHUlg3xaN9+MmjqR5uxPkaNltrZbChcFYUi8tmjuOqbIxt25pT7uifMThtvcBPMS84kvwKY2fizE+hhDCBkXGzuBZaUsN4qtPUVQj3uOJIhmGFSXlOO4loEmsr5KhtYIfvRjCUTxS1K8reKnIwAkLt/UHhqqUjUblIkFuxi18TRCv8KsNah5v8UbqRqqVi5JwOKhI/ym8wKzlg3+xzmGyrJ2QjC2U4ox4J72NS2fFEMI27CsdwEtlNsY43Wn9BVIlILNoo494t+CytD254bI2irngutJaN4Xr6mGkrpFVOb5VNbaqB96yRtfkiuBfxtf0UqUTxH9xDbU8XBaoPGAZt69dq3awy0uMLSH8fc4gvwFyuYuihNiCxwAAAABJRU5ErkJggg==");`
 var inssignalword = `INSERT INTO signalword (signalword_label) VALUES ("danger"), ("warning")`
 var inswelcomeannounce = `INSERT INTO welcomeannounce (welcomeannounce_text) VALUES ("")`
+
+// insstorageclass inserts the default storage classes, derived from the hazard statements,
+// and their incompatibilities. The acids and bases can not be told from their hazard statements
+// and are mapped to classes of compounds by the users.
+var insstorageclass = `INSERT INTO storageclass (storageclass_label, storageclass_description) VALUES
+	("explosive", "explosives and self-reactive substances"),
+	("flammable", "flammable gases, liquids and solids, pyrophoric substances"),
+	("oxidizing", "oxidizing gases, liquids and solids"),
+	("water-reactive", "substances reacting with water"),
+	("toxic", "acutely toxic substances"),
+	("corrosive", "corrosive substances"),
+	("acid", "acids"),
+	("base", "bases"),
+	("acid-reactive", "substances liberating toxic gases in contact with acids, such as cyanides");
+INSERT INTO storageclasshazardstatements (storageclasshazardstatements_storageclass_id, storageclasshazardstatements_hazardstatement_id)
+	SELECT storageclass_id, hazardstatement_id FROM storageclass, hazardstatement WHERE
+	(storageclass_label = "explosive" AND hazardstatement_reference IN ("H200", "H201", "H202", "H203", "H204", "H205", "H240", "H241", "EUH001")) OR
+	(storageclass_label = "flammable" AND hazardstatement_reference IN ("H220", "H221", "H222", "H223", "H224", "H225", "H226", "H228", "H242", "H250", "H251", "H252")) OR
+	(storageclass_label = "oxidizing" AND hazardstatement_reference IN ("H270", "H271", "H272")) OR
+	(storageclass_label = "water-reactive" AND hazardstatement_reference IN ("H260", "H261", "EUH014", "EUH029")) OR
+	(storageclass_label = "toxic" AND hazardstatement_reference IN ("H300", "H301", "H310", "H311", "H330", "H331")) OR
+	(storageclass_label = "corrosive" AND hazardstatement_reference IN ("H290", "H314")) OR
+	(storageclass_label = "acid-reactive" AND hazardstatement_reference IN ("EUH031", "EUH032"));
+INSERT INTO storageclassincompatibility (storageclassincompatibility_storageclass1, storageclassincompatibility_storageclass2)
+	SELECT MIN(c1.storageclass_id, c2.storageclass_id), MAX(c1.storageclass_id, c2.storageclass_id) FROM storageclass c1, storageclass c2 WHERE
+	(c1.storageclass_label = "explosive" AND c2.storageclass_label IN ("flammable", "oxidizing", "water-reactive", "acid", "base")) OR
+	(c1.storageclass_label = "oxidizing" AND c2.storageclass_label IN ("flammable", "water-reactive", "acid-reactive")) OR
+	(c1.storageclass_label = "water-reactive" AND c2.storageclass_label IN ("acid", "base", "corrosive")) OR
+	(c1.storageclass_label = "acid" AND c2.storageclass_label IN ("base", "acid-reactive"));`
@@ -1,6 +1,6 @@
 package datastores
 
-var versionToMigration = []string{migrationOne, migrationTwo, migrationThree}
+var versionToMigration = []string{migrationOne, migrationTwo, migrationThree, migrationFour, migrationFive, migrationSix, migrationSeven, migrationEight, migrationNine, migrationTen, migrationEleven, migrationTwelve, migrationThirteen, migrationFourteen, migrationFifteen, migrationSixteen, migrationSeventeen, migrationEighteen, migrationNineteen, migrationTwenty, migrationTwentyOne, migrationTwentyTwo}
 
 var migrationOne = `BEGIN TRANSACTION;
 
@@ -347,3 +347,440 @@ PRAGMA user_version=3;
 COMMIT;
 PRAGMA foreign_keys=on;
 `
+
+var migrationFour = `BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS inventory (
+	inventory_id integer PRIMARY KEY,
+	inventory_name string NOT NULL,
+	inventory_creationdate datetime NOT NULL,
+	inventory_closedate datetime,
+	person integer NOT NULL,
+	entity integer NOT NULL,
+	storelocation integer,
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(entity) references entity(entity_id),
+	FOREIGN KEY(storelocation) references storelocation(storelocation_id));
+CREATE INDEX IF NOT EXISTS idx_inventory_entity ON inventory(entity);
+
+CREATE TABLE IF NOT EXISTS inventoryscan (
+	inventoryscan_id integer PRIMARY KEY,
+	inventoryscan_code string NOT NULL,
+	inventoryscan_date datetime NOT NULL,
+	inventory integer NOT NULL,
+	person integer NOT NULL,
+	storelocation integer NOT NULL,
+	storage integer,
+	FOREIGN KEY(inventory) references inventory(inventory_id),
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(storelocation) references storelocation(storelocation_id),
+	FOREIGN KEY(storage) references storage(storage_id));
+CREATE INDEX IF NOT EXISTS idx_inventoryscan_inventory ON inventoryscan(inventory);
+
+PRAGMA user_version=4;
+COMMIT;
+`
+
+var migrationFive = `BEGIN TRANSACTION;
+ALTER TABLE storelocation ADD COLUMN storelocation_barecodeprefix string;
+ALTER TABLE entity ADD COLUMN entity_barecodeprefix string;
+ALTER TABLE entity ADD COLUMN entity_barecodetemplate string;
+
+-- moving the [PREFIX] of the store location names into the new column
+UPDATE storelocation SET
+	storelocation_barecodeprefix = substr(storelocation_name, 2, instr(storelocation_name, ']') - 2),
+	storelocation_name = CASE
+		WHEN trim(substr(storelocation_name, instr(storelocation_name, ']') + 1)) = '' THEN storelocation_name
+		ELSE trim(substr(storelocation_name, instr(storelocation_name, ']') + 1))
+	END
+WHERE regexp('^\[[_a-zA-Z]{1,5}\]', storelocation_name);
+
+-- rebuilding the full paths with the new names
+WITH RECURSIVE paths(id, path) AS (
+	SELECT storelocation_id, storelocation_name FROM storelocation WHERE storelocation IS NULL
+	UNION ALL
+	SELECT s.storelocation_id, paths.path || '/' || s.storelocation_name
+	FROM storelocation s JOIN paths ON s.storelocation = paths.id
+)
+UPDATE storelocation SET storelocation_fullpath = (SELECT path FROM paths WHERE paths.id = storelocation.storelocation_id)
+WHERE storelocation_id IN (SELECT id FROM paths);
+
+CREATE INDEX IF NOT EXISTS idx_storage_barecode ON storage(storage_barecode);
+
+PRAGMA user_version=5;
+COMMIT;
+`
+
+var migrationSix = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS gtin (
+	gtin_id integer PRIMARY KEY,
+	gtin_label text NOT NULL,
+	product integer NOT NULL,
+	supplierref integer,
+	FOREIGN KEY(product) references product(product_id),
+	FOREIGN KEY(supplierref) references supplierref(supplierref_id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_gtin_label ON gtin(gtin_label);
+CREATE INDEX IF NOT EXISTS idx_gtin_product ON gtin(product);
+
+PRAGMA user_version=6;
+COMMIT;
+`
+
+var migrationSeven = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS wastepickup (
+	wastepickup_id integer PRIMARY KEY,
+	wastepickup_creationdate datetime NOT NULL,
+	wastepickup_date datetime,
+	wastepickup_contractor string,
+	wastepickup_completiondate datetime,
+	person integer NOT NULL,
+	entity integer NOT NULL,
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(entity) references entity(entity_id));
+CREATE INDEX IF NOT EXISTS idx_wastepickup_entity ON wastepickup(entity);
+
+-- disposal records: storage is not a foreign key
+-- as the records are kept after the storages deletion
+CREATE TABLE IF NOT EXISTS wastepickupstorage (
+	wastepickupstorage_id integer PRIMARY KEY,
+	wastepickupstorage_category string NOT NULL,
+	wastepickupstorage_barecode string,
+	wastepickupstorage_productname string NOT NULL,
+	wastepickupstorage_casnumber string,
+	wastepickupstorage_physicalstate string,
+	wastepickupstorage_hazardstatements string,
+	wastepickupstorage_quantity float,
+	wastepickupstorage_unit string,
+	wastepickupstorage_storelocation string,
+	wastepickup integer NOT NULL,
+	storage integer NOT NULL,
+	FOREIGN KEY(wastepickup) references wastepickup(wastepickup_id));
+CREATE INDEX IF NOT EXISTS idx_wastepickupstorage_wastepickup ON wastepickupstorage(wastepickup);
+CREATE INDEX IF NOT EXISTS idx_wastepickupstorage_storage ON wastepickupstorage(storage);
+
+PRAGMA user_version=7;
+COMMIT;
+`
+
+var migrationEight = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS storagetransfer (
+	storagetransfer_id integer PRIMARY KEY,
+	storagetransfer_creationdate datetime NOT NULL,
+	storagetransfer_status string NOT NULL,
+	storagetransfer_comment string,
+	storagetransfer_decisiondate datetime,
+	storage integer NOT NULL,
+	person integer NOT NULL,
+	source_storelocation integer NOT NULL,
+	source_entity integer NOT NULL,
+	storelocation integer NOT NULL,
+	entity integer NOT NULL,
+	decision_person integer,
+	FOREIGN KEY(storage) references storage(storage_id),
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(source_storelocation) references storelocation(storelocation_id),
+	FOREIGN KEY(source_entity) references entity(entity_id),
+	FOREIGN KEY(storelocation) references storelocation(storelocation_id),
+	FOREIGN KEY(entity) references entity(entity_id),
+	FOREIGN KEY(decision_person) references person(person_id));
+CREATE INDEX IF NOT EXISTS idx_storagetransfer_storage ON storagetransfer(storage);
+CREATE INDEX IF NOT EXISTS idx_storagetransfer_source_entity ON storagetransfer(source_entity);
+CREATE INDEX IF NOT EXISTS idx_storagetransfer_entity ON storagetransfer(entity);
+
+PRAGMA user_version=8;
+COMMIT;
+`
+
+var migrationNine = `BEGIN TRANSACTION;
+ALTER TABLE storage ADD storage_parent integer REFERENCES storage(storage_id);
+CREATE INDEX IF NOT EXISTS idx_storage_parent ON storage(storage_parent);
+
+PRAGMA user_version=9;
+COMMIT;
+`
+
+var migrationTen = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS storagesource (
+	storagesource_id integer PRIMARY KEY,
+	storagesource_quantity REAL NOT NULL,
+	storage integer NOT NULL,
+	storagesource_storage integer NOT NULL,
+	FOREIGN KEY(storage) references storage(storage_id),
+	FOREIGN KEY(storagesource_storage) references storage(storage_id));
+CREATE INDEX IF NOT EXISTS idx_storagesource_storage ON storagesource(storage);
+CREATE INDEX IF NOT EXISTS idx_storagesource_source ON storagesource(storagesource_storage);
+
+-- Converting the concentration units.
+-- They were created with the default multiplier 1, and nM, µM and mM
+-- had no common reference unit (µM and mM under mM, nM alone),
+-- so a concentration could not be converted into another unit.
+-- The M reference unit is added and the existing rows are converted
+-- to their M and g/L reference units. The rows keep their ids and labels:
+-- the storage and product concentrations, stored as a value and a unit,
+-- are unchanged. Only the rows still with their initial multiplier are converted.
+INSERT OR IGNORE INTO unit (unit_label, unit_type) VALUES ("M", "concentration");
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label="M"), unit_multiplier=0.001 WHERE unit_label="mM" AND unit_type="concentration" AND unit_multiplier=1;
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label="M"), unit_multiplier=0.000001 WHERE unit_label="µM" AND unit_type="concentration" AND unit_multiplier=1;
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label="M"), unit_multiplier=0.000000001 WHERE unit_label="nM" AND unit_type="concentration" AND unit_multiplier=1;
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label="g/L"), unit_multiplier=0.001 WHERE unit_label="mg/L" AND unit_type="concentration" AND unit_multiplier=1;
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label="g/L"), unit_multiplier=0.000001 WHERE unit_label="µg/L" AND unit_type="concentration" AND unit_multiplier=1;
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label="g/L"), unit_multiplier=0.000000001 WHERE unit_label="ng/L" AND unit_type="concentration" AND unit_multiplier=1;
+
+PRAGMA user_version=10;
+COMMIT;
+`
+
+var migrationEleven = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS reservation (
+	reservation_id integer PRIMARY KEY,
+	reservation_creationdate datetime NOT NULL,
+	reservation_startdate datetime NOT NULL,
+	reservation_enddate datetime NOT NULL,
+	reservation_quantity REAL,
+	reservation_comment string,
+	person integer NOT NULL,
+	entity integer NOT NULL,
+	product integer NOT NULL,
+	storage integer,
+	unit_quantity integer,
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(entity) references entity(entity_id),
+	FOREIGN KEY(product) references product(product_id),
+	FOREIGN KEY(storage) references storage(storage_id),
+	FOREIGN KEY(unit_quantity) references unit(unit_id));
+CREATE INDEX IF NOT EXISTS idx_reservation_storage ON reservation(storage);
+CREATE INDEX IF NOT EXISTS idx_reservation_product_entity ON reservation(product, entity);
+
+PRAGMA user_version=11;
+COMMIT;
+`
+
+var migrationTwelve = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS purchaserequest (
+	purchaserequest_id integer PRIMARY KEY,
+	purchaserequest_creationdate datetime NOT NULL,
+	purchaserequest_status string NOT NULL,
+	purchaserequest_quantity REAL,
+	purchaserequest_nbitem integer NOT NULL DEFAULT 1,
+	purchaserequest_comment string,
+	purchaserequest_decisiondate datetime,
+	purchaserequest_orderdate datetime,
+	purchaserequest_orderreference string,
+	purchaserequest_receptiondate datetime,
+	person integer NOT NULL,
+	entity integer NOT NULL,
+	product integer NOT NULL,
+	supplierref integer,
+	unit_quantity integer,
+	decision_person integer,
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(entity) references entity(entity_id),
+	FOREIGN KEY(product) references product(product_id),
+	FOREIGN KEY(supplierref) references supplierref(supplierref_id),
+	FOREIGN KEY(unit_quantity) references unit(unit_id),
+	FOREIGN KEY(decision_person) references person(person_id));
+CREATE INDEX IF NOT EXISTS idx_purchaserequest_entity ON purchaserequest(entity);
+CREATE INDEX IF NOT EXISTS idx_purchaserequest_status ON purchaserequest(purchaserequest_status);
+
+PRAGMA user_version=12;
+COMMIT;
+`
+
+var migrationThirteen = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS stockthreshold (
+	stockthreshold_id integer PRIMARY KEY,
+	stockthreshold_quantity REAL NOT NULL,
+	entity integer NOT NULL,
+	product integer NOT NULL,
+	unit_quantity integer,
+	FOREIGN KEY(entity) references entity(entity_id),
+	FOREIGN KEY(product) references product(product_id),
+	FOREIGN KEY(unit_quantity) references unit(unit_id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_stockthreshold_entity_product ON stockthreshold(entity, product);
+
+PRAGMA user_version=13;
+COMMIT;
+`
+
+var migrationFourteen = `BEGIN TRANSACTION;
+ALTER TABLE supplierref ADD supplierref_unitprice REAL;
+ALTER TABLE supplierref ADD supplierref_currency string;
+ALTER TABLE storage ADD storage_price REAL;
+ALTER TABLE storage ADD storage_currency string;
+
+PRAGMA user_version=14;
+COMMIT;
+`
+
+var migrationFifteen = `BEGIN TRANSACTION;
+ALTER TABLE unit ADD unit_dimension string;
+
+INSERT OR IGNORE INTO unit (unit_label, unit_multiplier, unit_type) VALUES ("mol", 1, "quantity");
+INSERT OR IGNORE INTO unit (unit_label, unit_multiplier, unit_type, unit) VALUES ("mmol", 0.001, "quantity", (SELECT unit_id FROM unit WHERE unit_label="mol"));
+INSERT OR IGNORE INTO unit (unit_label, unit_multiplier, unit_type, unit) VALUES ("µmol", 0.000001, "quantity", (SELECT unit_id FROM unit WHERE unit_label="mol"));
+
+UPDATE unit SET unit_dimension="volume" WHERE unit_label="L" OR unit=(SELECT unit_id FROM unit WHERE unit_label="L");
+UPDATE unit SET unit_dimension="mass" WHERE unit_label="g" OR unit=(SELECT unit_id FROM unit WHERE unit_label="g");
+UPDATE unit SET unit_dimension="moles" WHERE unit_label="mol" OR unit=(SELECT unit_id FROM unit WHERE unit_label="mol");
+UPDATE unit SET unit_dimension="length" WHERE unit_label="m" OR unit=(SELECT unit_id FROM unit WHERE unit_label="m");
+
+PRAGMA user_version=15;
+COMMIT;
+`
+
+var migrationSixteen = `BEGIN TRANSACTION;
+ALTER TABLE product ADD product_density REAL;
+ALTER TABLE product ADD product_molarmass REAL;
+
+PRAGMA user_version=16;
+COMMIT;
+`
+
+var migrationSeventeen = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS stocksnapshot (
+	stocksnapshot_id integer PRIMARY KEY,
+	stocksnapshot_date string NOT NULL,
+	stocksnapshot_quantity REAL NOT NULL,
+	stocksnapshot_storagecount integer NOT NULL,
+	entity integer NOT NULL,
+	storelocation integer NOT NULL,
+	product integer NOT NULL,
+	unit integer,
+	FOREIGN KEY(entity) references entity(entity_id) ON DELETE CASCADE,
+	FOREIGN KEY(storelocation) references storelocation(storelocation_id) ON DELETE CASCADE,
+	FOREIGN KEY(product) references product(product_id) ON DELETE CASCADE,
+	FOREIGN KEY(unit) references unit(unit_id));
+CREATE INDEX IF NOT EXISTS idx_stocksnapshot_product_date ON stocksnapshot(product, stocksnapshot_date);
+CREATE INDEX IF NOT EXISTS idx_stocksnapshot_date ON stocksnapshot(stocksnapshot_date);
+
+PRAGMA user_version=17;
+COMMIT;
+`
+
+var migrationEighteen = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS storelocationlimit (
+	storelocationlimit_id integer PRIMARY KEY,
+	storelocationlimit_label string NOT NULL,
+	storelocationlimit_quantity REAL NOT NULL,
+	storelocationlimit_hard boolean default 0,
+	storelocation integer NOT NULL,
+	unit integer NOT NULL,
+	physicalstate integer,
+	FOREIGN KEY(storelocation) references storelocation(storelocation_id) ON DELETE CASCADE,
+	FOREIGN KEY(unit) references unit(unit_id),
+	FOREIGN KEY(physicalstate) references physicalstate(physicalstate_id));
+CREATE INDEX IF NOT EXISTS idx_storelocationlimit_storelocation ON storelocationlimit(storelocation);
+
+CREATE TABLE IF NOT EXISTS storelocationlimithazardstatements (
+	storelocationlimithazardstatements_storelocationlimit_id integer NOT NULL,
+	storelocationlimithazardstatements_hazardstatement_id integer NOT NULL,
+	PRIMARY KEY(storelocationlimithazardstatements_storelocationlimit_id, storelocationlimithazardstatements_hazardstatement_id),
+	FOREIGN KEY(storelocationlimithazardstatements_storelocationlimit_id) references storelocationlimit(storelocationlimit_id) ON DELETE CASCADE,
+	FOREIGN KEY(storelocationlimithazardstatements_hazardstatement_id) references hazardstatement(hazardstatement_id));
+
+CREATE TABLE IF NOT EXISTS storelocationlimitsymbols (
+	storelocationlimitsymbols_storelocationlimit_id integer NOT NULL,
+	storelocationlimitsymbols_symbol_id integer NOT NULL,
+	PRIMARY KEY(storelocationlimitsymbols_storelocationlimit_id, storelocationlimitsymbols_symbol_id),
+	FOREIGN KEY(storelocationlimitsymbols_storelocationlimit_id) references storelocationlimit(storelocationlimit_id) ON DELETE CASCADE,
+	FOREIGN KEY(storelocationlimitsymbols_symbol_id) references symbol(symbol_id));
+
+PRAGMA user_version=18;
+COMMIT;
+`
+
+var migrationNineteen = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS storageclass (
+	storageclass_id integer PRIMARY KEY,
+	storageclass_label string NOT NULL UNIQUE,
+	storageclass_description string);
+
+CREATE TABLE IF NOT EXISTS storageclasshazardstatements (
+	storageclasshazardstatements_storageclass_id integer NOT NULL,
+	storageclasshazardstatements_hazardstatement_id integer NOT NULL,
+	PRIMARY KEY(storageclasshazardstatements_storageclass_id, storageclasshazardstatements_hazardstatement_id),
+	FOREIGN KEY(storageclasshazardstatements_storageclass_id) references storageclass(storageclass_id) ON DELETE CASCADE,
+	FOREIGN KEY(storageclasshazardstatements_hazardstatement_id) references hazardstatement(hazardstatement_id));
+
+CREATE TABLE IF NOT EXISTS storageclassclassofcompound (
+	storageclassclassofcompound_storageclass_id integer NOT NULL,
+	storageclassclassofcompound_classofcompound_id integer NOT NULL,
+	PRIMARY KEY(storageclassclassofcompound_storageclass_id, storageclassclassofcompound_classofcompound_id),
+	FOREIGN KEY(storageclassclassofcompound_storageclass_id) references storageclass(storageclass_id) ON DELETE CASCADE,
+	FOREIGN KEY(storageclassclassofcompound_classofcompound_id) references classofcompound(classofcompound_id) ON DELETE CASCADE);
+
+CREATE TABLE IF NOT EXISTS storageclassincompatibility (
+	storageclassincompatibility_storageclass1 integer NOT NULL,
+	storageclassincompatibility_storageclass2 integer NOT NULL,
+	PRIMARY KEY(storageclassincompatibility_storageclass1, storageclassincompatibility_storageclass2),
+	CHECK(storageclassincompatibility_storageclass1 < storageclassincompatibility_storageclass2),
+	FOREIGN KEY(storageclassincompatibility_storageclass1) references storageclass(storageclass_id) ON DELETE CASCADE,
+	FOREIGN KEY(storageclassincompatibility_storageclass2) references storageclass(storageclass_id) ON DELETE CASCADE);
+
+CREATE TABLE IF NOT EXISTS productstorageclasses (
+	productstorageclasses_product_id integer NOT NULL,
+	productstorageclasses_storageclass_id integer NOT NULL,
+	PRIMARY KEY(productstorageclasses_product_id, productstorageclasses_storageclass_id),
+	FOREIGN KEY(productstorageclasses_product_id) references product(product_id) ON DELETE CASCADE,
+	FOREIGN KEY(productstorageclasses_storageclass_id) references storageclass(storageclass_id) ON DELETE CASCADE);
+
+PRAGMA user_version=19;
+COMMIT;
+`
+
+var migrationTwenty = `BEGIN TRANSACTION;
+
+ALTER TABLE storelocation ADD COLUMN storelocation_type string;
+ALTER TABLE storelocation ADD COLUMN storelocation_mintemperature REAL;
+ALTER TABLE storelocation ADD COLUMN storelocation_maxtemperature REAL;
+
+PRAGMA user_version=20;
+COMMIT;
+`
+
+var migrationTwentyOne = `BEGIN TRANSACTION;
+CREATE TABLE IF NOT EXISTS sensor (
+	sensor_id integer PRIMARY KEY,
+	sensor_label string NOT NULL,
+	sensor_tokenhash string NOT NULL UNIQUE,
+	storelocation integer NOT NULL,
+	FOREIGN KEY(storelocation) references storelocation(storelocation_id) ON DELETE CASCADE);
+
+CREATE TABLE IF NOT EXISTS sensorreading (
+	sensorreading_id integer PRIMARY KEY,
+	sensorreading_date datetime NOT NULL,
+	sensorreading_temperature REAL,
+	sensorreading_humidity REAL,
+	sensor integer NOT NULL,
+	storelocation integer NOT NULL,
+	FOREIGN KEY(sensor) references sensor(sensor_id) ON DELETE CASCADE,
+	FOREIGN KEY(storelocation) references storelocation(storelocation_id) ON DELETE CASCADE);
+CREATE INDEX IF NOT EXISTS idx_sensorreading_storelocation ON sensorreading(storelocation, sensorreading_date);
+
+CREATE TABLE IF NOT EXISTS sensoralert (
+	sensoralert_id integer PRIMARY KEY,
+	sensoralert_reason string NOT NULL,
+	sensorreading integer NOT NULL,
+	FOREIGN KEY(sensorreading) references sensorreading(sensorreading_id) ON DELETE CASCADE);
+
+CREATE TABLE IF NOT EXISTS sensoralertstorages (
+	sensoralertstorages_sensoralert_id integer NOT NULL,
+	sensoralertstorages_storage_id integer NOT NULL,
+	PRIMARY KEY(sensoralertstorages_sensoralert_id, sensoralertstorages_storage_id),
+	FOREIGN KEY(sensoralertstorages_sensoralert_id) references sensoralert(sensoralert_id) ON DELETE CASCADE,
+	FOREIGN KEY(sensoralertstorages_storage_id) references storage(storage_id) ON DELETE CASCADE);
+
+PRAGMA user_version=21;
+COMMIT;
+`
+
+var migrationTwentyTwo = `BEGIN TRANSACTION;
+
+ALTER TABLE storelocation ADD COLUMN storelocation_level string;
+ALTER TABLE storelocation ADD COLUMN storelocation_roomnumber string;
+ALTER TABLE storelocation ADD COLUMN storelocation_responsible integer REFERENCES person(person_id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_storelocation_level ON storelocation(storelocation_level);
+
+PRAGMA user_version=22;
+COMMIT;
+`
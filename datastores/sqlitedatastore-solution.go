@@ -0,0 +1,374 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+var (
+	// ErrSolutionSource is returned when a solution source storage is archived,
+	// is an history storage, is used twice or does not contain the withdrawn quantity
+	ErrSolutionSource = errors.New("invalid solution source")
+	// ErrSolutionConcentration is returned when the solution concentration
+	// can not be computed from the sources
+	ErrSolutionConcentration = errors.New("solution concentration can not be computed")
+	// ErrSolutionVolume is returned when the solution volume
+	// can not be computed from the sources
+	ErrSolutionVolume = errors.New("solution volume can not be computed")
+)
+
+// solutionSource is a source storage with its units
+// reduced to their reference unit ("L", "g", "M", "g/L"...)
+type solutionSource struct {
+	StorageID               int             `db:"storage_id"`
+	Quantity                sql.NullFloat64 `db:"storage_quantity"`
+	Archive                 sql.NullBool    `db:"storage_archive"`
+	ExpirationDate          sql.NullTime    `db:"storage_expirationdate"`
+	Concentration           sql.NullInt64   `db:"storage_concentration"`
+	ProductID               int             `db:"product"`
+	UnitQuantity            sql.NullInt64   `db:"unit_quantity"`
+	QuantityReference       sql.NullString  `db:"uq_reference"`
+	QuantityMultiplier      sql.NullFloat64 `db:"uq_multiplier"`
+	ConcentrationReference  sql.NullString  `db:"uc_reference"`
+	ConcentrationMultiplier sql.NullFloat64 `db:"uc_multiplier"`
+}
+
+// unitReference returns the reference unit label and the multiplier of the unit with id "id"
+func unitReference(q sqlx.Queryer, id int64) (reference string, multiplier float64, err error) {
+
+	var u struct {
+		Reference  string  `db:"reference"`
+		Multiplier float64 `db:"unit_multiplier"`
+	}
+
+	sqlr := `SELECT ref.unit_label AS reference, unit.unit_multiplier FROM unit
+	JOIN unit ref ON ref.unit_id = COALESCE(unit.unit, unit.unit_id)
+	WHERE unit.unit_id = ?`
+	if err = sqlx.Get(q, &u, sqlr, id); err != nil {
+		return "", 0, err
+	}
+
+	return u.Reference, u.Multiplier, nil
+
+}
+
+// concentrationUnit returns the unit of the reference concentration unit "reference"
+// giving the integer value closest to the concentration c,
+// expressed in the reference unit
+func concentrationUnit(q sqlx.Queryer, reference string, c float64) (id int64, value int64, err error) {
+
+	var units []struct {
+		ID         int64   `db:"unit_id"`
+		Multiplier float64 `db:"unit_multiplier"`
+	}
+
+	sqlr := `SELECT unit.unit_id, unit.unit_multiplier FROM unit
+	JOIN unit ref ON ref.unit_id = COALESCE(unit.unit, unit.unit_id)
+	WHERE ref.unit_label = ?
+	ORDER BY unit.unit_multiplier DESC`
+	if err = sqlx.Select(q, &units, sqlr, reference); err != nil {
+		return 0, 0, err
+	}
+	if len(units) == 0 {
+		return 0, 0, ErrSolutionConcentration
+	}
+
+	// the first unit giving an integer value,
+	// the smallest one otherwise
+	for _, u := range units {
+		v := c / u.Multiplier
+		if v >= 1 && math.Abs(v-math.Round(v)) <= 1e-6*v {
+			return u.ID, int64(math.Round(v)), nil
+		}
+	}
+	u := units[len(units)-1]
+
+	return u.ID, int64(math.Round(c / u.Multiplier)), nil
+
+}
+
+// solutionStorage validates the solution s prepared on behalf of the person
+// with id "personID" and returns the storage to create for it, with its sources.
+func solutionStorage(q sqlx.Queryer, s Solution, personID int, now time.Time) (solution Storage, sources []solutionSource, err error) {
+
+	var (
+		sqlr      string
+		reference string // solutes concentration reference unit
+		solute    float64
+		volume    float64 // in L
+		unitID    sql.NullInt64
+	)
+
+	if len(s.Sources) == 0 {
+		err = ErrSolutionSource
+		return
+	}
+
+	sqlr = `SELECT storage.storage_id,
+	storage.storage_quantity,
+	storage.storage_archive,
+	storage.storage_expirationdate,
+	storage.storage_concentration,
+	storage.product,
+	storage.unit_quantity,
+	uqref.unit_label AS uq_reference,
+	uq.unit_multiplier AS uq_multiplier,
+	ucref.unit_label AS uc_reference,
+	uc.unit_multiplier AS uc_multiplier
+	FROM storage
+	LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id
+	LEFT JOIN unit uqref ON uqref.unit_id = COALESCE(uq.unit, uq.unit_id)
+	LEFT JOIN unit uc ON storage.unit_concentration = uc.unit_id
+	LEFT JOIN unit ucref ON ucref.unit_id = COALESCE(uc.unit, uc.unit_id)
+	WHERE storage.storage_id = ? AND storage.storage IS NULL`
+
+	used := make(map[int]bool)
+	for _, ss := range s.Sources {
+		var source solutionSource
+		if err = sqlx.Get(q, &source, sqlr, ss.StorageID); err != nil {
+			if err == sql.ErrNoRows {
+				err = ErrSolutionSource
+			}
+			return
+		}
+		if used[ss.StorageID] ||
+			(source.Archive.Valid && source.Archive.Bool) ||
+			!source.Quantity.Valid ||
+			ss.Quantity <= 0 ||
+			ss.Quantity > source.Quantity.Float64 {
+			err = ErrSolutionSource
+			return
+		}
+		used[ss.StorageID] = true
+		sources = append(sources, source)
+	}
+
+	if s.ProductID == 0 {
+		s.ProductID = sources[0].ProductID
+	}
+
+	// computing the solute amount (in mol or g)
+	// and the sources volume
+	for i, source := range sources {
+		quantity := s.Sources[i].Quantity * source.QuantityMultiplier.Float64
+
+		isLiquid := source.QuantityReference.Valid && source.QuantityReference.String == "L"
+		if isLiquid {
+			volume += quantity
+			if !unitID.Valid {
+				unitID = source.UnitQuantity
+			}
+		}
+
+		if source.ProductID != s.ProductID {
+			// solvent
+			continue
+		}
+
+		var r string
+		switch {
+		case isLiquid && source.Concentration.Valid && source.ConcentrationReference.Valid:
+			r = source.ConcentrationReference.String
+			solute += float64(source.Concentration.Int64) * source.ConcentrationMultiplier.Float64 * quantity
+		case source.QuantityReference.Valid && source.QuantityReference.String == "g" && !source.Concentration.Valid:
+			r = "g/L"
+			solute += quantity
+		default:
+			err = ErrSolutionConcentration
+			return
+		}
+		if reference != "" && reference != r {
+			err = ErrSolutionConcentration
+			return
+		}
+		reference = r
+	}
+	if reference == "" {
+		err = ErrSolutionConcentration
+		return
+	}
+
+	// solution volume
+	if s.UnitQuantity.Valid {
+		unitID = s.UnitQuantity
+	}
+	if !unitID.Valid {
+		err = ErrSolutionVolume
+		return
+	}
+	var (
+		unitReferenceLabel string
+		unitMultiplier     float64
+	)
+	if unitReferenceLabel, unitMultiplier, err = unitReference(q, unitID.Int64); err != nil {
+		return
+	}
+	if unitReferenceLabel != "L" {
+		err = ErrSolutionVolume
+		return
+	}
+	if s.Quantity.Valid {
+		volume = s.Quantity.Float64 * unitMultiplier
+	}
+	if volume <= 0 {
+		err = ErrSolutionVolume
+		return
+	}
+
+	// solution concentration
+	var (
+		concentrationID    int64
+		concentrationValue int64
+	)
+	c := solute / volume
+	if s.UnitConcentration.Valid {
+		var (
+			r string
+			m float64
+		)
+		if r, m, err = unitReference(q, s.UnitConcentration.Int64); err != nil {
+			return
+		}
+		if r != reference {
+			err = ErrSolutionConcentration
+			return
+		}
+		concentrationID, concentrationValue = s.UnitConcentration.Int64, int64(math.Round(c/m))
+	} else if concentrationID, concentrationValue, err = concentrationUnit(q, reference, c); err != nil {
+		return
+	}
+
+	// the solution expires with its first expired source
+	for _, source := range sources {
+		if source.ExpirationDate.Valid && (!s.ExpirationDate.Valid || source.ExpirationDate.Time.Before(s.ExpirationDate.Time)) {
+			s.ExpirationDate = source.ExpirationDate
+		}
+	}
+
+	solution = Storage{
+		StorageCreationDate:     now,
+		StorageModificationDate: now,
+		StorageEntryDate:        sql.NullTime{Valid: true, Time: now},
+		StorageExpirationDate:   s.ExpirationDate,
+		StorageComment:          s.Comment,
+		StorageQuantity:         sql.NullFloat64{Valid: true, Float64: volume / unitMultiplier},
+		StorageConcentration:    sql.NullInt64{Valid: true, Int64: concentrationValue},
+		Person:                  Person{PersonID: personID},
+		Product:                 Product{ProductID: s.ProductID},
+		StoreLocation:           StoreLocation{StoreLocationID: sql.NullInt64{Valid: true, Int64: int64(s.StoreLocationID)}},
+		UnitQuantity:            Unit{UnitID: unitID},
+		UnitConcentration:       Unit{UnitID: sql.NullInt64{Valid: true, Int64: concentrationID}},
+	}
+	return
+
+}
+
+// GetSolutionStorage returns the storage that would be created
+// by preparing the solution s on behalf of the person with id "personID".
+func (db *SQLiteDataStore) GetSolutionStorage(s Solution, personID int) (Storage, error) {
+
+	logger.Log.WithFields(logrus.Fields{"s": s, "personID": personID}).Debug("GetSolutionStorage")
+
+	solution, _, err := solutionStorage(db, s, personID, time.Now())
+
+	return solution, err
+
+}
+
+// PrepareSolution creates the storage of the solution s prepared
+// on behalf of the person with id "personID", links it to its sources
+// and withdraws the sources quantities.
+// The solution expiration date can not be after its sources ones.
+// It returns the created storage id.
+func (db *SQLiteDataStore) PrepareSolution(s Solution, personID int) (id int, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"s": s, "personID": personID}).Debug("PrepareSolution")
+
+	var (
+		tx       *sqlx.Tx
+		sqlr     string
+		solution Storage
+		sources  []solutionSource
+		now      = time.Now()
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if solution, sources, err = solutionStorage(tx, s, personID, now); err != nil {
+		return
+	}
+
+	// withdrawing the sources quantities
+	for i, source := range sources {
+		if _, err = tx.Exec(storageHistoryInsert, source.StorageID, source.StorageID); err != nil {
+			return
+		}
+		sqlr = `UPDATE storage SET storage_quantity = ?, person = ?, storage_modificationdate = ?
+		WHERE storage_id = ?`
+		if _, err = tx.Exec(sqlr, source.Quantity.Float64-s.Sources[i].Quantity, personID, now, source.StorageID); err != nil {
+			return
+		}
+	}
+
+	if id, err = db.createStorage(tx.Tx, solution, 1); err != nil {
+		return
+	}
+
+	sqlr = `INSERT INTO storagesource (storagesource_quantity, storage, storagesource_storage) VALUES (?, ?, ?)`
+	for _, ss := range s.Sources {
+		if _, err = tx.Exec(sqlr, ss.Quantity, id, ss.StorageID); err != nil {
+			return
+		}
+	}
+
+	return
+
+}
+
+// GetStorageSources returns the source storages
+// of the solution storage with id "id".
+func (db *SQLiteDataStore) GetStorageSources(id int) ([]StorageSource, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetStorageSources")
+
+	var (
+		err     error
+		sources []StorageSource
+	)
+
+	sqlr := `SELECT ` + lineageStorageColumns + `,
+	storagesource.storagesource_quantity
+	FROM storagesource
+	JOIN storage ON storage.storage_id = storagesource.storagesource_storage
+	` + inventoryStorageJoins + `
+	WHERE storagesource.storage = ?
+	ORDER BY storagesource.storagesource_id`
+	if err = db.Select(&sources, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+
+}
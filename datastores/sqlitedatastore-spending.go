@@ -0,0 +1,95 @@
+package datastores
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// ErrSpendingGroupBy is returned for an unknown spending report grouping
+var ErrSpendingGroupBy = errors.New("unknown spending report grouping")
+
+// spendingGroups are the spending report group expressions
+var spendingGroups = map[string]string{
+	SpendingByEntity:   "entity.entity_name",
+	SpendingBySupplier: "COALESCE(supplier.supplier_label, '')",
+	SpendingByCategory: "COALESCE(category.category_label, '')",
+	SpendingByPeriod:   "COALESCE(strftime('%Y-%m', COALESCE(storage.storage_entrydate, storage.storage_creationdate)), '')",
+}
+
+// GetSpendings returns the spending report lines matching f,
+// one line per group and currency.
+// History storages are not taken into account, archived storages are.
+// A storage without purchase price is valued at the unit price of
+// the supplier ref matching its reference and supplier.
+func (db *SQLiteDataStore) GetSpendings(f SpendingFilter) ([]SpendingLine, error) {
+
+	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetSpendings")
+
+	var (
+		err   error
+		args  []interface{}
+		lines []SpendingLine
+		where strings.Builder
+	)
+
+	group, ok := spendingGroups[f.GroupBy]
+	if !ok {
+		return nil, ErrSpendingGroupBy
+	}
+
+	where.WriteString("storage.storage IS NULL")
+	if f.Entities != nil {
+		if len(f.Entities) == 0 {
+			return []SpendingLine{}, nil
+		}
+		where.WriteString(" AND storelocation.entity IN (?)")
+		args = append(args, f.Entities)
+	}
+	if f.From != "" {
+		where.WriteString(" AND date(COALESCE(storage.storage_entrydate, storage.storage_creationdate)) >= date(?)")
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		where.WriteString(" AND date(COALESCE(storage.storage_entrydate, storage.storage_creationdate)) <= date(?)")
+		args = append(args, f.To)
+	}
+
+	sqlr := fmt.Sprintf(`SELECT spending_group,
+	spending_currency,
+	COUNT(*) AS spending_storagecount,
+	SUM(price IS NULL) AS spending_unpricedcount,
+	COALESCE(SUM(price), 0) AS spending_total,
+	COALESCE(SUM(CASE WHEN NOT archive AND NOT todestroy THEN price END), 0) AS spending_stockvalue,
+	COALESCE(SUM(CASE WHEN todestroy THEN price END), 0) AS spending_disposedvalue
+	FROM (SELECT %s AS spending_group,
+		COALESCE(storage.storage_price, supplierref.supplierref_unitprice) AS price,
+		COALESCE(CASE WHEN storage.storage_price IS NOT NULL THEN storage.storage_currency ELSE supplierref.supplierref_currency END, '') AS spending_currency,
+		COALESCE(storage.storage_archive, 0) AS archive,
+		COALESCE(storage.storage_todestroy, 0) AS todestroy
+		FROM storage
+		JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+		JOIN entity ON storelocation.entity = entity.entity_id
+		JOIN product ON storage.product = product.product_id
+		LEFT JOIN category ON product.category = category.category_id
+		LEFT JOIN supplier ON storage.supplier = supplier.supplier_id
+		LEFT JOIN supplierref ON storage.storage_reference = supplierref.supplierref_label AND storage.supplier = supplierref.supplier
+		WHERE %s)
+	GROUP BY spending_group, spending_currency
+	ORDER BY spending_group, spending_currency`, group, where.String())
+
+	if sqlr, args, err = sqlx.In(sqlr, args...); err != nil {
+		return nil, err
+	}
+	if err = db.Select(&lines, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
+	}
+
+	return lines, nil
+
+}
@@ -3,294 +3,151 @@ package datastores
 import (
 	"database/sql"
 	"net/http"
-	"sync"
 
 	"github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 	"github.com/tbellembois/gochimitheque/logger"
 	. "github.com/tbellembois/gochimitheque/models"
 )
 
-type SyncStoreLocation struct {
-	mu            sync.Mutex
-	Storelocation *StoreLocation
-}
-
-// computeStockStorelocationConsumable returns the number of units of product p in the store location s.
-func (db *SQLiteDataStore) computeStockStorelocationConsumable(p Product, s *SyncStoreLocation, mu *sync.Mutex) float64 {
-
-	var (
-		err                   error
-		currentStock          float64
-		totalStock            float64
-		storelocationChildren []StoreLocation
-		sqlr                  string
-		args                  []interface{}
-	)
-
-	dialect := goqu.Dialect("sqlite3")
-	t := goqu.T("storage")
-
-	// Getting the store location current stock.
-	sQuery := dialect.From(t).Join(
-		goqu.T("product"),
-		goqu.On(goqu.Ex{"storage.product": goqu.I("product.product_id")}),
-	).Where(
-		goqu.I("storage.storage_archive").IsFalse(),
-		goqu.I("storage.storage").IsNull(),
-		goqu.I("storage.storelocation").Eq(s.Storelocation.StoreLocationID.Int64),
-		goqu.I("storage.product").Eq(p.ProductID),
-	).Select(
-		goqu.SUM(goqu.L("product.product_number_per_bag * storage.storage_number_of_bag")).As("bag"),
-		goqu.SUM(goqu.L("product.product_number_per_carton * storage.storage_number_of_carton")).As("carton"),
-		goqu.SUM(goqu.L("storage.storage_number_of_unit")).As("unit"),
-	)
-
-	if sqlr, args, err = sQuery.ToSQL(); err != nil {
-		logger.Log.Error(err)
-		return 0
-	}
-
-	type Result struct {
-		Bag    sql.NullInt64 `db:"bag"`
-		Carton sql.NullInt64 `db:"carton"`
-		Unit   sql.NullInt64 `db:"unit"`
-	}
-	var result Result
-	mu.Lock()
-	if err = db.Get(&result, sqlr, args...); err != nil && err != sql.ErrNoRows {
-		logger.Log.Error(err)
-		return 0
-	}
-	mu.Unlock()
-
-	var stock int64
-	if result.Bag.Valid && result.Bag.Int64 > 0 {
-		stock = result.Bag.Int64
-	}
-	if result.Carton.Valid && result.Carton.Int64 > 0 {
-		stock = stock + result.Carton.Int64
-	}
-	if result.Unit.Valid && result.Unit.Int64 > 0 {
-		stock = stock + result.Unit.Int64
-	}
-
-	// totalStock is initialized with currentStock
-	// and increased later while processing the children.
-	currentStock = float64(stock)
-	totalStock = float64(stock)
-
-	logger.Log.WithFields(logrus.Fields{
-		"p.ProductID":         p.ProductID,
-		"s.StoreLocationName": s.Storelocation.StoreLocationName,
-		"currentStock":        currentStock}).Debug("ComputeStockStorelocation")
-
-	// Getting the children store locations.
-	mu.Lock()
-	if storelocationChildren, err = db.GetStoreLocationChildren(int(s.Storelocation.StoreLocationID.Int64)); err != nil {
-		logger.Log.Error(err)
-		return 0
-	}
-	mu.Unlock()
-
-	for i := range storelocationChildren {
-
-		s.Storelocation.Children = append(s.Storelocation.Children, &storelocationChildren[i])
-
-		totalStock += db.computeStockStorelocationConsumable(p, &SyncStoreLocation{
-			Storelocation: &storelocationChildren[i],
-		}, mu)
-
-	}
-
-	s.mu.Lock()
-	(*s).Storelocation.Stocks = append((*s).Storelocation.Stocks, Stock{Total: totalStock, Current: currentStock})
-	s.mu.Unlock()
-
-	return currentStock
+// Kinds of store location stocks
+const (
+	stockUnit       = "unit"       // storages with a unit, in the reference unit
+	stockNoUnit     = "nounit"     // storages without unit
+	stockConsumable = "consumable" // number of consumable units
+)
 
+// storeLocationStock is the stock of a product in a store location
+// for a kind and, for the storages with a unit, a reference unit.
+// Current is the stock of the store location storages,
+// Total the stock of the store location and of all its descendants.
+type storeLocationStock struct {
+	StoreLocationID int64           `db:"storelocation_id"`
+	Kind            string          `db:"kind"`
+	UnitID          sql.NullInt64   `db:"unit_id"`
+	Current         sql.NullFloat64 `db:"current"`
+	Total           sql.NullFloat64 `db:"total"`
 }
 
-// computeStockStorelocation returns the quantity of product p in the store location s for the unit u.
-func (db *SQLiteDataStore) computeStockStorelocation(p Product, s *SyncStoreLocation, u Unit, mu *sync.Mutex) float64 {
+// storeLocationStocksQuery returns the stocks of the product (first parameter)
+// in each store location of the entities (second parameter).
+// The closure CTE pairs each store location with itself and all its descendants,
+// the current CTE contains the current stock of each store location,
+// computed as the former per store location queries.
+const storeLocationStocksQuery = `WITH RECURSIVE closure(ancestor, descendant) AS (
+	SELECT storelocation_id, storelocation_id FROM storelocation WHERE entity IN (?)
+	UNION ALL
+	SELECT closure.ancestor, storelocation.storelocation_id FROM closure
+	JOIN storelocation ON storelocation.storelocation = closure.descendant
+),
+product_storage AS (
+	SELECT storage.* FROM storage
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE
+	AND storage.product = ?
+),
+current(storelocation, kind, unit, quantity) AS (
+	SELECT product_storage.storelocation, 'unit', ref.unit_id, SUM(product_storage.storage_quantity * unit.unit_multiplier)
+	FROM product_storage
+	JOIN unit ON product_storage.unit_quantity = unit.unit_id
+	JOIN unit ref ON COALESCE(unit.unit, unit.unit_id) = ref.unit_id
+	WHERE product_storage.storage_quantity IS NOT NULL
+	AND ref.unit IS NULL AND ref.unit_type = 'quantity'
+	GROUP BY product_storage.storelocation, ref.unit_id
+	UNION ALL
+	SELECT product_storage.storelocation, 'nounit', NULL, SUM(product_storage.storage_quantity)
+	FROM product_storage
+	WHERE product_storage.storage_quantity IS NOT NULL
+	AND product_storage.unit_quantity IS NULL
+	GROUP BY product_storage.storelocation
+	UNION ALL
+	SELECT product_storage.storelocation, 'consumable', NULL,
+	MAX(COALESCE(SUM(product.product_number_per_bag * product_storage.storage_number_of_bag), 0), 0) +
+	MAX(COALESCE(SUM(product.product_number_per_carton * product_storage.storage_number_of_carton), 0), 0) +
+	MAX(COALESCE(SUM(product_storage.storage_number_of_unit), 0), 0)
+	FROM product_storage
+	JOIN product ON product_storage.product = product.product_id
+	GROUP BY product_storage.storelocation
+)
+SELECT closure.ancestor AS storelocation_id,
+current.kind AS kind,
+current.unit AS unit_id,
+SUM(CASE WHEN closure.descendant = closure.ancestor THEN current.quantity END) AS current,
+SUM(current.quantity) AS total
+FROM closure
+JOIN current ON current.storelocation = closure.descendant
+GROUP BY closure.ancestor, current.kind, current.unit`
+
+// getStoreLocationStocks returns the stocks of product p in the store locations
+// of the entities with ids "eids", by store location id.
+func (db *SQLiteDataStore) getStoreLocationStocks(p Product, eids []int) (map[int64][]storeLocationStock, error) {
 
 	var (
-		err                   error
-		currentStock          float64
-		totalStock            float64
-		storelocationChildren []StoreLocation
-		sqlr                  string
-		args                  []interface{}
-	)
-
-	dialect := goqu.Dialect("sqlite3")
-	t := goqu.T("storage")
-
-	// Getting the store location current stock.
-	sQuery := dialect.From(t).Join(
-		goqu.T("unit"),
-		goqu.On(goqu.Ex{"storage.unit_quantity": goqu.I("unit.unit_id")}),
-	).Where(
-		goqu.I("storage.storelocation").Eq(s.Storelocation.StoreLocationID.Int64),
-		goqu.I("storage.storage").IsNull(),
-		goqu.I("storage.storage_quantity").IsNotNull(),
-		goqu.I("storage.storage_archive").IsFalse(),
-		goqu.I("storage.product").Eq(p.ProductID),
-		goqu.Or(
-			goqu.I("storage.unit_quantity").Eq(u.UnitID.Int64),
-			goqu.I("storage.unit_quantity").In(dialect.From("unit").Select("unit_id").Where(goqu.I("unit.unit").Eq(u.UnitID.Int64))),
-		),
-	).Select(
-		goqu.SUM(goqu.L("storage.storage_quantity * unit_multiplier")),
+		err    error
+		sqlr   string
+		args   []interface{}
+		stocks []storeLocationStock
 	)
 
-	if sqlr, args, err = sQuery.ToSQL(); err != nil {
-		logger.Log.Error(err)
-		return 0
-	}
-
-	var nullableFloat64 sql.NullFloat64
-	mu.Lock()
-	if err = db.Get(&nullableFloat64, sqlr, args...); err != nil && err != sql.ErrNoRows {
-		logger.Log.Error(err)
-		return 0
-	}
-	mu.Unlock()
-
-	// totalStock is initialized with currentStock
-	// and increased later while processing the children.
-	if nullableFloat64.Valid {
-		currentStock = nullableFloat64.Float64
-		totalStock = nullableFloat64.Float64
+	if sqlr, args, err = sqlx.In(storeLocationStocksQuery, eids, p.ProductID); err != nil {
+		return nil, err
 	}
-
-	mu.Lock()
-	if storelocationChildren, err = db.GetStoreLocationChildren(int(s.Storelocation.StoreLocationID.Int64)); err != nil {
-		logger.Log.Error(err)
-		return 0
+	if err = db.Select(&stocks, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
 	}
-	mu.Unlock()
-
-	for i := range storelocationChildren {
-
-		s.Storelocation.Children = append(s.Storelocation.Children, &storelocationChildren[i])
-
-		totalStock += db.computeStockStorelocation(p, &SyncStoreLocation{
-			Storelocation: &storelocationChildren[i],
-		}, u, mu)
 
+	m := make(map[int64][]storeLocationStock)
+	for _, s := range stocks {
+		m[s.StoreLocationID] = append(m[s.StoreLocationID], s)
 	}
 
-	s.mu.Lock()
-	(*s).Storelocation.Stocks = append((*s).Storelocation.Stocks, Stock{Total: totalStock, Current: currentStock, Unit: u})
-	s.mu.Unlock()
-
-	return currentStock
+	return m, nil
 
 }
 
-// computeStockStorelocationNoUnit returns the quantity of product p with no unit in the store location s.
-func (db *SQLiteDataStore) computeStockStorelocationNoUnit(p Product, s *SyncStoreLocation, mu *sync.Mutex) float64 {
+// requestEntityIDs returns the ids of the entities the connected user can see.
+func (db *SQLiteDataStore) requestEntityIDs(r *http.Request) ([]int, error) {
 
 	var (
-		currentStock          float64
-		totalStock            float64
-		storelocationChildren []StoreLocation
-		err                   error
-		sqlr                  string
-		args                  []interface{}
-	)
-
-	dialect := goqu.Dialect("sqlite3")
-	t := goqu.T("storage")
-
-	// Getting the store location current stock.
-	sQuery := dialect.From(t).LeftJoin(
-		goqu.T("unit"),
-		goqu.On(goqu.Ex{"storage.unit_quantity": goqu.I("unit.unit_id")}),
-	).Where(
-		goqu.I("storage.storelocation").Eq(s.Storelocation.StoreLocationID.Int64),
-		goqu.I("storage.storage").IsNull(),
-		goqu.I("storage.storage_quantity").IsNotNull(),
-		goqu.I("storage.storage_archive").IsFalse(),
-		goqu.I("storage.product").Eq(p.ProductID),
-		goqu.I("storage.unit_quantity").IsNull(),
-	).Select(
-		goqu.SUM(goqu.I("storage.storage_quantity")),
+		err      error
+		entities []Entity
+		eids     []int
 	)
 
-	if sqlr, args, err = sQuery.ToSQL(); err != nil {
-		logger.Log.Error(err)
-		return 0
-	}
-
-	var nullableFloat64 sql.NullFloat64
-	mu.Lock()
-	if err = db.Get(&nullableFloat64, sqlr, args...); err != nil && err != sql.ErrNoRows {
-		logger.Log.Error(err)
-		return 0
-	}
-	mu.Unlock()
-
-	// totalStock is initialized with currentStock
-	// and increased later while processing the children.
-	if nullableFloat64.Valid {
-		currentStock = nullableFloat64.Float64
-		totalStock = nullableFloat64.Float64
-	}
-	logger.Log.WithFields(logrus.Fields{
-		"p.ProductID":         p.ProductID,
-		"s.StoreLocationName": s.Storelocation.StoreLocationName,
-		"currentStock":        currentStock}).Debug("ComputeStockStorelocation")
-
-	// Getting the children store locations.
-	mu.Lock()
-	if storelocationChildren, err = db.GetStoreLocationChildren(int(s.Storelocation.StoreLocationID.Int64)); err != nil {
-		logger.Log.Error(err)
-		return 0
+	h, _ := NewdbselectparamEntity(r, nil)
+	if entities, _, err = db.GetEntities(h); err != nil {
+		return nil, err
 	}
-	mu.Unlock()
-
-	for i := range storelocationChildren {
-
-		s.Storelocation.Children = append(s.Storelocation.Children, &storelocationChildren[i])
-
-		totalStock += db.computeStockStorelocationNoUnit(p, &SyncStoreLocation{
-			Storelocation: &storelocationChildren[i],
-		}, mu)
-
+	for _, e := range entities {
+		eids = append(eids, e.EntityID)
 	}
 
-	s.mu.Lock()
-	(*s).Storelocation.Stocks = append((*s).Storelocation.Stocks, Stock{Total: totalStock, Current: currentStock, Unit: Unit{}})
-	s.mu.Unlock()
-
-	return currentStock
+	return eids, nil
 
 }
 
 // ComputeStockEntity returns the root store locations of the entity(ies) of the loggued user.
-// Each store location has a Stocks []Stock field containing the stocks of the product p for each unit.
+// Each store location has a Stocks []Stock field containing the stocks of the product p for each unit,
+// followed by the stock of the storages without unit and the stock of consumables.
 func (db *SQLiteDataStore) ComputeStockEntity(p Product, r *http.Request) []StoreLocation {
 
 	var (
-		units              []Unit // reference units
-		syncstorelocations []SyncStoreLocation
-		entities           []Entity
-		eids               []int
-		err                error
-		sqlr               string
-		args               []interface{}
+		units          []Unit // reference units
+		storelocations []StoreLocation
+		stocks         map[int64][]storeLocationStock
+		eids           []int
+		err            error
+		sqlr           string
+		args           []interface{}
 	)
 
-	// Getting the entities (GetEntities returns only entities the connected user can see).
-	h, _ := NewdbselectparamEntity(r, nil)
-	if entities, _, err = db.GetEntities(h); err != nil {
+	if eids, err = db.requestEntityIDs(r); err != nil {
 		logger.Log.Error(err)
 		return []StoreLocation{}
 	}
-	for _, e := range entities {
-		eids = append(eids, e.EntityID)
+	if len(eids) == 0 {
+		return nil
 	}
 
 	dialect := goqu.Dialect("sqlite3")
@@ -303,6 +160,7 @@ func (db *SQLiteDataStore) ComputeStockEntity(p Product, r *http.Request) []Stor
 	).Select(
 		goqu.I("unit.unit_id"),
 		goqu.I("unit.unit_label"),
+		goqu.I("unit.unit_dimension"),
 	).ToSQL(); err != nil {
 		logger.Log.Error(err)
 		return []StoreLocation{}
@@ -313,72 +171,268 @@ func (db *SQLiteDataStore) ComputeStockEntity(p Product, r *http.Request) []Stor
 		return []StoreLocation{}
 	}
 
-	// Getting the root store locations.
-	t = goqu.T("storelocation")
-	sQuery := dialect.From(t).Where(
-		goqu.I("storelocation.storelocation").IsNull(),
-		goqu.I("storelocation.entity").In(eids),
-	).Select(
-		goqu.I("storelocation.storelocation_id"),
-		goqu.I("storelocation.storelocation_name"),
-		goqu.I("storelocation.storelocation_color"),
+	// Getting the root store locations and their descendants,
+	// parents before children.
+	sqlr = `WITH RECURSIVE tree(storelocation_id, depth) AS (
+		SELECT storelocation_id, 0 FROM storelocation
+		WHERE storelocation IS NULL AND entity IN (?)
+		UNION ALL
+		SELECT storelocation.storelocation_id, tree.depth + 1 FROM tree
+		JOIN storelocation ON storelocation.storelocation = tree.storelocation_id
 	)
-
-	if sqlr, args, err = sQuery.ToSQL(); err != nil {
+	SELECT s.storelocation_id,
+	s.storelocation_name,
+	s.storelocation_canstore,
+	s.storelocation_color,
+	s.storelocation_fullpath,
+	s.storelocation_barecodeprefix,
+	storelocation.storelocation_id AS "storelocation.storelocation_id",
+	storelocation.storelocation_name AS "storelocation.storelocation_name",
+	entity.entity_id AS "entity.entity_id",
+	entity.entity_name AS "entity.entity_name"
+	FROM tree
+	JOIN storelocation s ON tree.storelocation_id = s.storelocation_id
+	JOIN entity ON s.entity = entity.entity_id
+	LEFT JOIN storelocation ON s.storelocation = storelocation.storelocation_id
+	ORDER BY tree.depth, s.storelocation_id`
+	if sqlr, args, err = sqlx.In(sqlr, eids); err != nil {
+		logger.Log.Error(err)
+		return []StoreLocation{}
+	}
+	if err = db.Select(&storelocations, db.Rebind(sqlr), args...); err != nil {
 		logger.Log.Error(err)
 		return []StoreLocation{}
 	}
 
-	var rootStoreLocations []StoreLocation
-	if err = db.Select(&rootStoreLocations, sqlr, args...); err != nil {
+	// Getting the stocks.
+	if stocks, err = db.getStoreLocationStocks(p, eids); err != nil {
 		logger.Log.Error(err)
 		return []StoreLocation{}
 	}
 
-	for i := range rootStoreLocations {
-		syncstorelocations = append(syncstorelocations, SyncStoreLocation{
-			Storelocation: &rootStoreLocations[i],
-		})
+	// Building the store locations trees.
+	var (
+		roots []*StoreLocation
+		byID  = make(map[int64]*StoreLocation)
+	)
+	for i := range storelocations {
+		s := &storelocations[i]
+
+		// one stock per reference unit, then without unit and consumables,
+		// zero stocks included
+		type key struct {
+			kind string
+			unit int64
+		}
+		found := make(map[key]storeLocationStock)
+		for _, st := range stocks[s.StoreLocationID.Int64] {
+			found[key{st.Kind, st.UnitID.Int64}] = st
+		}
+		for _, u := range units {
+			st := found[key{stockUnit, u.UnitID.Int64}]
+			s.Stocks = append(s.Stocks, Stock{Total: st.Total.Float64, Current: st.Current.Float64, Unit: u})
+		}
+		st := found[key{stockNoUnit, 0}]
+		s.Stocks = append(s.Stocks, Stock{Total: st.Total.Float64, Current: st.Current.Float64, Unit: Unit{}})
+		st = found[key{stockConsumable, 0}]
+		s.Stocks = append(s.Stocks, Stock{Total: st.Total.Float64, Current: st.Current.Float64})
+
+		logger.Log.WithFields(logrus.Fields{
+			"p.ProductID":         p.ProductID,
+			"s.StoreLocationName": s.StoreLocationName,
+			"s.Stocks":            s.Stocks}).Debug("ComputeStockEntity")
+
+		byID[s.StoreLocationID.Int64] = s
+		if s.StoreLocation == nil || !s.StoreLocation.StoreLocationID.Valid {
+			roots = append(roots, s)
+			continue
+		}
+		if parent, ok := byID[s.StoreLocation.StoreLocationID.Int64]; ok {
+			parent.Children = append(parent.Children, s)
+		}
+	}
+
+	var result []StoreLocation
+	for _, s := range roots {
+		result = append(result, *s)
 	}
 
+	return result
+
+}
+
+// computeStockEntityTotal returns the total stock of product p in the entity with id "entityID".
+// If the reference unit u is valid, the stock is the quantity of the storages with a unit,
+// expressed in u. The stocks of the other dimensions are converted with the density
+// and molar mass of p, the reason why a stock could not be converted is returned
+// and this stock is then ignored.
+// Otherwise the stock is the number of items, that is the number of consumables
+// units and the quantity of the storages without unit.
+func (db *SQLiteDataStore) computeStockEntityTotal(p Product, entityID int, u Unit) (total float64, notConvertible string, err error) {
+
 	var (
-		wg sync.WaitGroup
+		rootIDs []int64
+		units   []Unit // reference units
+		stocks  map[int64][]storeLocationStock
 	)
-	mu := &sync.Mutex{}
-	// Computing stocks for storages with units.
-	for i := range syncstorelocations {
-		for j := range units {
-			wg.Add(1)
-			go func(u Unit, sl *SyncStoreLocation) {
-				db.computeStockStorelocation(p, sl, u, mu)
-				wg.Done()
-			}(units[j], &syncstorelocations[i])
+
+	sqlr := `SELECT storelocation_id FROM storelocation
+	WHERE storelocation IS NULL AND entity = ?`
+	if err = db.Select(&rootIDs, sqlr, entityID); err != nil {
+		return 0, "", err
+	}
+
+	sqlr = `SELECT unit_id, unit_dimension FROM unit
+	WHERE unit IS NULL AND unit_type = 'quantity'`
+	if err = db.Select(&units, sqlr); err != nil {
+		return 0, "", err
+	}
+	dimensions := make(map[int64]string)
+	for _, unit := range units {
+		dimensions[unit.UnitID.Int64] = unit.UnitDimension.String
+	}
+
+	if stocks, err = db.getStoreLocationStocks(p, []int{entityID}); err != nil {
+		return 0, "", err
+	}
+
+	for _, id := range rootIDs {
+		for _, s := range stocks[id] {
+			switch {
+			case u.UnitID.Valid && s.Kind == stockUnit && s.UnitID.Int64 == u.UnitID.Int64,
+				!u.UnitID.Valid && (s.Kind == stockNoUnit || s.Kind == stockConsumable):
+				total += s.Total.Float64
+			case u.UnitID.Valid && s.Kind == stockUnit && s.Total.Float64 != 0:
+				c := p.ConvertReferenceQuantity(s.Total.Float64, dimensions[s.UnitID.Int64], u.UnitDimension.String)
+				if !c.Convertible {
+					notConvertible = c.Reason
+					continue
+				}
+				total += c.Quantity
+			}
+		}
+	}
+
+	return total, notConvertible, nil
+
+}
+
+// ComputeStockTotals returns the stock of product p in the entity(ies) of the loggued user,
+// normalised per unit dimension: the quantities of the storages are converted
+// into the reference unit of their unit and summed per dimension.
+// The whole stock is also expressed in mass, volume and moles
+// with the density and molar mass of p.
+func (db *SQLiteDataStore) ComputeStockTotals(p Product, r *http.Request) (StockTotals, error) {
+
+	logger.Log.WithFields(logrus.Fields{"p.ProductID": p.ProductID}).Debug("ComputeStockTotals")
+
+	var (
+		err    error
+		sqlr   string
+		args   []interface{}
+		eids   []int
+		totals = StockTotals{Product: p, Totals: []StockTotal{}, Converted: []ConvertedQuantity{}}
+		rows   []struct {
+			UnitID            sql.NullInt64   `db:"unit_id"`
+			UnitLabel         sql.NullString  `db:"unit_label"`
+			RefID             sql.NullInt64   `db:"ref_id"`
+			RefLabel          sql.NullString  `db:"ref_label"`
+			Dimension         sql.NullString  `db:"unit_dimension"`
+			StorageCount      int             `db:"storagecount"`
+			UnquantifiedCount int             `db:"unquantifiedcount"`
+			Quantity          sql.NullFloat64 `db:"quantity"`
+			Total             sql.NullFloat64 `db:"total"`
 		}
+	)
+
+	if eids, err = db.requestEntityIDs(r); err != nil {
+		return StockTotals{}, err
 	}
-	// Computing stocks for storages without units.
-	for i := range syncstorelocations {
-		wg.Add(1)
-		go func(sl *SyncStoreLocation) {
-			db.computeStockStorelocationNoUnit(p, sl, mu)
-			wg.Done()
-		}(&syncstorelocations[i])
+	if len(eids) == 0 {
+		return totals, nil
+	}
+
+	// one row per storage unit, null for the storages without unit
+	sqlr = `SELECT unit.unit_id,
+	unit.unit_label,
+	ref.unit_id AS ref_id,
+	ref.unit_label AS ref_label,
+	ref.unit_dimension,
+	COUNT(storage.storage_quantity) AS storagecount,
+	COUNT(*) - COUNT(storage.storage_quantity) AS unquantifiedcount,
+	SUM(storage.storage_quantity) AS quantity,
+	SUM(storage.storage_quantity * COALESCE(unit.unit_multiplier, 1)) AS total
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	LEFT JOIN unit ON storage.unit_quantity = unit.unit_id
+	LEFT JOIN unit ref ON COALESCE(unit.unit, unit.unit_id) = ref.unit_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE
+	AND storage.product = ?
+	AND storelocation.entity IN (?)
+	GROUP BY storage.unit_quantity
+	ORDER BY ref.unit_dimension, ref.unit_id, unit.unit_multiplier DESC`
+	if sqlr, args, err = sqlx.In(sqlr, p.ProductID, eids); err != nil {
+		return StockTotals{}, err
 	}
-	// Computing stocks for consumables storages.
-	for i := range syncstorelocations {
-		wg.Add(1)
-		go func(sl *SyncStoreLocation) {
-			db.computeStockStorelocationConsumable(p, sl, mu)
-			wg.Done()
-		}(&syncstorelocations[i])
+	if err = db.Select(&rows, db.Rebind(sqlr), args...); err != nil {
+		return StockTotals{}, err
 	}
 
-	wg.Wait()
+	// totals index by dimension, or by reference unit
+	// for the units without dimension
+	index := make(map[string]int)
+	for _, row := range rows {
+		totals.StockTotalUnquantifiedCount += row.UnquantifiedCount
+		if row.StorageCount == 0 {
+			continue
+		}
 
-	var result []StoreLocation
-	for i := range syncstorelocations {
-		result = append(result, *syncstorelocations[i].Storelocation)
+		item := StockTotalItem{
+			StockTotalItemUnit:         Unit{UnitID: row.UnitID, UnitLabel: row.UnitLabel, UnitDimension: row.Dimension},
+			StockTotalItemStorageCount: row.StorageCount,
+			StockTotalItemQuantity:     row.Quantity.Float64,
+			StockTotalItemTotal:        row.Total.Float64,
+		}
+
+		if !row.UnitID.Valid {
+			totals.NoUnit = item
+			continue
+		}
+
+		key := row.Dimension.String
+		if !row.Dimension.Valid {
+			key = row.RefLabel.String
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(totals.Totals)
+			index[key] = i
+			totals.Totals = append(totals.Totals, StockTotal{
+				StockTotalDimension: row.Dimension.String,
+				StockTotalUnit:      Unit{UnitID: row.RefID, UnitLabel: row.RefLabel, UnitDimension: row.Dimension},
+				Breakdown:           []StockTotalItem{},
+			})
+		}
+		totals.Totals[i].StockTotalTotal += item.StockTotalItemTotal
+		totals.Totals[i].Breakdown = append(totals.Totals[i].Breakdown, item)
 	}
 
-	return result
+	// the whole stock in each convertible dimension,
+	// not convertible if one of the totals is not
+	for _, d := range []string{UnitDimensionMass, UnitDimensionVolume, UnitDimensionMoles} {
+		c := p.ConvertReferenceQuantity(0, d, d)
+		for _, t := range totals.Totals {
+			ct := p.ConvertReferenceQuantity(t.StockTotalTotal, t.StockTotalDimension, d)
+			if !ct.Convertible {
+				c = ct
+				break
+			}
+			c.Quantity += ct.Quantity
+		}
+		totals.Converted = append(totals.Converted, c)
+	}
+
+	return totals, nil
 
 }
@@ -0,0 +1,248 @@
+package datastores
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// seedStockEntity creates a database with a product stored in an entity
+// of "roots" root store locations with "children" children each down to "depth" levels,
+// and "storages" storages spread over all the store locations.
+// The storages are in turn stored with a reference unit, without unit and as consumables.
+func seedStockEntity(tb testing.TB, roots, children, depth, storages int) *SQLiteDataStore {
+
+	var (
+		err error
+		db  *SQLiteDataStore
+	)
+
+	if db, err = NewSQLiteDBstore(filepath.Join(tb.TempDir(), "storage.db")); err != nil {
+		tb.Fatal(err)
+	}
+	if err = db.CreateDatabase(); err != nil {
+		tb.Fatal(err)
+	}
+
+	tx := db.MustBegin()
+	tx.MustExec(`INSERT INTO name(name_label) VALUES ('water')`)
+	tx.MustExec(`INSERT INTO empiricalformula(empiricalformula_label) VALUES ('H2O')`)
+	tx.MustExec(`INSERT INTO product(person, empiricalformula, name, product_number_per_bag, product_number_per_carton) VALUES (1, 1, 1, 5, 10)`)
+
+	var (
+		level          []int64
+		storelocations []int64
+	)
+	for i := 0; i < roots; i++ {
+		res := tx.MustExec(`INSERT INTO storelocation(storelocation_name, storelocation_fullpath, storelocation_canstore, entity) VALUES ('root', 'root', true, 1)`)
+		id, _ := res.LastInsertId()
+		level = append(level, id)
+	}
+	storelocations = append(storelocations, level...)
+	for d := 1; d < depth; d++ {
+		var next []int64
+		for _, parent := range level {
+			for i := 0; i < children; i++ {
+				res := tx.MustExec(`INSERT INTO storelocation(storelocation_name, storelocation_fullpath, storelocation_canstore, entity, storelocation) VALUES ('child', 'child', true, 1, ?)`, parent)
+				id, _ := res.LastInsertId()
+				next = append(next, id)
+			}
+		}
+		level = next
+		storelocations = append(storelocations, level...)
+	}
+
+	var units []int64
+	if err = tx.Select(&units, `SELECT unit_id FROM unit WHERE unit IS NULL AND unit_type = 'quantity'`); err != nil {
+		tb.Fatal(err)
+	}
+	for i := 0; i < storages; i++ {
+		s := storelocations[i%len(storelocations)]
+		switch i % 3 {
+		case 0:
+			tx.MustExec(`INSERT INTO storage(storage_creationdate, storage_modificationdate, storage_quantity, unit_quantity, person, product, storelocation)
+			VALUES (datetime('now'), datetime('now'), ?, ?, 1, 1, ?)`, 1+i%7, units[(i/3)%len(units)], s)
+		case 1:
+			tx.MustExec(`INSERT INTO storage(storage_creationdate, storage_modificationdate, storage_quantity, person, product, storelocation)
+			VALUES (datetime('now'), datetime('now'), ?, 1, 1, ?)`, 1+i%5, s)
+		case 2:
+			tx.MustExec(`INSERT INTO storage(storage_creationdate, storage_modificationdate, storage_number_of_bag, storage_number_of_carton, storage_number_of_unit, person, product, storelocation)
+			VALUES (datetime('now'), datetime('now'), 1, ?, 2, 1, 1, ?)`, i%2, s)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		tb.Fatal(err)
+	}
+
+	return db
+
+}
+
+// stockRequest returns a request of the admin.
+func stockRequest() *http.Request {
+
+	r := httptest.NewRequest("GET", "/stocks/1", nil)
+	return r.WithContext(context.WithValue(r.Context(), ChimithequeContextKey("container"), ViewContainer{PersonID: 1}))
+
+}
+
+func BenchmarkComputeStockEntity(b *testing.B) {
+
+	db := seedStockEntity(b, 10, 4, 4, 5000)
+	defer db.Close()
+
+	r := stockRequest()
+	p := Product{ProductID: 1}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if s := db.ComputeStockEntity(p, r); len(s) == 0 {
+			b.Fatal("no store location stock")
+		}
+	}
+
+}
+
+func BenchmarkComputeStockEntityLegacy(b *testing.B) {
+
+	db := seedStockEntity(b, 10, 4, 4, 5000)
+	defer db.Close()
+
+	r := stockRequest()
+	p := Product{ProductID: 1}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if s := db.legacyComputeStockEntity(p, r); len(s) == 0 {
+			b.Fatal("no store location stock")
+		}
+	}
+
+}
+
+// legacyStocks returns the stocks of product p in the store locations of the roots trees,
+// computed by the former implementation, one stock per reference unit,
+// then without unit and consumables as ComputeStockEntity does.
+// The former ComputeStockEntity mixes the stocks of all the kinds in the same children
+// so the per kind functions are called with distinct trees.
+func legacyStocks(db *SQLiteDataStore, p Product, roots []StoreLocation, units []Unit) map[int64][]Stock {
+
+	var (
+		mu     = &sync.Mutex{}
+		stocks = make(map[int64][]Stock)
+		walk   func(s *StoreLocation)
+	)
+
+	walk = func(s *StoreLocation) {
+		stocks[s.StoreLocationID.Int64] = append(stocks[s.StoreLocationID.Int64], s.Stocks...)
+		for _, c := range s.Children {
+			walk(c)
+		}
+	}
+
+	compute := func(f func(s *legacySyncStoreLocation)) {
+		for _, root := range roots {
+			s := &legacySyncStoreLocation{Storelocation: &StoreLocation{StoreLocationID: root.StoreLocationID}}
+			f(s)
+			walk(s.Storelocation)
+		}
+	}
+
+	for _, u := range units {
+		compute(func(s *legacySyncStoreLocation) { db.legacyComputeStockStorelocation(p, s, u, mu) })
+	}
+	compute(func(s *legacySyncStoreLocation) { db.legacyComputeStockStorelocationNoUnit(p, s, mu) })
+	compute(func(s *legacySyncStoreLocation) { db.legacyComputeStockStorelocationConsumable(p, s, mu) })
+
+	return stocks
+
+}
+
+func TestComputeStockEntityLegacy(t *testing.T) {
+
+	p := Product{ProductID: 1}
+
+	tests := []struct {
+		name     string
+		children int
+		depth    int
+	}{
+		{"flat", 4, 1},
+		{"two levels", 4, 2},
+		{"four levels", 3, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			db := seedStockEntity(t, 3, test.children, test.depth, 600)
+			defer db.Close()
+
+			var units []Unit
+			if err := db.Select(&units, `SELECT unit_id, unit_label, unit_dimension FROM unit WHERE unit IS NULL AND unit_type = 'quantity'`); err != nil {
+				t.Fatal(err)
+			}
+
+			roots := db.ComputeStockEntity(p, stockRequest())
+			if len(roots) != 3 {
+				t.Fatalf("expected 3 root store locations, got %d", len(roots))
+			}
+			legacy := legacyStocks(db, p, roots, units)
+
+			// current returns the sum of the legacy current stocks of kind k in the tree of s.
+			var current func(s *StoreLocation, k int) float64
+			current = func(s *StoreLocation, k int) float64 {
+				c := legacy[s.StoreLocationID.Int64][k].Current
+				for _, child := range s.Children {
+					c += current(child, k)
+				}
+				return c
+			}
+
+			var check func(s *StoreLocation)
+			check = func(s *StoreLocation) {
+
+				id := s.StoreLocationID.Int64
+				if len(s.Stocks) != len(units)+2 || len(legacy[id]) != len(units)+2 {
+					t.Fatalf("store location %d: expected %d stocks, got %d and legacy %d", id, len(units)+2, len(s.Stocks), len(legacy[id]))
+				}
+
+				// The former implementation only adds the direct children
+				// current stocks to the totals, the totals are then only
+				// comparable for the store locations with leaves children.
+				leavesChildren := true
+				for _, child := range s.Children {
+					leavesChildren = leavesChildren && len(child.Children) == 0
+				}
+
+				for k := range s.Stocks {
+					if s.Stocks[k].Current != legacy[id][k].Current {
+						t.Errorf("store location %d stock %d: current %f, legacy %f", id, k, s.Stocks[k].Current, legacy[id][k].Current)
+					}
+					if leavesChildren && s.Stocks[k].Total != legacy[id][k].Total {
+						t.Errorf("store location %d stock %d: total %f, legacy %f", id, k, s.Stocks[k].Total, legacy[id][k].Total)
+					}
+					if c := current(s, k); s.Stocks[k].Total != c {
+						t.Errorf("store location %d stock %d: total %f, legacy sum of currents %f", id, k, s.Stocks[k].Total, c)
+					}
+				}
+
+				for _, child := range s.Children {
+					check(child)
+				}
+
+			}
+
+			for i := range roots {
+				check(&roots[i])
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,211 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// ErrStockTrendPeriod is returned for an unknown stock trend period
+var ErrStockTrendPeriod = errors.New("unknown stock trend period")
+
+// stockTrendPeriods are the stock trend periods strftime formats
+var stockTrendPeriods = map[string]string{
+	StockTrendByDay:   "%Y-%m-%d",
+	StockTrendByMonth: "%Y-%m",
+	StockTrendByYear:  "%Y",
+}
+
+// SnapshotStocks stores the stock of each product in each store location
+// as the snapshot of the day d, replacing the snapshot of the day if any.
+// The stocks are the quantities of the storages per reference unit,
+// and of the storages without unit.
+// It returns the number of snapshot rows.
+func (db *SQLiteDataStore) SnapshotStocks(d time.Time) (count int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"d": d}).Debug("SnapshotStocks")
+
+	var (
+		tx   *sqlx.Tx
+		res  sql.Result
+		date = d.Format("2006-01-02")
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				logger.Log.Error(errr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.Exec(`DELETE FROM stocksnapshot WHERE stocksnapshot_date = ?`, date); err != nil {
+		return 0, err
+	}
+
+	sqlr := `INSERT INTO stocksnapshot (stocksnapshot_date, stocksnapshot_quantity, stocksnapshot_storagecount, entity, storelocation, product, unit)
+	SELECT ?,
+	COALESCE(SUM(storage.storage_quantity * COALESCE(unit.unit_multiplier, 1)), 0),
+	COUNT(*),
+	storelocation.entity,
+	storage.storelocation,
+	storage.product,
+	ref.unit_id
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	LEFT JOIN unit ON storage.unit_quantity = unit.unit_id
+	LEFT JOIN unit ref ON COALESCE(unit.unit, unit.unit_id) = ref.unit_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE
+	GROUP BY storage.storelocation, storage.product, ref.unit_id`
+	if res, err = tx.Exec(sqlr, date); err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+
+}
+
+// GetStockTrends returns the stock history of the product of f, one trend
+// per reference unit, followed by the trend of the storages without unit.
+// Each trend has a point per period containing at least one snapshot,
+// the stock of a period being the one of its last snapshot.
+func (db *SQLiteDataStore) GetStockTrends(f StockTrendFilter) ([]StockTrend, error) {
+
+	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetStockTrends")
+
+	var (
+		err     error
+		sqlr    string
+		args    []interface{}
+		periods []struct {
+			Period string `db:"period"`
+			Date   string `db:"date"`
+		}
+		rows []struct {
+			Period       string         `db:"period"`
+			UnitID       sql.NullInt64  `db:"unit_id"`
+			UnitLabel    sql.NullString `db:"unit_label"`
+			Dimension    sql.NullString `db:"unit_dimension"`
+			Quantity     float64        `db:"quantity"`
+			StorageCount int            `db:"storagecount"`
+		}
+		dateWhere, where strings.Builder
+		dateArgs         []interface{}
+	)
+
+	format, ok := stockTrendPeriods[f.Period]
+	if !ok {
+		return nil, ErrStockTrendPeriod
+	}
+
+	dateWhere.WriteString("1")
+	if f.From != "" {
+		dateWhere.WriteString(" AND stocksnapshot_date >= ?")
+		dateArgs = append(dateArgs, f.From)
+	}
+	if f.To != "" {
+		dateWhere.WriteString(" AND stocksnapshot_date <= ?")
+		dateArgs = append(dateArgs, f.To)
+	}
+
+	// the last snapshot of each period
+	dates := fmt.Sprintf(`dates(period, date) AS (
+		SELECT strftime(?, stocksnapshot_date), MAX(stocksnapshot_date) FROM stocksnapshot
+		WHERE %s
+		GROUP BY 1
+	)`, dateWhere.String())
+
+	sqlr = `WITH ` + dates + ` SELECT period, date FROM dates ORDER BY period`
+	if err = db.Select(&periods, sqlr, append([]interface{}{format}, dateArgs...)...); err != nil {
+		return nil, err
+	}
+	if len(periods) == 0 {
+		return []StockTrend{}, nil
+	}
+
+	args = append([]interface{}{f.StoreLocation, format}, dateArgs...)
+	where.WriteString("stocksnapshot.product = ?")
+	args = append(args, f.Product)
+	if f.Entities != nil {
+		if len(f.Entities) == 0 {
+			return []StockTrend{}, nil
+		}
+		where.WriteString(" AND stocksnapshot.entity IN (?)")
+		args = append(args, f.Entities)
+	}
+	if f.StoreLocation != -1 {
+		where.WriteString(" AND stocksnapshot.storelocation IN (SELECT storelocation_id FROM closure)")
+	}
+
+	sqlr = fmt.Sprintf(`WITH RECURSIVE closure(storelocation_id) AS (
+		SELECT storelocation_id FROM storelocation WHERE storelocation_id = ?
+		UNION ALL
+		SELECT storelocation.storelocation_id FROM closure
+		JOIN storelocation ON storelocation.storelocation = closure.storelocation_id
+	),
+	%s
+	SELECT dates.period,
+	stocksnapshot.unit AS unit_id,
+	unit.unit_label,
+	unit.unit_dimension,
+	SUM(stocksnapshot.stocksnapshot_quantity) AS quantity,
+	SUM(stocksnapshot.stocksnapshot_storagecount) AS storagecount
+	FROM dates
+	JOIN stocksnapshot ON stocksnapshot.stocksnapshot_date = dates.date
+	LEFT JOIN unit ON stocksnapshot.unit = unit.unit_id
+	WHERE %s
+	GROUP BY dates.period, stocksnapshot.unit
+	ORDER BY stocksnapshot.unit IS NULL, stocksnapshot.unit, dates.period`, dates, where.String())
+
+	if sqlr, args, err = sqlx.In(sqlr, args...); err != nil {
+		return nil, err
+	}
+	if err = db.Select(&rows, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
+	}
+
+	// one point per period for each unit,
+	// zero for the periods without stock
+	var (
+		trends = []StockTrend{}
+		index  = make(map[int64]int)
+		points = make(map[int64]map[string]StockTrendPoint)
+	)
+	for _, row := range rows {
+		if _, ok := index[row.UnitID.Int64]; !ok {
+			index[row.UnitID.Int64] = len(trends)
+			points[row.UnitID.Int64] = make(map[string]StockTrendPoint)
+			trends = append(trends, StockTrend{
+				Unit: Unit{UnitID: row.UnitID, UnitLabel: row.UnitLabel, UnitDimension: row.Dimension},
+			})
+		}
+		points[row.UnitID.Int64][row.Period] = StockTrendPoint{
+			StockTrendPointQuantity:     row.Quantity,
+			StockTrendPointStorageCount: row.StorageCount,
+		}
+	}
+	for id, i := range index {
+		for _, p := range periods {
+			point := points[id][p.Period]
+			point.StockTrendPointPeriod = p.Period
+			point.StockTrendPointDate = p.Date
+			trends[i].Points = append(trends[i].Points, point)
+		}
+	}
+
+	return trends, nil
+
+}
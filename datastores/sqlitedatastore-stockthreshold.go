@@ -0,0 +1,263 @@
+package datastores
+
+import (
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// stockThresholdSelect returns the stock thresholds select clause
+func stockThresholdSelect() *goqu.SelectDataset {
+
+	dialect := goqu.Dialect("sqlite3")
+	tableStockThreshold := goqu.T("stockthreshold")
+
+	return dialect.From(tableStockThreshold).Join(
+		goqu.T("entity"),
+		goqu.On(goqu.Ex{"stockthreshold.entity": goqu.I("entity.entity_id")}),
+	).Join(
+		goqu.T("product"),
+		goqu.On(goqu.Ex{"stockthreshold.product": goqu.I("product.product_id")}),
+	).Join(
+		goqu.T("name"),
+		goqu.On(goqu.Ex{"product.name": goqu.I("name.name_id")}),
+	).LeftJoin(
+		goqu.T("empiricalformula"),
+		goqu.On(goqu.Ex{"product.empiricalformula": goqu.I("empiricalformula.empiricalformula_id")}),
+	).LeftJoin(
+		goqu.T("unit"),
+		goqu.On(goqu.Ex{"stockthreshold.unit_quantity": goqu.I("unit.unit_id")}),
+	)
+
+}
+
+// stockThresholdColumns are the columns of the stock thresholds select clause
+var stockThresholdColumns = []interface{}{
+	goqu.I("stockthreshold.stockthreshold_id"),
+	goqu.I("stockthreshold.stockthreshold_quantity"),
+	goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
+	goqu.I("entity.entity_name").As(goqu.C("entity.entity_name")),
+	goqu.I("product.product_id").As(goqu.C("product.product_id")),
+	goqu.I("name.name_label").As(goqu.C("product.name.name_label")),
+	goqu.I("product.product_density").As(goqu.C("product.product_density")),
+	goqu.I("product.product_molarmass").As(goqu.C("product.product_molarmass")),
+	goqu.I("empiricalformula.empiricalformula_label").As(goqu.C("product.empiricalformula.empiricalformula_label")),
+	goqu.I("unit.unit_id").As(goqu.C("unit_quantity.unit_id")),
+	goqu.I("unit.unit_label").As(goqu.C("unit_quantity.unit_label")),
+}
+
+// GetStockThresholds returns the stock thresholds matching p
+// of the entities of the logged person.
+func (db *SQLiteDataStore) GetStockThresholds(p DbselectparamStockThreshold) ([]StockThreshold, int, error) {
+
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("GetStockThresholds")
+
+	var err error
+
+	// Build orderby/order clause.
+	orderClause := goqu.I(p.GetOrderBy()).Asc()
+	if strings.ToLower(p.GetOrder()) == "desc" {
+		orderClause = goqu.I(p.GetOrderBy()).Desc()
+	}
+
+	// Build join clause.
+	joinClause := stockThresholdSelect().Join(
+		goqu.T("permission").As("perm"),
+		goqu.On(
+			goqu.Ex{
+				"perm.person":               p.GetLoggedPersonID(),
+				"perm.permission_item_name": []string{"all", "storages"},
+				"perm.permission_perm_name": []string{"r", "w", "all"},
+				"perm.permission_entity_id": []interface{}{-1, goqu.I("entity.entity_id")},
+			},
+		),
+	)
+
+	// Build where AND expression.
+	whereAnd := []goqu.Expression{
+		goqu.I("name.name_label").Like(p.GetSearch()),
+	}
+	if p.GetEntity() != -1 {
+		whereAnd = append(whereAnd, goqu.I("stockthreshold.entity").Eq(p.GetEntity()))
+	}
+	if p.GetProduct() != -1 {
+		whereAnd = append(whereAnd, goqu.I("stockthreshold.product").Eq(p.GetProduct()))
+	}
+
+	joinClause = joinClause.Where(goqu.And(whereAnd...))
+
+	// Building final count.
+	var (
+		countSql  string
+		countArgs []interface{}
+	)
+	if countSql, countArgs, err = joinClause.Select(
+		goqu.COUNT(goqu.I("stockthreshold.stockthreshold_id").Distinct()),
+	).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	// Building final select.
+	var (
+		selectSql  string
+		selectArgs []interface{}
+	)
+	if selectSql, selectArgs, err = joinClause.Select(
+		stockThresholdColumns...,
+	).GroupBy(goqu.I("stockthreshold.stockthreshold_id")).Order(orderClause).Limit(uint(p.GetLimit())).Offset(uint(p.GetOffset())).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		thresholds []StockThreshold
+		count      int
+	)
+
+	if err = db.Select(&thresholds, selectSql, selectArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	if err = db.Get(&count, countSql, countArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	return thresholds, count, nil
+
+}
+
+// GetStockThreshold returns the stock threshold with id "id".
+func (db *SQLiteDataStore) GetStockThreshold(id int) (StockThreshold, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetStockThreshold")
+
+	var (
+		err       error
+		sqlr      string
+		args      []interface{}
+		threshold StockThreshold
+	)
+
+	if sqlr, args, err = stockThresholdSelect().Where(
+		goqu.I("stockthreshold.stockthreshold_id").Eq(id),
+	).Select(
+		stockThresholdColumns...,
+	).ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return StockThreshold{}, err
+	}
+
+	if err = db.Get(&threshold, sqlr, args...); err != nil {
+		return StockThreshold{}, err
+	}
+
+	return threshold, nil
+
+}
+
+// SetStockThreshold inserts the stock threshold t, or updates it
+// if the entity already has a threshold for the product.
+// It returns the threshold id.
+func (db *SQLiteDataStore) SetStockThreshold(t StockThreshold) (id int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"t": t}).Debug("SetStockThreshold")
+
+	var unitID interface{}
+	if t.UnitQuantity.UnitID.Valid {
+		unitID = t.UnitQuantity.UnitID.Int64
+	}
+
+	sqlr := `INSERT INTO stockthreshold (stockthreshold_quantity, entity, product, unit_quantity) VALUES (?, ?, ?, ?)
+	ON CONFLICT(entity, product) DO UPDATE SET stockthreshold_quantity = excluded.stockthreshold_quantity, unit_quantity = excluded.unit_quantity`
+	if _, err = db.Exec(sqlr, t.StockThresholdQuantity, t.EntityID, t.Product.ProductID, unitID); err != nil {
+		return 0, err
+	}
+
+	sqlr = `SELECT stockthreshold_id FROM stockthreshold WHERE entity = ? AND product = ?`
+	if err = db.Get(&id, sqlr, t.EntityID, t.Product.ProductID); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+
+}
+
+// DeleteStockThreshold deletes the stock threshold with id "id".
+func (db *SQLiteDataStore) DeleteStockThreshold(id int) error {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteStockThreshold")
+
+	var err error
+
+	sqlr := `DELETE FROM stockthreshold WHERE stockthreshold_id = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// GetStockThresholdAlerts returns the stock thresholds of the entity with id "entityID",
+// or of all the entities if "entityID" is -1, whose product stock is below the threshold.
+// The StockThresholdStock field contains the current stock in the threshold unit,
+// including the stocks of the other dimensions that could be converted.
+func (db *SQLiteDataStore) GetStockThresholdAlerts(entityID int) ([]StockThreshold, error) {
+
+	logger.Log.WithFields(logrus.Fields{"entityID": entityID}).Debug("GetStockThresholdAlerts")
+
+	var (
+		err        error
+		sqlr       string
+		args       []interface{}
+		thresholds []StockThreshold
+		alerts     []StockThreshold
+	)
+
+	q := stockThresholdSelect()
+	if entityID != -1 {
+		q = q.Where(goqu.I("stockthreshold.entity").Eq(entityID))
+	}
+	if sqlr, args, err = q.Select(
+		stockThresholdColumns...,
+	).Order(goqu.I("entity.entity_name").Asc(), goqu.I("name.name_label").Asc()).ToSQL(); err != nil {
+		return nil, err
+	}
+	if err = db.Select(&thresholds, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	for _, t := range thresholds {
+		var (
+			reference  Unit
+			multiplier float64 = 1
+			stock      float64
+		)
+
+		// the stock is computed in the reference unit
+		// of the threshold unit
+		if t.UnitQuantity.UnitID.Valid {
+			sqlr = `SELECT ref.unit_id, ref.unit_dimension, unit.unit_multiplier FROM unit
+			JOIN unit ref ON COALESCE(unit.unit, unit.unit_id) = ref.unit_id
+			WHERE unit.unit_id = ?`
+			if err = db.QueryRowx(sqlr, t.UnitQuantity.UnitID.Int64).Scan(&reference.UnitID, &reference.UnitDimension, &multiplier); err != nil {
+				return nil, err
+			}
+		}
+
+		if stock, t.StockThresholdNotConvertible, err = db.computeStockEntityTotal(t.Product, t.EntityID, reference); err != nil {
+			return nil, err
+		}
+
+		t.StockThresholdStock = stock / multiplier
+		if t.StockThresholdStock < t.StockThresholdQuantity {
+			alerts = append(alerts, t)
+		}
+	}
+
+	return alerts, nil
+
+}
@@ -2,19 +2,91 @@ package datastores
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/doug-martin/goqu/v9"
 	"github.com/jmoiron/sqlx" // register sqlite3 driver
 	"github.com/sirupsen/logrus"
-	qrcode "github.com/skip2/go-qrcode"
+	"github.com/tbellembois/gochimitheque/codes"
 	"github.com/tbellembois/gochimitheque/logger"
 	. "github.com/tbellembois/gochimitheque/models"
 )
 
+// ErrBarecodeAlreadyExists is returned when a storage barecode
+// is already used by another storage of the entity
+var ErrBarecodeAlreadyExists = errors.New("barecode already exists in the entity")
+
+// getBarecodeScheme returns the barecode prefix and numbering template
+// of the storages of the store location id.
+// The prefix is the first one defined from the store location up to its root,
+// then the entity one, then the default.
+// The caller is responsible of opening and commiting the tx transaction.
+func (db *SQLiteDataStore) getBarecodeScheme(tx *sql.Tx, id int64) (prefix string, template string, err error) {
+
+	var (
+		slPrefix, entityPrefix, entityTemplate sql.NullString
+	)
+
+	sqlr := `WITH RECURSIVE parents(id, parent, prefix, depth) AS (
+		SELECT storelocation_id, storelocation, storelocation_barecodeprefix, 0 FROM storelocation WHERE storelocation_id = ?
+		UNION ALL
+		SELECT s.storelocation_id, s.storelocation, s.storelocation_barecodeprefix, parents.depth + 1
+		FROM storelocation s JOIN parents ON s.storelocation_id = parents.parent
+	)
+	SELECT (SELECT prefix FROM parents WHERE prefix IS NOT NULL AND prefix != '' ORDER BY depth LIMIT 1),
+	entity.entity_barecodeprefix,
+	entity.entity_barecodetemplate
+	FROM storelocation
+	JOIN entity ON storelocation.entity = entity.entity_id
+	WHERE storelocation.storelocation_id = ?`
+	if err = tx.QueryRow(sqlr, id, id).Scan(&slPrefix, &entityPrefix, &entityTemplate); err != nil {
+		return "", "", err
+	}
+
+	switch {
+	case slPrefix.Valid:
+		prefix = slPrefix.String
+	case entityPrefix.Valid && entityPrefix.String != "":
+		prefix = entityPrefix.String
+	default:
+		prefix = codes.DefaultBarecodePrefix
+	}
+
+	template = codes.DefaultBarecodeTemplate
+	if entityTemplate.Valid && entityTemplate.String != "" {
+		template = entityTemplate.String
+	}
+
+	return prefix, template, nil
+
+}
+
+// isBarecodeInEntity returns true if a current storage of the entity
+// other than the storage excludeID has the barecode b.
+// The caller is responsible of opening and commiting the tx transaction.
+func (db *SQLiteDataStore) isBarecodeInEntity(tx *sql.Tx, b string, entityID int, excludeID int64) (bool, error) {
+
+	var count int
+
+	sqlr := `SELECT count(storage.storage_id) FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_barecode = ?
+	AND storelocation.entity = ?
+	AND storage.storage_id != ?`
+	if err := tx.QueryRow(sqlr, b, entityID, excludeID).Scan(&count); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+
+}
+
 // ToogleStorageBorrowing toogles the borrowing b
 func (db *SQLiteDataStore) ToogleStorageBorrowing(s Storage) error {
 	var (
@@ -43,6 +115,22 @@ func (db *SQLiteDataStore) ToogleStorageBorrowing(s Storage) error {
 	return nil
 }
 
+// IsStorageBorrowed returns true if the storage with id "id" is borrowed
+func (db *SQLiteDataStore) IsStorageBorrowed(id int) (bool, error) {
+	var (
+		sqlr  string
+		count int
+		err   error
+	)
+
+	sqlr = `SELECT COUNT(borrowing_id) FROM borrowing WHERE storage = ?`
+	if err = db.Get(&count, sqlr, id); err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
 // GetStoragesUnits return the units matching the search criteria
 func (db *SQLiteDataStore) GetStoragesUnits(p DbselectparamUnit) ([]Unit, int, error) {
 	var (
@@ -216,9 +304,14 @@ func (db *SQLiteDataStore) GetStorages(p DbselectparamStorage) ([]Storage, int,
 		s.storage_number_of_carton,
 		s.storage_number_of_bag,
 		s.storage_number_of_unit,
+		s.storage_parent,
+		s.storage_price,
+		s.storage_currency,
 		storage.storage_id AS "storage.storage_id",
 		uq.unit_id AS "unit_quantity.unit_id",
 		uq.unit_label AS "unit_quantity.unit_label",
+		COALESCE(uq.unit_multiplier, 1) AS "unit_quantity.unit_multiplier",
+		uq.unit_dimension AS "unit_quantity.unit_dimension",
 		uc.unit_id AS "unit_concentration.unit_id",
 		uc.unit_label AS "unit_concentration.unit_label",
 		supplier.supplier_id AS "supplier.supplier_id",
@@ -229,6 +322,9 @@ func (db *SQLiteDataStore) GetStorages(p DbselectparamStorage) ([]Storage, int,
 		product.product_specificity AS "product.product_specificity",
 		product.product_number_per_carton AS "product.product_number_per_carton",
 		product.product_number_per_bag AS "product.product_number_per_bag",
+		product.product_density AS "product.product_density",
+		product.product_molarmass AS "product.product_molarmass",
+		empiricalformula.empiricalformula_label AS "product.empiricalformula.empiricalformula_label",
         producerref.producerref_id AS "product.producerref.producerref_id",
 		name.name_id AS "product.name.name_id",
 		name.name_label AS "product.name.name_label",
@@ -349,7 +445,11 @@ func (db *SQLiteDataStore) GetStorages(p DbselectparamStorage) ([]Storage, int,
 		comreq.WriteString(" AND entity.entity_id = :entity")
 	}
 	if p.GetStorelocation() != -1 {
-		comreq.WriteString(" AND storelocation.storelocation_id = :storelocation")
+		if p.GetStorelocationSubtree() {
+			comreq.WriteString(" AND " + storeLocationSubtreeFilter)
+		} else {
+			comreq.WriteString(" AND storelocation.storelocation_id = :storelocation")
+		}
 	}
 	if p.GetStorage() != -1 {
 		if p.GetHistory() {
@@ -512,6 +612,17 @@ func (db *SQLiteDataStore) GetStorages(p DbselectparamStorage) ([]Storage, int,
 		}
 	}
 
+	//
+	// getting number of running and upcoming reservations for each storage
+	//
+	for i, st := range storages {
+		reqhc.Reset()
+		reqhc.WriteString("SELECT count(DISTINCT reservation_id) from reservation WHERE reservation.storage = ? AND reservation.reservation_enddate >= ?")
+		if err = db.Get(&storages[i].StorageRC, reqhc.String(), st.StorageID, time.Now()); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	//
 	// getting borrower for each storage
 	//
@@ -610,6 +721,18 @@ func (db *SQLiteDataStore) GetOtherStorages(p DbselectparamStorage) ([]Entity, i
 		return nil, 0, err
 	}
 
+	// getting the running and upcoming reservations of the product
+	if p.GetProduct() != -1 {
+		for i, e := range entities {
+			if entities[i].Reservations, err = db.getActiveReservations(goqu.Ex{
+				"reservation.product": p.GetProduct(),
+				"reservation.entity":  e.EntityID,
+			}); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
 	return entities, count, nil
 }
 
@@ -640,6 +763,9 @@ func (db *SQLiteDataStore) GetStorage(id int) (Storage, error) {
 	storage.storage_number_of_carton,
 	storage.storage_number_of_bag,
 	storage.storage_number_of_unit,
+	storage.storage_parent,
+	storage.storage_price,
+	storage.storage_currency,
 	uq.unit_id AS "unit_quantity.unit_id",
 	uq.unit_label AS "unit_quantity.unit_label",
 	uc.unit_id AS "unit_concentration.unit_id",
@@ -675,6 +801,13 @@ func (db *SQLiteDataStore) GetStorage(id int) (Storage, error) {
 	if err = db.Get(&storage, sqlr, id); err != nil {
 		return Storage{}, err
 	}
+
+	// getting the running and upcoming reservations
+	if storage.Reservations, err = db.GetStorageReservations(id); err != nil {
+		return Storage{}, err
+	}
+	storage.StorageRC = len(storage.Reservations)
+
 	logger.Log.WithFields(logrus.Fields{"ID": id, "storage": storage}).Debug("GetStorage")
 	return storage, nil
 }
@@ -718,6 +851,45 @@ func (db *SQLiteDataStore) DeleteStorage(id int) error {
 
 // ArchiveStorage archives the storages with the given id
 func (db *SQLiteDataStore) ArchiveStorage(id int) error {
+	return db.ArchiveStorages([]int{id})
+}
+
+// ArchiveStorages archives the storages with the given ids
+// in a single transaction
+func (db *SQLiteDataStore) ArchiveStorages(ids []int) error {
+
+	var (
+		tx  *sql.Tx
+		err error
+	)
+
+	if tx, err = db.Begin(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err = db.archiveStorage(tx, id); err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				return errr
+			}
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		if errr := tx.Rollback(); errr != nil {
+			return errr
+		}
+		return err
+	}
+
+	return nil
+}
+
+// archiveStorage archives the storage with the given id and its history.
+// The caller is responsible of opening and commiting the tx transaction.
+func (db *SQLiteDataStore) archiveStorage(tx *sql.Tx, id int) error {
 
 	var (
 		sqlr string
@@ -725,12 +897,12 @@ func (db *SQLiteDataStore) ArchiveStorage(id int) error {
 	)
 	sqlr = `UPDATE storage SET storage_archive = true 
 	WHERE storage_id = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if _, err = tx.Exec(sqlr, id); err != nil {
 		return err
 	}
 	sqlr = `UPDATE storage SET storage_archive = true 
 	WHERE storage.storage = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if _, err = tx.Exec(sqlr, id); err != nil {
 		return err
 	}
 
@@ -891,21 +1063,54 @@ func (db *SQLiteDataStore) RestoreStorage(id int) error {
 func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error) {
 
 	var (
-		lastid       int64
-		tx           *sql.Tx
-		sqlr         string
-		res          sql.Result
-		sqla         []interface{}
-		ibuilder     sq.InsertBuilder
-		err          error
-		prefix       string
-		major, minor string
+		id  int
+		tx  *sql.Tx
+		err error
+	)
+
+	if tx, err = db.Begin(); err != nil {
+		return 0, err
+	}
+
+	if id, err = db.createStorage(tx, s, itemNumber); err != nil {
+		if errr := tx.Rollback(); errr != nil {
+			return 0, errr
+		}
+		return 0, err
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
+		if errr := tx.Rollback(); errr != nil {
+			return 0, errr
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// createStorage creates the new storage s.
+// The caller is responsible of opening and commiting the tx transaction.
+func (db *SQLiteDataStore) createStorage(tx *sql.Tx, s Storage, itemNumber int) (int, error) {
+
+	var (
+		lastid   int64
+		sqlr     string
+		res      sql.Result
+		sqla     []interface{}
+		ibuilder sq.InsertBuilder
+		err      error
+		prefix   string
+		template string
+		major    int
 	)
 
 	// Default major.
-	major = strconv.Itoa(s.ProductID)
+	major = s.ProductID
 
-	if tx, err = db.Begin(); err != nil {
+	// Getting the store location entity.
+	if err = tx.QueryRow(`SELECT entity FROM storelocation WHERE storelocation_id = ?`, s.StoreLocationID).Scan(&s.EntityID); err != nil {
 		return 0, err
 	}
 
@@ -913,39 +1118,23 @@ func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error)
 	if !(s.StorageBarecode.Valid) || s.StorageBarecode.String == "" {
 
 		//
-		// Getting the barecode prefix from the storelocation name.
+		// Getting the barecode prefix and numbering template
+		// from the store location, its parents and its entity.
 		//
-		// regex to detect store locations names starting with [_a-zA-Z] to build barecode prefixes
-		prefixRegex := regexp.MustCompile(`^\[(?P<groupone>[_a-zA-Z]{1,5})\].*$`)
-		groupNames := prefixRegex.SubexpNames()
-		matches := prefixRegex.FindAllStringSubmatch(s.StoreLocationName.String, -1)
-		// Building a map of matches.
-		matchesMap := map[string]string{}
-		if len(matches) != 0 {
-			for i, j := range matches[0] {
-				matchesMap[groupNames[i]] = j
-			}
-		}
-
-		if len(matchesMap) > 0 {
-			prefix = matchesMap["groupone"]
-		} else {
-			prefix = "_"
+		if prefix, template, err = db.getBarecodeScheme(tx, s.StoreLocationID.Int64); err != nil {
+			return 0, err
 		}
 
 		//
-		// Getting the storage barecodes matching the regex
+		// Getting the storage barecodes
 		// for the same product in the same entity.
 		//
 		sqlr := `SELECT storage_barecode FROM storage 
 		JOIN storelocation on storage.storelocation = storelocation.storelocation_id 
-		WHERE product = ? AND storelocation.entity = ? AND regexp('^[_a-zA-Z]{0,5}[0-9]+\.[0-9]+$', '' || storage_barecode || '') = true
+		WHERE product = ? AND storelocation.entity = ? AND storage_barecode IS NOT NULL
 		ORDER BY storage_barecode desc`
 		var rows *sql.Rows
 		if rows, err = tx.Query(sqlr, s.ProductID, s.EntityID); err != nil && err != sql.ErrNoRows {
-			if errr := tx.Rollback(); errr != nil {
-				return 0, errr
-			}
 			return 0, err
 		}
 
@@ -957,32 +1146,18 @@ func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error)
 
 			var barecode string
 			if err = rows.Scan(&barecode); err != nil && err != sql.ErrNoRows {
-				if errr := tx.Rollback(); errr != nil {
-					return 0, errr
-				}
 				return 0, err
 			}
 
-			majorRegex := regexp.MustCompile(`^[_a-zA-Z]{0,5}(?P<groupone>[0-9]+)\.(?P<grouptwo>[0-9]+)$`)
-			groupNames = majorRegex.SubexpNames()
-			matches = majorRegex.FindAllStringSubmatch(barecode, -1)
-			// Building a map of matches.
-			matchesMap = map[string]string{}
-			if len(matches) != 0 {
-				for i, j := range matches[0] {
-					matchesMap[groupNames[i]] = j
-				}
+			imajor, iminor, ok := codes.ParseBarecode(template, s.ProductID, s.EntityID, barecode)
+			if !ok {
+				continue
 			}
 
 			if count == 0 {
 				// All of the major number are the same.
 				// Extracting it ones.
-				major = matchesMap["groupone"]
-			}
-			minor = matchesMap["grouptwo"]
-			var iminor int
-			if iminor, err = strconv.Atoi(minor); err != nil {
-				return 0, err
+				major = imajor
 			}
 
 			if iminor > newMinor {
@@ -996,27 +1171,38 @@ func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error)
 		if (!s.StorageIdenticalBarecode.Valid || !s.StorageIdenticalBarecode.Bool) || (s.StorageIdenticalBarecode.Valid && s.StorageIdenticalBarecode.Bool && itemNumber == 1) {
 			newMinor++
 		}
-		minor = strconv.Itoa(newMinor)
-		s.StorageBarecode.String = prefix + major + "." + minor
+		s.StorageBarecode.String = codes.BuildBarecode(template, codes.BarecodeValues{
+			Prefix:  prefix,
+			Major:   major,
+			Minor:   newMinor,
+			Product: s.ProductID,
+			Entity:  s.EntityID,
+		})
 		s.StorageBarecode.Valid = true
 		logger.Log.WithFields(logrus.Fields{"s.StorageBarecode.String": s.StorageBarecode.String}).Debug("CreateStorage")
 
 	}
 
+	// Checking the barecode unicity in the entity
+	// except for the storages created with the identical barecode option.
+	if !(s.StorageIdenticalBarecode.Valid && s.StorageIdenticalBarecode.Bool && itemNumber > 1) {
+		var exists bool
+		if exists, err = db.isBarecodeInEntity(tx, s.StorageBarecode.String, s.EntityID, 0); err != nil {
+			return 0, err
+		}
+		if exists {
+			return 0, ErrBarecodeAlreadyExists
+		}
+	}
+
 	// if SupplierID = -1 then it is a new supplier
 	if v, err := s.Supplier.SupplierID.Value(); s.Supplier.SupplierID.Valid && err == nil && v.(int64) == -1 {
 		sqlr = `INSERT INTO supplier (supplier_label) VALUES (?)`
 		if res, err = tx.Exec(sqlr, s.Supplier.SupplierLabel); err != nil {
-			if errr := tx.Rollback(); errr != nil {
-				return 0, errr
-			}
 			return 0, err
 		}
 		// getting the last inserted id
 		if lastid, err = res.LastInsertId(); err != nil {
-			if errr := tx.Rollback(); errr != nil {
-				return 0, errr
-			}
 			return 0, err
 		}
 		// updating the storage SupplierId (SupplierLabel already set)
@@ -1024,9 +1210,6 @@ func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error)
 	}
 	if err != nil {
 		logger.Log.Error("supplier error - " + err.Error())
-		if errr := tx.Rollback(); errr != nil {
-			return 0, errr
-		}
 		return 0, err
 	}
 
@@ -1083,6 +1266,15 @@ func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error)
 	if s.UnitConcentration.UnitID.Valid {
 		m["unit_concentration"] = int(s.UnitConcentration.UnitID.Int64)
 	}
+	if s.StorageParentID.Valid {
+		m["storage_parent"] = s.StorageParentID.Int64
+	}
+	if s.StoragePrice.Valid {
+		m["storage_price"] = s.StoragePrice.Float64
+	}
+	if s.StorageCurrency.Valid {
+		m["storage_currency"] = s.StorageCurrency.String
+	}
 
 	m["person"] = s.PersonID
 	m["storelocation"] = s.StoreLocationID.Int64
@@ -1115,9 +1307,6 @@ func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error)
 
 	ibuilder = sq.Insert("storage").Columns(col...).Values(val...)
 	if sqlr, sqla, err = ibuilder.ToSql(); err != nil {
-		if errr := tx.Rollback(); errr != nil {
-			return 0, errr
-		}
 		return 0, err
 	}
 
@@ -1127,41 +1316,24 @@ func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error)
 	if res, err = tx.Exec(sqlr, sqla...); err != nil {
 		logger.Log.Error("storage error - " + err.Error())
 		logger.Log.Error("sql:" + sqlr)
-		if errr := tx.Rollback(); errr != nil {
-			return 0, errr
-		}
 		return 0, err
 	}
 
 	// getting the last inserted id
 	if lastid, err = res.LastInsertId(); err != nil {
-		if errr := tx.Rollback(); errr != nil {
-			return 0, errr
-		}
 		return 0, err
 	}
 
 	//
 	// qrcode
 	//
-	qr := strconv.FormatInt(lastid, 10)
-	if s.StorageQRCode, err = qrcode.Encode(qr, qrcode.Medium, 512); err != nil {
+	s.StorageID = sql.NullInt64{Valid: true, Int64: lastid}
+	if s.StorageQRCode, err = codes.StorageQRCode(s); err != nil {
 		return 0, err
 	}
 
 	sqlr = `UPDATE storage SET storage_qrcode=? WHERE storage_id=?`
 	if _, err = tx.Exec(sqlr, s.StorageQRCode, lastid); err != nil {
-		if errr := tx.Rollback(); errr != nil {
-			return 0, errr
-		}
-		return 0, err
-	}
-
-	// committing changes
-	if err = tx.Commit(); err != nil {
-		if errr := tx.Rollback(); errr != nil {
-			return 0, errr
-		}
 		return 0, err
 	}
 
@@ -1171,26 +1343,9 @@ func (db *SQLiteDataStore) CreateStorage(s Storage, itemNumber int) (int, error)
 	return int(s.StorageID.Int64), nil
 }
 
-// UpdateStorage updates the storage s
-func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
-
-	var (
-		sqlr     string
-		err      error
-		tx       *sql.Tx
-		res      sql.Result
-		lastid   int64
-		sqla     []interface{}
-		ubuilder sq.UpdateBuilder
-	)
-
-	// beginning transaction
-	if tx, err = db.Begin(); err != nil {
-		return err
-	}
-
-	// create an history of the storage
-	sqlr = `INSERT into storage (storage_creationdate, 
+// storageHistoryInsert copies the storage with id ? (second parameter)
+// into a new history row referencing the storage (first parameter)
+const storageHistoryInsert = `INSERT into storage (storage_creationdate, 
 		storage_modificationdate,
 		storage_entrydate, 
 		storage_exitdate, 
@@ -1207,6 +1362,8 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 		storage_number_of_unit,
 		storage_number_of_bag,
 		storage_number_of_carton,
+		storage_price,
+		storage_currency,
 		person,
 		product,
 		storelocation,
@@ -1230,6 +1387,8 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 				storage_number_of_unit,
 				storage_number_of_bag,
 				storage_number_of_carton,
+				storage_price,
+				storage_currency,
 				person,
 				product,
 				storelocation,
@@ -1237,37 +1396,98 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 				unit_concentration,
 				supplier,
 				? FROM storage WHERE storage_id = ?`
-	if _, err = tx.Exec(sqlr, s.StorageID, s.StorageID); err != nil {
+
+// UpdateStorage updates the storage s
+func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
+	return db.UpdateStorages([]Storage{s})
+}
+
+// UpdateStorages updates the storages ss in a single transaction
+func (db *SQLiteDataStore) UpdateStorages(ss []Storage) error {
+
+	var (
+		tx  *sql.Tx
+		err error
+	)
+
+	// beginning transaction
+	if tx, err = db.Begin(); err != nil {
+		return err
+	}
+
+	for _, s := range ss {
+		if err = db.updateStorage(tx, s); err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				return errr
+			}
+			return err
+		}
+	}
+
+	// committing changes
+	if err = tx.Commit(); err != nil {
 		if errr := tx.Rollback(); errr != nil {
 			return errr
 		}
+		return err
+	}
+
+	return nil
+}
+
+// updateStorage updates the storage s and keeps its history.
+// The caller is responsible of opening and commiting the tx transaction.
+func (db *SQLiteDataStore) updateStorage(tx *sql.Tx, s Storage) error {
+
+	var (
+		sqlr     string
+		err      error
+		res      sql.Result
+		lastid   int64
+		sqla     []interface{}
+		ubuilder sq.UpdateBuilder
+	)
+
+	// checking the barecode unicity in the entity if changed
+	var (
+		formerBarecode sql.NullString
+		entityID       int
+		exists         bool
+	)
+	if err = tx.QueryRow(`SELECT storage_barecode FROM storage WHERE storage_id = ?`, s.StorageID).Scan(&formerBarecode); err != nil {
+		return err
+	}
+	if s.StorageBarecode.Valid && s.StorageBarecode.String != formerBarecode.String {
+		if err = tx.QueryRow(`SELECT entity FROM storelocation WHERE storelocation_id = ?`, s.StoreLocationID).Scan(&entityID); err != nil {
+			return err
+		}
+		if exists, err = db.isBarecodeInEntity(tx, s.StorageBarecode.String, entityID, s.StorageID.Int64); err != nil {
+			return err
+		}
+		if exists {
+			return ErrBarecodeAlreadyExists
+		}
+	}
+
+	// create an history of the storage
+	sqlr = storageHistoryInsert
+	if _, err = tx.Exec(sqlr, s.StorageID, s.StorageID); err != nil {
+		return err
 	}
 
 	// if SupplierID = -1 then it is a new supplier
 	if v, err := s.Supplier.SupplierID.Value(); s.Supplier.SupplierID.Valid && err == nil && v.(int64) == -1 {
 		sqlr = `INSERT INTO supplier (supplier_label) VALUES (?)`
-		if _, err = tx.Exec(sqlr, s.Supplier.SupplierLabel); err != nil {
-			if errr := tx.Rollback(); errr != nil {
-				return errr
-			}
+		if res, err = tx.Exec(sqlr, s.Supplier.SupplierLabel); err != nil {
 			return err
 		}
 		// getting the last inserted id
 		if lastid, err = res.LastInsertId(); err != nil {
-			if errr := tx.Rollback(); errr != nil {
-				return errr
-			}
 			return err
 		}
 		// updating the storage SupplierId (SupplierLabel already set)
 		s.Supplier.SupplierID = sql.NullInt64{Valid: true, Int64: lastid}
 	}
-	if err != nil {
-		logger.Log.Error("supplier error - " + err.Error())
-		if errr := tx.Rollback(); errr != nil {
-			return errr
-		}
-	}
 
 	// finally updating the storage
 	m := make(map[string]interface{})
@@ -1328,26 +1548,18 @@ func (db *SQLiteDataStore) UpdateStorage(s Storage) error {
 	m["storelocation"] = s.StoreLocationID
 	m["unit_quantity"] = s.UnitQuantity.UnitID
 	m["supplier"] = s.SupplierID
+	// null to clear the price
+	m["storage_price"] = s.StoragePrice
+	m["storage_currency"] = s.StorageCurrency
 
 	ubuilder = sq.Update("storage").
 		SetMap(m).
 		Where(sq.Eq{"storage_id": s.StorageID})
 	if sqlr, sqla, err = ubuilder.ToSql(); err != nil {
-		if errr := tx.Rollback(); errr != nil {
-			return errr
-		}
+		return err
 	}
 	if _, err = tx.Exec(sqlr, sqla...); err != nil {
-		if errr := tx.Rollback(); errr != nil {
-			return errr
-		}
-	}
-
-	// committing changes
-	if err = tx.Commit(); err != nil {
-		if errr := tx.Rollback(); errr != nil {
-			return errr
-		}
+		return err
 	}
 
 	return nil
@@ -1365,7 +1577,7 @@ func (db *SQLiteDataStore) UpdateAllQRCodes() error {
 	)
 
 	// retrieving storages
-	if err = db.Select(&sts, ` SELECT storage_id
+	if err = db.Select(&sts, ` SELECT storage_id, storage_barecode
         FROM storage`); err != nil {
 		if errr := tx.Rollback(); errr != nil {
 			return errr
@@ -1380,10 +1592,10 @@ func (db *SQLiteDataStore) UpdateAllQRCodes() error {
 	for _, s := range sts {
 
 		// generating qrcode
-		newqrcode := strconv.FormatInt(s.StorageID.Int64, 10)
+		newqrcode := codes.StorageQRCodeContent(s)
 		logger.Log.Debug("  " + strconv.FormatInt(s.StorageID.Int64, 10) + " " + newqrcode)
 
-		if png, err = qrcode.Encode(newqrcode, qrcode.Medium, 512); err != nil {
+		if png, err = codes.StorageQRCode(s); err != nil {
 			return err
 		}
 		sqlr = `UPDATE storage
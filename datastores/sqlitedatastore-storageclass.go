@@ -0,0 +1,310 @@
+package datastores
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// productStorageClassesCTE are the productstorageclass CTE, containing the storage classes
+// of each product, and the incompatibility CTE, containing the incompatible classes pairs
+// in both directions.
+// The classes of a product are its explicit classes if any, or the ones derived
+// from its hazard statements and classes of compounds.
+const productStorageClassesCTE = `productstorageclass(product, storageclass) AS (
+	SELECT productstorageclasses_product_id, productstorageclasses_storageclass_id FROM productstorageclasses
+	UNION
+	SELECT producthazardstatements_product_id, storageclasshazardstatements_storageclass_id FROM producthazardstatements
+	JOIN storageclasshazardstatements ON storageclasshazardstatements_hazardstatement_id = producthazardstatements_hazardstatement_id
+	WHERE producthazardstatements_product_id NOT IN (SELECT productstorageclasses_product_id FROM productstorageclasses)
+	UNION
+	SELECT productclassofcompound_product_id, storageclassclassofcompound_storageclass_id FROM productclassofcompound
+	JOIN storageclassclassofcompound ON storageclassclassofcompound_classofcompound_id = productclassofcompound_classofcompound_id
+	WHERE productclassofcompound_product_id NOT IN (SELECT productstorageclasses_product_id FROM productstorageclasses)
+),
+incompatibility(storageclass1, storageclass2) AS (
+	SELECT storageclassincompatibility_storageclass1, storageclassincompatibility_storageclass2 FROM storageclassincompatibility
+	UNION ALL
+	SELECT storageclassincompatibility_storageclass2, storageclassincompatibility_storageclass1 FROM storageclassincompatibility
+)`
+
+// GetStorageClasses returns the storage classes with their incompatible classes.
+func (db *SQLiteDataStore) GetStorageClasses() ([]StorageClass, error) {
+
+	logger.Log.Debug("GetStorageClasses")
+
+	var (
+		err     error
+		classes []StorageClass
+		pairs   []struct {
+			StorageClass1 int `db:"storageclass1"`
+			StorageClass2 int `db:"storageclass2"`
+		}
+	)
+
+	sqlr := `SELECT storageclass_id, storageclass_label, storageclass_description FROM storageclass
+	ORDER BY storageclass_label`
+	if err = db.Select(&classes, sqlr); err != nil {
+		return nil, err
+	}
+
+	sqlr = `SELECT storageclassincompatibility_storageclass1 AS storageclass1, storageclassincompatibility_storageclass2 AS storageclass2
+	FROM storageclassincompatibility`
+	if err = db.Select(&pairs, sqlr); err != nil {
+		return nil, err
+	}
+
+	index := make(map[int]int)
+	for i, c := range classes {
+		index[c.StorageClassID] = i
+		classes[i].Incompatibilities = []StorageClass{}
+	}
+	for _, p := range pairs {
+		c1, c2 := classes[index[p.StorageClass1]], classes[index[p.StorageClass2]]
+		classes[index[p.StorageClass1]].Incompatibilities = append(c1.Incompatibilities, StorageClass{StorageClassID: c2.StorageClassID, StorageClassLabel: c2.StorageClassLabel})
+		classes[index[p.StorageClass2]].Incompatibilities = append(c2.Incompatibilities, StorageClass{StorageClassID: c1.StorageClassID, StorageClassLabel: c1.StorageClassLabel})
+	}
+
+	return classes, nil
+
+}
+
+// SetStorageClassIncompatibilities replaces the incompatible classes
+// of the storage class with id "id" by the classes with ids "ids".
+func (db *SQLiteDataStore) SetStorageClassIncompatibilities(id int, ids []int) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "ids": ids}).Debug("SetStorageClassIncompatibilities")
+
+	var tx *sqlx.Tx
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				logger.Log.Error(errr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr := `DELETE FROM storageclassincompatibility
+	WHERE storageclassincompatibility_storageclass1 = ? OR storageclassincompatibility_storageclass2 = ?`
+	if _, err = tx.Exec(sqlr, id, id); err != nil {
+		return err
+	}
+
+	for _, i := range ids {
+		if i == id {
+			continue
+		}
+		c1, c2 := id, i
+		if c2 < c1 {
+			c1, c2 = c2, c1
+		}
+		sqlr = `INSERT INTO storageclassincompatibility (storageclassincompatibility_storageclass1, storageclassincompatibility_storageclass2) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`
+		if _, err = tx.Exec(sqlr, c1, c2); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// GetProductStorageClasses returns the storage classes of the product with id "id".
+func (db *SQLiteDataStore) GetProductStorageClasses(id int) (ProductStorageClasses, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetProductStorageClasses")
+
+	var (
+		err      error
+		explicit int
+		p        = ProductStorageClasses{ProductID: id, StorageClasses: []StorageClass{}}
+	)
+
+	sqlr := `SELECT count(*) FROM productstorageclasses WHERE productstorageclasses_product_id = ?`
+	if err = db.Get(&explicit, sqlr, id); err != nil {
+		return p, err
+	}
+	p.Derived = explicit == 0
+
+	sqlr = `WITH ` + productStorageClassesCTE + `
+	SELECT storageclass_id, storageclass_label, storageclass_description FROM storageclass
+	JOIN productstorageclass ON productstorageclass.storageclass = storageclass.storageclass_id
+	WHERE productstorageclass.product = ?
+	ORDER BY storageclass_label`
+	if err = db.Select(&p.StorageClasses, sqlr, id); err != nil {
+		return p, err
+	}
+
+	return p, nil
+
+}
+
+// SetProductStorageClasses sets the storage classes of the product with id "id".
+// Without classes, the classes of the product are derived again
+// from its hazard statements and classes of compounds.
+func (db *SQLiteDataStore) SetProductStorageClasses(id int, classes []StorageClass) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "classes": classes}).Debug("SetProductStorageClasses")
+
+	var tx *sqlx.Tx
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				logger.Log.Error(errr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr := `DELETE FROM productstorageclasses WHERE productstorageclasses_product_id = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
+
+	for _, c := range classes {
+		sqlr = `INSERT INTO productstorageclasses (productstorageclasses_product_id, productstorageclasses_storageclass_id) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`
+		if _, err = tx.Exec(sqlr, id, c.StorageClassID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// storageClassConflictColumns are the columns of the storage class conflicts selects,
+// conflicting product and classes
+const storageClassConflictColumns = `sc1.storageclass_id AS "storageclass.storageclass_id",
+	sc1.storageclass_label AS "storageclass.storageclass_label",
+	p2.product_id AS "conflictingproduct.product_id",
+	n2.name_label AS "conflictingproduct.name.name_label",
+	sc2.storageclass_id AS "conflictingstorageclass.storageclass_id",
+	sc2.storageclass_label AS "conflictingstorageclass.storageclass_label"`
+
+// GetStorageClassIncompatibilities returns the conflicts that storing the storage s
+// would create in its store location with the products already stored there.
+// If s is an existing storage, it is ignored in the store location.
+func (db *SQLiteDataStore) GetStorageClassIncompatibilities(s Storage) ([]StorageClassConflict, error) {
+
+	logger.Log.WithFields(logrus.Fields{"s": s}).Debug("GetStorageClassIncompatibilities")
+
+	var (
+		err       error
+		conflicts = []StorageClassConflict{}
+	)
+
+	if !s.StoreLocation.StoreLocationID.Valid {
+		return conflicts, nil
+	}
+
+	excludeID := int64(-1)
+	if s.StorageID.Valid {
+		excludeID = s.StorageID.Int64
+	}
+
+	sqlr := `WITH ` + productStorageClassesCTE + `
+	SELECT DISTINCT storelocation.storelocation_id AS "storelocation.storelocation_id",
+	storelocation.storelocation_name AS "storelocation.storelocation_name",
+	storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath",
+	p1.product_id AS "product.product_id",
+	n1.name_label AS "product.name.name_label",
+	` + storageClassConflictColumns + `
+	FROM productstorageclass psc1
+	JOIN incompatibility ON incompatibility.storageclass1 = psc1.storageclass
+	JOIN productstorageclass psc2 ON psc2.storageclass = incompatibility.storageclass2
+	JOIN storage ON storage.product = psc2.product
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	JOIN product p1 ON psc1.product = p1.product_id
+	JOIN name n1 ON p1.name = n1.name_id
+	JOIN product p2 ON psc2.product = p2.product_id
+	JOIN name n2 ON p2.name = n2.name_id
+	JOIN storageclass sc1 ON psc1.storageclass = sc1.storageclass_id
+	JOIN storageclass sc2 ON psc2.storageclass = sc2.storageclass_id
+	WHERE psc1.product = ?
+	AND psc2.product != psc1.product
+	AND storage.storelocation = ?
+	AND storage.storage IS NULL
+	AND storage.storage_archive IS FALSE
+	AND storage.storage_id != ?
+	ORDER BY n2.name_label, sc1.storageclass_label, sc2.storageclass_label`
+	if err = db.Select(&conflicts, sqlr, s.Product.ProductID, s.StoreLocation.StoreLocationID.Int64, excludeID); err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+
+}
+
+// GetStorageClassConflicts returns the products stored in the store locations
+// of the entities with products of incompatible storage classes,
+// all of them if entities is nil.
+// Each pair of products is returned once.
+func (db *SQLiteDataStore) GetStorageClassConflicts(entities []int) ([]StorageClassConflict, error) {
+
+	logger.Log.WithFields(logrus.Fields{"entities": entities}).Debug("GetStorageClassConflicts")
+
+	var (
+		err       error
+		args      []interface{}
+		conflicts = []StorageClassConflict{}
+	)
+
+	sqlr := `WITH ` + productStorageClassesCTE + `,
+	stored(storelocation, product) AS (
+		SELECT DISTINCT storelocation, product FROM storage
+		WHERE storage.storage IS NULL
+		AND storage.storage_archive IS FALSE
+	)
+	SELECT DISTINCT storelocation.storelocation_id AS "storelocation.storelocation_id",
+	storelocation.storelocation_name AS "storelocation.storelocation_name",
+	storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath",
+	entity.entity_id AS "storelocation.entity.entity_id",
+	entity.entity_name AS "storelocation.entity.entity_name",
+	p1.product_id AS "product.product_id",
+	n1.name_label AS "product.name.name_label",
+	` + storageClassConflictColumns + `
+	FROM stored s1
+	JOIN stored s2 ON s1.storelocation = s2.storelocation AND s1.product < s2.product
+	JOIN productstorageclass psc1 ON psc1.product = s1.product
+	JOIN productstorageclass psc2 ON psc2.product = s2.product
+	JOIN incompatibility ON incompatibility.storageclass1 = psc1.storageclass AND incompatibility.storageclass2 = psc2.storageclass
+	JOIN storelocation ON s1.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id
+	JOIN product p1 ON s1.product = p1.product_id
+	JOIN name n1 ON p1.name = n1.name_id
+	JOIN product p2 ON s2.product = p2.product_id
+	JOIN name n2 ON p2.name = n2.name_id
+	JOIN storageclass sc1 ON psc1.storageclass = sc1.storageclass_id
+	JOIN storageclass sc2 ON psc2.storageclass = sc2.storageclass_id`
+	if entities != nil {
+		if len(entities) == 0 {
+			return conflicts, nil
+		}
+		sqlr += ` WHERE storelocation.entity IN (?)`
+		args = append(args, entities)
+	}
+	sqlr += ` ORDER BY entity.entity_name, storelocation.storelocation_fullpath, n1.name_label, n2.name_label`
+
+	if sqlr, args, err = sqlx.In(sqlr, args...); err != nil {
+		return nil, err
+	}
+	if err = db.Select(&conflicts, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
+	}
+
+	return conflicts, nil
+
+}
@@ -0,0 +1,199 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+var (
+	// ErrStorageNotSplittable is returned when the storage to split
+	// is archived, is an history storage or has no quantity
+	ErrStorageNotSplittable = errors.New("storage archived, history or without quantity")
+	// ErrSplitQuantity is returned when an aliquot quantity is not positive
+	// or when the aliquots quantities exceed the storage quantity
+	ErrSplitQuantity = errors.New("invalid aliquots quantities")
+)
+
+// lineageStorageColumns are the storage columns returned
+// by the lineage queries.
+const lineageStorageColumns = inventoryStorageColumns + `,
+	storage.storage_parent,
+	storage.storage_archive`
+
+// SplitStorage splits the storage with id "id" into aliquots
+// of the given quantities on behalf of the person with id "personID".
+// The aliquots quantities are withdrawn from the storage.
+// It returns the created aliquots ids.
+func (db *SQLiteDataStore) SplitStorage(id int, quantities []float64, personID int) (ids []int, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "quantities": quantities, "personID": personID}).Debug("SplitStorage")
+
+	var (
+		tx     *sqlx.Tx
+		sqlr   string
+		parent Storage
+		total  float64
+		now    = time.Now()
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr = `SELECT storage.storage_id,
+	storage.storage_quantity,
+	storage.storage_entrydate,
+	storage.storage_openingdate,
+	storage.storage_expirationdate,
+	storage.storage_reference,
+	storage.storage_batchnumber,
+	storage.storage_todestroy,
+	storage.storage_archive,
+	storage.storage_concentration,
+	storage.product AS "product.product_id",
+	storage.storelocation AS "storelocation.storelocation_id",
+	storage.unit_quantity AS "unit_quantity.unit_id",
+	storage.unit_concentration AS "unit_concentration.unit_id",
+	storage.supplier AS "supplier.supplier_id"
+	FROM storage
+	WHERE storage.storage_id = ? AND storage.storage IS NULL`
+	if err = tx.Get(&parent, sqlr, id); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrStorageNotSplittable
+		}
+		return
+	}
+	if (parent.StorageArchive.Valid && parent.StorageArchive.Bool) || !parent.StorageQuantity.Valid {
+		err = ErrStorageNotSplittable
+		return
+	}
+
+	for _, q := range quantities {
+		if q <= 0 {
+			err = ErrSplitQuantity
+			return
+		}
+		total += q
+	}
+	if len(quantities) == 0 || total > parent.StorageQuantity.Float64 {
+		err = ErrSplitQuantity
+		return
+	}
+
+	// create an history of the storage
+	if _, err = tx.Exec(storageHistoryInsert, id, id); err != nil {
+		return
+	}
+
+	sqlr = `UPDATE storage SET storage_quantity = ?, person = ?, storage_modificationdate = ?
+	WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, parent.StorageQuantity.Float64-total, personID, now, id); err != nil {
+		return
+	}
+
+	for i, q := range quantities {
+		aliquot := Storage{
+			StorageCreationDate:     now,
+			StorageModificationDate: now,
+			StorageEntryDate:        sql.NullTime{Valid: true, Time: now},
+			StorageOpeningDate:      parent.StorageOpeningDate,
+			StorageExpirationDate:   parent.StorageExpirationDate,
+			StorageReference:        parent.StorageReference,
+			StorageBatchNumber:      parent.StorageBatchNumber,
+			StorageToDestroy:        parent.StorageToDestroy,
+			StorageConcentration:    parent.StorageConcentration,
+			StorageQuantity:         sql.NullFloat64{Valid: true, Float64: q},
+			StorageParentID:         sql.NullInt64{Valid: true, Int64: int64(id)},
+			Person:                  Person{PersonID: personID},
+			Product:                 Product{ProductID: parent.ProductID},
+			StoreLocation:           StoreLocation{StoreLocationID: parent.StoreLocationID},
+			UnitQuantity:            parent.UnitQuantity,
+			UnitConcentration:       parent.UnitConcentration,
+			Supplier:                Supplier{SupplierID: parent.SupplierID},
+		}
+
+		var aliquotID int
+		if aliquotID, err = db.createStorage(tx.Tx, aliquot, i+1); err != nil {
+			return
+		}
+		ids = append(ids, aliquotID)
+	}
+
+	return
+
+}
+
+// GetStorageLineage returns the storage with id "id"
+// with the storages it has been split from and the storages split from it.
+func (db *SQLiteDataStore) GetStorageLineage(id int) (StorageLineage, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetStorageLineage")
+
+	var (
+		err     error
+		sqlr    string
+		lineage StorageLineage
+	)
+
+	if lineage.Storage, err = db.GetStorage(id); err != nil {
+		return lineage, err
+	}
+
+	sqlr = `WITH RECURSIVE ancestors(id, depth) AS (
+		SELECT storage_parent, -1 FROM storage
+		WHERE storage_id = ? AND storage_parent IS NOT NULL
+		UNION
+		SELECT storage.storage_parent, ancestors.depth - 1 FROM storage
+		JOIN ancestors ON storage.storage_id = ancestors.id
+		WHERE storage.storage_parent IS NOT NULL
+	)
+	SELECT ` + lineageStorageColumns + `,
+	ancestors.depth
+	FROM ancestors
+	JOIN storage ON storage.storage_id = ancestors.id
+	` + inventoryStorageJoins + `
+	ORDER BY ancestors.depth DESC`
+	if err = db.Select(&lineage.Ancestors, sqlr, id); err != nil {
+		return lineage, err
+	}
+
+	sqlr = `WITH RECURSIVE descendants(id, depth) AS (
+		SELECT storage_id, 1 FROM storage
+		WHERE storage_parent = ? AND storage.storage IS NULL
+		UNION
+		SELECT storage.storage_id, descendants.depth + 1 FROM storage
+		JOIN descendants ON storage.storage_parent = descendants.id
+		WHERE storage.storage IS NULL
+	)
+	SELECT ` + lineageStorageColumns + `,
+	descendants.depth
+	FROM descendants
+	JOIN storage ON storage.storage_id = descendants.id
+	` + inventoryStorageJoins + `
+	ORDER BY descendants.depth, storage.storage_id`
+	if err = db.Select(&lineage.Descendants, sqlr, id); err != nil {
+		return lineage, err
+	}
+
+	return lineage, nil
+
+}
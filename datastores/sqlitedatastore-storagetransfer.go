@@ -0,0 +1,487 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+var (
+	// ErrStorageTransferPending is returned when a storage transfer
+	// is requested for a storage already in a pending transfer
+	ErrStorageTransferPending = errors.New("a transfer of the storage is already pending")
+	// ErrStorageTransferNotPending is returned when a storage transfer
+	// already accepted, refused or cancelled is decided
+	ErrStorageTransferNotPending = errors.New("storage transfer not pending")
+	// ErrStorageNotTransferable is returned when the storage
+	// is archived or is an history storage
+	ErrStorageNotTransferable = errors.New("storage archived or history")
+)
+
+// storageTransferSelect returns the storage transfers select clause
+func storageTransferSelect() *goqu.SelectDataset {
+
+	dialect := goqu.Dialect("sqlite3")
+	tableStorageTransfer := goqu.T("storagetransfer")
+
+	return dialect.From(tableStorageTransfer).Join(
+		goqu.T("storage"),
+		goqu.On(goqu.Ex{"storagetransfer.storage": goqu.I("storage.storage_id")}),
+	).Join(
+		goqu.T("product"),
+		goqu.On(goqu.Ex{"storage.product": goqu.I("product.product_id")}),
+	).Join(
+		goqu.T("name"),
+		goqu.On(goqu.Ex{"product.name": goqu.I("name.name_id")}),
+	).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{"storagetransfer.person": goqu.I("person.person_id")}),
+	).Join(
+		goqu.T("storelocation").As("ssl"),
+		goqu.On(goqu.Ex{"storagetransfer.source_storelocation": goqu.I("ssl.storelocation_id")}),
+	).Join(
+		goqu.T("entity").As("se"),
+		goqu.On(goqu.Ex{"storagetransfer.source_entity": goqu.I("se.entity_id")}),
+	).Join(
+		goqu.T("storelocation").As("sl"),
+		goqu.On(goqu.Ex{"storagetransfer.storelocation": goqu.I("sl.storelocation_id")}),
+	).Join(
+		goqu.T("entity").As("e"),
+		goqu.On(goqu.Ex{"storagetransfer.entity": goqu.I("e.entity_id")}),
+	).LeftJoin(
+		goqu.T("person").As("dp"),
+		goqu.On(goqu.Ex{"storagetransfer.decision_person": goqu.I("dp.person_id")}),
+	)
+
+}
+
+// storageTransferColumns are the columns of the storage transfers select clause
+var storageTransferColumns = []interface{}{
+	goqu.I("storagetransfer.storagetransfer_id"),
+	goqu.I("storagetransfer.storagetransfer_creationdate"),
+	goqu.I("storagetransfer.storagetransfer_status"),
+	goqu.I("storagetransfer.storagetransfer_comment"),
+	goqu.I("storagetransfer.storagetransfer_decisiondate"),
+	goqu.I("storage.storage_id").As(goqu.C("storage.storage_id")),
+	goqu.I("storage.storage_barecode").As(goqu.C("storage.storage_barecode")),
+	goqu.I("product.product_id").As(goqu.C("storage.product.product_id")),
+	goqu.I("name.name_label").As(goqu.C("storage.product.name.name_label")),
+	goqu.I("person.person_id").As(goqu.C("person.person_id")),
+	goqu.I("person.person_email").As(goqu.C("person.person_email")),
+	goqu.I("ssl.storelocation_id").As(goqu.C("source_storelocation.storelocation_id")),
+	goqu.I("ssl.storelocation_name").As(goqu.C("source_storelocation.storelocation_name")),
+	goqu.I("ssl.storelocation_fullpath").As(goqu.C("source_storelocation.storelocation_fullpath")),
+	goqu.I("se.entity_id").As(goqu.C("source_entity.entity_id")),
+	goqu.I("se.entity_name").As(goqu.C("source_entity.entity_name")),
+	goqu.I("sl.storelocation_id").As(goqu.C("storelocation.storelocation_id")),
+	goqu.I("sl.storelocation_name").As(goqu.C("storelocation.storelocation_name")),
+	goqu.I("sl.storelocation_fullpath").As(goqu.C("storelocation.storelocation_fullpath")),
+	goqu.I("e.entity_id").As(goqu.C("entity.entity_id")),
+	goqu.I("e.entity_name").As(goqu.C("entity.entity_name")),
+	goqu.COALESCE(goqu.I("dp.person_id"), 0).As(goqu.C("decision_person.person_id")),
+	goqu.COALESCE(goqu.I("dp.person_email"), "").As(goqu.C("decision_person.person_email")),
+}
+
+// GetStorageTransfers returns the storage transfers matching p
+// from or to the entities of the logged person.
+func (db *SQLiteDataStore) GetStorageTransfers(p DbselectparamStorageTransfer) ([]StorageTransfer, int, error) {
+
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("GetStorageTransfers")
+
+	var err error
+
+	// Build orderby/order clause.
+	orderClause := goqu.I(p.GetOrderBy()).Asc()
+	if strings.ToLower(p.GetOrder()) == "desc" {
+		orderClause = goqu.I(p.GetOrderBy()).Desc()
+	}
+
+	// Build join clause.
+	joinClause := storageTransferSelect().Join(
+		goqu.T("permission").As("perm"),
+		goqu.On(
+			goqu.Ex{
+				"perm.person":               p.GetLoggedPersonID(),
+				"perm.permission_item_name": []string{"all", "storages"},
+				"perm.permission_perm_name": []string{"r", "w", "all"},
+				"perm.permission_entity_id": []interface{}{-1, goqu.I("se.entity_id"), goqu.I("e.entity_id")},
+			},
+		),
+	)
+
+	// Build where AND expression.
+	whereAnd := []goqu.Expression{
+		goqu.I("name.name_label").Like(p.GetSearch()),
+	}
+	if p.GetEntity() != -1 {
+		whereAnd = append(whereAnd, goqu.Or(
+			goqu.I("storagetransfer.source_entity").Eq(p.GetEntity()),
+			goqu.I("storagetransfer.entity").Eq(p.GetEntity()),
+		))
+	}
+	if p.GetStatus() != "" {
+		whereAnd = append(whereAnd, goqu.I("storagetransfer.storagetransfer_status").Eq(p.GetStatus()))
+	}
+
+	joinClause = joinClause.Where(goqu.And(whereAnd...))
+
+	// Building final count.
+	var (
+		countSql  string
+		countArgs []interface{}
+	)
+	if countSql, countArgs, err = joinClause.Select(
+		goqu.COUNT(goqu.I("storagetransfer.storagetransfer_id").Distinct()),
+	).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	// Building final select.
+	var (
+		selectSql  string
+		selectArgs []interface{}
+	)
+	if selectSql, selectArgs, err = joinClause.Select(
+		storageTransferColumns...,
+	).GroupBy(goqu.I("storagetransfer.storagetransfer_id")).Order(orderClause).Limit(uint(p.GetLimit())).Offset(uint(p.GetOffset())).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		transfers []StorageTransfer
+		count     int
+	)
+
+	if err = db.Select(&transfers, selectSql, selectArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	if err = db.Get(&count, countSql, countArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	return transfers, count, nil
+
+}
+
+// GetStorageTransfer returns the storage transfer with id "id".
+func (db *SQLiteDataStore) GetStorageTransfer(id int) (StorageTransfer, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetStorageTransfer")
+
+	var (
+		err      error
+		sqlr     string
+		args     []interface{}
+		transfer StorageTransfer
+	)
+
+	if sqlr, args, err = storageTransferSelect().Where(
+		goqu.I("storagetransfer.storagetransfer_id").Eq(id),
+	).Select(
+		storageTransferColumns...,
+	).ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return StorageTransfer{}, err
+	}
+
+	if err = db.Get(&transfer, sqlr, args...); err != nil {
+		return StorageTransfer{}, err
+	}
+
+	return transfer, nil
+
+}
+
+// GetStorageTransferEntities returns the source and target entities
+// of the storage transfer with id "id".
+func (db *SQLiteDataStore) GetStorageTransferEntities(id int) ([]Entity, error) {
+
+	var (
+		entities []Entity
+		sqlr     string
+		err      error
+	)
+
+	sqlr = `SELECT
+	entity.entity_id AS "entity_id",
+	entity.entity_name AS "entity_name"
+	FROM storagetransfer
+	JOIN entity ON storagetransfer.source_entity = entity.entity_id OR storagetransfer.entity = entity.entity_id
+	WHERE storagetransfer.storagetransfer_id = ?`
+	if err = db.Select(&entities, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	return entities, nil
+
+}
+
+// CreateStorageTransfer inserts the pending storage transfer t
+// of the storage t.Storage to the store location t.StoreLocation.
+// The source store location and entity are the current ones of the storage.
+func (db *SQLiteDataStore) CreateStorageTransfer(t StorageTransfer) (lastInsertId int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"t": fmt.Sprintf("%+v", t)}).Debug("CreateStorageTransfer")
+
+	var (
+		tx        *sqlx.Tx
+		sqlr      string
+		args      []interface{}
+		sqlResult sql.Result
+		count     int
+		source    struct {
+			StoreLocationID int `db:"storelocation_id"`
+			EntityID        int `db:"entity_id"`
+		}
+		entityID int
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr = `SELECT storelocation.storelocation_id, storelocation.entity AS "entity_id" FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storage.storage_id = ?
+	AND storage.storage IS NULL
+	AND (storage.storage_archive IS NULL OR storage.storage_archive = false)`
+	if err = tx.Get(&source, sqlr, t.Storage.StorageID.Int64); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrStorageNotTransferable
+		}
+		return
+	}
+
+	sqlr = `SELECT count(*) FROM storagetransfer WHERE storage = ? AND storagetransfer_status = ?`
+	if err = tx.Get(&count, sqlr, t.Storage.StorageID.Int64, StorageTransferPending); err != nil {
+		return
+	}
+	if count > 0 {
+		err = ErrStorageTransferPending
+		return
+	}
+
+	sqlr = `SELECT entity FROM storelocation WHERE storelocation_id = ?`
+	if err = tx.Get(&entityID, sqlr, t.StoreLocation.StoreLocationID.Int64); err != nil {
+		return
+	}
+
+	dialect := goqu.Dialect("sqlite3")
+	tableStorageTransfer := goqu.T("storagetransfer")
+
+	setClause := goqu.Record{
+		"storagetransfer_creationdate": time.Now(),
+		"storagetransfer_status":       StorageTransferPending,
+		"storage":                      t.Storage.StorageID.Int64,
+		"person":                       t.PersonID,
+		"source_storelocation":         source.StoreLocationID,
+		"source_entity":                source.EntityID,
+		"storelocation":                t.StoreLocation.StoreLocationID.Int64,
+		"entity":                       entityID,
+	}
+	if t.StorageTransferComment.Valid && t.StorageTransferComment.String != "" {
+		setClause["storagetransfer_comment"] = t.StorageTransferComment.String
+	}
+
+	if sqlr, args, err = dialect.Insert(tableStorageTransfer).Rows(setClause).ToSQL(); err != nil {
+		return
+	}
+
+	if sqlResult, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	return sqlResult.LastInsertId()
+
+}
+
+// decideStorageTransfer sets the status of the pending storage transfer
+// with id "id" decided by the person with id "personID".
+// ErrStorageTransferNotPending is returned if the transfer is not pending.
+// The caller is responsible of opening and commiting the tx transaction.
+func (db *SQLiteDataStore) decideStorageTransfer(tx *sqlx.Tx, id int, personID int, status string) error {
+
+	var (
+		err          error
+		sqlr         string
+		args         []interface{}
+		sqlResult    sql.Result
+		rowsAffected int64
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+	tableStorageTransfer := goqu.T("storagetransfer")
+
+	if sqlr, args, err = dialect.Update(tableStorageTransfer).Set(
+		goqu.Record{
+			"storagetransfer_status":       status,
+			"storagetransfer_decisiondate": time.Now(),
+			"decision_person":              personID,
+		},
+	).Where(
+		goqu.I("storagetransfer_id").Eq(id),
+		goqu.I("storagetransfer_status").Eq(StorageTransferPending),
+	).ToSQL(); err != nil {
+		return err
+	}
+
+	if sqlResult, err = tx.Exec(sqlr, args...); err != nil {
+		return err
+	}
+	if rowsAffected, err = sqlResult.RowsAffected(); err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrStorageTransferNotPending
+	}
+
+	return nil
+
+}
+
+// AcceptStorageTransfer accepts the pending storage transfer with id "id"
+// on behalf of the person with id "personID".
+// The storage is moved to the target store location and owned by the person.
+// An history of the storage is created.
+func (db *SQLiteDataStore) AcceptStorageTransfer(id int, personID int) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "personID": personID}).Debug("AcceptStorageTransfer")
+
+	var (
+		tx       *sqlx.Tx
+		sqlr     string
+		exists   bool
+		transfer struct {
+			StorageID       int64          `db:"storage"`
+			StoreLocationID int64          `db:"storelocation"`
+			EntityID        int            `db:"entity"`
+			Barecode        sql.NullString `db:"storage_barecode"`
+			Archive         sql.NullBool   `db:"storage_archive"`
+		}
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if err = db.decideStorageTransfer(tx, id, personID, StorageTransferAccepted); err != nil {
+		return
+	}
+
+	sqlr = `SELECT storagetransfer.storage, storagetransfer.storelocation, storagetransfer.entity,
+	storage.storage_barecode, storage.storage_archive
+	FROM storagetransfer
+	JOIN storage ON storagetransfer.storage = storage.storage_id
+	WHERE storagetransfer.storagetransfer_id = ?`
+	if err = tx.Get(&transfer, sqlr, id); err != nil {
+		return
+	}
+	if transfer.Archive.Valid && transfer.Archive.Bool {
+		err = ErrStorageNotTransferable
+		return
+	}
+
+	// checking the barecode unicity in the target entity
+	if transfer.Barecode.Valid {
+		if exists, err = db.isBarecodeInEntity(tx.Tx, transfer.Barecode.String, transfer.EntityID, transfer.StorageID); err != nil {
+			return
+		}
+		if exists {
+			err = ErrBarecodeAlreadyExists
+			return
+		}
+	}
+
+	// create an history of the storage
+	if _, err = tx.Exec(storageHistoryInsert, transfer.StorageID, transfer.StorageID); err != nil {
+		return
+	}
+
+	sqlr = `UPDATE storage SET storelocation = ?, person = ?, storage_modificationdate = ?
+	WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, transfer.StoreLocationID, personID, time.Now(), transfer.StorageID); err != nil {
+		return
+	}
+
+	return
+
+}
+
+// RefuseStorageTransfer refuses the pending storage transfer with id "id"
+// on behalf of the person with id "personID".
+func (db *SQLiteDataStore) RefuseStorageTransfer(id int, personID int) error {
+	return db.closeStorageTransfer(id, personID, StorageTransferRefused)
+}
+
+// CancelStorageTransfer cancels the pending storage transfer with id "id"
+// on behalf of the person with id "personID".
+func (db *SQLiteDataStore) CancelStorageTransfer(id int, personID int) error {
+	return db.closeStorageTransfer(id, personID, StorageTransferCancelled)
+}
+
+// closeStorageTransfer sets the status of the pending storage transfer
+// with id "id" without moving the storage
+func (db *SQLiteDataStore) closeStorageTransfer(id int, personID int, status string) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "personID": personID, "status": status}).Debug("closeStorageTransfer")
+
+	var tx *sqlx.Tx
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	err = db.decideStorageTransfer(tx, id, personID, status)
+
+	return
+
+}
@@ -0,0 +1,320 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// ErrStorageVersion is returned when restoring a storage
+// to a version that is not one of its history storages
+var ErrStorageVersion = errors.New("not a version of the storage")
+
+// storageVersion is a storage or history storage row
+// with the labels of its foreign keys
+type storageVersion struct {
+	StorageID               int             `db:"storage_id"`
+	StorageModificationDate time.Time       `db:"storage_modificationdate"`
+	PersonID                int             `db:"person_id"`
+	PersonEmail             string          `db:"person_email"`
+	EntryDate               sql.NullTime    `db:"storage_entrydate"`
+	ExitDate                sql.NullTime    `db:"storage_exitdate"`
+	OpeningDate             sql.NullTime    `db:"storage_openingdate"`
+	ExpirationDate          sql.NullTime    `db:"storage_expirationdate"`
+	Comment                 sql.NullString  `db:"storage_comment"`
+	Reference               sql.NullString  `db:"storage_reference"`
+	BatchNumber             sql.NullString  `db:"storage_batchnumber"`
+	Quantity                sql.NullFloat64 `db:"storage_quantity"`
+	Barecode                sql.NullString  `db:"storage_barecode"`
+	ToDestroy               sql.NullBool    `db:"storage_todestroy"`
+	Archive                 sql.NullBool    `db:"storage_archive"`
+	Concentration           sql.NullInt64   `db:"storage_concentration"`
+	NumberOfUnit            sql.NullInt64   `db:"storage_number_of_unit"`
+	NumberOfBag             sql.NullInt64   `db:"storage_number_of_bag"`
+	NumberOfCarton          sql.NullInt64   `db:"storage_number_of_carton"`
+	Price                   sql.NullFloat64 `db:"storage_price"`
+	Currency                sql.NullString  `db:"storage_currency"`
+	Product                 sql.NullString  `db:"product"`
+	StoreLocation           sql.NullString  `db:"storelocation"`
+	UnitQuantity            sql.NullString  `db:"unit_quantity"`
+	UnitConcentration       sql.NullString  `db:"unit_concentration"`
+	Supplier                sql.NullString  `db:"supplier"`
+}
+
+// storageVersionField is a storage field name and value
+type storageVersionField struct {
+	name  string
+	value *string
+}
+
+// fields returns the fields of the version compared between versions
+func (v storageVersion) fields() []storageVersionField {
+
+	str := func(n sql.NullString) *string {
+		if !n.Valid {
+			return nil
+		}
+		return &n.String
+	}
+	date := func(n sql.NullTime) *string {
+		if !n.Valid {
+			return nil
+		}
+		s := n.Time.Format("2006-01-02")
+		return &s
+	}
+	integer := func(n sql.NullInt64) *string {
+		if !n.Valid {
+			return nil
+		}
+		s := strconv.FormatInt(n.Int64, 10)
+		return &s
+	}
+	boolean := func(n sql.NullBool) *string {
+		if !n.Valid {
+			return nil
+		}
+		s := strconv.FormatBool(n.Bool)
+		return &s
+	}
+	float := func(n sql.NullFloat64) *string {
+		if !n.Valid {
+			return nil
+		}
+		s := strconv.FormatFloat(n.Float64, 'f', -1, 64)
+		return &s
+	}
+
+	return []storageVersionField{
+		{"product", str(v.Product)},
+		{"storelocation", str(v.StoreLocation)},
+		{"storage_quantity", float(v.Quantity)},
+		{"unit_quantity", str(v.UnitQuantity)},
+		{"storage_concentration", integer(v.Concentration)},
+		{"unit_concentration", str(v.UnitConcentration)},
+		{"storage_barecode", str(v.Barecode)},
+		{"storage_batchnumber", str(v.BatchNumber)},
+		{"storage_reference", str(v.Reference)},
+		{"supplier", str(v.Supplier)},
+		{"storage_entrydate", date(v.EntryDate)},
+		{"storage_exitdate", date(v.ExitDate)},
+		{"storage_openingdate", date(v.OpeningDate)},
+		{"storage_expirationdate", date(v.ExpirationDate)},
+		{"storage_comment", str(v.Comment)},
+		{"storage_todestroy", boolean(v.ToDestroy)},
+		{"storage_archive", boolean(v.Archive)},
+		{"storage_number_of_unit", integer(v.NumberOfUnit)},
+		{"storage_number_of_bag", integer(v.NumberOfBag)},
+		{"storage_number_of_carton", integer(v.NumberOfCarton)},
+		{"storage_price", float(v.Price)},
+		{"storage_currency", str(v.Currency)},
+	}
+
+}
+
+// changes returns the fields of the version modified from the previous version
+func (v storageVersion) changes(previous storageVersion) []StorageFieldChange {
+
+	changes := []StorageFieldChange{}
+	pfields := previous.fields()
+	for i, f := range v.fields() {
+		old := pfields[i].value
+		if (old == nil) != (f.value == nil) || (old != nil && *old != *f.value) {
+			changes = append(changes, StorageFieldChange{Field: f.name, Old: old, New: f.value})
+		}
+	}
+
+	return changes
+
+}
+
+// GetStorageVersions returns the versions of the storage with id "id",
+// from the oldest history storage to the current storage,
+// with the fields modified by each version.
+func (db *SQLiteDataStore) GetStorageVersions(id int) ([]StorageVersion, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetStorageVersions")
+
+	var (
+		err      error
+		rows     []storageVersion
+		versions []StorageVersion
+	)
+
+	sqlr := `SELECT storage.storage_id,
+	storage.storage_modificationdate,
+	person.person_id,
+	person.person_email,
+	storage.storage_entrydate,
+	storage.storage_exitdate,
+	storage.storage_openingdate,
+	storage.storage_expirationdate,
+	storage.storage_comment,
+	storage.storage_reference,
+	storage.storage_batchnumber,
+	storage.storage_quantity,
+	storage.storage_barecode,
+	storage.storage_todestroy,
+	storage.storage_archive,
+	storage.storage_concentration,
+	storage.storage_number_of_unit,
+	storage.storage_number_of_bag,
+	storage.storage_number_of_carton,
+	storage.storage_price,
+	storage.storage_currency,
+	name.name_label AS product,
+	storelocation.storelocation_fullpath AS storelocation,
+	uq.unit_label AS unit_quantity,
+	uc.unit_label AS unit_concentration,
+	supplier.supplier_label AS supplier
+	FROM storage
+	JOIN person ON storage.person = person.person_id
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id
+	LEFT JOIN unit uc ON storage.unit_concentration = uc.unit_id
+	LEFT JOIN supplier ON storage.supplier = supplier.supplier_id
+	WHERE storage.storage_id = ? OR storage.storage = ?
+	ORDER BY storage.storage IS NULL, storage.storage_id`
+	if err = db.Select(&rows, sqlr, id, id); err != nil {
+		return nil, err
+	}
+
+	for i, row := range rows {
+		v := StorageVersion{
+			StorageVersionID:        row.StorageID,
+			StorageVersionCurrent:   row.StorageID == id,
+			StorageModificationDate: row.StorageModificationDate,
+			Person:                  Person{PersonID: row.PersonID, PersonEmail: row.PersonEmail},
+			Changes:                 []StorageFieldChange{},
+		}
+		if i > 0 {
+			v.Changes = row.changes(rows[i-1])
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+
+}
+
+// RestoreStorageVersion restores the storage with id "id"
+// to its history storage with id "versionID" on behalf of the person with id "personID".
+// The current storage is kept as a new history storage.
+// The archive state of the storage is not restored.
+func (db *SQLiteDataStore) RestoreStorageVersion(id int, versionID int, personID int) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "versionID": versionID, "personID": personID}).Debug("RestoreStorageVersion")
+
+	var (
+		tx      *sqlx.Tx
+		sqlr    string
+		exists  bool
+		version struct {
+			Barecode sql.NullString `db:"storage_barecode"`
+			EntityID int            `db:"entity"`
+		}
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr = `SELECT storage.storage_barecode, storelocation.entity
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	WHERE storage.storage_id = ? AND storage.storage = ?`
+	if err = tx.Get(&version, sqlr, versionID, id); err != nil {
+		if err == sql.ErrNoRows {
+			err = ErrStorageVersion
+		}
+		return
+	}
+
+	// checking the barecode unicity in the entity
+	if version.Barecode.Valid {
+		if exists, err = db.isBarecodeInEntity(tx.Tx, version.Barecode.String, version.EntityID, int64(id)); err != nil {
+			return
+		}
+		if exists {
+			err = ErrBarecodeAlreadyExists
+			return
+		}
+	}
+
+	// create an history of the storage
+	if _, err = tx.Exec(storageHistoryInsert, id, id); err != nil {
+		return
+	}
+
+	sqlr = `UPDATE storage SET (storage_entrydate,
+		storage_exitdate,
+		storage_openingdate,
+		storage_expirationdate,
+		storage_comment,
+		storage_reference,
+		storage_batchnumber,
+		storage_quantity,
+		storage_barecode,
+		storage_todestroy,
+		storage_concentration,
+		storage_number_of_unit,
+		storage_number_of_bag,
+		storage_number_of_carton,
+		storage_price,
+		storage_currency,
+		product,
+		storelocation,
+		unit_quantity,
+		unit_concentration,
+		supplier) = (SELECT storage_entrydate,
+			storage_exitdate,
+			storage_openingdate,
+			storage_expirationdate,
+			storage_comment,
+			storage_reference,
+			storage_batchnumber,
+			storage_quantity,
+			storage_barecode,
+			storage_todestroy,
+			storage_concentration,
+			storage_number_of_unit,
+			storage_number_of_bag,
+			storage_number_of_carton,
+			storage_price,
+			storage_currency,
+			product,
+			storelocation,
+			unit_quantity,
+			unit_concentration,
+			supplier FROM storage WHERE storage_id = ?),
+		person = ?,
+		storage_modificationdate = ?
+	WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, versionID, personID, time.Now(), id); err != nil {
+		return
+	}
+
+	return
+
+}
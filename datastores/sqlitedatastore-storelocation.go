@@ -2,6 +2,7 @@ package datastores
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
@@ -13,6 +14,103 @@ import (
 	. "github.com/tbellembois/gochimitheque/models"
 )
 
+// ErrStoreLocationCycle is returned when a store location is moved under itself or one of its children
+var ErrStoreLocationCycle = errors.New("a store location can not be moved under itself or one of its children")
+
+// storeLocationSubtreeFilter is the condition of a store location
+// being the :storelocation store location or one of its children, at any level
+const storeLocationSubtreeFilter = `storelocation.storelocation_id IN (WITH RECURSIVE subtree(storelocation_id) AS (
+		SELECT :storelocation
+		UNION
+		SELECT child.storelocation_id FROM storelocation child
+		JOIN subtree ON child.storelocation = subtree.storelocation_id)
+	SELECT storelocation_id FROM subtree)`
+
+// isStoreLocationInSubtree returns true if the store location with id "id"
+// is the store location with id "rootID" or one of its children.
+func isStoreLocationInSubtree(tx *sqlx.Tx, id int64, rootID int64) (bool, error) {
+
+	var (
+		err   error
+		count int
+	)
+
+	sqlr := `WITH RECURSIVE subtree(storelocation_id) AS (
+		SELECT ?
+		UNION
+		SELECT storelocation.storelocation_id FROM subtree
+		JOIN storelocation ON storelocation.storelocation = subtree.storelocation_id
+	)
+	SELECT count(*) FROM subtree WHERE storelocation_id = ?`
+	if err = tx.Get(&count, sqlr, rootID, id); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+
+}
+
+// updateStoreLocationSubtreeFullPaths recomputes the full paths of the children
+// of the store location with id "id" from its full path.
+func updateStoreLocationSubtreeFullPaths(tx *sqlx.Tx, id int64) error {
+
+	sqlr := `WITH RECURSIVE subtree(storelocation_id, storelocation_fullpath) AS (
+		SELECT storelocation_id, storelocation_fullpath FROM storelocation WHERE storelocation_id = ?
+		UNION ALL
+		SELECT storelocation.storelocation_id, subtree.storelocation_fullpath || '/' || storelocation.storelocation_name FROM subtree
+		JOIN storelocation ON storelocation.storelocation = subtree.storelocation_id
+	)
+	UPDATE storelocation SET storelocation_fullpath = (SELECT subtree.storelocation_fullpath FROM subtree
+		WHERE subtree.storelocation_id = storelocation.storelocation_id)
+	WHERE storelocation_id IN (SELECT storelocation_id FROM subtree WHERE storelocation_id != ?)`
+	_, err := tx.Exec(sqlr, id, id)
+
+	return err
+
+}
+
+// RebuildStoreLocationFullPaths recomputes the full paths of all the store locations
+// from their names and parents in one transaction, and returns the number of updated paths.
+// The store locations not attached to a root store location, in a cycle, are left unchanged.
+func (db *SQLiteDataStore) RebuildStoreLocationFullPaths() (count int64, err error) {
+
+	var (
+		tx  *sqlx.Tx
+		res sql.Result
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				logger.Log.Error(errr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr := `WITH RECURSIVE paths(storelocation_id, storelocation_fullpath) AS (
+		SELECT storelocation_id, storelocation_name FROM storelocation WHERE storelocation IS NULL
+		UNION ALL
+		SELECT storelocation.storelocation_id, paths.storelocation_fullpath || '/' || storelocation.storelocation_name FROM paths
+		JOIN storelocation ON storelocation.storelocation = paths.storelocation_id
+	)
+	UPDATE storelocation SET storelocation_fullpath = (SELECT paths.storelocation_fullpath FROM paths
+		WHERE paths.storelocation_id = storelocation.storelocation_id)
+	WHERE storelocation_id IN (SELECT storelocation_id FROM paths)
+	AND storelocation_fullpath IS NOT (SELECT paths.storelocation_fullpath FROM paths
+		WHERE paths.storelocation_id = storelocation.storelocation_id)`
+	if res, err = tx.Exec(sqlr); err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+
+}
+
 // Return the store location full path.
 // The caller is responsible of opening and commiting the tx transaction.
 func (db *SQLiteDataStore) buildFullPath(s StoreLocation, tx *sqlx.Tx) string {
@@ -94,6 +192,9 @@ func (db *SQLiteDataStore) GetStoreLocations(p DbselectparamStoreLocation) ([]St
 	).LeftJoin(
 		goqu.T("storelocation"),
 		goqu.On(goqu.Ex{"s.storelocation": goqu.I("storelocation.storelocation_id")}),
+	).LeftJoin(
+		goqu.T("person").As("responsible"),
+		goqu.On(goqu.Ex{"s.storelocation_responsible": goqu.I("responsible.person_id")}),
 	).Join(
 		goqu.T("permission").As("perm"),
 		goqu.On(
@@ -142,6 +243,14 @@ func (db *SQLiteDataStore) GetStoreLocations(p DbselectparamStoreLocation) ([]St
 		goqu.I("s.storelocation_id").As("storelocation_id"),
 		goqu.I("s.storelocation_name").As("storelocation_name"),
 		goqu.I("s.storelocation_fullpath").As("storelocation_fullpath"),
+		goqu.I("s.storelocation_barecodeprefix").As("storelocation_barecodeprefix"),
+		goqu.I("s.storelocation_type").As("storelocation_type"),
+		goqu.I("s.storelocation_mintemperature").As("storelocation_mintemperature"),
+		goqu.I("s.storelocation_maxtemperature").As("storelocation_maxtemperature"),
+		goqu.I("s.storelocation_level").As("storelocation_level"),
+		goqu.I("s.storelocation_roomnumber").As("storelocation_roomnumber"),
+		goqu.I("s.storelocation_responsible").As("storelocation_responsible"),
+		goqu.I("responsible.person_email").As("storelocation_responsibleemail"),
 		goqu.I("storelocation.storelocation_id").As(goqu.C("storelocation.storelocation_id")),
 		goqu.I("storelocation.storelocation_name").As(goqu.C("storelocation.storelocation_name")),
 		goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
@@ -186,6 +295,9 @@ func (db *SQLiteDataStore) GetStoreLocation(id int) (StoreLocation, error) {
 	).LeftJoin(
 		goqu.T("storelocation"),
 		goqu.On(goqu.Ex{"s.storelocation": goqu.I("storelocation.storelocation_id")}),
+	).LeftJoin(
+		goqu.T("person").As("responsible"),
+		goqu.On(goqu.Ex{"s.storelocation_responsible": goqu.I("responsible.person_id")}),
 	).Where(
 		goqu.I("s.storelocation_id").Eq(id),
 	).Select(
@@ -194,6 +306,14 @@ func (db *SQLiteDataStore) GetStoreLocation(id int) (StoreLocation, error) {
 		goqu.I("s.storelocation_canstore"),
 		goqu.I("s.storelocation_color"),
 		goqu.I("s.storelocation_fullpath"),
+		goqu.I("s.storelocation_barecodeprefix"),
+		goqu.I("s.storelocation_type"),
+		goqu.I("s.storelocation_mintemperature"),
+		goqu.I("s.storelocation_maxtemperature"),
+		goqu.I("s.storelocation_level"),
+		goqu.I("s.storelocation_roomnumber"),
+		goqu.I("s.storelocation_responsible"),
+		goqu.I("responsible.person_email").As("storelocation_responsibleemail"),
 		goqu.I("storelocation.storelocation_id").As(goqu.C("storelocation.storelocation_id")),
 		goqu.I("storelocation.storelocation_name").As(goqu.C("storelocation.storelocation_name")),
 		goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
@@ -222,6 +342,60 @@ func (db *SQLiteDataStore) GetStoreLocation(id int) (StoreLocation, error) {
 
 }
 
+// GetStoreLocationsByBarecodePrefix select the store locations with the barecode prefix.
+func (db *SQLiteDataStore) GetStoreLocationsByBarecodePrefix(prefix string) ([]StoreLocation, error) {
+
+	dialect := goqu.Dialect("sqlite3")
+	tableStorelocation := goqu.T("storelocation")
+
+	// Select
+	sQuery := dialect.From(tableStorelocation.As("s")).Select(
+		goqu.I("s.storelocation_id"),
+		goqu.I("s.storelocation_name"),
+		goqu.I("s.storelocation_canstore"),
+		goqu.I("s.storelocation_color"),
+		goqu.I("s.storelocation_fullpath"),
+		goqu.I("s.storelocation_barecodeprefix"),
+		goqu.I("s.storelocation_type"),
+		goqu.I("s.storelocation_mintemperature"),
+		goqu.I("s.storelocation_maxtemperature"),
+		goqu.I("s.storelocation_level"),
+		goqu.I("s.storelocation_roomnumber"),
+		goqu.I("s.storelocation_responsible"),
+		goqu.I("storelocation.storelocation_id").As(goqu.C("storelocation.storelocation_id")),
+		goqu.I("storelocation.storelocation_name").As(goqu.C("storelocation.storelocation_name")),
+		goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
+		goqu.I("entity.entity_name").As(goqu.C("entity.entity_name")),
+	).Join(
+		goqu.T("entity"),
+		goqu.On(goqu.Ex{"s.entity": goqu.I("entity.entity_id")}),
+	).LeftJoin(
+		goqu.T("storelocation"),
+		goqu.On(goqu.Ex{"s.storelocation": goqu.I("storelocation.storelocation_id")}),
+	).Where(
+		goqu.I("s.storelocation_barecodeprefix").Eq(prefix),
+	)
+
+	var (
+		err            error
+		sqlr           string
+		args           []interface{}
+		storelocations []StoreLocation
+	)
+
+	if sqlr, args, err = sQuery.ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return nil, err
+	}
+
+	if err = db.Select(&storelocations, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return storelocations, nil
+
+}
+
 // GetStoreLocationChildren select the children store locations of parent id.
 func (db *SQLiteDataStore) GetStoreLocationChildren(id int) ([]StoreLocation, error) {
 
@@ -235,6 +409,13 @@ func (db *SQLiteDataStore) GetStoreLocationChildren(id int) ([]StoreLocation, er
 		goqu.I("s.storelocation_canstore"),
 		goqu.I("s.storelocation_color"),
 		goqu.I("s.storelocation_fullpath"),
+		goqu.I("s.storelocation_barecodeprefix"),
+		goqu.I("s.storelocation_type"),
+		goqu.I("s.storelocation_mintemperature"),
+		goqu.I("s.storelocation_maxtemperature"),
+		goqu.I("s.storelocation_level"),
+		goqu.I("s.storelocation_roomnumber"),
+		goqu.I("s.storelocation_responsible"),
 		goqu.I("storelocation.storelocation_id").As(goqu.C("storelocation.storelocation_id")),
 		goqu.I("storelocation.storelocation_name").As(goqu.C("storelocation.storelocation_name")),
 		goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
@@ -343,6 +524,41 @@ func (db *SQLiteDataStore) CreateStoreLocation(s StoreLocation) (lastInsertId in
 	if s.StoreLocationColor.Valid {
 		setClause["storelocation_color"] = s.StoreLocationColor.String
 	}
+	if s.StoreLocationBarecodePrefix.Valid && s.StoreLocationBarecodePrefix.String != "" {
+		setClause["storelocation_barecodeprefix"] = s.StoreLocationBarecodePrefix.String
+	} else {
+		setClause["storelocation_barecodeprefix"] = nil
+	}
+	if s.StoreLocationType.Valid && s.StoreLocationType.String != "" {
+		setClause["storelocation_type"] = s.StoreLocationType.String
+	} else {
+		setClause["storelocation_type"] = nil
+	}
+	if s.StoreLocationMinTemperature.Valid {
+		setClause["storelocation_mintemperature"] = s.StoreLocationMinTemperature.Float64
+	} else {
+		setClause["storelocation_mintemperature"] = nil
+	}
+	if s.StoreLocationMaxTemperature.Valid {
+		setClause["storelocation_maxtemperature"] = s.StoreLocationMaxTemperature.Float64
+	} else {
+		setClause["storelocation_maxtemperature"] = nil
+	}
+	if s.StoreLocationLevel.Valid && s.StoreLocationLevel.String != "" {
+		setClause["storelocation_level"] = s.StoreLocationLevel.String
+	} else {
+		setClause["storelocation_level"] = nil
+	}
+	if s.StoreLocationRoomNumber.Valid && s.StoreLocationRoomNumber.String != "" {
+		setClause["storelocation_roomnumber"] = s.StoreLocationRoomNumber.String
+	} else {
+		setClause["storelocation_roomnumber"] = nil
+	}
+	if s.StoreLocationResponsible.Valid {
+		setClause["storelocation_responsible"] = s.StoreLocationResponsible.Int64
+	} else {
+		setClause["storelocation_responsible"] = nil
+	}
 	if s.StoreLocation != nil {
 		setClause["storelocation"] = s.StoreLocation.StoreLocationID.Int64
 	}
@@ -392,6 +608,18 @@ func (db *SQLiteDataStore) UpdateStoreLocation(s StoreLocation) (err error) {
 		err = tx.Commit()
 	}()
 
+	// the store location can not be moved under itself or its children
+	if s.StoreLocation != nil && s.StoreLocation.StoreLocationID.Valid {
+		var cycle bool
+		if cycle, err = isStoreLocationInSubtree(tx, s.StoreLocation.StoreLocationID.Int64, s.StoreLocationID.Int64); err != nil {
+			return
+		}
+		if cycle {
+			err = ErrStoreLocationCycle
+			return
+		}
+	}
+
 	s.StoreLocationFullPath = db.buildFullPath(s, tx)
 
 	uQuery := dialect.Update(tableStorelocation)
@@ -408,8 +636,45 @@ func (db *SQLiteDataStore) UpdateStoreLocation(s StoreLocation) (err error) {
 	if s.StoreLocationColor.Valid {
 		setClause["storelocation_color"] = s.StoreLocationColor.String
 	}
-	if s.StoreLocation != nil {
+	if s.StoreLocationBarecodePrefix.Valid && s.StoreLocationBarecodePrefix.String != "" {
+		setClause["storelocation_barecodeprefix"] = s.StoreLocationBarecodePrefix.String
+	} else {
+		setClause["storelocation_barecodeprefix"] = nil
+	}
+	if s.StoreLocationType.Valid && s.StoreLocationType.String != "" {
+		setClause["storelocation_type"] = s.StoreLocationType.String
+	} else {
+		setClause["storelocation_type"] = nil
+	}
+	if s.StoreLocationMinTemperature.Valid {
+		setClause["storelocation_mintemperature"] = s.StoreLocationMinTemperature.Float64
+	} else {
+		setClause["storelocation_mintemperature"] = nil
+	}
+	if s.StoreLocationMaxTemperature.Valid {
+		setClause["storelocation_maxtemperature"] = s.StoreLocationMaxTemperature.Float64
+	} else {
+		setClause["storelocation_maxtemperature"] = nil
+	}
+	if s.StoreLocationLevel.Valid && s.StoreLocationLevel.String != "" {
+		setClause["storelocation_level"] = s.StoreLocationLevel.String
+	} else {
+		setClause["storelocation_level"] = nil
+	}
+	if s.StoreLocationRoomNumber.Valid && s.StoreLocationRoomNumber.String != "" {
+		setClause["storelocation_roomnumber"] = s.StoreLocationRoomNumber.String
+	} else {
+		setClause["storelocation_roomnumber"] = nil
+	}
+	if s.StoreLocationResponsible.Valid {
+		setClause["storelocation_responsible"] = s.StoreLocationResponsible.Int64
+	} else {
+		setClause["storelocation_responsible"] = nil
+	}
+	if s.StoreLocation != nil && s.StoreLocation.StoreLocationID.Valid {
 		setClause["storelocation"] = s.StoreLocation.StoreLocationID.Int64
+	} else {
+		setClause["storelocation"] = nil
 	}
 
 	var (
@@ -430,7 +695,8 @@ func (db *SQLiteDataStore) UpdateStoreLocation(s StoreLocation) (err error) {
 		return
 	}
 
-	return nil
+	// the children paths depend on the store location name and parent
+	return updateStoreLocationSubtreeFullPaths(tx, s.StoreLocationID.Int64)
 
 }
 
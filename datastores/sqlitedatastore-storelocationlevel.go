@@ -0,0 +1,164 @@
+package datastores
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// storeLocationRollupSubtree is the subtree CTE of the store location
+// of a rollup and its children
+const storeLocationRollupSubtree = `WITH RECURSIVE subtree(storelocation_id) AS (
+		SELECT ?
+		UNION
+		SELECT storelocation.storelocation_id FROM subtree
+		JOIN storelocation ON storelocation.storelocation = subtree.storelocation_id
+	)`
+
+// getStoreLocationRollup returns the stock and hazards of the current storages
+// of the store location sl and its children.
+func (db *SQLiteDataStore) getStoreLocationRollup(sl StoreLocation) (StoreLocationRollup, error) {
+
+	var (
+		err      error
+		storages []Storage
+		rollup   = StoreLocationRollup{
+			StoreLocation: sl,
+			Totals:        []ConvertedQuantity{},
+			Symbols:       []StoreLocationRollupSymbol{},
+		}
+	)
+
+	sqlr := storeLocationRollupSubtree + `
+	SELECT storage.storage_id,
+	storage.storage_quantity,
+	uq.unit_id AS "unit_quantity.unit_id",
+	COALESCE(uq.unit_multiplier, 1) AS "unit_quantity.unit_multiplier",
+	uq.unit_dimension AS "unit_quantity.unit_dimension"
+	FROM storage
+	JOIN subtree ON storage.storelocation = subtree.storelocation_id
+	LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE`
+	if err = db.Select(&storages, sqlr, sl.StoreLocationID.Int64); err != nil {
+		return rollup, err
+	}
+
+	totals := map[string]float64{}
+	for _, s := range storages {
+		rollup.StorageCount++
+		// no conversion between dimensions, the totals are per storage unit dimension
+		c := s.Product.ConvertQuantity(s.StorageQuantity, s.UnitQuantity, s.UnitQuantity.UnitDimension.String)
+		if !c.Convertible {
+			rollup.NotConvertibleCount++
+			continue
+		}
+		totals[c.Dimension] += c.Quantity
+	}
+	for _, d := range []string{UnitDimensionMass, UnitDimensionVolume, UnitDimensionMoles} {
+		if t, ok := totals[d]; ok {
+			rollup.Totals = append(rollup.Totals, ConvertedQuantity{
+				Dimension:   d,
+				UnitLabel:   ReferenceUnitLabels[d],
+				Quantity:    roundStock(t),
+				Convertible: true,
+			})
+		}
+	}
+
+	sqlr = storeLocationRollupSubtree + `
+	SELECT symbol.symbol_id AS "symbol.symbol_id",
+	symbol.symbol_label AS "symbol.symbol_label",
+	COUNT(DISTINCT storage.storage_id) AS "storagecount"
+	FROM storage
+	JOIN subtree ON storage.storelocation = subtree.storelocation_id
+	JOIN productsymbols ON productsymbols.productsymbols_product_id = storage.product
+	JOIN symbol ON productsymbols.productsymbols_symbol_id = symbol.symbol_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE
+	GROUP BY symbol.symbol_id
+	ORDER BY symbol.symbol_label`
+	if err = db.Select(&rollup.Symbols, sqlr, sl.StoreLocationID.Int64); err != nil {
+		return rollup, err
+	}
+
+	sqlr = storeLocationRollupSubtree + `
+	SELECT COUNT(DISTINCT storage.storage_id)
+	FROM storage
+	JOIN subtree ON storage.storelocation = subtree.storelocation_id
+	JOIN product ON storage.product = product.product_id
+	LEFT JOIN casnumber ON product.casnumber = casnumber.casnumber_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE
+	AND (casnumber.casnumber_cmr IS NOT NULL
+	OR EXISTS (SELECT 1 FROM producthazardstatements
+		JOIN hazardstatement ON producthazardstatements_hazardstatement_id = hazardstatement.hazardstatement_id
+		WHERE producthazardstatements_product_id = product.product_id
+		AND hazardstatement.hazardstatement_cmr IS NOT NULL AND hazardstatement.hazardstatement_cmr != ''))`
+	if err = db.Get(&rollup.CMRCount, sqlr, sl.StoreLocationID.Int64); err != nil {
+		return rollup, err
+	}
+
+	return rollup, nil
+
+}
+
+// GetStoreLocationRollups returns the stock and hazards of the store locations
+// of the level "level" of the entities, including their children,
+// all the levels if "level" is empty and all the entities if entities is nil.
+func (db *SQLiteDataStore) GetStoreLocationRollups(entities []int, level string) ([]StoreLocationRollup, error) {
+
+	logger.Log.WithFields(logrus.Fields{"entities": entities, "level": level}).Debug("GetStoreLocationRollups")
+
+	var (
+		err            error
+		args           []interface{}
+		storelocations []StoreLocation
+		rollup         StoreLocationRollup
+		rollups        = []StoreLocationRollup{}
+	)
+
+	sqlr := `SELECT storelocation.storelocation_id,
+	storelocation.storelocation_name,
+	storelocation.storelocation_fullpath,
+	storelocation.storelocation_level,
+	storelocation.storelocation_roomnumber,
+	storelocation.storelocation_responsible,
+	responsible.person_email AS "storelocation_responsibleemail",
+	entity.entity_id AS "entity.entity_id",
+	entity.entity_name AS "entity.entity_name"
+	FROM storelocation
+	JOIN entity ON storelocation.entity = entity.entity_id
+	LEFT JOIN person responsible ON storelocation.storelocation_responsible = responsible.person_id
+	WHERE storelocation.storelocation_level IS NOT NULL`
+	if level != "" {
+		sqlr += ` AND storelocation.storelocation_level = ?`
+		args = append(args, level)
+	}
+	if entities != nil {
+		if len(entities) == 0 {
+			return rollups, nil
+		}
+		sqlr += ` AND storelocation.entity IN (?)`
+		args = append(args, entities)
+	}
+	sqlr += ` ORDER BY entity.entity_name, storelocation.storelocation_fullpath`
+
+	if sqlr, args, err = sqlx.In(sqlr, args...); err != nil {
+		return nil, err
+	}
+	if err = db.Select(&storelocations, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
+	}
+
+	for _, sl := range storelocations {
+		if rollup, err = db.getStoreLocationRollup(sl); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, rollup)
+	}
+
+	return rollups, nil
+
+}
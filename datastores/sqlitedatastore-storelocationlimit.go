@@ -0,0 +1,524 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// ErrStoreLocationLimitUnit is returned for a limit unit that is not a mass,
+// volume or moles unit
+var ErrStoreLocationLimitUnit = errors.New("the store location limit unit must be a mass, volume or moles unit")
+
+// ErrStoreLocationLimitCriteria is returned for a limit without hazard statement,
+// symbol nor physical state
+var ErrStoreLocationLimitCriteria = errors.New("the store location limit must have a hazard statement, a symbol or a physical state")
+
+// storeLocationLimitColumns are the columns of the store location limits select
+const storeLocationLimitColumns = `storelocationlimit.storelocationlimit_id,
+	storelocationlimit.storelocationlimit_label,
+	storelocationlimit.storelocationlimit_quantity,
+	storelocationlimit.storelocationlimit_hard,
+	storelocation.storelocation_id AS "storelocation.storelocation_id",
+	storelocation.storelocation_name AS "storelocation.storelocation_name",
+	storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath",
+	entity.entity_id AS "storelocation.entity.entity_id",
+	entity.entity_name AS "storelocation.entity.entity_name",
+	unit.unit_id AS "unit.unit_id",
+	unit.unit_label AS "unit.unit_label",
+	unit.unit_multiplier AS "unit.unit_multiplier",
+	unit.unit_dimension AS "unit.unit_dimension",
+	physicalstate.physicalstate_id AS "physicalstate.physicalstate_id",
+	physicalstate.physicalstate_label AS "physicalstate.physicalstate_label"
+	FROM storelocationlimit
+	JOIN storelocation ON storelocationlimit.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id
+	JOIN unit ON storelocationlimit.unit = unit.unit_id
+	LEFT JOIN physicalstate ON storelocationlimit.physicalstate = physicalstate.physicalstate_id`
+
+// storeLocationLimitProductMatch is the condition of a product
+// matching the criteria of a store location limit:
+// one of its hazard statements, one of its symbols and its physical state,
+// each criterion being ignored if not set.
+const storeLocationLimitProductMatch = `(NOT EXISTS (SELECT 1 FROM storelocationlimithazardstatements
+		WHERE storelocationlimithazardstatements_storelocationlimit_id = storelocationlimit.storelocationlimit_id)
+	OR EXISTS (SELECT 1 FROM storelocationlimithazardstatements
+		JOIN producthazardstatements ON producthazardstatements_hazardstatement_id = storelocationlimithazardstatements_hazardstatement_id
+		WHERE storelocationlimithazardstatements_storelocationlimit_id = storelocationlimit.storelocationlimit_id
+		AND producthazardstatements_product_id = product.product_id))
+	AND (NOT EXISTS (SELECT 1 FROM storelocationlimitsymbols
+		WHERE storelocationlimitsymbols_storelocationlimit_id = storelocationlimit.storelocationlimit_id)
+	OR EXISTS (SELECT 1 FROM storelocationlimitsymbols
+		JOIN productsymbols ON productsymbols_symbol_id = storelocationlimitsymbols_symbol_id
+		WHERE storelocationlimitsymbols_storelocationlimit_id = storelocationlimit.storelocationlimit_id
+		AND productsymbols_product_id = product.product_id))
+	AND (storelocationlimit.physicalstate IS NULL OR storelocationlimit.physicalstate = product.physicalstate)`
+
+// getStoreLocationLimitsCriteria sets the hazard statements and symbols of the limits.
+func (db *SQLiteDataStore) getStoreLocationLimitsCriteria(limits []StoreLocationLimit) error {
+
+	var err error
+
+	for i := range limits {
+		limits[i].HazardStatements = []HazardStatement{}
+		limits[i].Symbols = []Symbol{}
+
+		sqlr := `SELECT hazardstatement_id, hazardstatement_label, hazardstatement_reference
+		FROM hazardstatement
+		JOIN storelocationlimithazardstatements ON storelocationlimithazardstatements_hazardstatement_id = hazardstatement_id
+		WHERE storelocationlimithazardstatements_storelocationlimit_id = ?
+		ORDER BY hazardstatement_reference`
+		if err = db.Select(&limits[i].HazardStatements, sqlr, limits[i].StoreLocationLimitID); err != nil {
+			return err
+		}
+
+		sqlr = `SELECT symbol_id, symbol_label FROM symbol
+		JOIN storelocationlimitsymbols ON storelocationlimitsymbols_symbol_id = symbol_id
+		WHERE storelocationlimitsymbols_storelocationlimit_id = ?
+		ORDER BY symbol_label`
+		if err = db.Select(&limits[i].Symbols, sqlr, limits[i].StoreLocationLimitID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// GetStoreLocationLimit returns the store location limit with id "id".
+func (db *SQLiteDataStore) GetStoreLocationLimit(id int) (StoreLocationLimit, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetStoreLocationLimit")
+
+	var (
+		err    error
+		limits = make([]StoreLocationLimit, 1)
+	)
+
+	sqlr := `SELECT ` + storeLocationLimitColumns + ` WHERE storelocationlimit.storelocationlimit_id = ?`
+	if err = db.Get(&limits[0], sqlr, id); err != nil {
+		return StoreLocationLimit{}, err
+	}
+	if err = db.getStoreLocationLimitsCriteria(limits); err != nil {
+		return StoreLocationLimit{}, err
+	}
+
+	return limits[0], nil
+
+}
+
+// setStoreLocationLimitCriteria replaces the hazard statements and symbols of the limit l.
+func setStoreLocationLimitCriteria(tx *sqlx.Tx, l StoreLocationLimit) (err error) {
+
+	sqlr := `DELETE FROM storelocationlimithazardstatements WHERE storelocationlimithazardstatements_storelocationlimit_id = ?`
+	if _, err = tx.Exec(sqlr, l.StoreLocationLimitID); err != nil {
+		return err
+	}
+	sqlr = `DELETE FROM storelocationlimitsymbols WHERE storelocationlimitsymbols_storelocationlimit_id = ?`
+	if _, err = tx.Exec(sqlr, l.StoreLocationLimitID); err != nil {
+		return err
+	}
+
+	for _, hs := range l.HazardStatements {
+		sqlr = `INSERT INTO storelocationlimithazardstatements (storelocationlimithazardstatements_storelocationlimit_id, storelocationlimithazardstatements_hazardstatement_id) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`
+		if _, err = tx.Exec(sqlr, l.StoreLocationLimitID, hs.HazardStatementID); err != nil {
+			return err
+		}
+	}
+	for _, sym := range l.Symbols {
+		sqlr = `INSERT INTO storelocationlimitsymbols (storelocationlimitsymbols_storelocationlimit_id, storelocationlimitsymbols_symbol_id) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`
+		if _, err = tx.Exec(sqlr, l.StoreLocationLimitID, sym.SymbolID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// checkStoreLocationLimit returns an error if the limit l has no criteria
+// or if its unit is not convertible.
+func (db *SQLiteDataStore) checkStoreLocationLimit(l StoreLocationLimit) error {
+
+	var (
+		err       error
+		dimension sql.NullString
+	)
+
+	if len(l.HazardStatements) == 0 && len(l.Symbols) == 0 && !l.PhysicalState.PhysicalStateID.Valid {
+		return ErrStoreLocationLimitCriteria
+	}
+
+	sqlr := `SELECT unit_dimension FROM unit WHERE unit_id = ?`
+	if err = db.Get(&dimension, sqlr, l.Unit.UnitID.Int64); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if _, ok := ReferenceUnitLabels[dimension.String]; !ok {
+		return ErrStoreLocationLimitUnit
+	}
+
+	return nil
+
+}
+
+// CreateStoreLocationLimit inserts the store location limit l with its criteria.
+func (db *SQLiteDataStore) CreateStoreLocationLimit(l StoreLocationLimit) (lastInsertID int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"l": l}).Debug("CreateStoreLocationLimit")
+
+	var (
+		tx  *sqlx.Tx
+		res sql.Result
+	)
+
+	if err = db.checkStoreLocationLimit(l); err != nil {
+		return 0, err
+	}
+
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				logger.Log.Error(errr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr := `INSERT INTO storelocationlimit (storelocationlimit_label, storelocationlimit_quantity, storelocationlimit_hard, storelocation, unit, physicalstate)
+	VALUES (?, ?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr,
+		l.StoreLocationLimitLabel,
+		l.StoreLocationLimitQuantity,
+		l.StoreLocationLimitHard,
+		l.StoreLocationID.Int64,
+		l.Unit.UnitID.Int64,
+		l.PhysicalState.PhysicalStateID); err != nil {
+		return 0, err
+	}
+	if lastInsertID, err = res.LastInsertId(); err != nil {
+		return 0, err
+	}
+
+	l.StoreLocationLimitID = int(lastInsertID)
+	if err = setStoreLocationLimitCriteria(tx, l); err != nil {
+		return 0, err
+	}
+
+	return lastInsertID, nil
+
+}
+
+// UpdateStoreLocationLimit updates the store location limit l with its criteria.
+// The store location of a limit can not be changed.
+func (db *SQLiteDataStore) UpdateStoreLocationLimit(l StoreLocationLimit) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"l": l}).Debug("UpdateStoreLocationLimit")
+
+	var tx *sqlx.Tx
+
+	if err = db.checkStoreLocationLimit(l); err != nil {
+		return err
+	}
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if errr := tx.Rollback(); errr != nil {
+				logger.Log.Error(errr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr := `UPDATE storelocationlimit SET storelocationlimit_label = ?,
+	storelocationlimit_quantity = ?,
+	storelocationlimit_hard = ?,
+	unit = ?,
+	physicalstate = ?
+	WHERE storelocationlimit_id = ?`
+	if _, err = tx.Exec(sqlr,
+		l.StoreLocationLimitLabel,
+		l.StoreLocationLimitQuantity,
+		l.StoreLocationLimitHard,
+		l.Unit.UnitID.Int64,
+		l.PhysicalState.PhysicalStateID,
+		l.StoreLocationLimitID); err != nil {
+		return err
+	}
+
+	return setStoreLocationLimitCriteria(tx, l)
+
+}
+
+// DeleteStoreLocationLimit deletes the store location limit with id "id".
+func (db *SQLiteDataStore) DeleteStoreLocationLimit(id int) error {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteStoreLocationLimit")
+
+	var err error
+
+	sqlr := `DELETE FROM storelocationlimit WHERE storelocationlimit_id = ?`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// roundStock rounds the stock q to remove the floating point
+// noise of the unit conversions
+func roundStock(q float64) float64 {
+
+	return math.Round(q*1e9) / 1e9
+
+}
+
+// getStoreLocationLimitStatus returns the stock of the products matching the limit l
+// in its store location and its children, excluding the storages with ids "excludeIDs".
+// The stock only includes the current storages, the ones whose quantity
+// can not be converted into the limit unit are counted apart.
+func (db *SQLiteDataStore) getStoreLocationLimitStatus(l StoreLocationLimit, excludeIDs []int64) (StoreLocationLimitStatus, error) {
+
+	var (
+		err      error
+		args     []interface{}
+		storages []Storage
+		status   = StoreLocationLimitStatus{Limit: l}
+	)
+
+	if len(excludeIDs) == 0 {
+		excludeIDs = []int64{-1}
+	}
+
+	sqlr := `WITH RECURSIVE closure(storelocation_id) AS (
+		SELECT storelocation FROM storelocationlimit WHERE storelocationlimit_id = ?
+		UNION ALL
+		SELECT storelocation.storelocation_id FROM closure
+		JOIN storelocation ON storelocation.storelocation = closure.storelocation_id
+	)
+	SELECT storage.storage_id,
+	storage.storage_quantity,
+	uq.unit_id AS "unit_quantity.unit_id",
+	COALESCE(uq.unit_multiplier, 1) AS "unit_quantity.unit_multiplier",
+	uq.unit_dimension AS "unit_quantity.unit_dimension",
+	product.product_id AS "product.product_id",
+	product.product_density AS "product.product_density",
+	product.product_molarmass AS "product.product_molarmass",
+	empiricalformula.empiricalformula_label AS "product.empiricalformula.empiricalformula_label"
+	FROM storage
+	JOIN closure ON storage.storelocation = closure.storelocation_id
+	JOIN storelocationlimit ON storelocationlimit.storelocationlimit_id = ?
+	JOIN product ON storage.product = product.product_id
+	LEFT JOIN empiricalformula ON product.empiricalformula = empiricalformula.empiricalformula_id
+	LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE
+	AND storage.storage_id NOT IN (?)
+	AND ` + storeLocationLimitProductMatch
+	if sqlr, args, err = sqlx.In(sqlr, l.StoreLocationLimitID, l.StoreLocationLimitID, excludeIDs); err != nil {
+		return status, err
+	}
+	if err = db.Select(&storages, db.Rebind(sqlr), args...); err != nil {
+		return status, err
+	}
+
+	for _, s := range storages {
+		c := s.Product.ConvertQuantity(s.StorageQuantity, s.UnitQuantity, l.Unit.UnitDimension.String)
+		if !c.Convertible {
+			status.NotConvertibleCount++
+			continue
+		}
+		status.Stock += c.Quantity / l.Unit.UnitMultiplier
+	}
+	status.Stock = roundStock(status.Stock)
+	status.Exceeded = status.Stock > l.StoreLocationLimitQuantity
+
+	return status, nil
+
+}
+
+// GetStoreLocationLimitStatuses returns the store location limits of the entities
+// with their current stock, all of them if entities is nil.
+func (db *SQLiteDataStore) GetStoreLocationLimitStatuses(entities []int) ([]StoreLocationLimitStatus, error) {
+
+	logger.Log.WithFields(logrus.Fields{"entities": entities}).Debug("GetStoreLocationLimitStatuses")
+
+	var (
+		err      error
+		sqlr     string
+		args     []interface{}
+		limits   []StoreLocationLimit
+		statuses = []StoreLocationLimitStatus{}
+	)
+
+	sqlr = `SELECT ` + storeLocationLimitColumns
+	if entities != nil {
+		if len(entities) == 0 {
+			return statuses, nil
+		}
+		if sqlr, args, err = sqlx.In(sqlr+` WHERE storelocation.entity IN (?)`, entities); err != nil {
+			return nil, err
+		}
+		sqlr = db.Rebind(sqlr)
+	}
+	sqlr += ` ORDER BY entity.entity_name, storelocation.storelocation_fullpath, storelocationlimit.storelocationlimit_label`
+
+	if err = db.Select(&limits, sqlr, args...); err != nil {
+		return nil, err
+	}
+	if err = db.getStoreLocationLimitsCriteria(limits); err != nil {
+		return nil, err
+	}
+
+	for _, l := range limits {
+		var status StoreLocationLimitStatus
+		if status, err = db.getStoreLocationLimitStatus(l, nil); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+
+}
+
+// CheckStoreLocationLimits returns the limits of the store location of the storage s
+// and of its ancestors that would be exceeded by storing "count" storages s,
+// with their stock including them.
+// If s is an existing storage, its former quantity is not included in the stock.
+func (db *SQLiteDataStore) CheckStoreLocationLimits(s Storage, count int) ([]StoreLocationLimitStatus, error) {
+
+	logger.Log.WithFields(logrus.Fields{"s": s, "count": count}).Debug("CheckStoreLocationLimits")
+
+	return db.checkStoreLocationLimits([]Storage{s}, count)
+
+}
+
+// CheckStoreLocationBatchLimits returns the limits of the store location of the storages ss,
+// all stored in the same store location, and of its ancestors
+// that would be exceeded by storing them together, with their stock including them.
+// The former quantities of the existing storages are not included in the stock.
+func (db *SQLiteDataStore) CheckStoreLocationBatchLimits(ss []Storage) ([]StoreLocationLimitStatus, error) {
+
+	logger.Log.WithFields(logrus.Fields{"ss": ss}).Debug("CheckStoreLocationBatchLimits")
+
+	return db.checkStoreLocationLimits(ss, 1)
+
+}
+
+// checkStoreLocationLimits returns the limits of the store location of the storages ss
+// and of its ancestors that would be exceeded by storing "count" storages of each of ss.
+func (db *SQLiteDataStore) checkStoreLocationLimits(ss []Storage, count int) ([]StoreLocationLimitStatus, error) {
+
+	var (
+		err        error
+		limitIDs   []int // in the order of their first matching storage
+		excludeIDs []int64
+		limits     = make(map[int]StoreLocationLimit)
+		added      = make(map[int]*StoreLocationLimitStatus)
+		exceeded   = []StoreLocationLimitStatus{}
+	)
+
+	for _, s := range ss {
+
+		var (
+			ids     []int
+			product Product
+		)
+
+		if !s.StoreLocation.StoreLocationID.Valid {
+			continue
+		}
+		if s.StorageID.Valid {
+			excludeIDs = append(excludeIDs, s.StorageID.Int64)
+		}
+
+		sqlr := `WITH RECURSIVE ancestors(storelocation_id) AS (
+			SELECT ?
+			UNION ALL
+			SELECT storelocation.storelocation FROM ancestors
+			JOIN storelocation ON storelocation.storelocation_id = ancestors.storelocation_id
+			WHERE storelocation.storelocation IS NOT NULL
+		)
+		SELECT storelocationlimit.storelocationlimit_id FROM storelocationlimit
+		JOIN ancestors ON storelocationlimit.storelocation = ancestors.storelocation_id
+		JOIN product ON product.product_id = ?
+		WHERE ` + storeLocationLimitProductMatch
+		if err = db.Select(&ids, sqlr, s.StoreLocation.StoreLocationID.Int64, s.Product.ProductID); err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		// the product conversion data and the storage unit
+		sqlr = `SELECT product.product_id, product.product_density, product.product_molarmass,
+		empiricalformula.empiricalformula_label AS "empiricalformula.empiricalformula_label"
+		FROM product
+		LEFT JOIN empiricalformula ON product.empiricalformula = empiricalformula.empiricalformula_id
+		WHERE product.product_id = ?`
+		if err = db.Get(&product, sqlr, s.Product.ProductID); err != nil {
+			return nil, err
+		}
+		unit := s.UnitQuantity
+		if unit.UnitID.Valid {
+			sqlr = `SELECT unit_id, unit_multiplier, unit_dimension FROM unit WHERE unit_id = ?`
+			if err = db.Get(&unit, sqlr, unit.UnitID.Int64); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, id := range ids {
+			l, found := limits[id]
+			if !found {
+				if l, err = db.GetStoreLocationLimit(id); err != nil {
+					return nil, err
+				}
+				limits[id] = l
+				added[id] = &StoreLocationLimitStatus{}
+				limitIDs = append(limitIDs, id)
+			}
+
+			c := product.ConvertQuantity(s.StorageQuantity, unit, l.Unit.UnitDimension.String)
+			if c.Convertible {
+				added[id].Stock += float64(count) * c.Quantity / l.Unit.UnitMultiplier
+			} else {
+				added[id].NotConvertibleCount += count
+			}
+		}
+
+	}
+
+	for _, id := range limitIDs {
+		var status StoreLocationLimitStatus
+		if status, err = db.getStoreLocationLimitStatus(limits[id], excludeIDs); err != nil {
+			return nil, err
+		}
+
+		status.Stock = roundStock(status.Stock + added[id].Stock)
+		status.NotConvertibleCount += added[id].NotConvertibleCount
+		status.Exceeded = status.Stock > limits[id].StoreLocationLimitQuantity
+
+		if status.Exceeded {
+			exceeded = append(exceeded, status)
+		}
+	}
+
+	return exceeded, nil
+
+}
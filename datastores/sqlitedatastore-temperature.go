@@ -0,0 +1,74 @@
+package datastores
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// GetTemperatureMismatches returns the storages of the store locations
+// of the entities whose product temperature is out of the store location
+// temperature range, all of them if entities is nil.
+func (db *SQLiteDataStore) GetTemperatureMismatches(entities []int) ([]TemperatureMismatch, error) {
+
+	logger.Log.WithFields(logrus.Fields{"entities": entities}).Debug("GetTemperatureMismatches")
+
+	var (
+		err        error
+		args       []interface{}
+		storages   []TemperatureMismatch
+		mismatches = []TemperatureMismatch{}
+	)
+
+	sqlr := `SELECT storage.storage_id,
+	storage.storage_barecode,
+	storelocation.storelocation_id AS "storelocation.storelocation_id",
+	storelocation.storelocation_name AS "storelocation.storelocation_name",
+	storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath",
+	storelocation.storelocation_type AS "storelocation.storelocation_type",
+	storelocation.storelocation_mintemperature AS "storelocation.storelocation_mintemperature",
+	storelocation.storelocation_maxtemperature AS "storelocation.storelocation_maxtemperature",
+	entity.entity_id AS "storelocation.entity.entity_id",
+	entity.entity_name AS "storelocation.entity.entity_name",
+	product.product_id AS "product.product_id",
+	product.product_temperature AS "product.product_temperature",
+	name.name_label AS "product.name.name_label",
+	ut.unit_id AS "product.unit_temperature.unit_id",
+	ut.unit_label AS "product.unit_temperature.unit_label"
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	LEFT JOIN unit ut ON product.unit_temperature = ut.unit_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_archive IS FALSE
+	AND product.product_temperature IS NOT NULL
+	AND (storelocation.storelocation_mintemperature IS NOT NULL OR storelocation.storelocation_maxtemperature IS NOT NULL)`
+	if entities != nil {
+		if len(entities) == 0 {
+			return mismatches, nil
+		}
+		sqlr += ` AND storelocation.entity IN (?)`
+		args = append(args, entities)
+	}
+	sqlr += ` ORDER BY entity.entity_name, storelocation.storelocation_fullpath, name.name_label`
+
+	if sqlr, args, err = sqlx.In(sqlr, args...); err != nil {
+		return nil, err
+	}
+	if err = db.Select(&storages, db.Rebind(sqlr), args...); err != nil {
+		return nil, err
+	}
+
+	// the product temperature unit conversions are done here
+	for _, s := range storages {
+		if s.Temperature, s.Reason = s.StoreLocation.TemperatureMismatch(s.Product); s.Reason != "" {
+			mismatches = append(mismatches, s)
+		}
+	}
+
+	return mismatches, nil
+
+}
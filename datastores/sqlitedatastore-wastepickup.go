@@ -0,0 +1,487 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	. "github.com/tbellembois/gochimitheque/models"
+)
+
+// ErrNoWasteStorage is returned when a waste pickup request
+// is created without any storage to destroy
+var ErrNoWasteStorage = errors.New("no storage to destroy")
+
+// wastePickupSelect returns the waste pickup requests select clause
+func wastePickupSelect() *goqu.SelectDataset {
+
+	dialect := goqu.Dialect("sqlite3")
+	tableWastePickup := goqu.T("wastepickup")
+
+	return dialect.From(tableWastePickup).Join(
+		goqu.T("entity"),
+		goqu.On(goqu.Ex{"wastepickup.entity": goqu.I("entity.entity_id")}),
+	).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{"wastepickup.person": goqu.I("person.person_id")}),
+	).LeftJoin(
+		goqu.T("wastepickupstorage"),
+		goqu.On(goqu.Ex{"wastepickupstorage.wastepickup": goqu.I("wastepickup.wastepickup_id")}),
+	)
+
+}
+
+// wastePickupColumns are the columns of the waste pickup requests select clause
+var wastePickupColumns = []interface{}{
+	goqu.I("wastepickup.wastepickup_id"),
+	goqu.I("wastepickup.wastepickup_creationdate"),
+	goqu.I("wastepickup.wastepickup_date"),
+	goqu.I("wastepickup.wastepickup_contractor"),
+	goqu.I("wastepickup.wastepickup_completiondate"),
+	goqu.COUNT(goqu.I("wastepickupstorage.wastepickupstorage_id").Distinct()).As("wastepickup_sc"),
+	goqu.I("person.person_id").As(goqu.C("person.person_id")),
+	goqu.I("person.person_email").As(goqu.C("person.person_email")),
+	goqu.I("entity.entity_id").As(goqu.C("entity.entity_id")),
+	goqu.I("entity.entity_name").As(goqu.C("entity.entity_name")),
+}
+
+// GetWastePickups returns the waste pickup requests matching p.
+func (db *SQLiteDataStore) GetWastePickups(p DbselectparamWastePickup) ([]WastePickup, int, error) {
+
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("GetWastePickups")
+
+	var err error
+
+	// Build orderby/order clause.
+	orderClause := goqu.I(p.GetOrderBy()).Asc()
+	if strings.ToLower(p.GetOrder()) == "desc" {
+		orderClause = goqu.I(p.GetOrderBy()).Desc()
+	}
+
+	// Build join clause.
+	joinClause := wastePickupSelect().Join(
+		goqu.T("permission").As("perm"),
+		goqu.On(
+			goqu.Ex{
+				"perm.person":               p.GetLoggedPersonID(),
+				"perm.permission_item_name": []string{"all", "storages"},
+				"perm.permission_perm_name": []string{"r", "w", "all"},
+				"perm.permission_entity_id": []interface{}{-1, goqu.I("entity.entity_id")},
+			},
+		),
+	)
+
+	// Build where AND expression.
+	whereAnd := []goqu.Expression{
+		goqu.L("IFNULL(wastepickup.wastepickup_contractor, '')").Like(p.GetSearch()),
+	}
+	if p.GetEntity() != -1 {
+		whereAnd = append(whereAnd, goqu.I("wastepickup.entity").Eq(p.GetEntity()))
+	}
+	if p.GetOpen() {
+		whereAnd = append(whereAnd, goqu.I("wastepickup.wastepickup_completiondate").IsNull())
+	}
+
+	joinClause = joinClause.Where(goqu.And(whereAnd...))
+
+	// Building final count.
+	var (
+		countSql  string
+		countArgs []interface{}
+	)
+	if countSql, countArgs, err = joinClause.Select(
+		goqu.COUNT(goqu.I("wastepickup.wastepickup_id").Distinct()),
+	).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	// Building final select.
+	var (
+		selectSql  string
+		selectArgs []interface{}
+	)
+	if selectSql, selectArgs, err = joinClause.Select(
+		wastePickupColumns...,
+	).GroupBy(goqu.I("wastepickup.wastepickup_id")).Order(orderClause).Limit(uint(p.GetLimit())).Offset(uint(p.GetOffset())).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		wastepickups []WastePickup
+		count        int
+	)
+
+	if err = db.Select(&wastepickups, selectSql, selectArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	if err = db.Get(&count, countSql, countArgs...); err != nil {
+		return nil, 0, err
+	}
+
+	return wastepickups, count, nil
+
+}
+
+// GetWastePickup returns the waste pickup request with id "id"
+// with its disposal records.
+func (db *SQLiteDataStore) GetWastePickup(id int) (WastePickup, error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetWastePickup")
+
+	var (
+		err         error
+		sqlr        string
+		args        []interface{}
+		wastepickup WastePickup
+	)
+
+	if sqlr, args, err = wastePickupSelect().Where(
+		goqu.I("wastepickup.wastepickup_id").Eq(id),
+	).Select(
+		wastePickupColumns...,
+	).GroupBy(goqu.I("wastepickup.wastepickup_id")).ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return WastePickup{}, err
+	}
+
+	if err = db.Get(&wastepickup, sqlr, args...); err != nil {
+		return WastePickup{}, err
+	}
+
+	sqlr = `SELECT * FROM wastepickupstorage
+	WHERE wastepickup = ?
+	ORDER BY wastepickupstorage_category, wastepickupstorage_productname, wastepickupstorage_barecode`
+	if err = db.Select(&wastepickup.WastePickupStorages, sqlr, id); err != nil {
+		return WastePickup{}, err
+	}
+
+	categories := make(map[string]bool)
+	for _, s := range wastepickup.WastePickupStorages {
+		if !categories[s.Category] {
+			categories[s.Category] = true
+			wastepickup.WastePickupCategories = append(wastepickup.WastePickupCategories, s.Category)
+		}
+	}
+
+	return wastepickup, nil
+
+}
+
+// GetWastePickupEntity returns the entity of the waste pickup request with id "id".
+func (db *SQLiteDataStore) GetWastePickupEntity(id int) (Entity, error) {
+
+	var (
+		entity Entity
+		sqlr   string
+		err    error
+	)
+
+	sqlr = `SELECT
+	entity.entity_id AS "entity_id",
+	entity.entity_name AS "entity_name"
+	FROM wastepickup
+	JOIN entity ON wastepickup.entity = entity.entity_id
+	WHERE wastepickup.wastepickup_id = ?`
+	if err = db.Get(&entity, sqlr, id); err != nil {
+		return Entity{}, err
+	}
+
+	return entity, nil
+
+}
+
+// CreateWastePickup inserts the waste pickup request w
+// with the current (non archived) storages to destroy of its entity
+// not already in an open pickup request.
+// If w.WastePickupCategories is not empty only the storages
+// of these waste categories are picked up.
+// The storages are copied into disposal records.
+// ErrNoWasteStorage is returned if there is no storage to pick up.
+func (db *SQLiteDataStore) CreateWastePickup(w WastePickup) (lastInsertId int64, err error) {
+
+	logger.Log.WithFields(logrus.Fields{"w": fmt.Sprintf("%+v", w)}).Debug("CreateWastePickup")
+
+	var (
+		tx        *sqlx.Tx
+		sqlr      string
+		args      []interface{}
+		sqlResult sql.Result
+		storages  []Storage
+		records   []goqu.Record
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	sqlr = `SELECT storage.storage_id,
+	storage.storage_barecode,
+	storage.storage_quantity,
+	uq.unit_label AS "unit_quantity.unit_label",
+	product.product_id AS "product.product_id",
+	product.product_specificity AS "product.product_specificity",
+	product.product_radioactive AS "product.product_radioactive",
+	name.name_label AS "product.name.name_label",
+	casnumber.casnumber_label AS "product.casnumber.casnumber_label",
+	physicalstate.physicalstate_label AS "product.physicalstate.physicalstate_label",
+	storelocation.storelocation_fullpath AS "storelocation.storelocation_fullpath"
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	LEFT JOIN casnumber ON product.casnumber = casnumber.casnumber_id
+	LEFT JOIN physicalstate ON product.physicalstate = physicalstate.physicalstate_id
+	LEFT JOIN unit uq ON storage.unit_quantity = uq.unit_id
+	WHERE storage.storage IS NULL
+	AND storage.storage_todestroy = true
+	AND (storage.storage_archive IS NULL OR storage.storage_archive = false)
+	AND storelocation.entity = ?
+	AND storage.storage_id NOT IN (SELECT wastepickupstorage.storage FROM wastepickupstorage
+		JOIN wastepickup ON wastepickupstorage.wastepickup = wastepickup.wastepickup_id
+		WHERE wastepickup.wastepickup_completiondate IS NULL)
+	ORDER BY storage.storage_id`
+	if err = tx.Select(&storages, sqlr, w.EntityID); err != nil {
+		return
+	}
+
+	// requested categories
+	categories := make(map[string]bool)
+	for _, c := range w.WastePickupCategories {
+		categories[c] = true
+	}
+
+	// product hazard statements
+	hazardstatements := make(map[int][]HazardStatement)
+
+	for _, s := range storages {
+
+		hs, ok := hazardstatements[s.ProductID]
+		if !ok {
+			sqlr = `SELECT hazardstatement_id, hazardstatement_label, hazardstatement_reference, hazardstatement_cmr
+			FROM hazardstatement
+			JOIN producthazardstatements ON producthazardstatements.producthazardstatements_hazardstatement_id = hazardstatement.hazardstatement_id
+			WHERE producthazardstatements.producthazardstatements_product_id = ?
+			ORDER BY hazardstatement_reference`
+			if err = tx.Select(&hs, sqlr, s.ProductID); err != nil {
+				return
+			}
+			hazardstatements[s.ProductID] = hs
+		}
+		s.Product.HazardStatements = hs
+
+		category := WasteCategory(s.Product)
+		if len(categories) > 0 && !categories[category] {
+			continue
+		}
+
+		references := make([]string, len(hs))
+		for i, h := range hs {
+			references[i] = h.HazardStatementReference
+		}
+
+		productname := s.Product.Name.NameLabel
+		if s.Product.ProductSpecificity.Valid && s.Product.ProductSpecificity.String != "" {
+			productname += " - " + s.Product.ProductSpecificity.String
+		}
+
+		records = append(records, goqu.Record{
+			"wastepickupstorage_category":         category,
+			"wastepickupstorage_barecode":         s.StorageBarecode,
+			"wastepickupstorage_productname":      productname,
+			"wastepickupstorage_casnumber":        s.Product.CasNumber.CasNumberLabel,
+			"wastepickupstorage_physicalstate":    s.Product.PhysicalState.PhysicalStateLabel,
+			"wastepickupstorage_hazardstatements": strings.Join(references, ","),
+			"wastepickupstorage_quantity":         s.StorageQuantity,
+			"wastepickupstorage_unit":             s.UnitQuantity.UnitLabel,
+			"wastepickupstorage_storelocation":    s.StoreLocation.StoreLocationFullPath,
+			"storage":                             s.StorageID.Int64,
+		})
+
+	}
+
+	if len(records) == 0 {
+		err = ErrNoWasteStorage
+		return
+	}
+
+	dialect := goqu.Dialect("sqlite3")
+	tableWastePickup := goqu.T("wastepickup")
+	tableWastePickupStorage := goqu.T("wastepickupstorage")
+
+	if sqlr, args, err = dialect.Insert(tableWastePickup).Rows(goqu.Record{
+		"wastepickup_creationdate": time.Now(),
+		"person":                   w.PersonID,
+		"entity":                   w.EntityID,
+	}).ToSQL(); err != nil {
+		return
+	}
+
+	if sqlResult, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+	if lastInsertId, err = sqlResult.LastInsertId(); err != nil {
+		return
+	}
+
+	for _, r := range records {
+		r["wastepickup"] = lastInsertId
+	}
+
+	if sqlr, args, err = dialect.Insert(tableWastePickupStorage).Rows(records).ToSQL(); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	return
+
+}
+
+// UpdateWastePickup records the pickup date and contractor
+// of the waste pickup request w.
+func (db *SQLiteDataStore) UpdateWastePickup(w WastePickup) error {
+
+	logger.Log.WithFields(logrus.Fields{"w": fmt.Sprintf("%+v", w)}).Debug("UpdateWastePickup")
+
+	dialect := goqu.Dialect("sqlite3")
+	tableWastePickup := goqu.T("wastepickup")
+
+	var (
+		err  error
+		sqlr string
+		args []interface{}
+	)
+
+	if sqlr, args, err = dialect.Update(tableWastePickup).Set(
+		goqu.Record{
+			"wastepickup_date":       w.WastePickupDate,
+			"wastepickup_contractor": w.WastePickupContractor,
+		},
+	).Where(
+		goqu.I("wastepickup_id").Eq(w.WastePickupID),
+	).ToSQL(); err != nil {
+		return err
+	}
+
+	if _, err = db.Exec(sqlr, args...); err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// CompleteWastePickup completes the waste pickup request with id "id"
+// and archives its storages and their history.
+// The disposal records are kept.
+func (db *SQLiteDataStore) CompleteWastePickup(id int) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("CompleteWastePickup")
+
+	var (
+		tx   *sqlx.Tx
+		sqlr string
+		args []interface{}
+	)
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	dialect := goqu.Dialect("sqlite3")
+	tableWastePickup := goqu.T("wastepickup")
+
+	if sqlr, args, err = dialect.Update(tableWastePickup).Set(
+		goqu.Record{"wastepickup_completiondate": time.Now()},
+	).Where(
+		goqu.I("wastepickup_id").Eq(id),
+	).ToSQL(); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	sqlr = `UPDATE storage SET storage_archive = true
+	WHERE storage_id IN (SELECT storage FROM wastepickupstorage WHERE wastepickup = ?)
+	OR storage.storage IN (SELECT storage FROM wastepickupstorage WHERE wastepickup = ?)`
+	if _, err = tx.Exec(sqlr, id, id); err != nil {
+		return
+	}
+
+	return
+
+}
+
+// DeleteWastePickup deletes the waste pickup request with id "id"
+// and its disposal records.
+func (db *SQLiteDataStore) DeleteWastePickup(id int) (err error) {
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteWastePickup")
+
+	var tx *sqlx.Tx
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+				return
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.Exec(`DELETE FROM wastepickupstorage WHERE wastepickup = ?`, id); err != nil {
+		return
+	}
+	if _, err = tx.Exec(`DELETE FROM wastepickup WHERE wastepickup_id = ?`, id); err != nil {
+		return
+	}
+
+	return
+
+}
@@ -180,6 +180,26 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 
 	}
 
+	// molar masses of the products created before the version 16
+	if userVersion < 16 {
+		logger.Log.Info("  computing products molar masses")
+		var products []Product
+		if err = db.Select(&products, `SELECT product.product_id,
+		empiricalformula.empiricalformula_label AS "empiricalformula.empiricalformula_label"
+		FROM product
+		JOIN empiricalformula ON product.empiricalformula = empiricalformula.empiricalformula_id
+		WHERE product.product_molarmass IS NULL`); err != nil {
+			return err
+		}
+		for _, p := range products {
+			if m, ok := p.MolarMass(); ok {
+				if _, err = db.Exec(`UPDATE product SET product_molarmass = ? WHERE product_id = ?`, m, p.ProductID); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	// welcome announce
 	if err = db.Get(&c, `SELECT count(*) FROM welcomeannounce`); err != nil {
 		return err
@@ -339,6 +359,17 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		}
 	}
 
+	// storage classes
+	if err = db.Get(&c, `SELECT count(*) FROM storageclass`); err != nil {
+		return err
+	}
+	if c == 0 {
+		logger.Log.Info("  inserting storage classes")
+		if _, err = db.Exec(insstorageclass); err != nil {
+			return err
+		}
+	}
+
 	// inserting default admin
 	var admin *Person
 	if err = db.Get(&c, `SELECT count(*) FROM person`); err != nil {
@@ -2082,41 +2113,9 @@ func (db *SQLiteDataStore) ImportV1(dir string) error {
 	}
 
 	logger.Log.Info("- updating store locations full path")
-	var sls []StoreLocation
-	if err = db.Select(&sls, ` SELECT s.storelocation_id AS "storelocation_id", 
-        s.storelocation_name AS "storelocation_name", 
-        s.storelocation_canstore, 
-        s.storelocation_color,
-        storelocation.storelocation_id AS "storelocation.storelocation_id",
-        storelocation.storelocation_name AS "storelocation.storelocation_name"
-        FROM storelocation AS s
-        LEFT JOIN storelocation on s.storelocation = storelocation.storelocation_id`); err != nil {
-		return err
-	}
-
-	// beginning new transaction
-	if tx, err = db.Beginx(); err != nil {
+	if _, err = db.RebuildStoreLocationFullPaths(); err != nil {
 		return err
 	}
 
-	for _, sl := range sls {
-		logger.Log.Debug("  " + sl.StoreLocationName.String)
-		sl.StoreLocationFullPath = db.buildFullPath(sl, tx)
-		sqlr = `UPDATE storelocation SET storelocation_fullpath = ? WHERE storelocation_id = ?`
-		if _, err = tx.Exec(sqlr, sl.StoreLocationFullPath, sl.StoreLocationID.Int64); err != nil {
-			if errr := tx.Rollback(); errr != nil {
-				return errr
-			}
-			return err
-		}
-	}
-
-	// committing changes
-	if err = tx.Commit(); err != nil {
-		if errr := tx.Rollback(); errr != nil {
-			return errr
-		}
-	}
-
 	return nil
 }
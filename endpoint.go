@@ -48,6 +48,7 @@ func buildEndpoints() (router *mux.Router) {
 	router.Handle("/{item:entities}/{id}", securechain.Then(env.AppMiddleware(env.UpdateEntityHandler))).Methods("PUT")
 	router.Handle("/{item:entities}/{id}", securechain.Then(env.AppMiddleware(env.DeleteEntityHandler))).Methods("DELETE")
 	router.Handle("/entities/{item:stocks}/{id}", securechain.Then(env.AppMiddleware(env.GetEntityStockHandler))).Methods("GET")
+	router.Handle("/entities/{item:stocks}/{id}/totals", securechain.Then(env.AppMiddleware(env.GetEntityStockTotalsHandler))).Methods("GET")
 
 	router.Handle("/f/{view:v}/{item:entities}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
 	router.Handle("/f/{view:vc}/{item:entities}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
@@ -108,6 +109,11 @@ func buildEndpoints() (router *mux.Router) {
 	router.Handle("/{item:products}/{id}", securechain.Then(env.AppMiddleware(env.UpdateProductHandler))).Methods("PUT")
 	router.Handle("/{item:products}", securechain.Then(env.AppMiddleware(env.CreateProductHandler))).Methods("POST")
 	router.Handle("/{item:products}/{id}", securechain.Then(env.AppMiddleware(env.DeleteProductHandler))).Methods("DELETE")
+	router.Handle("/{item:products}/{id}/gtins", securechain.Then(env.AppMiddleware(env.GetProductGTINsHandler))).Methods("GET")
+	router.Handle("/{item:products}/{id}/gtins", securechain.Then(env.AppMiddleware(env.CreateProductGTINHandler))).Methods("POST")
+	router.Handle("/{item:products}/{id}/storageclasses", securechain.Then(env.AppMiddleware(env.GetProductStorageClassesHandler))).Methods("GET")
+	router.Handle("/{item:products}/{id}/storageclasses", securechain.Then(env.AppMiddleware(env.UpdateProductStorageClassesHandler))).Methods("PUT")
+	router.Handle("/{item:gtins}/{id}", securechain.Then(env.AppMiddleware(env.DeleteGTINHandler))).Methods("DELETE")
 	router.Handle("/{item:bookmarks}/{id}", securechain.Then(env.AppMiddleware(env.ToogleProductBookmarkHandler))).Methods("PUT")
 
 	router.Handle("/{item:products}/casnumbers/", securechain.Then(env.AppMiddleware(env.GetProductsCasNumbersHandler))).Methods("GET")
@@ -165,7 +171,18 @@ func buildEndpoints() (router *mux.Router) {
 	router.Handle("/{item:storages}/others", securechain.Then(env.AppMiddleware(env.GetOtherStoragesHandler))).Methods("GET")
 	router.Handle("/{item:storages}/suppliers", securechain.Then(env.AppMiddleware(env.GetStoragesSuppliersHandler))).Methods("GET")
 	router.Handle("/{item:storages}/units", securechain.Then(env.AppMiddleware(env.GetStoragesUnitsHandler))).Methods("GET")
+	router.Handle("/{item:storages}/labels", securechain.Then(env.AppMiddleware(env.GetStoragesLabelsHandler))).Methods("GET")
+	router.Handle("/{item:storages}/labels/templates", securechain.Then(env.AppMiddleware(env.GetLabelTemplatesHandler))).Methods("GET")
+	router.Handle("/{item:storages}/gs1/{code}", securechain.Then(env.AppMiddleware(env.GetStorageGS1Handler))).Methods("GET")
+	router.Handle("/{item:storages}/solutions", securechain.Then(env.AppMiddleware(env.PrepareSolutionHandler))).Methods("POST")
+	router.Handle("/{item:storages}/{id}/lineage", securechain.Then(env.AppMiddleware(env.GetStorageLineageHandler))).Methods("GET")
+	router.Handle("/{item:storages}/{id}/split", securechain.Then(env.AppMiddleware(env.SplitStorageHandler))).Methods("POST")
+	router.Handle("/{item:storages}/{id}/sources", securechain.Then(env.AppMiddleware(env.GetStorageSourcesHandler))).Methods("GET")
+	router.Handle("/{item:storages}/{id}/versions", securechain.Then(env.AppMiddleware(env.GetStorageVersionsHandler))).Methods("GET")
+	router.Handle("/{item:storages}/{id}/versions/{version}/restore", securechain.Then(env.AppMiddleware(env.RestoreStorageVersionHandler))).Methods("PUT")
+	router.Handle("/{item:storages}/{id}/reservations/conflicts", securechain.Then(env.AppMiddleware(env.GetStorageReservationConflictsHandler))).Methods("GET")
 	router.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.GetStorageHandler))).Methods("GET")
+	router.Handle("/{item:storages}/{id}/code", securechain.Then(env.AppMiddleware(env.GetStorageCodeHandler))).Methods("GET")
 	router.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.UpdateStorageHandler))).Methods("PUT")
 	router.Handle("/{item:storages}", securechain.Then(env.AppMiddleware(env.CreateStorageHandler))).Methods("POST")
 	router.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.DeleteStorageHandler))).Methods("DELETE")
@@ -178,6 +195,90 @@ func buildEndpoints() (router *mux.Router) {
 	router.Handle("/f/{item:storages}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("POST")
 	router.Handle("/f/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("DELETE")
 
+	// scan
+	router.Handle("/{item:scan}", securechain.Then(env.AppMiddleware(env.ScanHandler))).Methods("GET")
+
+	// inventories
+	router.Handle("/{item:inventories}", securechain.Then(env.AppMiddleware(env.GetInventoriesHandler))).Methods("GET")
+	router.Handle("/{item:inventories}/{id}", securechain.Then(env.AppMiddleware(env.GetInventoryHandler))).Methods("GET")
+	router.Handle("/{item:inventories}", securechain.Then(env.AppMiddleware(env.CreateInventoryHandler))).Methods("POST")
+	router.Handle("/{item:inventories}/{id}/scans", securechain.Then(env.AppMiddleware(env.CreateInventoryScanHandler))).Methods("POST")
+	router.Handle("/{item:inventories}/{id}/report", securechain.Then(env.AppMiddleware(env.GetInventoryReportHandler))).Methods("GET")
+	router.Handle("/{item:inventories}/{id}/close", securechain.Then(env.AppMiddleware(env.CloseInventoryHandler))).Methods("PUT")
+	router.Handle("/{item:inventories}/{id}/missing/archive", securechain.Then(env.AppMiddleware(env.ArchiveInventoryMissingHandler))).Methods("PUT")
+	router.Handle("/{item:inventories}/{id}/misplaced/move", securechain.Then(env.AppMiddleware(env.MoveInventoryMisplacedHandler))).Methods("PUT")
+
+	// waste pickups
+	router.Handle("/{item:wastepickups}", securechain.Then(env.AppMiddleware(env.GetWastePickupsHandler))).Methods("GET")
+	router.Handle("/{item:wastepickups}/{id}", securechain.Then(env.AppMiddleware(env.GetWastePickupHandler))).Methods("GET")
+	router.Handle("/{item:wastepickups}", securechain.Then(env.AppMiddleware(env.CreateWastePickupHandler))).Methods("POST")
+	router.Handle("/{item:wastepickups}/{id}", securechain.Then(env.AppMiddleware(env.DeleteWastePickupHandler))).Methods("DELETE")
+	router.Handle("/{item:wastepickups}/{id}/manifest", securechain.Then(env.AppMiddleware(env.GetWastePickupManifestHandler))).Methods("GET")
+	router.Handle("/{item:wastepickups}/{id}/pickup", securechain.Then(env.AppMiddleware(env.UpdateWastePickupHandler))).Methods("PUT")
+	router.Handle("/{item:wastepickups}/{id}/complete", securechain.Then(env.AppMiddleware(env.CompleteWastePickupHandler))).Methods("PUT")
+
+	// storage transfers
+	router.Handle("/{item:storagetransfers}", securechain.Then(env.AppMiddleware(env.GetStorageTransfersHandler))).Methods("GET")
+	router.Handle("/{item:storagetransfers}/{id}", securechain.Then(env.AppMiddleware(env.GetStorageTransferHandler))).Methods("GET")
+	router.Handle("/{item:storagetransfers}", securechain.Then(env.AppMiddleware(env.CreateStorageTransferHandler))).Methods("POST")
+	router.Handle("/{item:storagetransfers}/{id}/accept", securechain.Then(env.AppMiddleware(env.AcceptStorageTransferHandler))).Methods("PUT")
+	router.Handle("/{item:storagetransfers}/{id}/refuse", securechain.Then(env.AppMiddleware(env.RefuseStorageTransferHandler))).Methods("PUT")
+	router.Handle("/{item:storagetransfers}/{id}/cancel", securechain.Then(env.AppMiddleware(env.CancelStorageTransferHandler))).Methods("PUT")
+
+	// reservations
+	router.Handle("/{item:reservations}", securechain.Then(env.AppMiddleware(env.GetReservationsHandler))).Methods("GET")
+	router.Handle("/{item:reservations}/{id}", securechain.Then(env.AppMiddleware(env.GetReservationHandler))).Methods("GET")
+	router.Handle("/{item:reservations}", securechain.Then(env.AppMiddleware(env.CreateReservationHandler))).Methods("POST")
+	router.Handle("/{item:reservations}/{id}", securechain.Then(env.AppMiddleware(env.DeleteReservationHandler))).Methods("DELETE")
+
+	// purchase requests
+	router.Handle("/{item:purchaserequests}", securechain.Then(env.AppMiddleware(env.GetPurchaseRequestsHandler))).Methods("GET")
+	router.Handle("/{item:purchaserequests}/{id}", securechain.Then(env.AppMiddleware(env.GetPurchaseRequestHandler))).Methods("GET")
+	router.Handle("/{item:purchaserequests}", securechain.Then(env.AppMiddleware(env.CreatePurchaseRequestHandler))).Methods("POST")
+	router.Handle("/{item:purchaserequests}/{id}/approve", securechain.Then(env.AppMiddleware(env.ApprovePurchaseRequestHandler))).Methods("PUT")
+	router.Handle("/{item:purchaserequests}/{id}/refuse", securechain.Then(env.AppMiddleware(env.RefusePurchaseRequestHandler))).Methods("PUT")
+	router.Handle("/{item:purchaserequests}/{id}/order", securechain.Then(env.AppMiddleware(env.OrderPurchaseRequestHandler))).Methods("PUT")
+	router.Handle("/{item:purchaserequests}/{id}/receive", securechain.Then(env.AppMiddleware(env.ReceivePurchaseRequestHandler))).Methods("PUT")
+	router.Handle("/{item:purchaserequests}/{id}/cancel", securechain.Then(env.AppMiddleware(env.CancelPurchaseRequestHandler))).Methods("PUT")
+
+	// stock thresholds
+	router.Handle("/{item:stockthresholds}", securechain.Then(env.AppMiddleware(env.GetStockThresholdsHandler))).Methods("GET")
+	router.Handle("/{item:stockthresholds}/alerts", securechain.Then(env.AppMiddleware(env.GetStockThresholdAlertsHandler))).Methods("GET")
+	router.Handle("/{item:stockthresholds}", securechain.Then(env.AppMiddleware(env.SetStockThresholdHandler))).Methods("POST")
+	router.Handle("/{item:stockthresholds}/{id}", securechain.Then(env.AppMiddleware(env.DeleteStockThresholdHandler))).Methods("DELETE")
+
+	// spendings
+	router.Handle("/{item:spendings}", securechain.Then(env.AppMiddleware(env.GetSpendingsHandler))).Methods("GET")
+
+	// stock trends
+	router.Handle("/{item:stocktrends}", securechain.Then(env.AppMiddleware(env.GetStockTrendsHandler))).Methods("GET")
+
+	// store location limits
+	router.Handle("/{item:storelocationlimits}", securechain.Then(env.AppMiddleware(env.GetStoreLocationLimitsHandler))).Methods("GET")
+	router.Handle("/{item:storelocationlimits}", securechain.Then(env.AppMiddleware(env.CreateStoreLocationLimitHandler))).Methods("POST")
+	router.Handle("/{item:storelocationlimits}/{id}", securechain.Then(env.AppMiddleware(env.UpdateStoreLocationLimitHandler))).Methods("PUT")
+	router.Handle("/{item:storelocationlimits}/{id}", securechain.Then(env.AppMiddleware(env.DeleteStoreLocationLimitHandler))).Methods("DELETE")
+
+	// storage classes
+	router.Handle("/{item:storageclasses}", securechain.Then(env.AppMiddleware(env.GetStorageClassesHandler))).Methods("GET")
+	router.Handle("/{item:storageclasses}/conflicts", securechain.Then(env.AppMiddleware(env.GetStorageClassConflictsHandler))).Methods("GET")
+	router.Handle("/{item:storageclasses}/{id}", securechain.Then(env.AppMiddleware(env.UpdateStorageClassHandler))).Methods("PUT")
+
+	// store location temperatures
+	router.Handle("/{item:temperaturemismatches}", securechain.Then(env.AppMiddleware(env.GetTemperatureMismatchesHandler))).Methods("GET")
+
+	// sensors
+	router.Handle("/{item:sensors}", securechain.Then(env.AppMiddleware(env.GetSensorsHandler))).Methods("GET")
+	router.Handle("/{item:sensors}", securechain.Then(env.AppMiddleware(env.CreateSensorHandler))).Methods("POST")
+	router.Handle("/{item:sensors}/{id}", securechain.Then(env.AppMiddleware(env.DeleteSensorHandler))).Methods("DELETE")
+	router.Handle("/{item:sensorreadings}", securechain.Then(env.AppMiddleware(env.GetSensorReadingsHandler))).Methods("GET")
+	router.Handle("/{item:sensoralerts}", securechain.Then(env.AppMiddleware(env.GetSensorAlertsHandler))).Methods("GET")
+	// sensors authenticate with their token
+	router.Handle("/sensorreadings", commonChain.Then(env.AppMiddleware(env.CreateSensorReadingHandler))).Methods("POST")
+
+	// store location levels
+	router.Handle("/{item:storelocationrollups}", securechain.Then(env.AppMiddleware(env.GetStoreLocationRollupsHandler))).Methods("GET")
+
 	// validators
 	router.Handle("/{item:validate}/entity/{id}/name/", securechain.Then(env.AppMiddleware(env.ValidateEntityNameHandler))).Methods("POST")
 	router.Handle("/{item:validate}/person/{id}/email/", securechain.Then(env.AppMiddleware(env.ValidatePersonEmailHandler))).Methods("POST")
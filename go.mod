@@ -8,6 +8,7 @@ require (
 	github.com/Joker/hpp v1.0.0 // indirect
 	github.com/Joker/jade v1.0.1-0.20200506134858-ee26e3c533bb // indirect
 	github.com/Masterminds/squirrel v1.5.0
+	github.com/boombuler/barcode v1.0.1
 	github.com/casbin/casbin/v2 v2.23.0
 	github.com/casbin/json-adapter/v2 v2.0.0
 	github.com/dchest/authcookie v0.0.0-20190824115100-f900d2294c8e // indirect
@@ -16,6 +17,7 @@ require (
 	github.com/doug-martin/goqu/v9 v9.10.0
 	github.com/gorilla/mux v1.8.0
 	github.com/jmoiron/sqlx v1.3.1
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/justinas/alice v1.2.0
 	github.com/mattn/go-sqlite3 v2.0.3+incompatible
 	github.com/nicksnyder/go-i18n/v2 v2.1.2
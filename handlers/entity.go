@@ -2,16 +2,149 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/codes"
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/static/jade"
 )
 
+// isEntityManager returns true if the person with id "personID"
+// is an admin or a manager of the entity with id "entityID"
+func (env *Env) isEntityManager(personID int, entityID int) (bool, error) {
+
+	var (
+		err      error
+		isadmin  bool
+		managers []models.Person
+	)
+
+	if isadmin, err = env.DB.IsPersonAdmin(personID); err != nil {
+		return false, err
+	}
+	if isadmin {
+		return true, nil
+	}
+
+	if managers, err = env.DB.GetEntityManager(entityID); err != nil {
+		return false, err
+	}
+	for _, m := range managers {
+		if m.PersonID == personID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+
+}
+
+// isEntityMember returns true if the person with id "personID"
+// is an admin or belongs to the entity with id "entityID"
+func (env *Env) isEntityMember(personID int, entityID int) (bool, error) {
+
+	var (
+		err     error
+		isadmin bool
+	)
+
+	if isadmin, err = env.DB.IsPersonAdmin(personID); err != nil {
+		return false, err
+	}
+	if isadmin {
+		return true, nil
+	}
+
+	return env.DB.DoesPersonBelongsTo(personID, []models.Entity{{EntityID: entityID}})
+
+}
+
+// requestEntities returns the entities of the "entity" request parameter
+// if the logged person is a member of it, or all the entities of the logged person,
+// nil for the administrators.
+func (env *Env) requestEntities(r *http.Request) ([]int, *models.AppError) {
+	return env.requestEntitiesOf(r, env.isEntityMember, func(personID int) ([]models.Entity, error) {
+		return env.DB.GetPersonEntities(personID, personID)
+	})
+}
+
+// requestManagedEntities returns the entities of the "entity" request parameter
+// if the logged person is a manager of it, or all the entities managed by the logged person,
+// nil for the administrators.
+func (env *Env) requestManagedEntities(r *http.Request) ([]int, *models.AppError) {
+	return env.requestEntitiesOf(r, env.isEntityManager, env.DB.GetPersonManageEntities)
+}
+
+// requestEntitiesOf returns the entities of the "entity" request parameter
+// if "allowed" for the logged person, or the "personEntities" of the logged person,
+// nil for the administrators.
+func (env *Env) requestEntitiesOf(r *http.Request,
+	allowed func(personID int, entityID int) (bool, error),
+	personEntities func(personID int) ([]models.Entity, error)) ([]int, *models.AppError) {
+
+	var (
+		err      error
+		ok       bool
+		isadmin  bool
+		entityID int
+		entities []int
+		pe       []models.Entity
+	)
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if e, found := r.URL.Query()["entity"]; found {
+		if entityID, err = strconv.Atoi(e[0]); err != nil {
+			return nil, &models.AppError{
+				Error:   err,
+				Message: "entity atoi conversion",
+				Code:    http.StatusBadRequest}
+		}
+		if ok, err = allowed(c.PersonID, entityID); err != nil {
+			return nil, &models.AppError{
+				Error:   err,
+				Message: "error getting person entities",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return nil, &models.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+		return []int{entityID}, nil
+	}
+
+	if isadmin, err = env.DB.IsPersonAdmin(c.PersonID); err != nil {
+		return nil, &models.AppError{
+			Error:   err,
+			Message: "error getting admin status",
+			Code:    http.StatusInternalServerError}
+	}
+	if isadmin {
+		return nil, nil
+	}
+	if pe, err = personEntities(c.PersonID); err != nil {
+		return nil, &models.AppError{
+			Error:   err,
+			Message: "error getting person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	entities = []int{}
+	for _, e := range pe {
+		entities = append(entities, e.EntityID)
+	}
+
+	return entities, nil
+
+}
+
 /*
 	views handlers
 */
@@ -123,6 +256,52 @@ func (env *Env) GetEntityStockHandler(w http.ResponseWriter, r *http.Request) *m
 	return nil
 }
 
+// GetEntityStockTotalsHandler returns a json of the stock of the product with the requested id
+// normalised per unit dimension
+func (env *Env) GetEntityStockTotalsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		pid    int
+		p      models.Product
+		totals models.StockTotals
+		err    error
+	)
+
+	if pid, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusBadRequest}
+	}
+
+	if p, err = env.DB.GetProduct(pid); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the product",
+		}
+	}
+
+	if totals, err = env.DB.ComputeStockTotals(p, r); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error computing the stock totals",
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(totals); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
 // GetEntityHandler returns a json of the entity with the requested id
 func (env *Env) GetEntityHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	vars := mux.Vars(r)
@@ -224,6 +403,23 @@ func (env *Env) CreateEntityHandler(w http.ResponseWriter, r *http.Request) *mod
 	// }
 	logger.Log.WithFields(logrus.Fields{"e": e}).Debug("CreateEntityHandler")
 
+	if e.EntityBarecodePrefix.Valid && e.EntityBarecodePrefix.String != "" {
+		if err = codes.ValidateBarecodePrefix(e.EntityBarecodePrefix.String); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+	}
+	if e.EntityBarecodeTemplate.Valid && e.EntityBarecodeTemplate.String != "" {
+		if err = codes.ValidateBarecodeTemplate(e.EntityBarecodeTemplate.String); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+	}
+
 	if _, err = env.DB.CreateEntity(e); err != nil {
 		return &models.AppError{
 			Error:   err,
@@ -275,6 +471,23 @@ func (env *Env) UpdateEntityHandler(w http.ResponseWriter, r *http.Request) *mod
 	// }
 	logger.Log.WithFields(logrus.Fields{"e": e}).Debug("UpdateEntityHandler")
 
+	if e.EntityBarecodePrefix.Valid && e.EntityBarecodePrefix.String != "" {
+		if err = codes.ValidateBarecodePrefix(e.EntityBarecodePrefix.String); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+	}
+	if e.EntityBarecodeTemplate.Valid && e.EntityBarecodeTemplate.String != "" {
+		if err = codes.ValidateBarecodeTemplate(e.EntityBarecodeTemplate.String); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+	}
+
 	if id, err = strconv.Atoi(vars["id"]); err != nil {
 		return &models.AppError{
 			Error:   err,
@@ -290,6 +503,8 @@ func (env *Env) UpdateEntityHandler(w http.ResponseWriter, r *http.Request) *mod
 	}
 	updatede.EntityName = e.EntityName
 	updatede.EntityDescription = e.EntityDescription
+	updatede.EntityBarecodePrefix = e.EntityBarecodePrefix
+	updatede.EntityBarecodeTemplate = e.EntityBarecodeTemplate
 	updatede.Managers = e.Managers
 	logger.Log.WithFields(logrus.Fields{"updatede": updatede}).Debug("UpdateEntityHandler")
 
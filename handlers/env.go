@@ -52,6 +52,13 @@ type Env struct {
 	BuildID string
 	// DisableCache disables the views cache
 	DisableCache bool
+	// SolutionExpirationDays is the default lifetime
+	// of the prepared solutions
+	SolutionExpirationDays int
+	// RefuseIncompatibleStorages refuses the storages in a store location
+	// holding products of incompatible storage classes,
+	// instead of warning
+	RefuseIncompatibleStorages bool
 }
 
 func NewEnv() Env {
@@ -98,6 +105,14 @@ func (env *Env) InitCasbinPolicy() {
 	env.Enforcer.AddFunction("matchStorelocation", env.MatchStorelocationFunc)
 	env.Enforcer.AddFunction("matchPeople", env.MatchPeopleFunc)
 	env.Enforcer.AddFunction("matchEntity", env.MatchEntityFunc)
+	env.Enforcer.AddFunction("matchInventory", env.MatchEntityItemFunc("matchInventory", env.inventoryEntities))
+	env.Enforcer.AddFunction("matchWastePickup", env.MatchEntityItemFunc("matchWastePickup", env.wastePickupEntities))
+	env.Enforcer.AddFunction("matchStorageTransfer", env.MatchEntityItemFunc("matchStorageTransfer", env.storageTransferEntities))
+	env.Enforcer.AddFunction("matchReservation", env.MatchEntityItemFunc("matchReservation", env.reservationEntities))
+	env.Enforcer.AddFunction("matchPurchaseRequest", env.MatchEntityItemFunc("matchPurchaseRequest", env.purchaseRequestEntities))
+	env.Enforcer.AddFunction("matchStockThreshold", env.MatchEntityItemFunc("matchStockThreshold", env.stockThresholdEntities))
+	env.Enforcer.AddFunction("matchStoreLocationLimit", env.MatchEntityItemFunc("matchStoreLocationLimit", env.storeLocationLimitEntities))
+	env.Enforcer.AddFunction("matchSensor", env.MatchEntityItemFunc("matchSensor", env.sensorEntities))
 
 	if err = env.Enforcer.LoadPolicy(); err != nil {
 		logger.Log.Error("enforcer policy load error: " + err.Error())
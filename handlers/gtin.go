@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/codes"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// prefillStorageGS1 fills the empty fields of the storage s
+// with the values of its scanned supplier GS1 code:
+// product and supplier from the GTIN mapping, batch number and expiration date.
+// mapped is false if the GTIN is not mapped to a product yet.
+func (env *Env) prefillStorageGS1(s *models.Storage) (g codes.GS1, mapped bool, aerr *models.AppError) {
+
+	var (
+		err  error
+		gtin models.GTIN
+	)
+
+	if g, err = codes.ParseGS1(s.StorageGS1); err != nil {
+		return codes.GS1{}, false, &models.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+
+	if gtin, err = env.DB.GetGTIN(g.GTIN); err != nil && err != sql.ErrNoRows {
+		return codes.GS1{}, false, &models.AppError{
+			Error:   err,
+			Message: "error getting the gtin",
+			Code:    http.StatusInternalServerError}
+	}
+	mapped = err == nil
+
+	if mapped {
+		if s.ProductID == 0 {
+			s.ProductID = gtin.ProductID
+		}
+		if !s.Supplier.SupplierID.Valid && gtin.Supplier.SupplierID.Valid {
+			s.Supplier = gtin.Supplier
+		}
+		if (!s.StorageReference.Valid || s.StorageReference.String == "") && gtin.SupplierRefLabel.Valid {
+			s.StorageReference = gtin.SupplierRefLabel
+		}
+	}
+	if (!s.StorageBatchNumber.Valid || s.StorageBatchNumber.String == "") && g.Lot != "" {
+		s.StorageBatchNumber = sql.NullString{Valid: true, String: g.Lot}
+	}
+	if !s.StorageExpirationDate.Valid && !g.Expiry.IsZero() {
+		s.StorageExpirationDate = sql.NullTime{Valid: true, Time: g.Expiry}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"g": g, "mapped": mapped}).Debug("prefillStorageGS1")
+
+	return g, mapped, nil
+
+}
+
+// createStorageGTIN maps the GTIN to the storage product
+// and to the product supplier reference of the storage supplier if any
+func (env *Env) createStorageGTIN(s models.Storage, gtin string) error {
+
+	var (
+		err error
+		p   models.Product
+	)
+
+	if p, err = env.DB.GetProduct(s.ProductID); err != nil {
+		return err
+	}
+
+	g := models.GTIN{
+		GTINLabel: gtin,
+		ProductID: s.ProductID,
+	}
+	if s.Supplier.SupplierID.Valid {
+		for _, sr := range p.SupplierRefs {
+			if sr.Supplier != nil && sr.Supplier.SupplierID.Int64 == s.Supplier.SupplierID.Int64 {
+				g.SupplierRefID = sql.NullInt64{Valid: true, Int64: int64(sr.SupplierRefID)}
+				break
+			}
+		}
+	}
+
+	_, err = env.DB.CreateGTIN(g)
+
+	return err
+
+}
+
+/*
+	REST handlers
+*/
+
+// GetStorageGS1Handler returns a json storage prefilled
+// with the values of the supplier GS1 code
+func (env *Env) GetStorageGS1Handler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		err  error
+		aerr *models.AppError
+		s    models.Storage
+	)
+
+	s.StorageGS1 = vars["code"]
+	if _, _, aerr = env.prefillStorageGS1(&s); aerr != nil {
+		return aerr
+	}
+
+	if s.ProductID != 0 {
+		if s.Product, err = env.DB.GetProduct(s.ProductID); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the product",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(s); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetProductGTINsHandler returns a json list of the GTINs mapped to the product
+func (env *Env) GetProductGTINsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id    int
+		err   error
+		gtins []models.GTIN
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if gtins, err = env.DB.GetProductGTINs(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the gtins",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(gtins); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreateProductGTINHandler maps a GTIN to the product
+func (env *Env) CreateProductGTINHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id    int
+		err   error
+		ok    bool
+		g     models.GTIN
+		gtin  models.GTIN
+		newid int64
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&g); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	g.ProductID = id
+
+	if g.GTINLabel, ok = codes.NormalizeGTIN(g.GTINLabel); !ok {
+		return &models.AppError{
+			Error:   errors.New("invalid gtin"),
+			Message: "invalid gtin",
+			Code:    http.StatusBadRequest}
+	}
+
+	// a GTIN is mapped once
+	if gtin, err = env.DB.GetGTIN(g.GTINLabel); err != nil && err != sql.ErrNoRows {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the gtin",
+			Code:    http.StatusInternalServerError}
+	}
+	if err == nil {
+		if gtin.ProductID != id {
+			return &models.AppError{
+				Error:   errors.New("gtin already mapped"),
+				Message: "gtin already mapped to another product",
+				Code:    http.StatusBadRequest}
+		}
+		g = gtin
+	} else {
+		if newid, err = env.DB.CreateGTIN(g); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "create gtin error",
+				Code:    http.StatusInternalServerError}
+		}
+		g.GTINID = int(newid)
+	}
+	logger.Log.WithFields(logrus.Fields{"g": g}).Debug("CreateProductGTINHandler")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(g); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// DeleteGTINHandler deletes the GTIN mapping with the requested id
+func (env *Env) DeleteGTINHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if err = env.DB.DeleteGTIN(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "delete gtin error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return nil
+}
@@ -0,0 +1,541 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// inventoryStorages is the optional body of the inventory bulk actions.
+// If empty all the storages of the report section are processed.
+type inventoryStorages struct {
+	StorageIDs []int64 `json:"storage_ids"`
+}
+
+// contains returns true if id is in the requested storages
+// or if no storages were requested
+func (i inventoryStorages) contains(id int64) bool {
+	if len(i.StorageIDs) == 0 {
+		return true
+	}
+	for _, sid := range i.StorageIDs {
+		if sid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// getInventoryFromRequest returns the inventory matching the request "id" variable
+func (env *Env) getInventoryFromRequest(r *http.Request) (models.Inventory, *models.AppError) {
+	vars := mux.Vars(r)
+	var (
+		id        int
+		err       error
+		inventory models.Inventory
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.Inventory{}, &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if inventory, err = env.DB.GetInventory(id); err != nil {
+		return models.Inventory{}, &models.AppError{
+			Error:   err,
+			Message: "error getting the inventory",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return inventory, nil
+}
+
+// decodeInventoryStorages decodes the optional inventory bulk action body
+func decodeInventoryStorages(r *http.Request) (inventoryStorages, *models.AppError) {
+	var is inventoryStorages
+
+	if r.ContentLength == 0 {
+		return is, nil
+	}
+	if err := json.NewDecoder(r.Body).Decode(&is); err != nil {
+		return is, &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return is, nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetInventoriesHandler returns a json list of the inventory campaigns matching the search criteria
+func (env *Env) GetInventoriesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetInventoriesHandler")
+
+	var (
+		err  error
+		aerr *models.AppError
+		dspi models.DbselectparamInventory
+	)
+
+	// init db request parameters
+	if dspi, aerr = models.NewdbselectparamInventory(r, nil); aerr != nil {
+		return aerr
+	}
+
+	inventories, count, err := env.DB.GetInventories(dspi)
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the inventories",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.Inventory `json:"rows"`
+		Total int                `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(resp{Rows: inventories, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetInventoryHandler returns a json of the inventory campaign with the requested id
+func (env *Env) GetInventoryHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err       error
+		aerr      *models.AppError
+		inventory models.Inventory
+	)
+
+	if inventory, aerr = env.getInventoryFromRequest(r); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(inventory); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreateInventoryHandler creates the inventory campaign from the request form
+func (env *Env) CreateInventoryHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateInventoryHandler")
+	var (
+		i       models.Inventory
+		sl      models.StoreLocation
+		err     error
+		id      int64
+		belongs bool
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&i); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	// the logged user must be a member of the inventory entity
+	if belongs, err = env.isEntityMember(c.PersonID, i.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !belongs {
+		return &models.AppError{
+			Error:   errors.New("person does not belong to the entity"),
+			Message: "person does not belong to the entity",
+			Code:    http.StatusForbidden}
+	}
+
+	// the optional store location must belong to the inventory entity
+	if i.StoreLocation.StoreLocationID.Valid {
+		if sl, err = env.DB.GetStoreLocation(int(i.StoreLocation.StoreLocationID.Int64)); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the store location",
+				Code:    http.StatusInternalServerError}
+		}
+		if sl.EntityID != i.EntityID {
+			return &models.AppError{
+				Error:   errors.New("store location not in the inventory entity"),
+				Message: "store location not in the inventory entity",
+				Code:    http.StatusBadRequest}
+		}
+	}
+
+	i.PersonID = c.PersonID
+	logger.Log.WithFields(logrus.Fields{"i": i}).Debug("CreateInventoryHandler")
+
+	if id, err = env.DB.CreateInventory(i); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "create inventory error",
+			Code:    http.StatusInternalServerError}
+	}
+	i.InventoryID = int(id)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(i); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreateInventoryScanHandler records a code scanned in a store location
+// during the inventory campaign with the requested id
+func (env *Env) CreateInventoryScanHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		s         models.InventoryScan
+		sl        models.StoreLocation
+		inventory models.Inventory
+		err       error
+		aerr      *models.AppError
+	)
+
+	if inventory, aerr = env.getInventoryFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if inventory.IsClosed() {
+		return &models.AppError{
+			Error:   errors.New("inventory closed"),
+			Message: "inventory closed",
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&s); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+	if s.InventoryScanCode == "" {
+		return &models.AppError{
+			Error:   errors.New("empty code"),
+			Message: "empty code",
+			Code:    http.StatusBadRequest}
+	}
+
+	// the scan store location must belong to the inventory entity
+	if sl, err = env.DB.GetStoreLocation(int(s.StoreLocationID.Int64)); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				Error:   err,
+				Message: "store location not found",
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location",
+			Code:    http.StatusInternalServerError}
+	}
+	if sl.EntityID != inventory.EntityID {
+		return &models.AppError{
+			Error:   errors.New("store location not in the inventory entity"),
+			Message: "store location not in the inventory entity",
+			Code:    http.StatusBadRequest}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	s.Inventory = inventory
+	s.StoreLocation = sl
+	s.PersonID = c.PersonID
+	s.PersonEmail = c.PersonEmail
+	logger.Log.WithFields(logrus.Fields{"s": s}).Debug("CreateInventoryScanHandler")
+
+	if s, err = env.DB.CreateInventoryScan(s); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "create inventory scan error",
+			Code:    http.StatusInternalServerError}
+	}
+	if s.Storage.StorageID.Valid {
+		if s.Storage, err = env.DB.GetStorage(int(s.Storage.StorageID.Int64)); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the storage",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(s); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetInventoryReportHandler returns the reconciliation report
+// of the inventory campaign with the requested id
+func (env *Env) GetInventoryReportHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err       error
+		aerr      *models.AppError
+		inventory models.Inventory
+		report    models.InventoryReport
+	)
+
+	if inventory, aerr = env.getInventoryFromRequest(r); aerr != nil {
+		return aerr
+	}
+
+	if report, err = env.DB.GetInventoryReport(inventory.InventoryID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the inventory report",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CloseInventoryHandler closes the inventory campaign with the requested id
+// and returns its reconciliation report
+func (env *Env) CloseInventoryHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err       error
+		aerr      *models.AppError
+		inventory models.Inventory
+		report    models.InventoryReport
+	)
+
+	if inventory, aerr = env.getInventoryFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if inventory.IsClosed() {
+		return &models.AppError{
+			Error:   errors.New("inventory already closed"),
+			Message: "inventory already closed",
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = env.DB.CloseInventory(inventory.InventoryID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "close inventory error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if report, err = env.DB.GetInventoryReport(inventory.InventoryID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the inventory report",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(report); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// ArchiveInventoryMissingHandler archives the storages reported missing
+// by the closed inventory campaign with the requested id
+func (env *Env) ArchiveInventoryMissingHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err       error
+		aerr      *models.AppError
+		inventory models.Inventory
+		report    models.InventoryReport
+		is        inventoryStorages
+		archived  []models.Storage
+	)
+
+	if inventory, aerr = env.getInventoryFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if !inventory.IsClosed() {
+		return &models.AppError{
+			Error:   errors.New("inventory not closed"),
+			Message: "inventory not closed",
+			Code:    http.StatusBadRequest}
+	}
+	if is, aerr = decodeInventoryStorages(r); aerr != nil {
+		return aerr
+	}
+
+	if report, err = env.DB.GetInventoryReport(inventory.InventoryID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the inventory report",
+			Code:    http.StatusInternalServerError}
+	}
+
+	var ids []int
+	for _, s := range report.Missing {
+		if !is.contains(s.StorageID.Int64) {
+			continue
+		}
+		ids = append(ids, int(s.StorageID.Int64))
+		archived = append(archived, s)
+	}
+
+	if err = env.DB.ArchiveStorages(ids); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "archive storage error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(archived); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// MoveInventoryMisplacedHandler moves the storages reported misplaced
+// by the closed inventory campaign with the requested id into the store location
+// where they were scanned, after checking the store location limits
+// for all the storages moved to the same store location,
+// the storage classes and the temperatures
+func (env *Env) MoveInventoryMisplacedHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err       error
+		aerr      *models.AppError
+		inventory models.Inventory
+		report    models.InventoryReport
+		is        inventoryStorages
+		moved     []models.Storage
+	)
+
+	if inventory, aerr = env.getInventoryFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if !inventory.IsClosed() {
+		return &models.AppError{
+			Error:   errors.New("inventory not closed"),
+			Message: "inventory not closed",
+			Code:    http.StatusBadRequest}
+	}
+	if is, aerr = decodeInventoryStorages(r); aerr != nil {
+		return aerr
+	}
+
+	if report, err = env.DB.GetInventoryReport(inventory.InventoryID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the inventory report",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	// misplaced storages by store location they are moved to
+	byStoreLocation := make(map[int64][]models.Storage)
+	var storeLocations []int64
+	for _, m := range report.Misplaced {
+		if !is.contains(m.Storage.StorageID.Int64) {
+			continue
+		}
+
+		// full storage needed to keep the history
+		updateds, err := env.DB.GetStorage(int(m.Storage.StorageID.Int64))
+		if err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the storage",
+				Code:    http.StatusInternalServerError}
+		}
+		updateds.StorageModificationDate = time.Now()
+		updateds.StoreLocation = m.FoundIn
+		updateds.PersonID = c.PersonID
+
+		if aerr = env.checkStorageClassIncompatibilities(w, updateds); aerr != nil {
+			return aerr
+		}
+		if aerr = env.checkStorageTemperature(w, updateds); aerr != nil {
+			return aerr
+		}
+
+		id := updateds.StoreLocation.StoreLocationID.Int64
+		if _, found := byStoreLocation[id]; !found {
+			storeLocations = append(storeLocations, id)
+		}
+		byStoreLocation[id] = append(byStoreLocation[id], updateds)
+		moved = append(moved, updateds)
+	}
+
+	// the storages moved to the same store location are checked together
+	for _, id := range storeLocations {
+		if aerr = env.checkStoreLocationBatchLimits(w, byStoreLocation[id]); aerr != nil {
+			return aerr
+		}
+	}
+
+	if err = env.DB.UpdateStorages(moved); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "update storage error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(moved); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
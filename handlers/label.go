@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/labels"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+/*
+	REST handlers
+*/
+
+// GetLabelTemplatesHandler returns a json list of the label sheet templates
+func (env *Env) GetLabelTemplatesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var err error
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(labels.GetTemplates()); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetStoragesLabelsHandler returns a PDF of the labels of the storages matching the search criteria
+// (usually a selection of storages with the "ids" parameter).
+// The "template" parameter is the label sheet template name
+// and the "skip" parameter the number of labels already used on the first sheet.
+func (env *Env) GetStoragesLabelsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetStoragesLabelsHandler")
+
+	var (
+		err      error
+		aerr     *models.AppError
+		dsps     models.DbselectparamStorage
+		storages []models.Storage
+		product  models.Product
+		ls       []labels.Label
+		skip     int
+		pdf      bytes.Buffer
+	)
+
+	// init db request parameters
+	if dsps, aerr = models.NewdbselectparamStorage(r, nil); aerr != nil {
+		return aerr
+	}
+
+	template := labels.Templates[labels.DefaultTemplate]
+	if t, ok := r.URL.Query()["template"]; ok {
+		if template, ok = labels.Templates[t[0]]; !ok {
+			return &models.AppError{
+				Error:   errors.New("unknown template " + t[0]),
+				Code:    http.StatusBadRequest,
+				Message: "unknown template",
+			}
+		}
+	}
+	if s, ok := r.URL.Query()["skip"]; ok {
+		if skip, err = strconv.Atoi(s[0]); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusInternalServerError,
+				Message: "skip atoi conversion",
+			}
+		}
+	}
+
+	if storages, _, err = env.DB.GetStorages(dsps); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the storages",
+		}
+	}
+
+	// product symbols, retrieved once per product
+	symbols := make(map[int][]models.Symbol)
+	for _, s := range storages {
+		if _, ok := symbols[s.ProductID]; !ok {
+			if product, err = env.DB.GetProduct(s.ProductID); err != nil {
+				return &models.AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "error getting the product",
+				}
+			}
+			symbols[s.ProductID] = product.Symbols
+		}
+
+		l, err := labels.NewLabel(s, symbols[s.ProductID])
+		if err != nil {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusInternalServerError,
+				Message: "error building the label",
+			}
+		}
+		ls = append(ls, l)
+	}
+	logger.Log.WithFields(logrus.Fields{"template": template.Name, "nb labels": len(ls)}).Debug("GetStoragesLabelsHandler")
+
+	if err = labels.Generate(&pdf, template, ls, skip); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error generating the labels",
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment; filename=chimitheque-labels.pdf")
+	w.WriteHeader(http.StatusOK)
+	if _, err = pdf.WriteTo(w); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
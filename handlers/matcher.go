@@ -163,3 +163,122 @@ func (env *Env) MatchEntityFunc(args ...interface{}) (interface{}, error) {
 
 	return (bool)(env.matchEntity(personId, entityId)), nil
 }
+
+// matchEntityItem returns true if the item with id "itemId" named "name"
+// belongs to the entity "entityId", one of the entities returned by "itemEntities",
+// and if the person "personId" is a member of it
+func (env *Env) matchEntityItem(name string, itemEntities func(id int) ([]int, error), personId string, itemId string, entityId string) bool {
+	var (
+		pid, iid int
+		eids     []int
+		err      error
+		m        bool
+	)
+
+	if pid, err = strconv.Atoi(personId); err != nil {
+		logger.Log.Error(name + ": " + err.Error())
+		return false
+	}
+	if iid, err = strconv.Atoi(itemId); err != nil {
+		logger.Log.Error(name + ": " + err.Error())
+		return false
+	}
+
+	if eids, err = itemEntities(iid); err != nil {
+		logger.Log.Error(fmt.Sprintf("%s: %d %s", name, iid, err.Error()))
+		return false
+	}
+	for _, eid := range eids {
+		if strconv.Itoa(eid) != entityId {
+			continue
+		}
+		if m, err = env.DB.DoesPersonBelongsTo(pid, []models.Entity{{EntityID: eid}}); err != nil {
+			logger.Log.Error(fmt.Sprintf("%s: %d %s", name, eid, err.Error()))
+			return false
+		}
+		if m {
+			break
+		}
+	}
+	logger.Log.WithFields(logrus.Fields{"m": m}).Debug(name)
+
+	return m
+}
+
+// MatchEntityItemFunc returns the casbin function "name" matching
+// the items whose entities are returned by "itemEntities"
+func (env *Env) MatchEntityItemFunc(name string, itemEntities func(id int) ([]int, error)) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		personId := args[0].(string)
+		itemId := args[1].(string)
+		entityId := args[2].(string)
+
+		return (bool)(env.matchEntityItem(name, itemEntities, personId, itemId, entityId)), nil
+	}
+}
+
+// inventoryEntities returns the entity id of the inventory with id "id"
+func (env *Env) inventoryEntities(id int) ([]int, error) {
+	e, err := env.DB.GetInventoryEntity(id)
+	return []int{e.EntityID}, err
+}
+
+// wastePickupEntities returns the entity id of the waste pickup request with id "id"
+func (env *Env) wastePickupEntities(id int) ([]int, error) {
+	e, err := env.DB.GetWastePickupEntity(id)
+	return []int{e.EntityID}, err
+}
+
+// storageTransferEntities returns the source and target entity ids
+// of the storage transfer with id "id"
+func (env *Env) storageTransferEntities(id int) ([]int, error) {
+	ents, err := env.DB.GetStorageTransferEntities(id)
+	if err != nil {
+		return nil, err
+	}
+	eids := []int{}
+	for _, e := range ents {
+		eids = append(eids, e.EntityID)
+	}
+	return eids, nil
+}
+
+// reservationEntities returns the entity id of the reservation with id "id"
+func (env *Env) reservationEntities(id int) ([]int, error) {
+	r, err := env.DB.GetReservation(id)
+	return []int{r.EntityID}, err
+}
+
+// purchaseRequestEntities returns the entity id of the purchase request with id "id"
+func (env *Env) purchaseRequestEntities(id int) ([]int, error) {
+	p, err := env.DB.GetPurchaseRequest(id)
+	return []int{p.EntityID}, err
+}
+
+// stockThresholdEntities returns the entity id of the stock threshold with id "id"
+func (env *Env) stockThresholdEntities(id int) ([]int, error) {
+	t, err := env.DB.GetStockThreshold(id)
+	return []int{t.EntityID}, err
+}
+
+// storeLocationLimitEntities returns the entity id of the store location
+// of the store location limit with id "id"
+func (env *Env) storeLocationLimitEntities(id int) ([]int, error) {
+	l, err := env.DB.GetStoreLocationLimit(id)
+	if err != nil {
+		return nil, err
+	}
+	sl, err := env.DB.GetStoreLocation(int(l.StoreLocationID.Int64))
+	return []int{sl.EntityID}, err
+}
+
+// sensorEntities returns the entity id of the store location
+// of the sensor with id "id"
+func (env *Env) sensorEntities(id int) ([]int, error) {
+	s, err := env.DB.GetSensor(id)
+	if err != nil {
+		return nil, err
+	}
+	sl, err := env.DB.GetStoreLocation(int(s.StoreLocationID.Int64))
+	return []int{sl.EntityID}, err
+}
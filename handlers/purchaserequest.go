@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/mailer"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// getPurchaseRequestFromRequest returns the purchase request matching the request "id" variable
+func (env *Env) getPurchaseRequestFromRequest(r *http.Request) (models.PurchaseRequest, *models.AppError) {
+	vars := mux.Vars(r)
+	var (
+		id      int
+		err     error
+		request models.PurchaseRequest
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.PurchaseRequest{}, &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if request, err = env.DB.GetPurchaseRequest(id); err != nil {
+		if err == sql.ErrNoRows {
+			return models.PurchaseRequest{}, &models.AppError{
+				Error:   err,
+				Message: "purchase request not found",
+				Code:    http.StatusNotFound}
+		}
+		return models.PurchaseRequest{}, &models.AppError{
+			Error:   err,
+			Message: "error getting the purchase request",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return request, nil
+}
+
+// notifyPurchaseRequest mails the message "message" about the purchase request p
+// to the request entity managers and to the requester, except the person "by".
+// Errors are only logged.
+func (env *Env) notifyPurchaseRequest(p models.PurchaseRequest, message string, by models.Person) {
+
+	var (
+		err      error
+		managers []models.Person
+	)
+
+	people := []models.Person{p.Person}
+	if managers, err = env.DB.GetEntityManager(p.EntityID); err != nil {
+		logger.Log.Errorf("error getting the entity managers %s", err.Error())
+	}
+	people = append(people, managers...)
+
+	msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "purchaserequest_" + message + "_mailbody", PluralCount: 1}),
+		p.Product.Name.NameLabel,
+		p.EntityName,
+		by.PersonEmail,
+		env.ApplicationFullURL)
+	msgsubject := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "purchaserequest_" + message + "_mailsubject", PluralCount: 1})
+
+	sent := map[string]bool{by.PersonEmail: true}
+	for _, p := range people {
+		if sent[p.PersonEmail] {
+			continue
+		}
+		sent[p.PersonEmail] = true
+
+		if err = mailer.SendMail(p.PersonEmail, msgsubject, msgbody); err != nil {
+			logger.Log.Errorf("error sending email %s", err.Error())
+		}
+	}
+
+}
+
+// purchaseRequestAppError returns the AppError of the purchase request datastore error err
+func purchaseRequestAppError(err error, message string) *models.AppError {
+	switch err {
+	case datastores.ErrPurchaseRequestStatus,
+		datastores.ErrPurchaseRequestSupplierRef,
+		datastores.ErrPurchaseRequestStoreLocation,
+		datastores.ErrBarecodeAlreadyExists:
+		return &models.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+	return &models.AppError{
+		Error:   err,
+		Message: message,
+		Code:    http.StatusInternalServerError}
+}
+
+/*
+	REST handlers
+*/
+
+// GetPurchaseRequestsHandler returns a json list of the purchase requests matching the search criteria
+func (env *Env) GetPurchaseRequestsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetPurchaseRequestsHandler")
+
+	var (
+		err  error
+		aerr *models.AppError
+		dspp models.DbselectparamPurchaseRequest
+	)
+
+	// init db request parameters
+	if dspp, aerr = models.NewdbselectparamPurchaseRequest(r, nil); aerr != nil {
+		return aerr
+	}
+
+	requests, count, err := env.DB.GetPurchaseRequests(dspp)
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the purchase requests",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.PurchaseRequest `json:"rows"`
+		Total int                      `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(resp{Rows: requests, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetPurchaseRequestHandler returns a json of the purchase request with the requested id
+func (env *Env) GetPurchaseRequestHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err     error
+		aerr    *models.AppError
+		ok      bool
+		request models.PurchaseRequest
+	)
+
+	if request, aerr = env.getPurchaseRequestFromRequest(r); aerr != nil {
+		return aerr
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if ok, err = env.isEntityMember(c.PersonID, request.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(request); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreatePurchaseRequestHandler creates a purchase request of a product
+// for an entity of the logged user and notifies the entity managers
+func (env *Env) CreatePurchaseRequestHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreatePurchaseRequestHandler")
+	var (
+		p   models.PurchaseRequest
+		err error
+		ok  bool
+		id  int64
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if p.Product.ProductID == 0 || p.EntityID == 0 {
+		return &models.AppError{
+			Error:   errors.New("missing purchase request product or entity"),
+			Message: "missing purchase request product or entity",
+			Code:    http.StatusBadRequest}
+	}
+	if p.PurchaseRequestNbItem == 0 {
+		p.PurchaseRequestNbItem = 1
+	}
+	if p.PurchaseRequestNbItem < 0 || (p.PurchaseRequestQuantity.Valid && p.PurchaseRequestQuantity.Float64 <= 0) {
+		return &models.AppError{
+			Error:   errors.New("invalid purchase request quantity"),
+			Message: "invalid purchase request quantity",
+			Code:    http.StatusBadRequest}
+	}
+
+	// the logged user must belong to the entity
+	if ok, err = env.isEntityMember(c.PersonID, p.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("person does not belong to the entity"),
+			Message: "person does not belong to the entity",
+			Code:    http.StatusForbidden}
+	}
+
+	p.PersonID = c.PersonID
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("CreatePurchaseRequestHandler")
+
+	if id, err = env.DB.CreatePurchaseRequest(p); err != nil {
+		return purchaseRequestAppError(err, "create purchase request error")
+	}
+
+	if p, err = env.DB.GetPurchaseRequest(int(id)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the purchase request",
+			Code:    http.StatusInternalServerError}
+	}
+
+	env.notifyPurchaseRequest(p, models.PurchaseRequestRequested, p.Person)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(p); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// decidePurchaseRequestHandler approves, refuses, orders or cancels the purchase request
+// with the requested id according to the status.
+// Requests are approved, refused and ordered by the entity managers
+// and cancelled by the requester or the entity managers.
+// The requester and the entity managers are notified.
+func (env *Env) decidePurchaseRequestHandler(w http.ResponseWriter, r *http.Request, status string) *models.AppError {
+	var (
+		err     error
+		aerr    *models.AppError
+		ok      bool
+		request models.PurchaseRequest
+		order   models.PurchaseRequest
+	)
+
+	if request, aerr = env.getPurchaseRequestFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if status == models.PurchaseRequestOrdered {
+		if err = json.NewDecoder(r.Body).Decode(&order); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "JSON decoding error",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if status == models.PurchaseRequestCancelled && request.PersonID == c.PersonID {
+		ok = true
+	} else if ok, err = env.isEntityManager(c.PersonID, request.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error checking the permissions",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	switch status {
+	case models.PurchaseRequestApproved:
+		err = env.DB.ApprovePurchaseRequest(request.PurchaseRequestID, c.PersonID)
+	case models.PurchaseRequestRefused:
+		err = env.DB.RefusePurchaseRequest(request.PurchaseRequestID, c.PersonID)
+	case models.PurchaseRequestOrdered:
+		err = env.DB.OrderPurchaseRequest(request.PurchaseRequestID, order.PurchaseRequestOrderReference)
+	case models.PurchaseRequestCancelled:
+		err = env.DB.CancelPurchaseRequest(request.PurchaseRequestID)
+	}
+	if err != nil {
+		return purchaseRequestAppError(err, "purchase request error")
+	}
+
+	if request, err = env.DB.GetPurchaseRequest(request.PurchaseRequestID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the purchase request",
+			Code:    http.StatusInternalServerError}
+	}
+	logger.Log.WithFields(logrus.Fields{"request": request}).Debug("decidePurchaseRequestHandler")
+
+	env.notifyPurchaseRequest(request, status, models.Person{PersonID: c.PersonID, PersonEmail: c.PersonEmail})
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(request); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// ApprovePurchaseRequestHandler approves the purchase request with the requested id
+func (env *Env) ApprovePurchaseRequestHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	return env.decidePurchaseRequestHandler(w, r, models.PurchaseRequestApproved)
+}
+
+// RefusePurchaseRequestHandler refuses the purchase request with the requested id
+func (env *Env) RefusePurchaseRequestHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	return env.decidePurchaseRequestHandler(w, r, models.PurchaseRequestRefused)
+}
+
+// OrderPurchaseRequestHandler sets the purchase request with the requested id as ordered
+// with the order reference of the request body
+func (env *Env) OrderPurchaseRequestHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	return env.decidePurchaseRequestHandler(w, r, models.PurchaseRequestOrdered)
+}
+
+// CancelPurchaseRequestHandler cancels the purchase request with the requested id
+func (env *Env) CancelPurchaseRequestHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	return env.decidePurchaseRequestHandler(w, r, models.PurchaseRequestCancelled)
+}
+
+// ReceivePurchaseRequestHandler sets the purchase request with the requested id as received
+// and stores the received items in the store location of the request body.
+// Requests are received by the requester or the entity managers.
+// It returns a json list of the created storages.
+func (env *Env) ReceivePurchaseRequestHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err       error
+		aerr      *models.AppError
+		ok        bool
+		ids       []int
+		request   models.PurchaseRequest
+		reception models.PurchaseReception
+		storage   models.Storage
+		storages  []models.Storage
+	)
+
+	if request, aerr = env.getPurchaseRequestFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if err = json.NewDecoder(r.Body).Decode(&reception); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if request.PersonID == c.PersonID {
+		ok = true
+	} else if ok, err = env.isEntityManager(c.PersonID, request.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error checking the permissions",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"request": request, "reception": reception}).Debug("ReceivePurchaseRequestHandler")
+
+	if aerr = env.checkStoreLocationLimits(w, models.Storage{
+		StorageQuantity: request.PurchaseRequestQuantity,
+		Product:         request.Product,
+		StoreLocation:   reception.StoreLocation,
+		UnitQuantity:    request.UnitQuantity,
+	}, request.PurchaseRequestNbItem); aerr != nil {
+		return aerr
+	}
+
+	if ids, err = env.DB.ReceivePurchaseRequest(request.PurchaseRequestID, reception, c.PersonID); err != nil {
+		return purchaseRequestAppError(err, "receive purchase request error")
+	}
+
+	for _, i := range ids {
+		if storage, err = env.DB.GetStorage(i); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the storage",
+				Code:    http.StatusInternalServerError}
+		}
+		storages = append(storages, storage)
+	}
+
+	env.notifyPurchaseRequest(request, models.PurchaseRequestReceived, models.Person{PersonID: c.PersonID, PersonEmail: c.PersonEmail})
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(storages); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/mailer"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// getReservationFromRequest returns the reservation matching the request "id" variable
+func (env *Env) getReservationFromRequest(r *http.Request) (models.Reservation, *models.AppError) {
+	vars := mux.Vars(r)
+	var (
+		id          int
+		err         error
+		reservation models.Reservation
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.Reservation{}, &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if reservation, err = env.DB.GetReservation(id); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Reservation{}, &models.AppError{
+				Error:   err,
+				Message: "reservation not found",
+				Code:    http.StatusNotFound}
+		}
+		return models.Reservation{}, &models.AppError{
+			Error:   err,
+			Message: "error getting the reservation",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return reservation, nil
+}
+
+// getReservationConflicts returns the reservations of other people than the person "personID"
+// broken by withdrawing the quantity "withdrawn" from the storage "id".
+// Errors are only logged: reservations never block an operation.
+func (env *Env) getReservationConflicts(id int, personID int, withdrawn sql.NullFloat64) []models.Reservation {
+
+	var (
+		err       error
+		conflicts []models.Reservation
+	)
+
+	if conflicts, err = env.DB.GetReservationConflicts(id, personID, withdrawn); err != nil {
+		logger.Log.Errorf("error getting the reservation conflicts %s", err.Error())
+		return nil
+	}
+
+	return conflicts
+}
+
+// warnReservationConflicts sets a warning header on w for the reservations "conflicts"
+// broken by the operation done by the person "by" on the storage s
+// and mails the reserving people.
+// Errors are only logged.
+func (env *Env) warnReservationConflicts(w http.ResponseWriter, s models.Storage, conflicts []models.Reservation, by string) {
+
+	if len(conflicts) == 0 {
+		return
+	}
+
+	w.Header().Add("Warning", fmt.Sprintf(`199 - "%d reservation(s) may not be honored anymore"`, len(conflicts)))
+
+	msgsubject := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "reservation_conflict_mailsubject", PluralCount: 1})
+	for _, c := range conflicts {
+		msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "reservation_conflict_mailbody", PluralCount: 1}),
+			by,
+			s.StorageBarecode.String,
+			s.Product.Name.NameLabel,
+			c.ReservationStartDate.Format("2006-01-02"),
+			c.ReservationEndDate.Format("2006-01-02"),
+			env.ApplicationFullURL)
+
+		if err := mailer.SendMail(c.PersonEmail, msgsubject, msgbody); err != nil {
+			logger.Log.Errorf("error sending email %s", err.Error())
+		}
+	}
+
+}
+
+/*
+	REST handlers
+*/
+
+// GetReservationsHandler returns a json list of the reservations matching the search criteria
+func (env *Env) GetReservationsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetReservationsHandler")
+
+	var (
+		err  error
+		aerr *models.AppError
+		dspr models.DbselectparamReservation
+	)
+
+	// init db request parameters
+	if dspr, aerr = models.NewdbselectparamReservation(r, nil); aerr != nil {
+		return aerr
+	}
+
+	reservations, count, err := env.DB.GetReservations(dspr)
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the reservations",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.Reservation `json:"rows"`
+		Total int                  `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(resp{Rows: reservations, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetReservationHandler returns a json of the reservation with the requested id.
+// Only the reserving person and the entity managers can get it.
+func (env *Env) GetReservationHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err         error
+		aerr        *models.AppError
+		ok          bool
+		reservation models.Reservation
+	)
+
+	if reservation, aerr = env.getReservationFromRequest(r); aerr != nil {
+		return aerr
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if reservation.PersonID != c.PersonID {
+		if ok, err = env.isEntityManager(c.PersonID, reservation.EntityID); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the entity managers",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return &models.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(reservation); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreateReservationHandler creates a reservation of a storage,
+// or of a product in an entity, for the logged user
+func (env *Env) CreateReservationHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateReservationHandler")
+	var (
+		res models.Reservation
+		err error
+		ok  bool
+		id  int64
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&res); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+	res.PersonID = c.PersonID
+
+	if !res.ReservationStartDate.Before(res.ReservationEndDate) {
+		return &models.AppError{
+			Error:   errors.New("invalid reservation dates"),
+			Message: "invalid reservation dates",
+			Code:    http.StatusBadRequest}
+	}
+	if res.ReservationQuantity.Valid && res.ReservationQuantity.Float64 <= 0 {
+		return &models.AppError{
+			Error:   errors.New("invalid reservation quantity"),
+			Message: "invalid reservation quantity",
+			Code:    http.StatusBadRequest}
+	}
+
+	if res.IsStorageReservation() {
+		// the logged user must be able to see the storage
+		if ok, err = env.enforce(r, "r", "storages", res.Storage.StorageID.Int64); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "enforcer error",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return &models.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+	} else {
+		if res.ProductID == 0 || res.EntityID == 0 {
+			return &models.AppError{
+				Error:   errors.New("missing reservation product or entity"),
+				Message: "missing reservation product or entity",
+				Code:    http.StatusBadRequest}
+		}
+		// the logged user must belong to the entity
+		if ok, err = env.isEntityMember(c.PersonID, res.EntityID); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting person entities",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return &models.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"res": res}).Debug("CreateReservationHandler")
+
+	if id, err = env.DB.CreateReservation(res); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "create reservation error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if res, err = env.DB.GetReservation(int(id)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the reservation",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(res); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// DeleteReservationHandler deletes the reservation with the requested id.
+// Only the reserving person and the entity managers can delete it.
+func (env *Env) DeleteReservationHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err         error
+		aerr        *models.AppError
+		ok          bool
+		reservation models.Reservation
+	)
+
+	if reservation, aerr = env.getReservationFromRequest(r); aerr != nil {
+		return aerr
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if reservation.PersonID != c.PersonID {
+		if ok, err = env.isEntityManager(c.PersonID, reservation.EntityID); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the entity managers",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return &models.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+	}
+
+	if err = env.DB.DeleteReservation(reservation.ReservationID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "delete reservation error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return nil
+}
+
+// GetStorageReservationConflictsHandler returns a json list of the reservations
+// of other people broken by withdrawing the "withdrawn" request parameter quantity
+// from the storage with the requested id.
+// Without "withdrawn" the whole storage is supposed to leave (borrowing).
+func (env *Env) GetStorageReservationConflictsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id        int
+		err       error
+		withdrawn sql.NullFloat64
+		conflicts []models.Reservation
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if q, ok := r.URL.Query()["withdrawn"]; ok {
+		if withdrawn.Float64, err = strconv.ParseFloat(q[0], 64); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "withdrawn float conversion",
+				Code:    http.StatusBadRequest}
+		}
+		withdrawn.Valid = true
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if conflicts, err = env.DB.GetReservationConflicts(id, c.PersonID, withdrawn); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the reservation conflicts",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(conflicts); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
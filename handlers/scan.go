@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/codes"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// enforce returns true if the logged user is allowed
+// to perform the action on the item with the id
+func (env *Env) enforce(r *http.Request, action string, item string, id int64) (bool, error) {
+	c := models.ContainerFromRequestContext(r)
+	return env.Enforcer.Enforce(strconv.Itoa(c.PersonID), action, item, strconv.FormatInt(id, 10))
+}
+
+// scanStorages returns the storages matching the dsps search criteria
+// the logged user can view, with the allowed actions.
+// match filters the storages returned by the LIKE search criteria.
+func (env *Env) scanStorages(r *http.Request, dsps models.DbselectparamStorage, match func(models.Storage) bool) ([]models.ScanStorage, error) {
+
+	var (
+		err      error
+		ok       bool
+		storages []models.Storage
+		result   []models.ScanStorage
+	)
+
+	if storages, _, err = env.DB.GetStorages(dsps); err != nil {
+		return nil, err
+	}
+
+	for _, s := range storages {
+		if match != nil && !match(s) {
+			continue
+		}
+
+		if ok, err = env.enforce(r, "r", "storages", s.StorageID.Int64); err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		// borrowings are allowed for every storage the user can view
+		actions := []string{models.ScanActionView, models.ScanActionBorrow}
+
+		if ok, err = env.enforce(r, "w", "storages", s.StorageID.Int64); err != nil {
+			return nil, err
+		}
+		if ok {
+			actions = append(actions, models.ScanActionMove, models.ScanActionWithdraw)
+		}
+
+		result = append(result, models.ScanStorage{Storage: s, Actions: actions})
+	}
+
+	return result, nil
+
+}
+
+// ScanHandler resolves the "code" request parameter scanned by a barecode reader.
+// The code is a query parameter and not a path variable as it may contain
+// "/" or "?" (URL QR codes).
+// The code is tried in order as:
+// - a storage QR code
+// - a storage barecode
+// - a storage batch number
+// - a store location barecode prefix
+// - a supplier GS1 barecode (GTIN)
+// and the first match is returned.
+func (env *Env) ScanHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err  error
+		aerr *models.AppError
+		ok   bool
+		dsps models.DbselectparamStorage
+	)
+
+	q, found := r.URL.Query()["code"]
+	if !found || q[0] == "" {
+		return &models.AppError{
+			Error:   errors.New("missing code"),
+			Code:    http.StatusBadRequest,
+			Message: "missing code",
+		}
+	}
+
+	result := models.ScanResult{
+		Code: q[0],
+		Type: models.ScanTypeUnknown,
+	}
+	code := result.Code
+
+	// storage QR code
+	if id, barecode, isqr := codes.ParseStorageQRCodeContent(code); isqr {
+		if dsps, aerr = models.NewdbselectparamStorage(r, nil); aerr != nil {
+			return aerr
+		}
+		if id == 0 {
+			// payload without {id}
+			code = barecode
+		} else {
+			dsps.SetIds([]int{int(id)})
+			if result.Storages, err = env.scanStorages(r, dsps, nil); err != nil {
+				return &models.AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "error getting the storages",
+				}
+			}
+			if len(result.Storages) > 0 {
+				result.Type = models.ScanTypeStorage
+			}
+		}
+	}
+
+	// storage barecode
+	if result.Type == models.ScanTypeUnknown {
+		if dsps, aerr = models.NewdbselectparamStorage(r, nil); aerr != nil {
+			return aerr
+		}
+		dsps.SetStorageBarecode(code)
+		if result.Storages, err = env.scanStorages(r, dsps, func(s models.Storage) bool {
+			return s.StorageBarecode.String == code
+		}); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusInternalServerError,
+				Message: "error getting the storages",
+			}
+		}
+		if len(result.Storages) > 0 {
+			result.Type = models.ScanTypeBarecode
+		}
+	}
+
+	// storage batch number
+	if result.Type == models.ScanTypeUnknown {
+		if dsps, aerr = models.NewdbselectparamStorage(r, nil); aerr != nil {
+			return aerr
+		}
+		dsps.SetStorageBatchNumber(code)
+		if result.Storages, err = env.scanStorages(r, dsps, func(s models.Storage) bool {
+			return s.StorageBatchNumber.String == code
+		}); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusInternalServerError,
+				Message: "error getting the storages",
+			}
+		}
+		if len(result.Storages) > 0 {
+			result.Type = models.ScanTypeBatchNumber
+		}
+	}
+
+	// store location barecode prefix
+	if result.Type == models.ScanTypeUnknown && codes.ValidateBarecodePrefix(code) == nil {
+		var storelocations []models.StoreLocation
+		if storelocations, err = env.DB.GetStoreLocationsByBarecodePrefix(code); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusInternalServerError,
+				Message: "error getting the store locations",
+			}
+		}
+		for _, sl := range storelocations {
+			if ok, err = env.enforce(r, "r", "storelocations", sl.StoreLocationID.Int64); err != nil {
+				return &models.AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "enforcer error",
+				}
+			}
+			if ok {
+				result.StoreLocations = append(result.StoreLocations, models.ScanStoreLocation{
+					StoreLocation: sl,
+					Actions:       []string{models.ScanActionView},
+				})
+			}
+		}
+		if len(result.StoreLocations) > 0 {
+			result.Type = models.ScanTypeStoreLocation
+		}
+	}
+
+	// supplier GS1 barecode
+	if result.Type == models.ScanTypeUnknown {
+		if gs1, e := codes.ParseGS1(code); e == nil {
+			result.Type = models.ScanTypeGS1
+			result.GTIN = gs1.GTIN
+
+			var (
+				ids  []int
+				gtin models.GTIN
+			)
+			// GTIN mapping first, then supplier references
+			if gtin, err = env.DB.GetGTIN(gs1.GTIN); err != nil && err != sql.ErrNoRows {
+				return &models.AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "error getting the gtin",
+				}
+			}
+			if err == nil {
+				ids = []int{gtin.ProductID}
+			} else if ids, err = env.DB.GetSupplierRefsProductIDs(codes.GTINVariants(gs1.GTIN)); err != nil {
+				return &models.AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "error getting the products",
+				}
+			}
+			for _, id := range ids {
+				if ok, err = env.enforce(r, "r", "products", int64(id)); err != nil {
+					return &models.AppError{
+						Error:   err,
+						Code:    http.StatusInternalServerError,
+						Message: "enforcer error",
+					}
+				}
+				if !ok {
+					continue
+				}
+				var p models.Product
+				if p, err = env.DB.GetProduct(id); err != nil {
+					return &models.AppError{
+						Error:   err,
+						Code:    http.StatusInternalServerError,
+						Message: "error getting the product",
+					}
+				}
+				result.Products = append(result.Products, models.ScanProduct{
+					Product: p,
+					Actions: []string{models.ScanActionView},
+				})
+			}
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"code": result.Code, "type": result.Type}).Debug("ScanHandler")
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/mailer"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// hashSensorToken returns the hash of the sensor token stored in the database
+func hashSensorToken(token string) string {
+
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+
+}
+
+// notifySensorAlert mails the alert a to the owners of its storages
+// and to the managers of the store location entity.
+// Errors are only logged.
+func (env *Env) notifySensorAlert(a models.SensorAlert) {
+
+	var (
+		err      error
+		managers []models.Person
+		lines    []string
+	)
+
+	people := []models.Person{}
+	for _, s := range a.Storages {
+		lines = append(lines, fmt.Sprintf("- %s %s (%s): %s",
+			s.StorageBarecode.String,
+			s.Product.Name.NameLabel,
+			s.StoreLocation.StoreLocationFullPath,
+			s.Person.PersonEmail))
+		people = append(people, s.Person)
+	}
+	if managers, err = env.DB.GetEntityManager(a.SensorReading.EntityID); err != nil {
+		logger.Log.Errorf("error getting the entity managers %s", err.Error())
+	}
+	people = append(people, managers...)
+
+	msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "sensoralert_mailbody", PluralCount: 1}),
+		a.SensorReading.Sensor.SensorLabel,
+		a.SensorAlertReason,
+		a.SensorReading.SensorReadingDate.Format("2006-01-02 15:04:05"),
+		strings.Join(lines, "\n"),
+		env.ApplicationFullURL)
+	msgsubject := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "sensoralert_mailsubject", PluralCount: 1})
+
+	sent := map[string]bool{}
+	for _, p := range people {
+		if sent[p.PersonEmail] {
+			continue
+		}
+		sent[p.PersonEmail] = true
+
+		if err = mailer.SendMail(p.PersonEmail, msgsubject, msgbody); err != nil {
+			logger.Log.Errorf("error sending email %s", err.Error())
+		}
+	}
+
+}
+
+/*
+	REST handlers
+*/
+
+// GetSensorsHandler returns a json list of the sensors, for the "entity" request parameter
+// or for all the entities of the logged user
+func (env *Env) GetSensorsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err      error
+		aerr     *models.AppError
+		entities []int
+		sensors  []models.Sensor
+	)
+
+	if entities, aerr = env.requestEntities(r); aerr != nil {
+		return aerr
+	}
+
+	if sensors, err = env.DB.GetSensors(entities); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the sensors",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(sensors); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreateSensorHandler creates a sensor and returns it with its token.
+// The token is not stored and can not be retrieved later.
+// Sensors are created by the managers of the store location entity.
+func (env *Env) CreateSensorHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateSensorHandler")
+	var (
+		s     models.Sensor
+		err   error
+		aerr  *models.AppError
+		id    int64
+		token = make([]byte, 32)
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&s); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if !s.StoreLocationID.Valid || s.SensorLabel == "" {
+		return &models.AppError{
+			Error:   errors.New("missing sensor label or store location"),
+			Message: "missing sensor label or store location",
+			Code:    http.StatusBadRequest}
+	}
+	if aerr = env.storeLocationManager(c.PersonID, int(s.StoreLocationID.Int64)); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"s": s}).Debug("CreateSensorHandler")
+
+	if _, err = rand.Read(token); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error generating the sensor token",
+			Code:    http.StatusInternalServerError}
+	}
+	tokenStr := hex.EncodeToString(token)
+
+	if id, err = env.DB.CreateSensor(s, hashSensorToken(tokenStr)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "create sensor error",
+			Code:    http.StatusInternalServerError}
+	}
+	if s, err = env.DB.GetSensor(int(id)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the sensor",
+			Code:    http.StatusInternalServerError}
+	}
+	s.SensorToken = tokenStr
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(s); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// DeleteSensorHandler deletes the sensor with the requested id and its readings.
+// Sensors are deleted by the managers of the store location entity.
+func (env *Env) DeleteSensorHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id   int
+		err  error
+		aerr *models.AppError
+		s    models.Sensor
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if s, err = env.DB.GetSensor(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the sensor",
+			Code:    http.StatusInternalServerError}
+	}
+	if aerr = env.storeLocationManager(c.PersonID, int(s.StoreLocationID.Int64)); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.DeleteSensor(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "delete sensor error",
+			Code:    http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// CreateSensorReadingHandler records the reading of the sensor authenticated
+// by the "Authorization: Bearer <token>" header.
+// The first reading out of the store location temperature range raises an alert
+// mailed to the owners of the store location storages and to the entity managers.
+// The alert is returned, or null.
+func (env *Env) CreateSensorReadingHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err     error
+		s       models.Sensor
+		m       models.SensorMeasure
+		last    models.SensorReading
+		found   bool
+		reason  string
+		alertID int64
+		alert   *models.SensorAlert
+	)
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return &models.AppError{
+			Error:   errors.New("missing sensor token"),
+			Message: "missing sensor token",
+			Code:    http.StatusUnauthorized}
+	}
+	if s, err = env.DB.GetSensorByTokenHash(hashSensorToken(token)); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				Error:   errors.New("invalid sensor token"),
+				Message: "invalid sensor token",
+				Code:    http.StatusUnauthorized}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the sensor",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&m); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusBadRequest}
+	}
+	if m.Temperature == nil && m.Humidity == nil {
+		return &models.AppError{
+			Error:   errors.New("missing temperature or humidity"),
+			Message: "missing temperature or humidity",
+			Code:    http.StatusBadRequest}
+	}
+
+	reading := models.SensorReading{Sensor: s, SensorReadingDate: time.Now()}
+	if m.Date != nil {
+		reading.SensorReadingDate = *m.Date
+	}
+	if m.Humidity != nil {
+		reading.SensorReadingHumidity = sql.NullFloat64{Valid: true, Float64: *m.Humidity}
+	}
+	if m.Temperature != nil {
+		reading.SensorReadingTemperature = sql.NullFloat64{Valid: true, Float64: *m.Temperature}
+
+		// alerting on the reading leaving the range only
+		if reason = s.StoreLocation.TemperatureExcursion(*m.Temperature); reason != "" {
+			if last, found, err = env.DB.GetLastSensorReading(int(s.StoreLocationID.Int64)); err != nil {
+				return &models.AppError{
+					Error:   err,
+					Message: "error getting the last sensor reading",
+					Code:    http.StatusInternalServerError}
+			}
+			if found && s.StoreLocation.TemperatureExcursion(last.SensorReadingTemperature.Float64) != "" {
+				reason = ""
+			}
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"reading": reading, "reason": reason}).Debug("CreateSensorReadingHandler")
+
+	if alertID, err = env.DB.CreateSensorReading(reading, reason); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "create sensor reading error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if alertID != 0 {
+		var a models.SensorAlert
+		if a, err = env.DB.GetSensorAlert(int(alertID)); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the sensor alert",
+				Code:    http.StatusInternalServerError}
+		}
+		env.notifySensorAlert(a)
+		alert = &a
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(alert); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetSensorReadingsHandler returns a json list of the readings of the "storelocation"
+// request parameter, between the "from" and "to" optional request parameters as 2006-01-02
+func (env *Env) GetSensorReadingsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err      error
+		ok       bool
+		id       int
+		sl       models.StoreLocation
+		readings []models.SensorReading
+	)
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+	q := r.URL.Query()
+
+	if id, err = strconv.Atoi(q.Get("storelocation")); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "storelocation atoi conversion",
+			Code:    http.StatusBadRequest}
+	}
+	if sl, err = env.DB.GetStoreLocation(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location",
+			Code:    http.StatusInternalServerError}
+	}
+	if ok, err = env.isEntityMember(c.PersonID, sl.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	if readings, err = env.DB.GetSensorReadings(id, q.Get("from"), q.Get("to")); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the sensor readings",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(readings); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetSensorAlertsHandler returns a json list of the sensor alerts with their storages,
+// for the "entity" request parameter or for all the entities of the logged user
+func (env *Env) GetSensorAlertsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err      error
+		aerr     *models.AppError
+		entities []int
+		alerts   []models.SensorAlert
+	)
+
+	if entities, aerr = env.requestEntities(r); aerr != nil {
+		return aerr
+	}
+
+	if alerts, err = env.DB.GetSensorAlerts(entities); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the sensor alerts",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(alerts); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+/*
+	REST handlers
+*/
+
+// solutionAppError returns the AppError of the solution preparation error err
+func solutionAppError(err error) *models.AppError {
+	if err == datastores.ErrSolutionSource ||
+		err == datastores.ErrSolutionConcentration ||
+		err == datastores.ErrSolutionVolume ||
+		err == datastores.ErrBarecodeAlreadyExists {
+		return &models.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+	return &models.AppError{
+		Error:   err,
+		Message: "prepare solution error",
+		Code:    http.StatusInternalServerError}
+}
+
+// PrepareSolutionHandler creates the storage of a solution prepared
+// from source storages and returns it as json
+func (env *Env) PrepareSolutionHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("PrepareSolutionHandler")
+	var (
+		s       models.Solution
+		sl      models.StoreLocation
+		storage models.Storage
+		err     error
+		id      int
+		ok      bool
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&s); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	// the logged user must be able to modify the sources
+	for _, source := range s.Sources {
+		if ok, err = env.enforce(r, "w", "storages", int64(source.StorageID)); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "enforcer error",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return &models.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+	}
+
+	// the store location must be able to store
+	// and belong to an entity of the logged user
+	if sl, err = env.DB.GetStoreLocation(s.StoreLocationID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location",
+			Code:    http.StatusInternalServerError}
+	}
+	if !sl.StoreLocationCanStore.Valid || !sl.StoreLocationCanStore.Bool {
+		return &models.AppError{
+			Error:   errors.New("store location can not store"),
+			Message: "store location can not store",
+			Code:    http.StatusBadRequest}
+	}
+	if ok, err = env.isEntityMember(c.PersonID, sl.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("person does not belong to the entity"),
+			Message: "person does not belong to the entity",
+			Code:    http.StatusForbidden}
+	}
+
+	// default expiration date
+	if !s.ExpirationDate.Valid && env.SolutionExpirationDays > 0 {
+		s.ExpirationDate.Time = time.Now().AddDate(0, 0, env.SolutionExpirationDays)
+		s.ExpirationDate.Valid = true
+	}
+	logger.Log.WithFields(logrus.Fields{"s": s}).Debug("PrepareSolutionHandler")
+
+	// reservations broken by the sources withdrawals
+	var (
+		sources   []models.Storage
+		conflicts [][]models.Reservation
+	)
+	for _, source := range s.Sources {
+		if storage, err = env.DB.GetStorage(source.StorageID); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the storage",
+				Code:    http.StatusInternalServerError}
+		}
+		sources = append(sources, storage)
+		conflicts = append(conflicts, env.getReservationConflicts(source.StorageID, c.PersonID, sql.NullFloat64{Valid: true, Float64: source.Quantity}))
+	}
+
+	// the solution storage to be created
+	if storage, err = env.DB.GetSolutionStorage(s, c.PersonID); err != nil {
+		return solutionAppError(err)
+	}
+	if aerr := env.checkStoreLocationLimits(w, storage, 1); aerr != nil {
+		return aerr
+	}
+
+	if id, err = env.DB.PrepareSolution(s, c.PersonID); err != nil {
+		return solutionAppError(err)
+	}
+
+	if storage, err = env.DB.GetStorage(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	for i := range sources {
+		env.warnReservationConflicts(w, sources[i], conflicts[i], c.PersonEmail)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(storage); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetStorageSourcesHandler returns a json list of the source storages
+// the storage with the requested id has been prepared from.
+// Storages the logged user can not read are removed.
+func (env *Env) GetStorageSourcesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id       int
+		ok       bool
+		err      error
+		sources  []models.StorageSource
+		readable []models.StorageSource
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if sources, err = env.DB.GetStorageSources(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage sources",
+			Code:    http.StatusInternalServerError}
+	}
+
+	readable = make([]models.StorageSource, 0, len(sources))
+	for _, source := range sources {
+		if ok, err = env.enforce(r, "r", "storages", source.StorageID.Int64); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "enforcer error",
+				Code:    http.StatusInternalServerError}
+		}
+		if ok {
+			readable = append(readable, source)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(readable); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
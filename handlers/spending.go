@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// GetSpendingsHandler returns the spending report of the "entity" request parameter
+// or of the entities managed by the logged user.
+// The "groupby" request parameter is entity (default), supplier, category or period,
+// "from" and "to" are the storage entry dates boundaries as 2006-01-02
+// and "format" is json (default) or csv.
+func (env *Env) GetSpendingsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err   error
+		aerr  *models.AppError
+		lines []models.SpendingLine
+		buf   bytes.Buffer
+	)
+
+	f := models.SpendingFilter{GroupBy: models.SpendingByEntity}
+	q := r.URL.Query()
+	if g, found := q["groupby"]; found {
+		f.GroupBy = g[0]
+	}
+	for _, d := range []struct {
+		param string
+		value *string
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v, found := q[d.param]; found && v[0] != "" {
+			if _, err = time.Parse("2006-01-02", v[0]); err != nil {
+				return &models.AppError{
+					Error:   err,
+					Message: "invalid " + d.param + " date",
+					Code:    http.StatusBadRequest}
+			}
+			*d.value = v[0]
+		}
+	}
+
+	if f.Entities, aerr = env.requestManagedEntities(r); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetSpendingsHandler")
+
+	if lines, err = env.DB.GetSpendings(f); err != nil {
+		if err == datastores.ErrSpendingGroupBy {
+			return &models.AppError{
+				Error:   err,
+				Message: "unknown grouping " + f.GroupBy,
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the spendings",
+			Code:    http.StatusInternalServerError}
+	}
+	if lines == nil {
+		lines = []models.SpendingLine{}
+	}
+
+	format := "json"
+	if v, found := q["format"]; found {
+		format = v[0]
+	}
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err = json.NewEncoder(w).Encode(lines); err != nil {
+			return &models.AppError{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			}
+		}
+		return nil
+	case "csv":
+		if err = models.WriteSpendingsCSV(&buf, lines); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusInternalServerError,
+				Message: "error generating the spending report",
+			}
+		}
+	default:
+		return &models.AppError{
+			Error:   errors.New("unknown format"),
+			Message: "unknown format " + format,
+			Code:    http.StatusBadRequest}
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=chimitheque-spendings-"+f.GroupBy+".csv")
+	w.WriteHeader(http.StatusOK)
+	if _, err = buf.WriteTo(w); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
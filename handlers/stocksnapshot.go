@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// SnapshotStocks stores the snapshot of the stocks of the day.
+func (env *Env) SnapshotStocks() error {
+
+	count, err := env.DB.SnapshotStocks(time.Now())
+	if err != nil {
+		return err
+	}
+	logger.Log.Infof("  %d stock snapshot rows", count)
+
+	return nil
+
+}
+
+// RunStockSnapshotJob snapshots the stocks at startup and then every "interval",
+// a snapshot replacing the previous one of the same day.
+// It never returns.
+func (env *Env) RunStockSnapshotJob(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	for {
+		logger.Log.Info("- snapshotting stocks")
+		if err := env.SnapshotStocks(); err != nil {
+			logger.Log.Error("an error occured: " + err.Error())
+		}
+		<-ticker.C
+	}
+
+}
+
+/*
+	REST handlers
+*/
+
+// GetStockTrendsHandler returns the stock history of the "product" request parameter
+// in the "entity" or "storelocation" (with its children) request parameters,
+// or in the entities of the logged user.
+// The "period" request parameter is day, month (default) or year,
+// "from" and "to" are the snapshot dates boundaries as 2006-01-02
+// and "format" is json (default) or csv.
+func (env *Env) GetStockTrendsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err    error
+		aerr   *models.AppError
+		ok     bool
+		sl     models.StoreLocation
+		trends []models.StockTrend
+		buf    bytes.Buffer
+	)
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	f := models.StockTrendFilter{Period: models.StockTrendByMonth, StoreLocation: -1}
+	q := r.URL.Query()
+
+	if p, found := q["product"]; found {
+		if f.Product, err = strconv.Atoi(p[0]); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "product atoi conversion",
+				Code:    http.StatusBadRequest}
+		}
+	} else {
+		return &models.AppError{
+			Error:   errors.New("missing product"),
+			Message: "missing product",
+			Code:    http.StatusBadRequest}
+	}
+	if p, found := q["period"]; found {
+		f.Period = p[0]
+	}
+	for _, d := range []struct {
+		param string
+		value *string
+	}{{"from", &f.From}, {"to", &f.To}} {
+		if v, found := q[d.param]; found && v[0] != "" {
+			if _, err = time.Parse("2006-01-02", v[0]); err != nil {
+				return &models.AppError{
+					Error:   err,
+					Message: "invalid " + d.param + " date",
+					Code:    http.StatusBadRequest}
+			}
+			*d.value = v[0]
+		}
+	}
+
+	if s, found := q["storelocation"]; found {
+		if f.StoreLocation, err = strconv.Atoi(s[0]); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "storelocation atoi conversion",
+				Code:    http.StatusBadRequest}
+		}
+		if sl, err = env.DB.GetStoreLocation(f.StoreLocation); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the store location",
+				Code:    http.StatusInternalServerError}
+		}
+		if ok, err = env.isEntityMember(c.PersonID, sl.EntityID); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the entity members",
+				Code:    http.StatusInternalServerError}
+		}
+		if !ok {
+			return &models.AppError{
+				Error:   errors.New("unauthorized"),
+				Message: "unauthorized",
+				Code:    http.StatusForbidden}
+		}
+		f.Entities = []int{sl.EntityID}
+	} else if f.Entities, aerr = env.requestEntities(r); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetStockTrendsHandler")
+
+	if trends, err = env.DB.GetStockTrends(f); err != nil {
+		if err == datastores.ErrStockTrendPeriod {
+			return &models.AppError{
+				Error:   err,
+				Message: "unknown period " + f.Period,
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the stock trends",
+			Code:    http.StatusInternalServerError}
+	}
+
+	format := "json"
+	if v, found := q["format"]; found {
+		format = v[0]
+	}
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err = json.NewEncoder(w).Encode(trends); err != nil {
+			return &models.AppError{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			}
+		}
+		return nil
+	case "csv":
+		if err = models.WriteStockTrendsCSV(&buf, trends); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusInternalServerError,
+				Message: "error generating the stock trends",
+			}
+		}
+	default:
+		return &models.AppError{
+			Error:   errors.New("unknown format"),
+			Message: "unknown format " + format,
+			Code:    http.StatusBadRequest}
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=chimitheque-stocktrends-"+strconv.Itoa(f.Product)+".csv")
+	w.WriteHeader(http.StatusOK)
+	if _, err = buf.WriteTo(w); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/mailer"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// MailStockThresholdAlerts mails to the managers of each entity
+// the list of the products whose stock is below the entity threshold.
+// Mail errors are only logged.
+func (env *Env) MailStockThresholdAlerts() error {
+
+	var (
+		err      error
+		alerts   []models.StockThreshold
+		managers []models.Person
+	)
+
+	if alerts, err = env.DB.GetStockThresholdAlerts(-1); err != nil {
+		return err
+	}
+
+	// alerts grouped by entity, in the entity name order
+	var (
+		entities []models.Entity
+		lines    = make(map[int][]string)
+	)
+	for _, a := range alerts {
+		if _, ok := lines[a.EntityID]; !ok {
+			entities = append(entities, a.Entity)
+		}
+		line := fmt.Sprintf("- %s: %s / %s %s",
+			a.Product.Name.NameLabel,
+			strconv.FormatFloat(a.StockThresholdStock, 'f', -1, 64),
+			strconv.FormatFloat(a.StockThresholdQuantity, 'f', -1, 64),
+			a.UnitQuantity.UnitLabel.String)
+		if a.StockThresholdNotConvertible != "" {
+			line += " (" + a.StockThresholdNotConvertible + ")"
+		}
+		lines[a.EntityID] = append(lines[a.EntityID], line)
+	}
+
+	msgsubject := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "stockthreshold_alert_mailsubject", PluralCount: 1})
+	for _, e := range entities {
+		if managers, err = env.DB.GetEntityManager(e.EntityID); err != nil {
+			logger.Log.Errorf("error getting the entity managers %s", err.Error())
+			continue
+		}
+
+		msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "stockthreshold_alert_mailbody", PluralCount: 1}),
+			e.EntityName,
+			strings.Join(lines[e.EntityID], "\n"),
+			env.ApplicationFullURL)
+
+		for _, m := range managers {
+			if err = mailer.SendMail(m.PersonEmail, msgsubject, msgbody); err != nil {
+				logger.Log.Errorf("error sending email %s", err.Error())
+			}
+		}
+	}
+
+	return nil
+
+}
+
+// RunStockThresholdAlertsJob mails the stock threshold alerts every "interval".
+// It never returns.
+func (env *Env) RunStockThresholdAlertsJob(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		logger.Log.Info("- mailing stock threshold alerts")
+		if err := env.MailStockThresholdAlerts(); err != nil {
+			logger.Log.Error("an error occured: " + err.Error())
+		}
+	}
+
+}
+
+/*
+	REST handlers
+*/
+
+// GetStockThresholdsHandler returns a json list of the stock thresholds matching the search criteria
+func (env *Env) GetStockThresholdsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetStockThresholdsHandler")
+
+	var (
+		err  error
+		aerr *models.AppError
+		dsps models.DbselectparamStockThreshold
+	)
+
+	// init db request parameters
+	if dsps, aerr = models.NewdbselectparamStockThreshold(r, nil); aerr != nil {
+		return aerr
+	}
+
+	thresholds, count, err := env.DB.GetStockThresholds(dsps)
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the stock thresholds",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.StockThreshold `json:"rows"`
+		Total int                     `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(resp{Rows: thresholds, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// SetStockThresholdHandler sets the stock threshold of a product in an entity.
+// Thresholds are set by the entity managers.
+func (env *Env) SetStockThresholdHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("SetStockThresholdHandler")
+	var (
+		t   models.StockThreshold
+		err error
+		ok  bool
+		id  int64
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&t); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if t.Product.ProductID == 0 || t.EntityID == 0 {
+		return &models.AppError{
+			Error:   errors.New("missing stock threshold product or entity"),
+			Message: "missing stock threshold product or entity",
+			Code:    http.StatusBadRequest}
+	}
+	if t.StockThresholdQuantity <= 0 {
+		return &models.AppError{
+			Error:   errors.New("invalid stock threshold quantity"),
+			Message: "invalid stock threshold quantity",
+			Code:    http.StatusBadRequest}
+	}
+
+	if ok, err = env.isEntityManager(c.PersonID, t.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the entity managers",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"t": t}).Debug("SetStockThresholdHandler")
+
+	if id, err = env.DB.SetStockThreshold(t); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "set stock threshold error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if t, err = env.DB.GetStockThreshold(int(id)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the stock threshold",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(t); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// DeleteStockThresholdHandler deletes the stock threshold with the requested id.
+// Thresholds are deleted by the entity managers.
+func (env *Env) DeleteStockThresholdHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		ok  bool
+		t   models.StockThreshold
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if t, err = env.DB.GetStockThreshold(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the stock threshold",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if ok, err = env.isEntityManager(c.PersonID, t.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the entity managers",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	if err = env.DB.DeleteStockThreshold(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "delete stock threshold error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return nil
+}
+
+// GetStockThresholdAlertsHandler returns a json list of the stock thresholds
+// whose product stock is below the threshold, for the "entity" request parameter
+// or for all the entities of the logged user
+func (env *Env) GetStockThresholdAlertsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err      error
+		aerr     *models.AppError
+		entities []int
+		alerts   []models.StockThreshold
+	)
+
+	if entities, aerr = env.requestEntities(r); aerr != nil {
+		return aerr
+	}
+	if entities == nil {
+		// all the entities
+		entities = []int{-1}
+	}
+
+	alerts = []models.StockThreshold{}
+	for _, e := range entities {
+		var a []models.StockThreshold
+		if a, err = env.DB.GetStockThresholdAlerts(e); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the stock threshold alerts",
+				Code:    http.StatusInternalServerError}
+		}
+		alerts = append(alerts, a...)
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(alerts); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
@@ -3,13 +3,17 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/codes"
+	"github.com/tbellembois/gochimitheque/datastores"
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/static/jade"
@@ -48,8 +52,11 @@ func (env *Env) VCreateStorageHandler(w http.ResponseWriter, r *http.Request) *m
 func (env *Env) ToogleStorageBorrowingHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 
 	var (
-		err error
-		s   models.Storage
+		err       error
+		s         models.Storage
+		borrowed  bool
+		storage   models.Storage
+		conflicts []models.Reservation
 	)
 
 	if err = json.NewDecoder(r.Body).Decode(&s); err != nil {
@@ -64,6 +71,29 @@ func (env *Env) ToogleStorageBorrowingHandler(w http.ResponseWriter, r *http.Req
 	s.Borrowing.Person = &models.Person{}
 	s.Borrowing.Person.PersonID = c.PersonID
 
+	// reservations of other people than the borrower broken by a borrowing
+	if borrowed, err = env.DB.IsStorageBorrowed(int(s.StorageID.Int64)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the borrowing",
+		}
+	}
+	if !borrowed {
+		borrowerID := c.PersonID
+		if s.Borrowing.Borrower != nil && s.Borrowing.Borrower.PersonID != 0 {
+			borrowerID = s.Borrowing.Borrower.PersonID
+		}
+		if storage, err = env.DB.GetStorage(int(s.StorageID.Int64)); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusInternalServerError,
+				Message: "error getting the storage",
+			}
+		}
+		conflicts = env.getReservationConflicts(int(s.StorageID.Int64), borrowerID, sql.NullFloat64{})
+	}
+
 	// toggling the borrowing
 	err = env.DB.ToogleStorageBorrowing(s)
 
@@ -75,6 +105,8 @@ func (env *Env) ToogleStorageBorrowingHandler(w http.ResponseWriter, r *http.Req
 		}
 	}
 
+	env.warnReservationConflicts(w, storage, conflicts, c.PersonEmail)
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	if err = json.NewEncoder(w).Encode(s); err != nil {
@@ -303,15 +335,112 @@ func (env *Env) GetStorageHandler(w http.ResponseWriter, r *http.Request) *model
 	return nil
 }
 
+// GetStorageCodeHandler returns a PNG image of the code of the storage with the requested id.
+// The "format" parameter is qrcode (default), code128 or datamatrix
+// and the "size" parameter the image width in pixels.
+// The QR code contains the configured payload, the other formats the storage barecode.
+func (env *Env) GetStorageCodeHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id      int
+		size    int
+		err     error
+		content string
+		png     []byte
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	format := codes.FormatQRCode
+	if f, ok := r.URL.Query()["format"]; ok {
+		format = f[0]
+	}
+	if s, ok := r.URL.Query()["size"]; ok {
+		if size, err = strconv.Atoi(s[0]); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "size atoi conversion",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+
+	storage, err := env.DB.GetStorage(id)
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the storage",
+		}
+	}
+
+	if format == codes.FormatQRCode {
+		content = codes.StorageQRCodeContent(storage)
+	} else {
+		content = storage.StorageBarecode.String
+	}
+	if content == "" {
+		return &models.AppError{
+			Error:   errors.New("empty code"),
+			Code:    http.StatusNotFound,
+			Message: "empty code",
+		}
+	}
+
+	if png, err = codes.Encode(format, content, size); err != nil {
+		if err == codes.ErrUnknownFormat {
+			return &models.AppError{
+				Error:   err,
+				Code:    http.StatusBadRequest,
+				Message: err.Error(),
+			}
+		}
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error encoding the code",
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(png); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
 // UpdateStorageHandler updates the storage from the request form
 func (env *Env) UpdateStorageHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	vars := mux.Vars(r)
 	var (
-		id  int
-		err error
-		s   models.Storage
+		id     int
+		err    error
+		s      models.Storage
+		body   []byte
+		fields map[string]json.RawMessage
 	)
-	if err = json.NewDecoder(r.Body).Decode(&s); err != nil {
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "request body reading error",
+			Code:    http.StatusInternalServerError}
+	}
+	if err = json.Unmarshal(body, &s); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+	// fields of the request, to tell a missing field from a null one
+	if err = json.Unmarshal(body, &fields); err != nil {
 		return &models.AppError{
 			Error:   err,
 			Message: "JSON decoding error",
@@ -330,6 +459,14 @@ func (env *Env) UpdateStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 			Code:    http.StatusInternalServerError}
 	}
 	updateds, _ := env.DB.GetStorage(id)
+	moved := updateds.StoreLocationID != s.StoreLocationID
+
+	// reservations broken by a withdrawal
+	var conflicts []models.Reservation
+	if updateds.StorageQuantity.Valid && s.StorageQuantity.Valid && s.StorageQuantity.Float64 < updateds.StorageQuantity.Float64 {
+		conflicts = env.getReservationConflicts(id, c.PersonID, sql.NullFloat64{Valid: true, Float64: updateds.StorageQuantity.Float64 - s.StorageQuantity.Float64})
+	}
+
 	updateds.StorageModificationDate = time.Now()
 	updateds.StorageBarecode = s.StorageBarecode
 	updateds.StorageQuantity = s.StorageQuantity
@@ -348,15 +485,43 @@ func (env *Env) UpdateStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 	updateds.StorageNumberOfBag = s.StorageNumberOfBag
 	updateds.StorageNumberOfCarton = s.StorageNumberOfCarton
 	updateds.StorageNumberOfUnit = s.StorageNumberOfUnit
+	// the price and the currency are kept if missing from the request
+	// and cleared if null
+	if _, ok := fields["storage_price"]; ok {
+		updateds.StoragePrice = s.StoragePrice
+	}
+	if _, ok := fields["storage_currency"]; ok {
+		updateds.StorageCurrency = s.StorageCurrency
+	}
 	logger.Log.WithFields(logrus.Fields{"updateds": updateds}).Debug("UpdateStorageHandler")
 
+	if aerr := env.checkStoreLocationLimits(w, updateds, 1); aerr != nil {
+		return aerr
+	}
+	if moved {
+		if aerr := env.checkStorageClassIncompatibilities(w, updateds); aerr != nil {
+			return aerr
+		}
+		if aerr := env.checkStorageTemperature(w, updateds); aerr != nil {
+			return aerr
+		}
+	}
+
 	if err := env.DB.UpdateStorage(updateds); err != nil {
+		if err == datastores.ErrBarecodeAlreadyExists {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
 		return &models.AppError{
 			Error:   err,
 			Message: "update storage error",
 			Code:    http.StatusInternalServerError}
 	}
 
+	env.warnReservationConflicts(w, updateds, conflicts, c.PersonEmail)
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	if err = json.NewEncoder(w).Encode([]models.Storage{updateds}); err != nil {
@@ -473,13 +638,47 @@ func (env *Env) CreateStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 	logger.Log.WithFields(logrus.Fields{"s": fmt.Sprintf("%+v", s)}).Debug("CreateStorageHandler")
 	logger.Log.WithFields(logrus.Fields{"s.StorageNbItem": s.StorageNbItem}).Debug("CreateStorageHandler")
 
+	// prefilling with the scanned supplier GS1 code
+	var (
+		gs1       codes.GS1
+		gs1Mapped bool
+		aerr      *models.AppError
+	)
+	if s.StorageGS1 != "" {
+		if gs1, gs1Mapped, aerr = env.prefillStorageGS1(&s); aerr != nil {
+			return aerr
+		}
+	}
+	if s.ProductID == 0 {
+		return &models.AppError{
+			Error:   errors.New("no product"),
+			Message: "product required, the supplier code is not mapped to a product",
+			Code:    http.StatusBadRequest}
+	}
+
 	if s.StorageNbItem == 0 {
 		s.StorageNbItem = 1
 	}
 
+	if aerr = env.checkStoreLocationLimits(w, s, s.StorageNbItem); aerr != nil {
+		return aerr
+	}
+	if aerr = env.checkStorageClassIncompatibilities(w, s); aerr != nil {
+		return aerr
+	}
+	if aerr = env.checkStorageTemperature(w, s); aerr != nil {
+		return aerr
+	}
+
 	var result []models.Storage
 	for i := 1; i <= s.StorageNbItem; i++ {
 		if id, err = env.DB.CreateStorage(s, i); err != nil {
+			if err == datastores.ErrBarecodeAlreadyExists {
+				return &models.AppError{
+					Error:   err,
+					Message: err.Error(),
+					Code:    http.StatusBadRequest}
+			}
 			return &models.AppError{
 				Error:   err,
 				Message: "create storage error",
@@ -491,6 +690,13 @@ func (env *Env) CreateStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 	}
 	s.StorageID = sql.NullInt64{Valid: true, Int64: int64(id)}
 
+	// mapping the GTIN to the product on the first scan
+	if s.StorageGS1 != "" && !gs1Mapped {
+		if err = env.createStorageGTIN(s, gs1.GTIN); err != nil {
+			logger.Log.Error("error mapping the gtin - " + err.Error())
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.WriteHeader(http.StatusOK)
 	if err = json.NewEncoder(w).Encode(result); err != nil {
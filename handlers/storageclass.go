@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// checkStorageClassIncompatibilities checks the storage classes of the products
+// already stored in the store location of the storage s.
+// It returns an error for an incompatible class if the incompatible storages
+// are refused, otherwise it adds a Warning header for each incompatibility.
+func (env *Env) checkStorageClassIncompatibilities(w http.ResponseWriter, s models.Storage) *models.AppError {
+
+	var (
+		err       error
+		conflicts []models.StorageClassConflict
+		msgs      []string
+	)
+
+	if conflicts, err = env.DB.GetStorageClassIncompatibilities(s); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error checking the storage classes incompatibilities",
+			Code:    http.StatusInternalServerError}
+	}
+
+	for _, c := range conflicts {
+		msgs = append(msgs, fmt.Sprintf("%s incompatible with %s (%s) in %s",
+			c.StorageClass.StorageClassLabel,
+			c.ConflictingStorageClass.StorageClassLabel,
+			c.ConflictingProduct.NameLabel,
+			c.StoreLocation.StoreLocationFullPath))
+	}
+
+	if len(msgs) != 0 && env.RefuseIncompatibleStorages {
+		return &models.AppError{
+			Error:   errors.New("incompatible storage classes"),
+			Message: strings.Join(msgs, ", "),
+			Code:    http.StatusBadRequest}
+	}
+	for _, msg := range msgs {
+		w.Header().Add("Warning", fmt.Sprintf(`199 - "%s"`, msg))
+	}
+
+	return nil
+
+}
+
+/*
+	REST handlers
+*/
+
+// GetStorageClassesHandler returns a json list of the storage classes
+// with their incompatible classes
+func (env *Env) GetStorageClassesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err     error
+		classes []models.StorageClass
+	)
+
+	if classes, err = env.DB.GetStorageClasses(); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage classes",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(classes); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// UpdateStorageClassHandler replaces the incompatible classes of the storage class
+// with the requested id.
+// The incompatibility matrix is updated by the administrators.
+func (env *Env) UpdateStorageClassHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id      int
+		err     error
+		isadmin bool
+		c       models.StorageClass
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&c); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	container := models.ContainerFromRequestContext(r)
+
+	if isadmin, err = env.DB.IsPersonAdmin(container.PersonID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting admin status",
+			Code:    http.StatusInternalServerError}
+	}
+	if !isadmin {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"c": c}).Debug("UpdateStorageClassHandler")
+
+	ids := []int{}
+	for _, i := range c.Incompatibilities {
+		ids = append(ids, i.StorageClassID)
+	}
+	if err = env.DB.SetStorageClassIncompatibilities(id, ids); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "update storage class error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return env.GetStorageClassesHandler(w, r)
+}
+
+// GetProductStorageClassesHandler returns the storage classes of the product with the requested id
+func (env *Env) GetProductStorageClassesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		p   models.ProductStorageClasses
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if p, err = env.DB.GetProductStorageClasses(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the product storage classes",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(p); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// UpdateProductStorageClassesHandler sets the storage classes of the product with the requested id.
+// An empty list restores the classes derived from the product
+// hazard statements and classes of compounds.
+func (env *Env) UpdateProductStorageClassesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id  int
+		err error
+		p   models.ProductStorageClasses
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("UpdateProductStorageClassesHandler")
+
+	if err = env.DB.SetProductStorageClasses(id, p.StorageClasses); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "update product storage classes error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return env.GetProductStorageClassesHandler(w, r)
+}
+
+// GetStorageClassConflictsHandler returns a json list of the products stored
+// with products of incompatible storage classes, for the "entity" request parameter
+// or for all the entities of the logged user
+func (env *Env) GetStorageClassConflictsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err       error
+		aerr      *models.AppError
+		entities  []int
+		conflicts []models.StorageClassConflict
+	)
+
+	if entities, aerr = env.requestEntities(r); aerr != nil {
+		return aerr
+	}
+
+	if conflicts, err = env.DB.GetStorageClassConflicts(entities); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage class conflicts",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(conflicts); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
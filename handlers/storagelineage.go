@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+/*
+	REST handlers
+*/
+
+// SplitStorageHandler splits the storage with the requested id into aliquots
+// and returns a json list of the created aliquots
+func (env *Env) SplitStorageHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("SplitStorageHandler")
+	vars := mux.Vars(r)
+	var (
+		id       int
+		ids      []int
+		err      error
+		split    models.StorageSplit
+		aliquot  models.Storage
+		aliquots []models.Storage
+		source   models.Storage
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&split); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+	logger.Log.WithFields(logrus.Fields{"id": id, "split": split}).Debug("SplitStorageHandler")
+
+	// reservations broken by the split
+	if source, err = env.DB.GetStorage(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+	var withdrawn sql.NullFloat64
+	for _, q := range split.Quantities {
+		withdrawn.Float64 += q
+	}
+	withdrawn.Valid = true
+	conflicts := env.getReservationConflicts(id, c.PersonID, withdrawn)
+
+	// the store location limits are not checked: the aliquots stay
+	// in the storage store location and their quantity is withdrawn from it
+
+	if ids, err = env.DB.SplitStorage(id, split.Quantities, c.PersonID); err != nil {
+		if err == datastores.ErrStorageNotSplittable || err == datastores.ErrSplitQuantity || err == datastores.ErrBarecodeAlreadyExists {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "split storage error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	for _, i := range ids {
+		if aliquot, err = env.DB.GetStorage(i); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the storage",
+				Code:    http.StatusInternalServerError}
+		}
+		aliquots = append(aliquots, aliquot)
+	}
+
+	env.warnReservationConflicts(w, source, conflicts, c.PersonEmail)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(aliquots); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetStorageLineageHandler returns a json of the storage with the requested id
+// with the storages it has been split from and the storages split from it.
+// Storages the logged user can not read are removed.
+func (env *Env) GetStorageLineageHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id      int
+		err     error
+		lineage models.StorageLineage
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if lineage, err = env.DB.GetStorageLineage(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage lineage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if lineage.Ancestors, err = env.readableLineageNodes(r, lineage.Ancestors); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "enforcer error",
+			Code:    http.StatusInternalServerError}
+	}
+	if lineage.Descendants, err = env.readableLineageNodes(r, lineage.Descendants); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "enforcer error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(lineage); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// readableLineageNodes returns the nodes the logged user can read
+func (env *Env) readableLineageNodes(r *http.Request, nodes []models.StorageLineageNode) ([]models.StorageLineageNode, error) {
+
+	var (
+		ok       bool
+		err      error
+		readable = make([]models.StorageLineageNode, 0, len(nodes))
+	)
+
+	for _, n := range nodes {
+		if ok, err = env.enforce(r, "r", "storages", n.StorageID.Int64); err != nil {
+			return nil, err
+		}
+		if ok {
+			readable = append(readable, n)
+		}
+	}
+
+	return readable, nil
+
+}
@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/mailer"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// getStorageTransferFromRequest returns the storage transfer matching the request "id" variable
+func (env *Env) getStorageTransferFromRequest(r *http.Request) (models.StorageTransfer, *models.AppError) {
+	vars := mux.Vars(r)
+	var (
+		id       int
+		err      error
+		transfer models.StorageTransfer
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.StorageTransfer{}, &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if transfer, err = env.DB.GetStorageTransfer(id); err != nil {
+		return models.StorageTransfer{}, &models.AppError{
+			Error:   err,
+			Message: "error getting the storage transfer",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return transfer, nil
+}
+
+// notifyStorageTransfer mails the message "message" about the transfer t
+// to the managers of the entities and to the people, except the person "by".
+// Errors are only logged.
+func (env *Env) notifyStorageTransfer(t models.StorageTransfer, message string, by models.Person, entities []int, people []models.Person) {
+
+	var (
+		err      error
+		managers []models.Person
+	)
+
+	for _, e := range entities {
+		if managers, err = env.DB.GetEntityManager(e); err != nil {
+			logger.Log.Errorf("error getting the entity managers %s", err.Error())
+			continue
+		}
+		people = append(people, managers...)
+	}
+
+	msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "storagetransfer_" + message + "_mailbody", PluralCount: 1}),
+		t.Storage.StorageBarecode.String,
+		t.Storage.Product.Name.NameLabel,
+		t.SourceEntity.EntityName,
+		t.StoreLocation.StoreLocationFullPath,
+		t.EntityName,
+		by.PersonEmail,
+		env.ApplicationFullURL)
+	msgsubject := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "storagetransfer_" + message + "_mailsubject", PluralCount: 1})
+
+	sent := map[string]bool{by.PersonEmail: true}
+	for _, p := range people {
+		if sent[p.PersonEmail] {
+			continue
+		}
+		sent[p.PersonEmail] = true
+
+		if err = mailer.SendMail(p.PersonEmail, msgsubject, msgbody); err != nil {
+			logger.Log.Errorf("error sending email %s", err.Error())
+		}
+	}
+
+}
+
+// storageTransferAppError returns the AppError of the storage transfer datastore error err
+func storageTransferAppError(err error, message string) *models.AppError {
+	switch err {
+	case datastores.ErrStorageTransferPending,
+		datastores.ErrStorageTransferNotPending,
+		datastores.ErrStorageNotTransferable,
+		datastores.ErrBarecodeAlreadyExists:
+		return &models.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+	return &models.AppError{
+		Error:   err,
+		Message: message,
+		Code:    http.StatusInternalServerError}
+}
+
+/*
+	REST handlers
+*/
+
+// GetStorageTransfersHandler returns a json list of the storage transfers matching the search criteria
+func (env *Env) GetStorageTransfersHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetStorageTransfersHandler")
+
+	var (
+		err  error
+		aerr *models.AppError
+		dspt models.DbselectparamStorageTransfer
+	)
+
+	// init db request parameters
+	if dspt, aerr = models.NewdbselectparamStorageTransfer(r, nil); aerr != nil {
+		return aerr
+	}
+
+	transfers, count, err := env.DB.GetStorageTransfers(dspt)
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the storage transfers",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.StorageTransfer `json:"rows"`
+		Total int                      `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(resp{Rows: transfers, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetStorageTransferHandler returns a json of the storage transfer with the requested id
+func (env *Env) GetStorageTransferHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err      error
+		aerr     *models.AppError
+		transfer models.StorageTransfer
+	)
+
+	if transfer, aerr = env.getStorageTransferFromRequest(r); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(transfer); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreateStorageTransferHandler requests the transfer of a storage
+// to a store location of another entity.
+// The target entity managers are notified.
+func (env *Env) CreateStorageTransferHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateStorageTransferHandler")
+	var (
+		t      models.StorageTransfer
+		sl     models.StoreLocation
+		source models.Entity
+		err    error
+		ok     bool
+		id     int64
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&t); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	// the logged user must be able to modify the storage
+	if ok, err = env.enforce(r, "w", "storages", t.Storage.StorageID.Int64); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "enforcer error",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	// the target store location must be able to store
+	// and belong to another entity
+	if sl, err = env.DB.GetStoreLocation(int(t.StoreLocation.StoreLocationID.Int64)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location",
+			Code:    http.StatusInternalServerError}
+	}
+	if !sl.StoreLocationCanStore.Valid || !sl.StoreLocationCanStore.Bool {
+		return &models.AppError{
+			Error:   errors.New("store location can not store"),
+			Message: "store location can not store",
+			Code:    http.StatusBadRequest}
+	}
+	if source, err = env.DB.GetStorageEntity(int(t.Storage.StorageID.Int64)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage entity",
+			Code:    http.StatusInternalServerError}
+	}
+	if source.EntityID == sl.EntityID {
+		return &models.AppError{
+			Error:   errors.New("store location in the storage entity"),
+			Message: "store location in the storage entity",
+			Code:    http.StatusBadRequest}
+	}
+
+	t.PersonID = c.PersonID
+	logger.Log.WithFields(logrus.Fields{"t": t}).Debug("CreateStorageTransferHandler")
+
+	if id, err = env.DB.CreateStorageTransfer(t); err != nil {
+		return storageTransferAppError(err, "create storage transfer error")
+	}
+
+	if t, err = env.DB.GetStorageTransfer(int(id)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage transfer",
+			Code:    http.StatusInternalServerError}
+	}
+
+	env.notifyStorageTransfer(t, "request", t.Person, []int{t.EntityID}, nil)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(t); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// decideStorageTransferHandler accepts, refuses or cancels the storage transfer
+// with the requested id according to the status.
+// Transfers are accepted or refused by the target entity managers
+// and cancelled by the people allowed to modify the storage.
+// Both entities are notified.
+func (env *Env) decideStorageTransferHandler(w http.ResponseWriter, r *http.Request, status string) *models.AppError {
+	var (
+		err      error
+		aerr     *models.AppError
+		ok       bool
+		transfer models.StorageTransfer
+	)
+
+	if transfer, aerr = env.getStorageTransferFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if !transfer.IsPending() {
+		return storageTransferAppError(datastores.ErrStorageTransferNotPending, "")
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if status == models.StorageTransferCancelled {
+		ok, err = env.enforce(r, "w", "storages", transfer.Storage.StorageID.Int64)
+	} else {
+		ok, err = env.isEntityManager(c.PersonID, transfer.EntityID)
+	}
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error checking the permissions",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	// the storage is moved into the target store location
+	if status == models.StorageTransferAccepted {
+		var s models.Storage
+		if s, err = env.DB.GetStorage(int(transfer.Storage.StorageID.Int64)); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the storage",
+				Code:    http.StatusInternalServerError}
+		}
+		s.StoreLocation = transfer.StoreLocation
+		if aerr = env.checkStoreLocationLimits(w, s, 1); aerr != nil {
+			return aerr
+		}
+		if aerr = env.checkStorageClassIncompatibilities(w, s); aerr != nil {
+			return aerr
+		}
+		if aerr = env.checkStorageTemperature(w, s); aerr != nil {
+			return aerr
+		}
+	}
+
+	switch status {
+	case models.StorageTransferAccepted:
+		err = env.DB.AcceptStorageTransfer(transfer.StorageTransferID, c.PersonID)
+	case models.StorageTransferRefused:
+		err = env.DB.RefuseStorageTransfer(transfer.StorageTransferID, c.PersonID)
+	case models.StorageTransferCancelled:
+		err = env.DB.CancelStorageTransfer(transfer.StorageTransferID, c.PersonID)
+	}
+	if err != nil {
+		return storageTransferAppError(err, "storage transfer error")
+	}
+
+	if transfer, err = env.DB.GetStorageTransfer(transfer.StorageTransferID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage transfer",
+			Code:    http.StatusInternalServerError}
+	}
+	logger.Log.WithFields(logrus.Fields{"transfer": transfer}).Debug("decideStorageTransferHandler")
+
+	env.notifyStorageTransfer(transfer, status, models.Person{PersonID: c.PersonID, PersonEmail: c.PersonEmail},
+		[]int{transfer.SourceEntity.EntityID, transfer.EntityID}, []models.Person{transfer.Person})
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(transfer); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// AcceptStorageTransferHandler accepts the storage transfer with the requested id
+// and moves the storage into the target store location
+func (env *Env) AcceptStorageTransferHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	return env.decideStorageTransferHandler(w, r, models.StorageTransferAccepted)
+}
+
+// RefuseStorageTransferHandler refuses the storage transfer with the requested id
+func (env *Env) RefuseStorageTransferHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	return env.decideStorageTransferHandler(w, r, models.StorageTransferRefused)
+}
+
+// CancelStorageTransferHandler cancels the storage transfer with the requested id
+func (env *Env) CancelStorageTransferHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	return env.decideStorageTransferHandler(w, r, models.StorageTransferCancelled)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+/*
+	REST handlers
+*/
+
+// GetStorageVersionsHandler returns a json list of the versions of the storage with the requested id
+// with the fields modified by each version
+func (env *Env) GetStorageVersionsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id       int
+		err      error
+		versions []models.StorageVersion
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if versions, err = env.DB.GetStorageVersions(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage versions",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(versions); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// RestoreStorageVersionHandler restores the storage with the requested id
+// to the requested version and returns it as json
+func (env *Env) RestoreStorageVersionHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id        int
+		versionID int
+		err       error
+		storage   models.Storage
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+	if versionID, err = strconv.Atoi(vars["version"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "version atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+	logger.Log.WithFields(logrus.Fields{"id": id, "versionID": versionID}).Debug("RestoreStorageVersionHandler")
+
+	// the storage as restored
+	if storage, err = env.DB.GetStorage(versionID); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				Error:   datastores.ErrStorageVersion,
+				Message: datastores.ErrStorageVersion.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage version",
+			Code:    http.StatusInternalServerError}
+	}
+	storage.StorageID = sql.NullInt64{Valid: true, Int64: int64(id)}
+	if aerr := env.checkStoreLocationLimits(w, storage, 1); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.RestoreStorageVersion(id, versionID, c.PersonID); err != nil {
+		if err == datastores.ErrStorageVersion || err == datastores.ErrBarecodeAlreadyExists {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "restore storage version error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if storage, err = env.DB.GetStorage(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(storage); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
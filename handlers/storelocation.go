@@ -8,6 +8,8 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/codes"
+	"github.com/tbellembois/gochimitheque/datastores"
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/static/jade"
@@ -117,6 +119,50 @@ func (env *Env) GetStoreLocationHandler(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
+// validateStoreLocationLevel checks the level of the store location sl
+// against the levels of its parent and of the children of the store location with id "id", if not 0.
+func (env *Env) validateStoreLocationLevel(sl models.StoreLocation, id int) *models.AppError {
+
+	var (
+		err      error
+		parent   *models.StoreLocation
+		children []models.StoreLocation
+	)
+
+	if !sl.StoreLocationLevel.Valid || sl.StoreLocationLevel.String == "" {
+		return nil
+	}
+
+	if sl.StoreLocation != nil && sl.StoreLocation.StoreLocationID.Valid {
+		var p models.StoreLocation
+		if p, err = env.DB.GetStoreLocation(int(sl.StoreLocation.StoreLocationID.Int64)); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the parent store location",
+				Code:    http.StatusInternalServerError}
+		}
+		parent = &p
+	}
+	if id != 0 {
+		if children, err = env.DB.GetStoreLocationChildren(id); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: "error getting the store location children",
+				Code:    http.StatusInternalServerError}
+		}
+	}
+
+	if err = models.ValidateStoreLocationLevel(sl, parent, children); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+
+	return nil
+
+}
+
 // CreateStoreLocationHandler creates the store location from the request form
 func (env *Env) CreateStoreLocationHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	logger.Log.Debug("CreateStoreLocationHandler")
@@ -135,6 +181,24 @@ func (env *Env) CreateStoreLocationHandler(w http.ResponseWriter, r *http.Reques
 
 	logger.Log.WithFields(logrus.Fields{"sl": sl}).Debug("CreateStoreLocationHandler")
 
+	if sl.StoreLocationBarecodePrefix.Valid && sl.StoreLocationBarecodePrefix.String != "" {
+		if err = codes.ValidateBarecodePrefix(sl.StoreLocationBarecodePrefix.String); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+	}
+	if err = models.ValidateStoreLocationTemperature(sl); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+	if aerr := env.validateStoreLocationLevel(sl, 0); aerr != nil {
+		return aerr
+	}
+
 	if id, err = env.DB.CreateStoreLocation(sl); err != nil {
 		return &models.AppError{
 			Error:   err,
@@ -199,6 +263,21 @@ func (env *Env) UpdateStoreLocationHandler(w http.ResponseWriter, r *http.Reques
 	// }
 	logger.Log.WithFields(logrus.Fields{"sl": sl}).Debug("UpdateStoreLocationHandler")
 
+	if sl.StoreLocationBarecodePrefix.Valid && sl.StoreLocationBarecodePrefix.String != "" {
+		if err = codes.ValidateBarecodePrefix(sl.StoreLocationBarecodePrefix.String); err != nil {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+	}
+	if err = models.ValidateStoreLocationTemperature(sl); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: err.Error(),
+			Code:    http.StatusBadRequest}
+	}
+
 	if id, err = strconv.Atoi(vars["id"]); err != nil {
 		return &models.AppError{
 			Error:   err,
@@ -216,11 +295,28 @@ func (env *Env) UpdateStoreLocationHandler(w http.ResponseWriter, r *http.Reques
 	updatedsl.StoreLocationName = sl.StoreLocationName
 	updatedsl.StoreLocationColor = sl.StoreLocationColor
 	updatedsl.StoreLocationCanStore = sl.StoreLocationCanStore
+	updatedsl.StoreLocationBarecodePrefix = sl.StoreLocationBarecodePrefix
+	updatedsl.StoreLocationType = sl.StoreLocationType
+	updatedsl.StoreLocationMinTemperature = sl.StoreLocationMinTemperature
+	updatedsl.StoreLocationMaxTemperature = sl.StoreLocationMaxTemperature
+	updatedsl.StoreLocationLevel = sl.StoreLocationLevel
+	updatedsl.StoreLocationRoomNumber = sl.StoreLocationRoomNumber
+	updatedsl.StoreLocationResponsible = sl.StoreLocationResponsible
 	updatedsl.StoreLocation = sl.StoreLocation
 	updatedsl.Entity = sl.Entity
 	logger.Log.WithFields(logrus.Fields{"updatedsl": updatedsl}).Debug("UpdateStoreLocationHandler")
 
+	if aerr := env.validateStoreLocationLevel(updatedsl, id); aerr != nil {
+		return aerr
+	}
+
 	if err := env.DB.UpdateStoreLocation(updatedsl); err != nil {
+		if err == datastores.ErrStoreLocationCycle {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
 		return &models.AppError{
 			Error:   err,
 			Message: "update store location error",
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+/*
+	REST handlers
+*/
+
+// GetStoreLocationRollupsHandler returns a json list of the stock and hazards of the store locations
+// of the "level" request parameter including their children, or of all the levels,
+// for the "entity" request parameter or for all the entities of the logged user
+func (env *Env) GetStoreLocationRollupsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err      error
+		aerr     *models.AppError
+		entities []int
+		rollups  []models.StoreLocationRollup
+	)
+
+	level := r.URL.Query().Get("level")
+	if level != "" {
+		if _, ok := models.StoreLocationLevelDepth(level); !ok {
+			return &models.AppError{
+				Error:   errors.New("unknown store location level " + level),
+				Message: "unknown store location level " + level,
+				Code:    http.StatusBadRequest}
+		}
+	}
+
+	if entities, aerr = env.requestEntities(r); aerr != nil {
+		return aerr
+	}
+
+	if rollups, err = env.DB.GetStoreLocationRollups(entities, level); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location rollups",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(rollups); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
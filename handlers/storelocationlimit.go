@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// checkStoreLocationLimits checks the limits of the store location of the storage s
+// before storing "count" storages s.
+// It returns an error if a hard limit would be exceeded,
+// and adds a Warning header for each other exceeded limit.
+func (env *Env) checkStoreLocationLimits(w http.ResponseWriter, s models.Storage, count int) *models.AppError {
+
+	exceeded, err := env.DB.CheckStoreLocationLimits(s, count)
+
+	return storeLocationLimitsError(w, exceeded, err)
+
+}
+
+// checkStoreLocationBatchLimits checks the limits of the store location of the storages ss,
+// all stored in the same store location, before storing them together.
+// It returns an error if a hard limit would be exceeded,
+// and adds a Warning header for each other exceeded limit.
+func (env *Env) checkStoreLocationBatchLimits(w http.ResponseWriter, ss []models.Storage) *models.AppError {
+
+	exceeded, err := env.DB.CheckStoreLocationBatchLimits(ss)
+
+	return storeLocationLimitsError(w, exceeded, err)
+
+}
+
+// storeLocationLimitsError returns an error for the hard limits of the "exceeded" ones
+// or for err, and adds a Warning header for each other exceeded limit.
+func storeLocationLimitsError(w http.ResponseWriter, exceeded []models.StoreLocationLimitStatus, err error) *models.AppError {
+
+	var hard []string
+
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error checking the store location limits",
+			Code:    http.StatusInternalServerError}
+	}
+
+	for _, e := range exceeded {
+		msg := fmt.Sprintf("%s limit exceeded in %s: %s / %s %s",
+			e.Limit.StoreLocationLimitLabel,
+			e.Limit.StoreLocationFullPath,
+			strconv.FormatFloat(e.Stock, 'f', -1, 64),
+			strconv.FormatFloat(e.Limit.StoreLocationLimitQuantity, 'f', -1, 64),
+			e.Limit.Unit.UnitLabel.String)
+		if e.Limit.StoreLocationLimitHard {
+			hard = append(hard, msg)
+			continue
+		}
+		w.Header().Add("Warning", fmt.Sprintf(`199 - "%s"`, msg))
+	}
+
+	if len(hard) != 0 {
+		return &models.AppError{
+			Error:   errors.New("store location limit exceeded"),
+			Message: strings.Join(hard, ", "),
+			Code:    http.StatusBadRequest}
+	}
+
+	return nil
+
+}
+
+// storeLocationManager returns an error if the logged person
+// is not a manager of the entity of the store location with id "id".
+func (env *Env) storeLocationManager(personID int, id int) *models.AppError {
+
+	var (
+		err error
+		ok  bool
+		sl  models.StoreLocation
+	)
+
+	if sl, err = env.DB.GetStoreLocation(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location",
+			Code:    http.StatusInternalServerError}
+	}
+	if ok, err = env.isEntityManager(personID, sl.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the entity managers",
+			Code:    http.StatusInternalServerError}
+	}
+	if !ok {
+		return &models.AppError{
+			Error:   errors.New("unauthorized"),
+			Message: "unauthorized",
+			Code:    http.StatusForbidden}
+	}
+
+	return nil
+
+}
+
+/*
+	REST handlers
+*/
+
+// GetStoreLocationLimitsHandler returns a json list of the store location limits
+// with their current stock, for the "entity" request parameter
+// or for all the entities of the logged user.
+// Only the exceeded limits are returned if the "exceeded" request parameter is true.
+func (env *Env) GetStoreLocationLimitsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err      error
+		aerr     *models.AppError
+		entities []int
+		statuses []models.StoreLocationLimitStatus
+	)
+
+	q := r.URL.Query()
+
+	if entities, aerr = env.requestEntities(r); aerr != nil {
+		return aerr
+	}
+
+	if statuses, err = env.DB.GetStoreLocationLimitStatuses(entities); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location limits",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if e, found := q["exceeded"]; found && e[0] == "true" {
+		exceeded := []models.StoreLocationLimitStatus{}
+		for _, s := range statuses {
+			if s.Exceeded {
+				exceeded = append(exceeded, s)
+			}
+		}
+		statuses = exceeded
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(statuses); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreateStoreLocationLimitHandler creates a store location limit.
+// Limits are set by the managers of the store location entity.
+func (env *Env) CreateStoreLocationLimitHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateStoreLocationLimitHandler")
+	var (
+		l    models.StoreLocationLimit
+		err  error
+		aerr *models.AppError
+		id   int64
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&l); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if !l.StoreLocationID.Valid || !l.Unit.UnitID.Valid || l.StoreLocationLimitLabel == "" {
+		return &models.AppError{
+			Error:   errors.New("missing store location limit label, store location or unit"),
+			Message: "missing store location limit label, store location or unit",
+			Code:    http.StatusBadRequest}
+	}
+	if l.StoreLocationLimitQuantity <= 0 {
+		return &models.AppError{
+			Error:   errors.New("invalid store location limit quantity"),
+			Message: "invalid store location limit quantity",
+			Code:    http.StatusBadRequest}
+	}
+	if aerr = env.storeLocationManager(c.PersonID, int(l.StoreLocationID.Int64)); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"l": l}).Debug("CreateStoreLocationLimitHandler")
+
+	if id, err = env.DB.CreateStoreLocationLimit(l); err != nil {
+		if err == datastores.ErrStoreLocationLimitUnit || err == datastores.ErrStoreLocationLimitCriteria {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "create store location limit error",
+			Code:    http.StatusInternalServerError}
+	}
+	if l, err = env.DB.GetStoreLocationLimit(int(id)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location limit",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(l); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// UpdateStoreLocationLimitHandler updates the store location limit with the requested id.
+// Limits are updated by the managers of the store location entity.
+func (env *Env) UpdateStoreLocationLimitHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id      int
+		err     error
+		aerr    *models.AppError
+		l       models.StoreLocationLimit
+		updated models.StoreLocationLimit
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&l); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if updated, err = env.DB.GetStoreLocationLimit(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location limit",
+			Code:    http.StatusInternalServerError}
+	}
+	if aerr = env.storeLocationManager(c.PersonID, int(updated.StoreLocationID.Int64)); aerr != nil {
+		return aerr
+	}
+
+	if !l.Unit.UnitID.Valid || l.StoreLocationLimitLabel == "" {
+		return &models.AppError{
+			Error:   errors.New("missing store location limit label or unit"),
+			Message: "missing store location limit label or unit",
+			Code:    http.StatusBadRequest}
+	}
+	if l.StoreLocationLimitQuantity <= 0 {
+		return &models.AppError{
+			Error:   errors.New("invalid store location limit quantity"),
+			Message: "invalid store location limit quantity",
+			Code:    http.StatusBadRequest}
+	}
+
+	updated.StoreLocationLimitLabel = l.StoreLocationLimitLabel
+	updated.StoreLocationLimitQuantity = l.StoreLocationLimitQuantity
+	updated.StoreLocationLimitHard = l.StoreLocationLimitHard
+	updated.Unit = l.Unit
+	updated.PhysicalState = l.PhysicalState
+	updated.HazardStatements = l.HazardStatements
+	updated.Symbols = l.Symbols
+	logger.Log.WithFields(logrus.Fields{"updated": updated}).Debug("UpdateStoreLocationLimitHandler")
+
+	if err = env.DB.UpdateStoreLocationLimit(updated); err != nil {
+		if err == datastores.ErrStoreLocationLimitUnit || err == datastores.ErrStoreLocationLimitCriteria {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "update store location limit error",
+			Code:    http.StatusInternalServerError}
+	}
+	if updated, err = env.DB.GetStoreLocationLimit(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location limit",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(updated); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// DeleteStoreLocationLimitHandler deletes the store location limit with the requested id.
+// Limits are deleted by the managers of the store location entity.
+func (env *Env) DeleteStoreLocationLimitHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+	var (
+		id   int
+		err  error
+		aerr *models.AppError
+		l    models.StoreLocationLimit
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	if l, err = env.DB.GetStoreLocationLimit(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the store location limit",
+			Code:    http.StatusInternalServerError}
+	}
+	if aerr = env.storeLocationManager(c.PersonID, int(l.StoreLocationID.Int64)); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.DeleteStoreLocationLimit(id); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "delete store location limit error",
+			Code:    http.StatusInternalServerError}
+	}
+	return nil
+}
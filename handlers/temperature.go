@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// checkStorageTemperature checks the product temperature of the storage s
+// against the temperature range of its store location
+// and adds a Warning header if it is out of range.
+func (env *Env) checkStorageTemperature(w http.ResponseWriter, s models.Storage) *models.AppError {
+
+	var (
+		err    error
+		p      models.Product
+		sl     models.StoreLocation
+		reason string
+	)
+
+	if sl, err = env.DB.GetStoreLocation(int(s.StoreLocationID.Int64)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage store location",
+			Code:    http.StatusInternalServerError}
+	}
+	if !sl.StoreLocationMinTemperature.Valid && !sl.StoreLocationMaxTemperature.Valid {
+		return nil
+	}
+	if p, err = env.DB.GetProduct(s.ProductID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the storage product",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if _, reason = sl.TemperatureMismatch(p); reason != "" {
+		w.Header().Add("Warning", fmt.Sprintf(`199 - "%s"`, reason))
+	}
+
+	return nil
+
+}
+
+/*
+	REST handlers
+*/
+
+// GetTemperatureMismatchesHandler returns a json list of the storages whose product temperature
+// is out of their store location temperature range, for the "entity" request parameter
+// or for all the entities of the logged user
+func (env *Env) GetTemperatureMismatchesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err        error
+		aerr       *models.AppError
+		entities   []int
+		mismatches []models.TemperatureMismatch
+	)
+
+	if entities, aerr = env.requestEntities(r); aerr != nil {
+		return aerr
+	}
+
+	if mismatches, err = env.DB.GetTemperatureMismatches(entities); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the temperature mismatches",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(mismatches); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
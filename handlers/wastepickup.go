@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/waste"
+)
+
+// getWastePickupFromRequest returns the waste pickup request matching the request "id" variable
+func (env *Env) getWastePickupFromRequest(r *http.Request) (models.WastePickup, *models.AppError) {
+	vars := mux.Vars(r)
+	var (
+		id          int
+		err         error
+		wastepickup models.WastePickup
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return models.WastePickup{}, &models.AppError{
+			Error:   err,
+			Message: "id atoi conversion",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if wastepickup, err = env.DB.GetWastePickup(id); err != nil {
+		return models.WastePickup{}, &models.AppError{
+			Error:   err,
+			Message: "error getting the waste pickup",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return wastepickup, nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetWastePickupsHandler returns a json list of the waste pickup requests matching the search criteria
+func (env *Env) GetWastePickupsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetWastePickupsHandler")
+
+	var (
+		err  error
+		aerr *models.AppError
+		dspw models.DbselectparamWastePickup
+	)
+
+	// init db request parameters
+	if dspw, aerr = models.NewdbselectparamWastePickup(r, nil); aerr != nil {
+		return aerr
+	}
+
+	wastepickups, count, err := env.DB.GetWastePickups(dspw)
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error getting the waste pickups",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.WastePickup `json:"rows"`
+		Total int                  `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(resp{Rows: wastepickups, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// GetWastePickupHandler returns a json of the waste pickup request with the requested id
+// and its disposal records
+func (env *Env) GetWastePickupHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err         error
+		aerr        *models.AppError
+		wastepickup models.WastePickup
+	)
+
+	if wastepickup, aerr = env.getWastePickupFromRequest(r); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(wastepickup); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreateWastePickupHandler creates a waste pickup request
+// with the storages to destroy of the requested entity
+func (env *Env) CreateWastePickupHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateWastePickupHandler")
+	var (
+		wp      models.WastePickup
+		err     error
+		id      int64
+		belongs bool
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&wp); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	// retrieving the logged user id from request context
+	c := models.ContainerFromRequestContext(r)
+
+	// the logged user must be a member of the waste pickup entity
+	if belongs, err = env.isEntityMember(c.PersonID, wp.EntityID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting person entities",
+			Code:    http.StatusInternalServerError}
+	}
+	if !belongs {
+		return &models.AppError{
+			Error:   errors.New("person does not belong to the entity"),
+			Message: "person does not belong to the entity",
+			Code:    http.StatusForbidden}
+	}
+
+	wp.PersonID = c.PersonID
+	logger.Log.WithFields(logrus.Fields{"wp": wp}).Debug("CreateWastePickupHandler")
+
+	if id, err = env.DB.CreateWastePickup(wp); err != nil {
+		if err == datastores.ErrNoWasteStorage {
+			return &models.AppError{
+				Error:   err,
+				Message: err.Error(),
+				Code:    http.StatusBadRequest}
+		}
+		return &models.AppError{
+			Error:   err,
+			Message: "create waste pickup error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if wp, err = env.DB.GetWastePickup(int(id)); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the waste pickup",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(wp); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// UpdateWastePickupHandler records the pickup date and contractor
+// of the waste pickup request with the requested id
+func (env *Env) UpdateWastePickupHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err         error
+		aerr        *models.AppError
+		wp          models.WastePickup
+		wastepickup models.WastePickup
+	)
+
+	if wastepickup, aerr = env.getWastePickupFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if wastepickup.IsCompleted() {
+		return &models.AppError{
+			Error:   errors.New("waste pickup completed"),
+			Message: "waste pickup completed",
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&wp); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "JSON decoding error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	wastepickup.WastePickupDate = wp.WastePickupDate
+	wastepickup.WastePickupContractor = wp.WastePickupContractor
+	if wastepickup.WastePickupContractor.String == "" {
+		wastepickup.WastePickupContractor.Valid = false
+	}
+	logger.Log.WithFields(logrus.Fields{"wastepickup": wastepickup}).Debug("UpdateWastePickupHandler")
+
+	if err = env.DB.UpdateWastePickup(wastepickup); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "update waste pickup error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(wastepickup); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CompleteWastePickupHandler completes the waste pickup request with the requested id
+// and archives its storages
+func (env *Env) CompleteWastePickupHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err         error
+		aerr        *models.AppError
+		wastepickup models.WastePickup
+	)
+
+	if wastepickup, aerr = env.getWastePickupFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if wastepickup.IsCompleted() {
+		return &models.AppError{
+			Error:   errors.New("waste pickup already completed"),
+			Message: "waste pickup already completed",
+			Code:    http.StatusBadRequest}
+	}
+	// the pickup must be recorded first
+	if !wastepickup.WastePickupDate.Valid || !wastepickup.WastePickupContractor.Valid {
+		return &models.AppError{
+			Error:   errors.New("pickup date and contractor required"),
+			Message: "pickup date and contractor required",
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = env.DB.CompleteWastePickup(wastepickup.WastePickupID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "complete waste pickup error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	if wastepickup, err = env.DB.GetWastePickup(wastepickup.WastePickupID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "error getting the waste pickup",
+			Code:    http.StatusInternalServerError}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(wastepickup); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// DeleteWastePickupHandler deletes the waste pickup request with the requested id.
+// Completed requests are kept for regulatory retention.
+func (env *Env) DeleteWastePickupHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err         error
+		aerr        *models.AppError
+		wastepickup models.WastePickup
+	)
+
+	if wastepickup, aerr = env.getWastePickupFromRequest(r); aerr != nil {
+		return aerr
+	}
+	if wastepickup.IsCompleted() {
+		return &models.AppError{
+			Error:   errors.New("waste pickup completed"),
+			Message: "waste pickup completed",
+			Code:    http.StatusBadRequest}
+	}
+
+	if err = env.DB.DeleteWastePickup(wastepickup.WastePickupID); err != nil {
+		return &models.AppError{
+			Error:   err,
+			Message: "delete waste pickup error",
+			Code:    http.StatusInternalServerError}
+	}
+
+	return nil
+}
+
+// GetWastePickupManifestHandler returns the waste manifest
+// of the waste pickup request with the requested id.
+// The "format" request parameter is pdf (default), csv or json.
+func (env *Env) GetWastePickupManifestHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err         error
+		aerr        *models.AppError
+		wastepickup models.WastePickup
+		buf         bytes.Buffer
+	)
+
+	if wastepickup, aerr = env.getWastePickupFromRequest(r); aerr != nil {
+		return aerr
+	}
+	manifest := wastepickup.Manifest()
+
+	format := "pdf"
+	if f, ok := r.URL.Query()["format"]; ok {
+		format = f[0]
+	}
+	filename := fmt.Sprintf("chimitheque-waste-manifest-%d.%s", wastepickup.WastePickupID, format)
+
+	switch format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.WriteHeader(http.StatusOK)
+		if err = json.NewEncoder(w).Encode(manifest); err != nil {
+			return &models.AppError{
+				Code:    http.StatusInternalServerError,
+				Message: err.Error(),
+			}
+		}
+		return nil
+	case "csv":
+		err = waste.WriteCSV(&buf, manifest)
+		w.Header().Set("Content-Type", "text/csv")
+	case "pdf":
+		err = waste.WritePDF(&buf, manifest)
+		w.Header().Set("Content-Type", "application/pdf")
+	default:
+		return &models.AppError{
+			Error:   errors.New("unknown format"),
+			Message: "unknown format " + format,
+			Code:    http.StatusBadRequest}
+	}
+	if err != nil {
+		return &models.AppError{
+			Error:   err,
+			Code:    http.StatusInternalServerError,
+			Message: "error generating the waste manifest",
+		}
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.WriteHeader(http.StatusOK)
+	if _, err = buf.WriteTo(w); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
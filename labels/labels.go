@@ -0,0 +1,219 @@
+package labels
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/tbellembois/gochimitheque/codes"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// padding is the inner margin of a label in millimeters
+const padding = 1.5
+
+// Pictogram is a GHS pictogram printed on a label
+type Pictogram struct {
+	Label string
+	Image []byte // PNG
+}
+
+// Label is the printable content of a storage label
+type Label struct {
+	QRCode        []byte // PNG
+	Barecode      string
+	ProductName   string
+	CasNumber     string
+	StoreLocation string
+	Pictograms    []Pictogram
+}
+
+// NewLabel returns the label of the storage s
+// with the pictograms of the symbols
+func NewLabel(s models.Storage, symbols []models.Symbol) (Label, error) {
+
+	var (
+		err error
+		l   Label
+	)
+
+	l.Barecode = s.StorageBarecode.String
+	l.ProductName = s.Product.Name.NameLabel
+	if s.Product.ProductSpecificity.Valid && s.Product.ProductSpecificity.String != "" {
+		l.ProductName += " - " + s.Product.ProductSpecificity.String
+	}
+	l.CasNumber = s.Product.CasNumber.CasNumberLabel.String
+	l.StoreLocation = s.StoreLocation.StoreLocationFullPath
+
+	l.QRCode = s.StorageQRCode
+	if len(l.QRCode) == 0 {
+		if l.QRCode, err = codes.StorageQRCode(s); err != nil {
+			return Label{}, err
+		}
+	}
+
+	for _, sym := range symbols {
+		// images are stored as "image/png;base64,..."
+		var img []byte
+		if img, err = base64.StdEncoding.DecodeString(sym.SymbolImage[strings.Index(sym.SymbolImage, ",")+1:]); err != nil {
+			return Label{}, fmt.Errorf("symbol %s: %w", sym.SymbolLabel, err)
+		}
+		l.Pictograms = append(l.Pictograms, Pictogram{Label: sym.SymbolLabel, Image: img})
+	}
+
+	return l, nil
+
+}
+
+// Generate writes into w the PDF of the labels ls with the template t.
+// skip is the number of labels already used on the first sheet.
+func Generate(w io.Writer, t Template, ls []Label, skip int) error {
+
+	pdf := gofpdf.NewCustom(&gofpdf.InitType{
+		UnitStr: "mm",
+		Size:    gofpdf.SizeType{Wd: t.PageWidth, Ht: t.PageHeight},
+	})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCellMargin(0)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	if skip < 0 || skip >= t.PerPage() {
+		skip = 0
+	}
+
+	for i, l := range ls {
+
+		pos := (i + skip) % t.PerPage()
+		if i == 0 || pos == 0 {
+			pdf.AddPage()
+		}
+
+		x := t.MarginLeft + float64(pos%t.Columns)*t.PitchX
+		y := t.MarginTop + float64(pos/t.Columns)*t.PitchY
+
+		drawLabel(pdf, tr, t, l, strconv.Itoa(i), x, y)
+
+		if pdf.Err() {
+			return pdf.Error()
+		}
+
+	}
+
+	return pdf.Output(w)
+
+}
+
+// drawLabel draws the label l at the x, y position
+func drawLabel(pdf *gofpdf.Fpdf, tr func(string) string, t Template, l Label, id string, x, y float64) {
+
+	var (
+		// QR code on the left
+		qrSize = math.Min(t.LabelHeight-2*padding, t.LabelWidth/3)
+		// text on the right
+		textX     = x + padding + qrSize + padding
+		textWidth = t.LabelWidth - 3*padding - qrSize
+		// font size in points and line height in millimeters
+		fontSize   = math.Max(5, math.Min(9, t.LabelHeight*0.22))
+		lineHeight = fontSize * 0.3528 * 1.2
+	)
+
+	imgOptions := gofpdf.ImageOptions{ImageType: "PNG"}
+
+	qrName := "qrcode-" + id
+	pdf.RegisterImageOptionsReader(qrName, imgOptions, bytes.NewReader(l.QRCode))
+	pdf.ImageOptions(qrName, x+padding, y+(t.LabelHeight-qrSize)/2, qrSize, qrSize, false, imgOptions, 0, "")
+
+	ty := y + padding
+
+	// product name, 2 lines max
+	pdf.SetFont("Helvetica", "B", fontSize)
+	for _, line := range wrap(pdf, tr(l.ProductName), textWidth, 2) {
+		pdf.SetXY(textX, ty)
+		pdf.CellFormat(textWidth, lineHeight, line, "", 0, "L", false, 0, "")
+		ty += lineHeight
+	}
+
+	pdf.SetFont("Helvetica", "", fontSize)
+	for _, text := range []string{l.CasNumber, l.Barecode, l.StoreLocation} {
+		if text == "" {
+			continue
+		}
+		pdf.SetXY(textX, ty)
+		pdf.CellFormat(textWidth, lineHeight, strings.Join(wrap(pdf, tr(text), textWidth, 1), ""), "", 0, "L", false, 0, "")
+		ty += lineHeight
+	}
+
+	// pictograms in the remaining space
+	pictoSize := math.Min(y+t.LabelHeight-padding-ty, 12)
+	if pictoSize < 4 {
+		return
+	}
+	px := textX
+	for _, p := range l.Pictograms {
+		if px+pictoSize > textX+textWidth {
+			break
+		}
+		pictoName := "symbol-" + p.Label
+		pdf.RegisterImageOptionsReader(pictoName, imgOptions, bytes.NewReader(p.Image))
+		pdf.ImageOptions(pictoName, px, y+t.LabelHeight-padding-pictoSize, pictoSize, pictoSize, false, imgOptions, 0, "")
+		px += pictoSize
+	}
+
+}
+
+// wrap splits the (already translated) text into at most maxLines
+// lines fitting in width with the current font, cutting the last line if needed
+func wrap(pdf *gofpdf.Fpdf, text string, width float64, maxLines int) []string {
+
+	var (
+		lines []string
+		line  string
+	)
+
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if pdf.GetStringWidth(candidate) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = word
+		// word longer than the line
+		for pdf.GetStringWidth(line) > width && len(lines) < maxLines {
+			n := len(line) - 1
+			for n > 1 && pdf.GetStringWidth(line[:n]) > width {
+				n--
+			}
+			lines = append(lines, line[:n])
+			line = line[n:]
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+	}
+	if len(lines) > 0 {
+		last := lines[len(lines)-1]
+		for len(last) > 1 && pdf.GetStringWidth(last) > width {
+			last = last[:len(last)-1]
+		}
+		lines[len(lines)-1] = last
+	}
+
+	return lines
+
+}
@@ -0,0 +1,119 @@
+package labels
+
+import "sort"
+
+// Template is a label sheet layout.
+// All dimensions are in millimeters.
+type Template struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	PageWidth   float64 `json:"page_width"`
+	PageHeight  float64 `json:"page_height"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	LabelWidth  float64 `json:"label_width"`
+	LabelHeight float64 `json:"label_height"`
+	// position of the top left label
+	MarginLeft float64 `json:"margin_left"`
+	MarginTop  float64 `json:"margin_top"`
+	// distance between the origins of two consecutive labels
+	PitchX float64 `json:"pitch_x"`
+	PitchY float64 `json:"pitch_y"`
+}
+
+// PerPage returns the number of labels per page
+func (t Template) PerPage() int {
+	return t.Columns * t.Rows
+}
+
+// DefaultTemplate is the template used when none is requested
+const DefaultTemplate = "avery-l7160"
+
+// Templates are the available label sheet layouts
+var Templates = map[string]Template{
+	// A4 sheets
+	"avery-l7159": {
+		Name:        "avery-l7159",
+		Description: "Avery L7159 - A4 - 24 labels 63.5x33.9mm",
+		PageWidth:   210, PageHeight: 297,
+		Columns: 3, Rows: 8,
+		LabelWidth: 63.5, LabelHeight: 33.9,
+		MarginLeft: 7.2, MarginTop: 12.9,
+		PitchX: 66, PitchY: 33.9,
+	},
+	"avery-l7160": {
+		Name:        "avery-l7160",
+		Description: "Avery L7160 - A4 - 21 labels 63.5x38.1mm",
+		PageWidth:   210, PageHeight: 297,
+		Columns: 3, Rows: 7,
+		LabelWidth: 63.5, LabelHeight: 38.1,
+		MarginLeft: 7.2, MarginTop: 15.1,
+		PitchX: 66, PitchY: 38.1,
+	},
+	"avery-l7163": {
+		Name:        "avery-l7163",
+		Description: "Avery L7163 - A4 - 14 labels 99.1x38.1mm",
+		PageWidth:   210, PageHeight: 297,
+		Columns: 2, Rows: 7,
+		LabelWidth: 99.1, LabelHeight: 38.1,
+		MarginLeft: 4.7, MarginTop: 15.1,
+		PitchX: 101.6, PitchY: 38.1,
+	},
+	"avery-l7165": {
+		Name:        "avery-l7165",
+		Description: "Avery L7165 - A4 - 8 labels 99.1x67.7mm",
+		PageWidth:   210, PageHeight: 297,
+		Columns: 2, Rows: 4,
+		LabelWidth: 99.1, LabelHeight: 67.7,
+		MarginLeft: 4.7, MarginTop: 13.1,
+		PitchX: 101.6, PitchY: 67.7,
+	},
+	"avery-l7651": {
+		Name:        "avery-l7651",
+		Description: "Avery L7651 - A4 - 65 labels 38.1x21.2mm",
+		PageWidth:   210, PageHeight: 297,
+		Columns: 5, Rows: 13,
+		LabelWidth: 38.1, LabelHeight: 21.2,
+		MarginLeft: 4.7, MarginTop: 10.7,
+		PitchX: 40.6, PitchY: 21.2,
+	},
+	// thermal printers: one label per page
+	"thermal-57x32": {
+		Name:        "thermal-57x32",
+		Description: "thermal printer - single label 57x32mm",
+		PageWidth:   57, PageHeight: 32,
+		Columns: 1, Rows: 1,
+		LabelWidth: 57, LabelHeight: 32,
+		PitchX: 57, PitchY: 32,
+	},
+	"thermal-62x29": {
+		Name:        "thermal-62x29",
+		Description: "thermal printer - single label 62x29mm",
+		PageWidth:   62, PageHeight: 29,
+		Columns: 1, Rows: 1,
+		LabelWidth: 62, LabelHeight: 29,
+		PitchX: 62, PitchY: 29,
+	},
+	"thermal-102x51": {
+		Name:        "thermal-102x51",
+		Description: "thermal printer - single label 102x51mm",
+		PageWidth:   102, PageHeight: 51,
+		Columns: 1, Rows: 1,
+		LabelWidth: 102, LabelHeight: 51,
+		PitchX: 102, PitchY: 51,
+	},
+}
+
+// GetTemplates returns the available templates sorted by name
+func GetTemplates() []Template {
+	var ts []Template
+
+	for _, t := range Templates {
+		ts = append(ts, t)
+	}
+	sort.Slice(ts, func(i, j int) bool {
+		return ts[i].Name < ts[j].Name
+	})
+
+	return ts
+}
@@ -163,6 +163,120 @@ var LOCALES_EN = []byte(`
 	You will then receive a temporary password.
 	'''
 
+[storagetransfer_request_mailsubject]
+	one = "Chimithèque storage transfer request\r\n"
+[storagetransfer_request_mailbody]
+	one = '''
+	%[6]s requests the transfer of the storage %[1]s (%[2]s) from the entity %[3]s to the store location %[4]s of the entity %[5]s.
+
+	Accept or refuse the request in Chimithèque: %[7]s
+	'''
+[storagetransfer_accepted_mailsubject]
+	one = "Chimithèque storage transfer accepted\r\n"
+[storagetransfer_accepted_mailbody]
+	one = '''
+	The transfer of the storage %[1]s (%[2]s) from the entity %[3]s to the store location %[4]s of the entity %[5]s has been accepted by %[6]s.
+
+	%[7]s
+	'''
+[storagetransfer_refused_mailsubject]
+	one = "Chimithèque storage transfer refused\r\n"
+[storagetransfer_refused_mailbody]
+	one = '''
+	The transfer of the storage %[1]s (%[2]s) from the entity %[3]s to the store location %[4]s of the entity %[5]s has been refused by %[6]s.
+
+	%[7]s
+	'''
+[storagetransfer_cancelled_mailsubject]
+	one = "Chimithèque storage transfer cancelled\r\n"
+[storagetransfer_cancelled_mailbody]
+	one = '''
+	The transfer of the storage %[1]s (%[2]s) from the entity %[3]s to the store location %[4]s of the entity %[5]s has been cancelled by %[6]s.
+
+	%[7]s
+	'''
+
+[reservation_conflict_mailsubject]
+	one = "Chimithèque reservation at risk\r\n"
+[reservation_conflict_mailbody]
+	one = '''
+	%[1]s has withdrawn from or borrowed the storage %[2]s (%[3]s). Your reservation from %[4]s to %[5]s may not be honored anymore.
+
+	%[6]s
+	'''
+
+[purchaserequest_requested_mailsubject]
+	one = "Chimithèque purchase request\r\n"
+[purchaserequest_requested_mailbody]
+	one = '''
+	%[3]s requests the purchase of %[1]s for the entity %[2]s.
+
+	Approve or refuse the request in Chimithèque: %[4]s
+	'''
+[purchaserequest_approved_mailsubject]
+	one = "Chimithèque purchase request approved\r\n"
+[purchaserequest_approved_mailbody]
+	one = '''
+	The purchase of %[1]s for the entity %[2]s has been approved by %[3]s.
+
+	%[4]s
+	'''
+[purchaserequest_refused_mailsubject]
+	one = "Chimithèque purchase request refused\r\n"
+[purchaserequest_refused_mailbody]
+	one = '''
+	The purchase of %[1]s for the entity %[2]s has been refused by %[3]s.
+
+	%[4]s
+	'''
+[purchaserequest_ordered_mailsubject]
+	one = "Chimithèque purchase request ordered\r\n"
+[purchaserequest_ordered_mailbody]
+	one = '''
+	%[1]s for the entity %[2]s has been ordered by %[3]s.
+
+	%[4]s
+	'''
+[purchaserequest_received_mailsubject]
+	one = "Chimithèque purchase request received\r\n"
+[purchaserequest_received_mailbody]
+	one = '''
+	%[1]s for the entity %[2]s has been received and stored by %[3]s.
+
+	%[4]s
+	'''
+[purchaserequest_cancelled_mailsubject]
+	one = "Chimithèque purchase request cancelled\r\n"
+[purchaserequest_cancelled_mailbody]
+	one = '''
+	The purchase of %[1]s for the entity %[2]s has been cancelled by %[3]s.
+
+	%[4]s
+	'''
+
+[stockthreshold_alert_mailsubject]
+	one = "Chimithèque products to reorder\r\n"
+[stockthreshold_alert_mailbody]
+	one = '''
+	The stock of the following products of the entity %[1]s is below the minimum stock (current stock / minimum stock):
+
+	%[2]s
+
+	%[3]s
+	'''
+
+[sensoralert_mailsubject]
+	one = "Chimithèque store location temperature alert\r\n"
+[sensoralert_mailbody]
+	one = '''
+	%[1]s: %[2]s on %[3]s.
+
+	Storages of the store location:
+	%[4]s
+
+	%[5]s
+	'''
+
 [logo_information1]
 	one = "Chimithèque logo designed by "
 [logo_information2]
@@ -585,6 +699,8 @@ var LOCALES_EN = []byte(`
 	one = "can store"
 [storelocation_color_title]
 	one = "color"
+[storelocation_barecodeprefix_title]
+	one = "barecode prefix"
 [storelocation_name_title]
 	one = "name"
 [storelocation_name_table_header]
@@ -616,6 +732,10 @@ var LOCALES_EN = []byte(`
 	one = "name"
 [entity_description_table_header]
 	one = "description"
+[entity_barecodeprefix_title]
+	one = "barecode prefix"
+[entity_barecodetemplate_title]
+	one = "barecode numbering template"
 [entity_manager_table_header]
 	one = "manager(s)"
 [entity_manager_placeholder]
@@ -163,6 +163,120 @@ var LOCALES_FR = []byte(`
 	Vous recevrez ensuite un mot de passe temporaire.
 	'''
 
+[storagetransfer_request_mailsubject]
+	one = "Chimithèque demande de transfert de stockage\r\n"
+[storagetransfer_request_mailbody]
+	one = '''
+	%[6]s demande le transfert du stockage %[1]s (%[2]s) de l'entité %[3]s vers l'emplacement %[4]s de l'entité %[5]s.
+
+	Acceptez ou refusez la demande dans Chimithèque : %[7]s
+	'''
+[storagetransfer_accepted_mailsubject]
+	one = "Chimithèque transfert de stockage accepté\r\n"
+[storagetransfer_accepted_mailbody]
+	one = '''
+	Le transfert du stockage %[1]s (%[2]s) de l'entité %[3]s vers l'emplacement %[4]s de l'entité %[5]s a été accepté par %[6]s.
+
+	%[7]s
+	'''
+[storagetransfer_refused_mailsubject]
+	one = "Chimithèque transfert de stockage refusé\r\n"
+[storagetransfer_refused_mailbody]
+	one = '''
+	Le transfert du stockage %[1]s (%[2]s) de l'entité %[3]s vers l'emplacement %[4]s de l'entité %[5]s a été refusé par %[6]s.
+
+	%[7]s
+	'''
+[storagetransfer_cancelled_mailsubject]
+	one = "Chimithèque transfert de stockage annulé\r\n"
+[storagetransfer_cancelled_mailbody]
+	one = '''
+	Le transfert du stockage %[1]s (%[2]s) de l'entité %[3]s vers l'emplacement %[4]s de l'entité %[5]s a été annulé par %[6]s.
+
+	%[7]s
+	'''
+
+[reservation_conflict_mailsubject]
+	one = "Chimithèque réservation compromise\r\n"
+[reservation_conflict_mailbody]
+	one = '''
+	%[1]s a prélevé ou emprunté le stockage %[2]s (%[3]s). Votre réservation du %[4]s au %[5]s pourrait ne plus être honorée.
+
+	%[6]s
+	'''
+
+[purchaserequest_requested_mailsubject]
+	one = "Chimithèque demande d'achat\r\n"
+[purchaserequest_requested_mailbody]
+	one = '''
+	%[3]s demande l'achat de %[1]s pour l'entité %[2]s.
+
+	Approuvez ou refusez la demande dans Chimithèque : %[4]s
+	'''
+[purchaserequest_approved_mailsubject]
+	one = "Chimithèque demande d'achat approuvée\r\n"
+[purchaserequest_approved_mailbody]
+	one = '''
+	L'achat de %[1]s pour l'entité %[2]s a été approuvé par %[3]s.
+
+	%[4]s
+	'''
+[purchaserequest_refused_mailsubject]
+	one = "Chimithèque demande d'achat refusée\r\n"
+[purchaserequest_refused_mailbody]
+	one = '''
+	L'achat de %[1]s pour l'entité %[2]s a été refusé par %[3]s.
+
+	%[4]s
+	'''
+[purchaserequest_ordered_mailsubject]
+	one = "Chimithèque demande d'achat commandée\r\n"
+[purchaserequest_ordered_mailbody]
+	one = '''
+	%[1]s pour l'entité %[2]s a été commandé par %[3]s.
+
+	%[4]s
+	'''
+[purchaserequest_received_mailsubject]
+	one = "Chimithèque demande d'achat réceptionnée\r\n"
+[purchaserequest_received_mailbody]
+	one = '''
+	%[1]s pour l'entité %[2]s a été réceptionné et stocké par %[3]s.
+
+	%[4]s
+	'''
+[purchaserequest_cancelled_mailsubject]
+	one = "Chimithèque demande d'achat annulée\r\n"
+[purchaserequest_cancelled_mailbody]
+	one = '''
+	L'achat de %[1]s pour l'entité %[2]s a été annulé par %[3]s.
+
+	%[4]s
+	'''
+
+[stockthreshold_alert_mailsubject]
+	one = "Chimithèque produits à recommander\r\n"
+[stockthreshold_alert_mailbody]
+	one = '''
+	Le stock des produits suivants de l'entité %[1]s est inférieur au stock minimum (stock actuel / stock minimum) :
+
+	%[2]s
+
+	%[3]s
+	'''
+
+[sensoralert_mailsubject]
+	one = "Chimithèque alerte de température d'emplacement\r\n"
+[sensoralert_mailbody]
+	one = '''
+	%[1]s : %[2]s le %[3]s.
+
+	Stockages de l'emplacement :
+	%[4]s
+
+	%[5]s
+	'''
+
 [logo_information1]
 	one = "logo Chimithèque réalisé par "
 [logo_information2]
@@ -585,6 +699,8 @@ var LOCALES_FR = []byte(`
 	one = "peut stocker"
 [storelocation_color_title]
 	one = "couleur"
+[storelocation_barecodeprefix_title]
+	one = "préfixe code barre"
 [storelocation_name_title]
 	one = "nom"
 [storelocation_name_table_header]
@@ -616,6 +732,10 @@ var LOCALES_FR = []byte(`
 	one = "nom"
 [entity_description_table_header]
 	one = "description"
+[entity_barecodeprefix_title]
+	one = "préfixe code barre"
+[entity_barecodetemplate_title]
+	one = "modèle de numérotation des codes barres"
 [entity_manager_table_header]
 	one = "responsable(s)"
 [entity_manager_placeholder]
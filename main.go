@@ -18,9 +18,11 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/codes"
 	"github.com/tbellembois/gochimitheque/datastores"
 	"github.com/tbellembois/gochimitheque/handlers"
 	"github.com/tbellembois/gochimitheque/logger"
@@ -43,12 +45,18 @@ var (
 	paramPublicProductsEndpoint,
 	commandResetAdminPassword,
 	commandUpdateQRCode,
+	commandMailStockAlerts,
+	commandSnapshotStocks,
+	commandRebuildStoreLocationPaths,
 	paramDebug,
 	commandVersion,
 	commandGenLocaleJS,
 	paramDisableCache *bool
 	GitCommit string
 
+	paramStockAlertInterval,
+	paramStockSnapshotInterval *int
+
 	//go:embed models/model.conf
 	embedModel string
 	//go:embed wasm/*
@@ -85,10 +93,18 @@ func init() {
 	flagLogFile := flag.String("logfile", "", "log to the given file (optional)")
 	flagDebug := flag.Bool("debug", false, "debug (verbose log), default is error")
 	flagDisableCache := flag.Bool("disablecache", false, "disable the cache (development only)")
+	flagQRCodePayload := flag.String("qrcodepayload", "{id}", "the storages QR codes content, with the {id}, {barecode} and {url} placeholders, run -updateqrcode after a change (optional)")
+	flagSolutionExpirationDays := flag.Int("solutionexpirationdays", 30, "the default lifetime in days of the prepared solutions (optional)")
+	flagStockAlertInterval := flag.Int("stockalertinterval", 24, "the interval in hours between the mails of the products below the stock thresholds, 0 to disable (optional)")
+	flagStockSnapshotInterval := flag.Int("stocksnapshotinterval", 24, "the interval in hours between the stock snapshots, 0 to disable (optional)")
+	flagRefuseIncompatibleStorages := flag.Bool("refuseincompatiblestorages", false, "refuse the storages in a store location holding products of incompatible storage classes instead of warning (optional)")
 
 	// One shot commands.
 	flagResetAdminPassword := flag.Bool("resetadminpassword", false, "reset the admin password to `chimitheque`")
 	flagUpdateQRCode := flag.Bool("updateqrcode", false, "regenerate storages QR codes")
+	flagMailStockAlerts := flag.Bool("mailstockalerts", false, "mail the products below the stock thresholds to the entity managers")
+	flagSnapshotStocks := flag.Bool("snapshotstocks", false, "snapshot the stocks of the day")
+	flagRebuildStoreLocationPaths := flag.Bool("rebuildstorelocationpaths", false, "recompute the full paths of all the store locations")
 	flagVersion := flag.Bool("version", false, "display application version")
 	flagMailTest := flag.String("mailtest", "", "send a test mail")
 	flagImportV1From := flag.String("importv1from", "", "full path of the directory containing the Chimithèque v1 CSV to import")
@@ -106,14 +122,22 @@ func init() {
 	mailer.MailServerSender = *flagMailServerSender
 	mailer.MailServerUseTLS = *flagMailServerUseTLS
 	mailer.MailServerTLSSkipVerify = *flagMailServerTLSSkipVerify
+	codes.QRCodePayload = *flagQRCodePayload
+	env.SolutionExpirationDays = *flagSolutionExpirationDays
+	env.RefuseIncompatibleStorages = *flagRefuseIncompatibleStorages
 	paramPublicProductsEndpoint = flagPublicProductsEndpoint
 	paramAdminList = flagAdminList
 	paramLogFile = flagLogFile
 	paramDebug = flagDebug
 	paramDisableCache = flagDisableCache
+	paramStockAlertInterval = flagStockAlertInterval
+	paramStockSnapshotInterval = flagStockSnapshotInterval
 
 	commandResetAdminPassword = flagResetAdminPassword
 	commandUpdateQRCode = flagUpdateQRCode
+	commandMailStockAlerts = flagMailStockAlerts
+	commandSnapshotStocks = flagSnapshotStocks
+	commandRebuildStoreLocationPaths = flagRebuildStoreLocationPaths
 	commandVersion = flagVersion
 	commandMailTest = flagMailTest
 	commandImportV1From = flagImportV1From
@@ -126,6 +150,8 @@ func init() {
 		env.ApplicationFullURL = "http://localhost:" + *paramListenPort
 	}
 
+	codes.ApplicationFullURL = env.ApplicationFullURL
+
 	if GitCommit == "" {
 		env.BuildID = "developer"
 	} else {
@@ -340,6 +366,43 @@ func main() {
 
 	}
 
+	if *commandMailStockAlerts {
+
+		logger.Log.Info("- mailing stock threshold alerts")
+		err := env.MailStockThresholdAlerts()
+		if err != nil {
+			logger.Log.Error("an error occured: " + err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	}
+
+	if *commandSnapshotStocks {
+
+		logger.Log.Info("- snapshotting stocks")
+		err := env.SnapshotStocks()
+		if err != nil {
+			logger.Log.Error("an error occured: " + err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+
+	}
+
+	if *commandRebuildStoreLocationPaths {
+
+		logger.Log.Info("- rebuilding store locations full paths")
+		count, err := env.DB.RebuildStoreLocationFullPaths()
+		if err != nil {
+			logger.Log.Error("an error occured: " + err.Error())
+			os.Exit(1)
+		}
+		logger.Log.Info(fmt.Sprintf("  %d paths updated", count))
+		os.Exit(0)
+
+	}
+
 	if *commandMailTest != "" {
 
 		logger.Log.Info("- sending a mail to " + *commandMailTest)
@@ -360,6 +423,15 @@ func main() {
 
 	env.InitCasbinPolicy()
 
+	if *paramStockAlertInterval > 0 {
+		logger.Log.Info("- starting stock threshold alerts job")
+		go env.RunStockThresholdAlertsJob(time.Duration(*paramStockAlertInterval) * time.Hour)
+	}
+	if *paramStockSnapshotInterval > 0 {
+		logger.Log.Info("- starting stock snapshot job")
+		go env.RunStockSnapshotJob(time.Duration(*paramStockSnapshotInterval) * time.Hour)
+	}
+
 	logger.Log.Info("- application running")
 	if err = http.ListenAndServe(":"+*paramListenPort, nil); err != nil {
 		panic("error running the server")
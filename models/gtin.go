@@ -0,0 +1,15 @@
+package models
+
+import "database/sql"
+
+// GTIN maps a supplier GS1 Global Trade Item Number to a product
+// and optionally to one of its supplier references
+type GTIN struct {
+	GTINID    int    `db:"gtin_id" json:"gtin_id" schema:"gtin_id"`
+	GTINLabel string `db:"gtin_label" json:"gtin_label" schema:"gtin_label"` // 14 digits
+	ProductID int    `db:"product" json:"product_id" schema:"product_id"`
+
+	SupplierRefID    sql.NullInt64  `db:"supplierref_id" json:"supplierref_id" schema:"supplierref_id"`
+	SupplierRefLabel sql.NullString `db:"supplierref_label" json:"supplierref_label" schema:"supplierref_label"`
+	Supplier         `db:"supplier" json:"supplier" schema:"supplier"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Inventory is a stock-taking campaign in an entity,
+// optionally restricted to a store location and its children
+type Inventory struct {
+	InventoryID           int          `db:"inventory_id" json:"inventory_id" schema:"inventory_id"`
+	InventoryName         string       `db:"inventory_name" json:"inventory_name" schema:"inventory_name"`
+	InventoryCreationDate time.Time    `db:"inventory_creationdate" json:"inventory_creationdate" schema:"inventory_creationdate"`
+	InventoryCloseDate    sql.NullTime `db:"inventory_closedate" json:"inventory_closedate" schema:"inventory_closedate"`
+	Person                `db:"person" json:"person" schema:"person"`
+	Entity                `db:"entity" json:"entity" schema:"entity"`
+	StoreLocation         StoreLocation `db:"storelocation" json:"storelocation" schema:"storelocation"`
+
+	// scan count
+	InventorySC int `db:"inventory_sc" json:"inventory_sc" schema:"inventory_sc"` // not in db but sqlx requires the "db" entry
+}
+
+// IsClosed returns true if the inventory campaign is closed
+func (i Inventory) IsClosed() bool {
+	return i.InventoryCloseDate.Valid
+}
+
+// InventoryScan is a barecode or QR code scanned in a store location
+// during an inventory campaign
+type InventoryScan struct {
+	InventoryScanID   int       `db:"inventoryscan_id" json:"inventoryscan_id" schema:"inventoryscan_id"`
+	InventoryScanCode string    `db:"inventoryscan_code" json:"inventoryscan_code" schema:"inventoryscan_code"`
+	InventoryScanDate time.Time `db:"inventoryscan_date" json:"inventoryscan_date" schema:"inventoryscan_date"`
+	Inventory         Inventory `db:"inventory" json:"-" schema:"inventory"`
+	Person            `db:"person" json:"person" schema:"person"`
+	StoreLocation     `db:"storelocation" json:"storelocation" schema:"storelocation"`
+	// the storage matching the scanned code, if any
+	Storage Storage `db:"storage" json:"storage" schema:"storage"`
+}
+
+// InventoryMisplaced is a storage found in another store location
+// than the one recorded in the database
+type InventoryMisplaced struct {
+	Storage Storage `json:"storage"`
+	// the store location where the storage has been scanned
+	FoundIn StoreLocation `json:"found_in"`
+}
+
+// InventoryReport is the reconciliation report of an inventory campaign
+type InventoryReport struct {
+	Inventory Inventory            `json:"inventory"`
+	Found     []Storage            `json:"found"`
+	Misplaced []InventoryMisplaced `json:"misplaced"`
+	Missing   []Storage            `json:"missing"`
+	Unknown   []InventoryScan      `json:"unknown"`
+}
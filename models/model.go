@@ -51,6 +51,17 @@ type StoreLocation struct {
 	Entity                `db:"entity" json:"entity" schema:"entity"`
 	StoreLocation         *StoreLocation `db:"storelocation" json:"storelocation" schema:"storelocation"`
 	StoreLocationFullPath string         `db:"storelocation_fullpath" json:"storelocation_fullpath" schema:"storelocation_fullpath"`
+	// barecode prefix of the store location storages, inherited by the children
+	StoreLocationBarecodePrefix sql.NullString `db:"storelocation_barecodeprefix" json:"storelocation_barecodeprefix" schema:"storelocation_barecodeprefix"`
+	// fridge, freezer... and temperature range in Celsius
+	StoreLocationType           sql.NullString  `db:"storelocation_type" json:"storelocation_type" schema:"storelocation_type"`
+	StoreLocationMinTemperature sql.NullFloat64 `db:"storelocation_mintemperature" json:"storelocation_mintemperature" schema:"storelocation_mintemperature"`
+	StoreLocationMaxTemperature sql.NullFloat64 `db:"storelocation_maxtemperature" json:"storelocation_maxtemperature" schema:"storelocation_maxtemperature"`
+	// site, building... hierarchy level and its metadata
+	StoreLocationLevel            sql.NullString `db:"storelocation_level" json:"storelocation_level" schema:"storelocation_level"`
+	StoreLocationRoomNumber       sql.NullString `db:"storelocation_roomnumber" json:"storelocation_roomnumber" schema:"storelocation_roomnumber"`
+	StoreLocationResponsible      sql.NullInt64  `db:"storelocation_responsible" json:"storelocation_responsible" schema:"storelocation_responsible"`
+	StoreLocationResponsibleEmail sql.NullString `db:"storelocation_responsibleemail" json:"storelocation_responsibleemail" schema:"-"`
 
 	Children []*StoreLocation `db:"-" json:"children" schema:"-"`
 	Stocks   []Stock          `db:"-" json:"stock" schema:"-"`
@@ -58,10 +69,16 @@ type StoreLocation struct {
 
 // Entity represent a department, a laboratory...
 type Entity struct {
-	EntityID          int       `db:"entity_id" json:"entity_id" schema:"entity_id"`
-	EntityName        string    `db:"entity_name" json:"entity_name" schema:"entity_name"`
-	EntityDescription string    `db:"entity_description" json:"entity_description" schema:"entity_description"`
-	Managers          []*Person `db:"-" json:"managers" schema:"managers"`
+	EntityID          int    `db:"entity_id" json:"entity_id" schema:"entity_id"`
+	EntityName        string `db:"entity_name" json:"entity_name" schema:"entity_name"`
+	EntityDescription string `db:"entity_description" json:"entity_description" schema:"entity_description"`
+	// barecode prefix of the entity store locations without prefix
+	EntityBarecodePrefix sql.NullString `db:"entity_barecodeprefix" json:"entity_barecodeprefix" schema:"entity_barecodeprefix"`
+	// storages barecode numbering template
+	EntityBarecodeTemplate sql.NullString `db:"entity_barecodetemplate" json:"entity_barecodetemplate" schema:"entity_barecodetemplate"`
+	Managers               []*Person      `db:"-" json:"managers" schema:"managers"`
+	// running and upcoming reservations of the requested product
+	Reservations []Reservation `db:"-" json:"reservations" schema:"-"`
 
 	// total store location count
 	EntitySLC int `db:"entity_slc" json:"entity_slc" schema:"entity_slc"` // not in db but sqlx requires the "db" entry
@@ -91,7 +108,9 @@ type Unit struct {
 	UnitLabel      sql.NullString `db:"unit_label" json:"unit_label" schema:"unit_label"`
 	UnitType       sql.NullString `db:"unit_type" json:"unit_type" schema:"unit_type"`
 	Unit           *Unit          `db:"unit" json:"unit" schema:"unit"` // reference
-	UnitMultiplier int            `db:"unit_multiplier" json:"-" schema:"-"`
+	UnitMultiplier float64        `db:"unit_multiplier" json:"-" schema:"-"`
+	// mass, volume, moles or length for the quantity units
+	UnitDimension sql.NullString `db:"unit_dimension" json:"unit_dimension" schema:"unit_dimension"`
 }
 
 // Supplier is a product supplier
@@ -107,6 +126,10 @@ type SupplierRef struct {
 	SupplierRefID    int       `db:"supplierref_id" json:"supplierref_id" schema:"supplierref_id"`
 	SupplierRefLabel string    `db:"supplierref_label" json:"supplierref_label" schema:"supplierref_label"`
 	Supplier         *Supplier `db:"supplier" json:"supplier" schema:"supplier"`
+
+	// catalog unit price
+	SupplierRefUnitPrice sql.NullFloat64 `db:"supplierref_unitprice" json:"supplierref_unitprice" schema:"supplierref_unitprice"`
+	SupplierRefCurrency  sql.NullString  `db:"supplierref_currency" json:"supplierref_currency" schema:"supplierref_currency"`
 }
 
 // Producer is a product producer
@@ -155,6 +178,7 @@ type Storage struct {
 	StorageQuantity          sql.NullFloat64 `db:"storage_quantity" json:"storage_quantity" schema:"storage_quantity"`
 	StorageNbItem            int             `db:"-" json:"storage_nbitem" schema:"storage_nbitem"`
 	StorageIdenticalBarecode sql.NullBool    `db:"-" json:"storage_identicalbarecode" schema:"storage_identicalbarecode"`
+	StorageGS1               string          `db:"-" json:"storage_gs1" schema:"storage_gs1"` // scanned supplier GS1 code
 	StorageBarecode          sql.NullString  `db:"storage_barecode" json:"storage_barecode" schema:"storage_barecode"`
 	StorageQRCode            []byte          `db:"storage_qrcode" json:"storage_qrcode" schema:"storage_qrcode"`
 	StorageToDestroy         sql.NullBool    `db:"storage_todestroy" json:"storage_todestroy" schema:"storage_todestroy"`
@@ -174,6 +198,18 @@ type Storage struct {
 
 	// storage history count
 	StorageHC int `db:"storage_hc" json:"storage_hc" schema:"storage_hc"` // not in db but sqlx requires the "db" entry
+
+	// storage this storage has been split from
+	StorageParentID sql.NullInt64 `db:"storage_parent" json:"storage_parent" schema:"storage_parent"`
+
+	// actual purchase price
+	StoragePrice    sql.NullFloat64 `db:"storage_price" json:"storage_price" schema:"storage_price"`
+	StorageCurrency sql.NullString  `db:"storage_currency" json:"storage_currency" schema:"storage_currency"`
+
+	// running and upcoming reservations count
+	StorageRC int `db:"storage_rc" json:"storage_rc" schema:"storage_rc"` // not in db but sqlx requires the "db" entry
+	// running and upcoming reservations
+	Reservations []Reservation `db:"-" json:"reservations" schema:"-"`
 }
 
 // Borrowing represent a storage borrowing
@@ -318,6 +354,12 @@ type Product struct {
 	SupplierRefs            []SupplierRef            `db:"-" json:"supplierrefs" schema:"supplierrefs"`
 	Tags                    []Tag                    `db:"-" json:"tags" schema:"tags"`
 
+	// density in g/mL
+	ProductDensity sql.NullFloat64 `db:"product_density" json:"product_density" schema:"product_density"`
+	// molar mass in g/mol, computed from the empirical formula,
+	// given for the products without a computable formula
+	ProductMolarMass sql.NullFloat64 `db:"product_molarmass" json:"product_molarmass" schema:"product_molarmass"`
+
 	Bookmark *Bookmark `db:"bookmark" json:"bookmark" schema:"bookmark"` // not in db but sqlx requires the "db" entry
 
 	// archived storage count in the logged user entity(ies)
@@ -392,6 +434,17 @@ func (p Product) ProductToStringSlice() []string {
 	ret = append(ret, strconv.FormatBool(p.ProductRestricted.Bool))
 	ret = append(ret, strconv.FormatBool(p.ProductRadioactive.Bool))
 
+	if p.ProductDensity.Valid {
+		ret = append(ret, strconv.FormatFloat(p.ProductDensity.Float64, 'f', -1, 64))
+	} else {
+		ret = append(ret, "")
+	}
+	if m, ok := p.MolarMass(); ok {
+		ret = append(ret, strconv.FormatFloat(m, 'f', -1, 64))
+	} else {
+		ret = append(ret, "")
+	}
+
 	return ret
 }
 
@@ -424,6 +477,22 @@ func (s Storage) StorageToStringSlice() []string {
 	ret = append(ret, strconv.FormatBool(s.StorageToDestroy.Bool))
 	ret = append(ret, strconv.FormatBool(s.StorageArchive.Bool))
 
+	if s.StoragePrice.Valid {
+		ret = append(ret, strconv.FormatFloat(s.StoragePrice.Float64, 'f', -1, 64))
+	} else {
+		ret = append(ret, "")
+	}
+	ret = append(ret, s.StorageCurrency.String)
+
+	// quantity in mass, volume and moles, empty if not convertible
+	for _, d := range []string{UnitDimensionMass, UnitDimensionVolume, UnitDimensionMoles} {
+		if c := s.Product.ConvertQuantity(s.StorageQuantity, s.UnitQuantity, d); c.Convertible {
+			ret = append(ret, strconv.FormatFloat(c.Quantity, 'f', -1, 64))
+		} else {
+			ret = append(ret, "")
+		}
+	}
+
 	return ret
 }
 
@@ -450,7 +519,9 @@ func ProductsToCSV(prs []Product) string {
 		"remark",
 		"disposal_comment",
 		"restricted?",
-		"radioactive?"}
+		"radioactive?",
+		"density",
+		"molar_mass"}
 
 	// create a temp file
 	tmpFile, err := ioutil.TempFile(os.TempDir(), "chimitheque-")
@@ -497,7 +568,12 @@ func StoragesToCSV(sts []Storage) (string, error) {
 		"reference",
 		"batch_number",
 		"to_destroy?",
-		"archive?"}
+		"archive?",
+		"price",
+		"currency",
+		"quantity_g",
+		"quantity_L",
+		"quantity_mol"}
 
 	// create a temp file
 	if tmpFile, err = ioutil.TempFile(os.TempDir(), "chimitheque-"); err != nil {
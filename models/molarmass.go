@@ -0,0 +1,124 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// AtomicWeights are the standard atomic weights in g/mol,
+// the mass number of the most stable isotope for the elements
+// without stable isotope.
+var AtomicWeights = map[string]float64{
+	"H": 1.008, "D": 2.014, "He": 4.0026,
+	"Li": 6.94, "Be": 9.0122, "B": 10.81, "C": 12.011, "N": 14.007, "O": 15.999, "F": 18.998, "Ne": 20.180,
+	"Na": 22.990, "Mg": 24.305, "Al": 26.982, "Si": 28.085, "P": 30.974, "S": 32.06, "Cl": 35.45, "Ar": 39.948,
+	"K": 39.098, "Ca": 40.078, "Sc": 44.956, "Ti": 47.867, "V": 50.942, "Cr": 51.996, "Mn": 54.938, "Fe": 55.845,
+	"Co": 58.933, "Ni": 58.693, "Cu": 63.546, "Zn": 65.38, "Ga": 69.723, "Ge": 72.630, "As": 74.922, "Se": 78.971,
+	"Br": 79.904, "Kr": 83.798,
+	"Rb": 85.468, "Sr": 87.62, "Y": 88.906, "Zr": 91.224, "Nb": 92.906, "Mo": 95.95, "Tc": 98, "Ru": 101.07,
+	"Rh": 102.91, "Pd": 106.42, "Ag": 107.87, "Cd": 112.41, "In": 114.82, "Sn": 118.71, "Sb": 121.76, "Te": 127.60,
+	"I": 126.90, "Xe": 131.29,
+	"Cs": 132.91, "Ba": 137.33, "La": 138.91, "Ce": 140.12, "Pr": 140.91, "Nd": 144.24, "Pm": 145, "Sm": 150.36,
+	"Eu": 151.96, "Gd": 157.25, "Tb": 158.93, "Dy": 162.50, "Ho": 164.93, "Er": 167.26, "Tm": 168.93, "Yb": 173.05,
+	"Lu": 174.97, "Hf": 178.49, "Ta": 180.95, "W": 183.84, "Re": 186.21, "Os": 190.23, "Ir": 192.22, "Pt": 195.08,
+	"Au": 196.97, "Hg": 200.59, "Tl": 204.38, "Pb": 207.2, "Bi": 208.98, "Po": 209, "At": 210, "Rn": 222,
+	"Fr": 223, "Ra": 226, "Ac": 227, "Th": 232.04, "Pa": 231.04, "U": 238.03, "Np": 237, "Pu": 244,
+	"Am": 243, "Cm": 247, "Bk": 247, "Cf": 251, "Es": 252, "Fm": 257, "Md": 258, "No": 259, "Lr": 266,
+	"Rf": 267, "Db": 268, "Sg": 269, "Bh": 270, "Hs": 277, "Mt": 278, "Ds": 281, "Rg": 282, "Cn": 285,
+}
+
+// ErrFormula is returned for a formula whose molar mass can not be computed
+var ErrFormula = errors.New("invalid formula")
+
+// MolarMass returns the molar mass in g/mol of the empirical formula f
+// like C2H6O, Ca(OH)2 or CuSO4.5H2O.
+func MolarMass(f string) (float64, error) {
+
+	f = strings.Replace(f, " ", "", -1)
+	if f == "" || f == "XXXX" {
+		return 0, ErrFormula
+	}
+
+	var total float64
+	for _, part := range strings.Split(f, ".") {
+		// leading multiplier of hydrates like 5H2O
+		coef, i := formulaCount(part, 0)
+		m, i, err := formulaGroup(part, i, 0)
+		if err != nil {
+			return 0, err
+		}
+		if i != len(part) || m == 0 {
+			return 0, ErrFormula
+		}
+		total += float64(coef) * m
+	}
+
+	return total, nil
+
+}
+
+// formulaGroup returns the mass of the atoms and parenthesis groups
+// of f from the index i up to the end of f or the closing bracket,
+// and the index of the closing bracket.
+func formulaGroup(f string, i int, depth int) (float64, int, error) {
+
+	var total float64
+
+	for i < len(f) {
+		c := rune(f[i])
+		switch {
+		case c == '(' || c == '[':
+			m, j, err := formulaGroup(f, i+1, depth+1)
+			if err != nil {
+				return 0, 0, err
+			}
+			if j == len(f) || (c == '(' && f[j] != ')') || (c == '[' && f[j] != ']') {
+				return 0, 0, ErrFormula
+			}
+			n, k := formulaCount(f, j+1)
+			total += float64(n) * m
+			i = k
+		case c == ')' || c == ']':
+			if depth == 0 {
+				return 0, 0, ErrFormula
+			}
+			return total, i, nil
+		case unicode.IsUpper(c):
+			j := i + 1
+			for j < len(f) && unicode.IsLower(rune(f[j])) {
+				j++
+			}
+			w, ok := AtomicWeights[f[i:j]]
+			if !ok {
+				return 0, 0, ErrFormula
+			}
+			n, k := formulaCount(f, j)
+			total += float64(n) * w
+			i = k
+		default:
+			return 0, 0, ErrFormula
+		}
+	}
+
+	return total, i, nil
+
+}
+
+// formulaCount returns the number at the index i of f, 1 if there is none,
+// and the index following the number.
+func formulaCount(f string, i int) (int, int) {
+
+	n := 0
+	j := i
+	for j < len(f) && f[j] >= '0' && f[j] <= '9' {
+		n = n*10 + int(f[j]-'0')
+		j++
+	}
+	if j == i {
+		return 1, i
+	}
+
+	return n, j
+
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Purchase request statuses
+const (
+	PurchaseRequestRequested = "requested"
+	PurchaseRequestApproved  = "approved"
+	PurchaseRequestRefused   = "refused"
+	PurchaseRequestOrdered   = "ordered"
+	PurchaseRequestReceived  = "received"
+	PurchaseRequestCancelled = "cancelled"
+)
+
+// PurchaseRequest is a request to buy a product for an entity,
+// approved or refused by the entity managers, then ordered and received.
+// The reception creates the storages of the ordered items.
+type PurchaseRequest struct {
+	PurchaseRequestID             int             `db:"purchaserequest_id" json:"purchaserequest_id" schema:"purchaserequest_id"`
+	PurchaseRequestCreationDate   time.Time       `db:"purchaserequest_creationdate" json:"purchaserequest_creationdate" schema:"purchaserequest_creationdate"`
+	PurchaseRequestStatus         string          `db:"purchaserequest_status" json:"purchaserequest_status" schema:"purchaserequest_status"`
+	PurchaseRequestQuantity       sql.NullFloat64 `db:"purchaserequest_quantity" json:"purchaserequest_quantity" schema:"purchaserequest_quantity"`
+	PurchaseRequestNbItem         int             `db:"purchaserequest_nbitem" json:"purchaserequest_nbitem" schema:"purchaserequest_nbitem"`
+	PurchaseRequestComment        sql.NullString  `db:"purchaserequest_comment" json:"purchaserequest_comment" schema:"purchaserequest_comment"`
+	PurchaseRequestDecisionDate   sql.NullTime    `db:"purchaserequest_decisiondate" json:"purchaserequest_decisiondate" schema:"purchaserequest_decisiondate"`
+	PurchaseRequestOrderDate      sql.NullTime    `db:"purchaserequest_orderdate" json:"purchaserequest_orderdate" schema:"purchaserequest_orderdate"`
+	PurchaseRequestOrderReference sql.NullString  `db:"purchaserequest_orderreference" json:"purchaserequest_orderreference" schema:"purchaserequest_orderreference"`
+	PurchaseRequestReceptionDate  sql.NullTime    `db:"purchaserequest_receptiondate" json:"purchaserequest_receptiondate" schema:"purchaserequest_receptiondate"`
+	// requester
+	Person `db:"person" json:"person" schema:"person"`
+	// entity the product is bought for
+	Entity       `db:"entity" json:"entity" schema:"entity"`
+	Product      Product     `db:"product" json:"product" schema:"product"`
+	SupplierRef  SupplierRef `db:"supplierref" json:"supplierref" schema:"supplierref"`
+	UnitQuantity Unit        `db:"unit_quantity" json:"unit_quantity" schema:"unit_quantity"`
+	// manager who approved or refused the request
+	DecisionPerson Person `db:"decision_person" json:"decision_person" schema:"decision_person"`
+}
+
+// PurchaseReception contains the storage informations
+// entered at the reception of a purchase request.
+type PurchaseReception struct {
+	StoreLocation         StoreLocation  `json:"storelocation"`
+	StorageBatchNumber    sql.NullString `json:"storage_batchnumber"`
+	StorageExpirationDate sql.NullTime   `json:"storage_expirationdate"`
+	StorageComment        sql.NullString `json:"storage_comment"`
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// Reasons of a not convertible quantity
+const (
+	NotConvertibleNoQuantity  = "no quantity"
+	NotConvertibleNoUnit      = "no unit"
+	NotConvertibleDimension   = "unit dimension not convertible"
+	NotConvertibleNoDensity   = "missing density"
+	NotConvertibleNoMolarMass = "missing molar mass"
+)
+
+// ReferenceUnitLabels are the reference units of the convertible dimensions.
+var ReferenceUnitLabels = map[string]string{
+	UnitDimensionMass:   "g",
+	UnitDimensionVolume: "L",
+	UnitDimensionMoles:  "mol",
+}
+
+// ConvertedQuantity is a quantity expressed in the reference unit
+// of a dimension.
+// Convertible is false when the quantity can not be converted,
+// Reason then tells the missing data.
+type ConvertedQuantity struct {
+	Dimension   string  `json:"convertedquantity_dimension"`
+	UnitLabel   string  `json:"convertedquantity_unitlabel"`
+	Quantity    float64 `json:"convertedquantity_quantity"`
+	Convertible bool    `json:"convertedquantity_convertible"`
+	Reason      string  `json:"convertedquantity_reason,omitempty"`
+}
+
+// MolarMass returns the molar mass of the product in g/mol,
+// computed from its empirical formula when not set,
+// and false if it is unknown.
+func (p Product) MolarMass() (float64, bool) {
+
+	if p.ProductMolarMass.Valid && p.ProductMolarMass.Float64 > 0 {
+		return p.ProductMolarMass.Float64, true
+	}
+	if !p.EmpiricalFormulaLabel.Valid {
+		return 0, false
+	}
+	m, err := MolarMass(p.EmpiricalFormulaLabel.String)
+
+	return m, err == nil
+
+}
+
+// ConvertQuantity returns the quantity q of a storage of the product in the unit u
+// expressed in the reference unit of the dimension d.
+// u must have its multiplier and dimension.
+func (p Product) ConvertQuantity(q sql.NullFloat64, u Unit, d string) ConvertedQuantity {
+
+	if !q.Valid {
+		return ConvertedQuantity{Dimension: d, UnitLabel: ReferenceUnitLabels[d], Reason: NotConvertibleNoQuantity}
+	}
+	if !u.UnitID.Valid {
+		return ConvertedQuantity{Dimension: d, UnitLabel: ReferenceUnitLabels[d], Reason: NotConvertibleNoUnit}
+	}
+
+	return p.ConvertReferenceQuantity(q.Float64*u.UnitMultiplier, u.UnitDimension.String, d)
+
+}
+
+// ConvertReferenceQuantity returns the quantity q expressed in the reference unit
+// of the dimension from, expressed in the reference unit of the dimension to.
+// A mass is converted into a volume with the density of the product,
+// and into moles with its molar mass.
+func (p Product) ConvertReferenceQuantity(q float64, from string, to string) ConvertedQuantity {
+
+	c := ConvertedQuantity{Dimension: to, UnitLabel: ReferenceUnitLabels[to]}
+
+	_, okFrom := ReferenceUnitLabels[from]
+	_, okTo := ReferenceUnitLabels[to]
+	if !okFrom || !okTo {
+		c.Reason = NotConvertibleDimension
+		return c
+	}
+	if from == to {
+		c.Quantity = q
+		c.Convertible = true
+		return c
+	}
+
+	// density in g/mL, grams per litre
+	gramsPerLitre := p.ProductDensity.Float64 * 1000
+	hasDensity := p.ProductDensity.Valid && gramsPerLitre > 0
+	molarMass, hasMolarMass := p.MolarMass()
+
+	// converting into grams
+	grams := q
+	switch from {
+	case UnitDimensionVolume:
+		if !hasDensity {
+			c.Reason = NotConvertibleNoDensity
+			return c
+		}
+		grams = q * gramsPerLitre
+	case UnitDimensionMoles:
+		if !hasMolarMass {
+			c.Reason = NotConvertibleNoMolarMass
+			return c
+		}
+		grams = q * molarMass
+	}
+
+	// then into the target dimension
+	switch to {
+	case UnitDimensionMass:
+		c.Quantity = grams
+	case UnitDimensionVolume:
+		if !hasDensity {
+			c.Reason = NotConvertibleNoDensity
+			return c
+		}
+		c.Quantity = grams / gramsPerLitre
+	case UnitDimensionMoles:
+		if !hasMolarMass {
+			c.Reason = NotConvertibleNoMolarMass
+			return c
+		}
+		c.Quantity = grams / molarMass
+	}
+	c.Convertible = true
+
+	return c
+
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Reservation is a quantity of a storage, or of a product in an entity,
+// reserved by a person for a time window.
+// A reservation without quantity reserves the whole storage or product.
+type Reservation struct {
+	ReservationID           int             `db:"reservation_id" json:"reservation_id" schema:"reservation_id"`
+	ReservationCreationDate time.Time       `db:"reservation_creationdate" json:"reservation_creationdate" schema:"reservation_creationdate"`
+	ReservationStartDate    time.Time       `db:"reservation_startdate" json:"reservation_startdate" schema:"reservation_startdate"`
+	ReservationEndDate      time.Time       `db:"reservation_enddate" json:"reservation_enddate" schema:"reservation_enddate"`
+	ReservationQuantity     sql.NullFloat64 `db:"reservation_quantity" json:"reservation_quantity" schema:"reservation_quantity"`
+	ReservationComment      sql.NullString  `db:"reservation_comment" json:"reservation_comment" schema:"reservation_comment"`
+	// reserving person
+	Person `db:"person" json:"person" schema:"person"`
+	// entity storing the storage or the product
+	Entity  `db:"entity" json:"entity" schema:"entity"`
+	Product `db:"product" json:"product" schema:"product"`
+	// reserved storage, not set for a product reservation
+	Storage      Storage `db:"storage" json:"storage" schema:"storage"`
+	UnitQuantity Unit    `db:"unit_quantity" json:"unit_quantity" schema:"unit_quantity"`
+}
+
+// IsStorageReservation returns true if the reservation is a storage one,
+// false for a product one
+func (r Reservation) IsStorageReservation() bool {
+	return r.Storage.StorageID.Valid
+}
@@ -0,0 +1,48 @@
+package models
+
+// scanned code types
+const (
+	ScanTypeStorage       = "storage"       // storage id from a QR code
+	ScanTypeBarecode      = "barecode"      // storage barecode
+	ScanTypeBatchNumber   = "batchnumber"   // storage batch number
+	ScanTypeStoreLocation = "storelocation" // store location barecode prefix
+	ScanTypeGS1           = "gs1"           // supplier GS1 barecode
+	ScanTypeUnknown       = "unknown"
+)
+
+// actions allowed on a scanned item
+const (
+	ScanActionView     = "view"
+	ScanActionBorrow   = "borrow"
+	ScanActionMove     = "move"
+	ScanActionWithdraw = "withdraw"
+)
+
+// ScanStorage is a storage matching a scanned code
+type ScanStorage struct {
+	Storage Storage  `json:"storage"`
+	Actions []string `json:"actions"`
+}
+
+// ScanStoreLocation is a store location matching a scanned code
+type ScanStoreLocation struct {
+	StoreLocation StoreLocation `json:"storelocation"`
+	Actions       []string      `json:"actions"`
+}
+
+// ScanProduct is a product matching a scanned code
+type ScanProduct struct {
+	Product Product  `json:"product"`
+	Actions []string `json:"actions"`
+}
+
+// ScanResult is the resolution of a code scanned by a barecode reader.
+// Only the items the logged user can view are returned.
+type ScanResult struct {
+	Code           string              `json:"code"`
+	Type           string              `json:"type"`
+	GTIN           string              `json:"gtin,omitempty"`
+	Storages       []ScanStorage       `json:"storages"`
+	StoreLocations []ScanStoreLocation `json:"storelocations"`
+	Products       []ScanProduct       `json:"products"`
+}
@@ -38,6 +38,7 @@ type DbselectparamProduct interface {
 	SetEntity(int)
 	SetProduct(int)
 	SetStorelocation(int)
+	SetStorelocationSubtree(bool)
 	SetBookmark(bool)
 	SetProductSpecificity(string)
 	SetCustomNamePartOf(string)
@@ -63,6 +64,7 @@ type DbselectparamProduct interface {
 	GetEntity() int
 	GetProduct() int
 	GetStorelocation() int
+	GetStorelocationSubtree() bool
 	GetBookmark() bool
 	GetProductSpecificity() string
 	GetCustomNamePartOf() string
@@ -92,6 +94,10 @@ type dbselectparamProduct struct {
 	ProducerRef   int // id
 	Bookmark      bool
 
+	// StorelocationSubtree extends the Storelocation filter
+	// to the children of the store location, at any level
+	StorelocationSubtree bool
+
 	CustomNamePartOf        string
 	Name                    int // id
 	EmpiricalFormula        int // id
@@ -121,6 +127,7 @@ type DbselectparamStorage interface {
 	SetEntity(int)
 	SetProduct(int)
 	SetStorelocation(int)
+	SetStorelocationSubtree(bool)
 	SetBookmark(bool)
 	SetStorage(int)
 	SetHistory(bool)
@@ -151,6 +158,7 @@ type DbselectparamStorage interface {
 	GetEntity() int
 	GetProduct() int
 	GetStorelocation() int
+	GetStorelocationSubtree() bool
 	GetBookmark() bool
 	GetStorage() int
 	GetHistory() bool
@@ -189,6 +197,10 @@ type dbselectparamStorage struct {
 	History        bool
 	StorageArchive bool
 
+	// StorelocationSubtree extends the Storelocation filter
+	// to the children of the store location, at any level
+	StorelocationSubtree bool
+
 	CustomNamePartOf        string
 	Name                    int // id
 	EmpiricalFormula        int // id
@@ -286,6 +298,105 @@ type dbselectparamSupplierRef struct {
 	Supplier int
 }
 
+// DbselectparamInventory contains the parameters of the GetInventories function
+type DbselectparamInventory interface {
+	Dbselectparam
+	SetEntity(int)
+	SetOpen(bool)
+
+	GetEntity() int
+	GetOpen() bool
+}
+type dbselectparamInventory struct {
+	dbselectparam
+	Entity int
+	Open   bool
+}
+
+// DbselectparamWastePickup contains the parameters of the GetWastePickups function
+type DbselectparamWastePickup interface {
+	Dbselectparam
+	SetEntity(int)
+	SetOpen(bool)
+
+	GetEntity() int
+	GetOpen() bool
+}
+type dbselectparamWastePickup struct {
+	dbselectparam
+	Entity int
+	Open   bool
+}
+
+// DbselectparamStorageTransfer contains the parameters of the GetStorageTransfers function
+type DbselectparamStorageTransfer interface {
+	Dbselectparam
+	SetEntity(int)
+	SetStatus(string)
+
+	GetEntity() int
+	GetStatus() string
+}
+type dbselectparamStorageTransfer struct {
+	dbselectparam
+	Entity int
+	Status string
+}
+
+// DbselectparamReservation contains the parameters of the GetReservations function
+type DbselectparamReservation interface {
+	Dbselectparam
+	SetStorage(int)
+	SetProduct(int)
+	SetEntity(int)
+	SetActive(bool)
+
+	GetStorage() int
+	GetProduct() int
+	GetEntity() int
+	GetActive() bool
+}
+type dbselectparamReservation struct {
+	dbselectparam
+	Storage int
+	Product int
+	Entity  int
+	Active  bool
+}
+
+// DbselectparamPurchaseRequest contains the parameters of the GetPurchaseRequests function
+type DbselectparamPurchaseRequest interface {
+	Dbselectparam
+	SetEntity(int)
+	SetProduct(int)
+	SetStatus(string)
+
+	GetEntity() int
+	GetProduct() int
+	GetStatus() string
+}
+type dbselectparamPurchaseRequest struct {
+	dbselectparam
+	Entity  int
+	Product int
+	Status  string
+}
+
+// DbselectparamStockThreshold contains the parameters of the GetStockThresholds function
+type DbselectparamStockThreshold interface {
+	Dbselectparam
+	SetEntity(int)
+	SetProduct(int)
+
+	GetEntity() int
+	GetProduct() int
+}
+type dbselectparamStockThreshold struct {
+	dbselectparam
+	Entity  int
+	Product int
+}
+
 //
 // dbselectparam functions
 //
@@ -373,6 +484,144 @@ func (d dbselectparamPerson) GetEntity() int {
 	return d.Entity
 }
 
+//
+// dbselectparamInventory functions
+//
+func (d *dbselectparamInventory) SetEntity(i int) {
+	d.Entity = i
+}
+
+func (d dbselectparamInventory) GetEntity() int {
+	return d.Entity
+}
+
+func (d *dbselectparamInventory) SetOpen(b bool) {
+	d.Open = b
+}
+
+func (d dbselectparamInventory) GetOpen() bool {
+	return d.Open
+}
+
+//
+// dbselectparamWastePickup functions
+//
+func (d *dbselectparamWastePickup) SetEntity(i int) {
+	d.Entity = i
+}
+
+func (d dbselectparamWastePickup) GetEntity() int {
+	return d.Entity
+}
+
+func (d *dbselectparamWastePickup) SetOpen(b bool) {
+	d.Open = b
+}
+
+func (d dbselectparamWastePickup) GetOpen() bool {
+	return d.Open
+}
+
+//
+// dbselectparamStorageTransfer functions
+//
+func (d *dbselectparamStorageTransfer) SetEntity(i int) {
+	d.Entity = i
+}
+
+func (d dbselectparamStorageTransfer) GetEntity() int {
+	return d.Entity
+}
+
+func (d *dbselectparamStorageTransfer) SetStatus(s string) {
+	d.Status = s
+}
+
+func (d dbselectparamStorageTransfer) GetStatus() string {
+	return d.Status
+}
+
+//
+// dbselectparamReservation functions
+//
+func (d *dbselectparamReservation) SetStorage(i int) {
+	d.Storage = i
+}
+
+func (d dbselectparamReservation) GetStorage() int {
+	return d.Storage
+}
+
+func (d *dbselectparamReservation) SetProduct(i int) {
+	d.Product = i
+}
+
+func (d dbselectparamReservation) GetProduct() int {
+	return d.Product
+}
+
+func (d *dbselectparamReservation) SetEntity(i int) {
+	d.Entity = i
+}
+
+func (d dbselectparamReservation) GetEntity() int {
+	return d.Entity
+}
+
+func (d *dbselectparamReservation) SetActive(b bool) {
+	d.Active = b
+}
+
+func (d dbselectparamReservation) GetActive() bool {
+	return d.Active
+}
+
+//
+// dbselectparamPurchaseRequest functions
+//
+func (d *dbselectparamPurchaseRequest) SetEntity(i int) {
+	d.Entity = i
+}
+
+func (d dbselectparamPurchaseRequest) GetEntity() int {
+	return d.Entity
+}
+
+func (d *dbselectparamPurchaseRequest) SetProduct(i int) {
+	d.Product = i
+}
+
+func (d dbselectparamPurchaseRequest) GetProduct() int {
+	return d.Product
+}
+
+func (d *dbselectparamPurchaseRequest) SetStatus(s string) {
+	d.Status = s
+}
+
+func (d dbselectparamPurchaseRequest) GetStatus() string {
+	return d.Status
+}
+
+//
+// dbselectparamStockThreshold functions
+//
+func (d *dbselectparamStockThreshold) SetEntity(i int) {
+	d.Entity = i
+}
+
+func (d dbselectparamStockThreshold) GetEntity() int {
+	return d.Entity
+}
+
+func (d *dbselectparamStockThreshold) SetProduct(i int) {
+	d.Product = i
+}
+
+func (d dbselectparamStockThreshold) GetProduct() int {
+	return d.Product
+}
+
 //
 // dbselectparamStoreLocation functions
 //
@@ -475,6 +724,14 @@ func (d dbselectparamProduct) GetStorelocation() int {
 	return d.Storelocation
 }
 
+func (d *dbselectparamProduct) SetStorelocationSubtree(b bool) {
+	d.StorelocationSubtree = b
+}
+
+func (d dbselectparamProduct) GetStorelocationSubtree() bool {
+	return d.StorelocationSubtree
+}
+
 func (d *dbselectparamProduct) SetBookmark(b bool) {
 	d.Bookmark = b
 }
@@ -678,6 +935,14 @@ func (d dbselectparamStorage) GetStorelocation() int {
 	return d.Storelocation
 }
 
+func (d *dbselectparamStorage) SetStorelocationSubtree(b bool) {
+	d.StorelocationSubtree = b
+}
+
+func (d dbselectparamStorage) GetStorelocationSubtree() bool {
+	return d.StorelocationSubtree
+}
+
 func (d *dbselectparamStorage) SetStorage(i int) {
 	d.Storage = i
 }
@@ -966,6 +1231,15 @@ func NewdbselectparamProduct(r *http.Request, f func(string) (string, error)) (*
 				}
 			}
 		}
+		if subtree, ok := r.URL.Query()["storelocation_subtree"]; ok {
+			if dspp.StorelocationSubtree, err = strconv.ParseBool(subtree[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "storelocation_subtree bool conversion",
+				}
+			}
+		}
 		if bookmark, ok := r.URL.Query()["bookmark"]; ok {
 			if dspp.Bookmark, err = strconv.ParseBool(bookmark[0]); err != nil {
 				return nil, &AppError{
@@ -1239,6 +1513,15 @@ func NewdbselectparamStorage(r *http.Request, f func(string) (string, error)) (*
 				}
 			}
 		}
+		if subtree, ok := r.URL.Query()["storelocation_subtree"]; ok {
+			if dsps.StorelocationSubtree, err = strconv.ParseBool(subtree[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "storelocation_subtree bool conversion",
+				}
+			}
+		}
 		if storageid, ok := r.URL.Query()["storage"]; ok {
 			if dsps.Storage, err = strconv.Atoi(storageid[0]); err != nil {
 				return nil, &AppError{
@@ -1661,3 +1944,306 @@ func NewdbselectparamEntity(r *http.Request, f func(string) (string, error)) (*d
 	return &dspe, nil
 
 }
+
+// NewdbselectparamInventory returns a dbselectparamInventory struct
+// with values populated from the request parameters
+func NewdbselectparamInventory(r *http.Request, f func(string) (string, error)) (*dbselectparamInventory, *AppError) {
+
+	var (
+		err  error
+		aerr *AppError
+		dsp  *dbselectparam
+		dspi dbselectparamInventory
+	)
+
+	// init defaults
+	dspi.Entity = -1
+	dspi.Open = false
+	if dsp, aerr = Newdbselectparam(r, f); aerr != nil {
+		return nil, aerr
+	}
+	dspi.dbselectparam = *dsp
+
+	if r != nil {
+		if o, ok := r.URL.Query()["sort"]; ok {
+			dspi.OrderBy = o[0]
+		} else {
+			dspi.OrderBy = "inventory_id"
+		}
+		if entityid, ok := r.URL.Query()["entity"]; ok {
+			if dspi.Entity, err = strconv.Atoi(entityid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "entity atoi conversion",
+				}
+			}
+		}
+		if open, ok := r.URL.Query()["open"]; ok {
+			if dspi.Open, err = strconv.ParseBool(open[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "open bool conversion",
+				}
+			}
+		}
+	}
+	return &dspi, nil
+
+}
+
+// NewdbselectparamWastePickup returns a dbselectparamWastePickup struct
+// with values populated from the request parameters
+func NewdbselectparamWastePickup(r *http.Request, f func(string) (string, error)) (*dbselectparamWastePickup, *AppError) {
+
+	var (
+		err  error
+		aerr *AppError
+		dsp  *dbselectparam
+		dspw dbselectparamWastePickup
+	)
+
+	// init defaults
+	dspw.Entity = -1
+	dspw.Open = false
+	if dsp, aerr = Newdbselectparam(r, f); aerr != nil {
+		return nil, aerr
+	}
+	dspw.dbselectparam = *dsp
+
+	if r != nil {
+		if o, ok := r.URL.Query()["sort"]; ok {
+			dspw.OrderBy = o[0]
+		} else {
+			dspw.OrderBy = "wastepickup_id"
+		}
+		if entityid, ok := r.URL.Query()["entity"]; ok {
+			if dspw.Entity, err = strconv.Atoi(entityid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "entity atoi conversion",
+				}
+			}
+		}
+		if open, ok := r.URL.Query()["open"]; ok {
+			if dspw.Open, err = strconv.ParseBool(open[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "open bool conversion",
+				}
+			}
+		}
+	}
+	return &dspw, nil
+
+}
+
+// NewdbselectparamStorageTransfer returns a dbselectparamStorageTransfer struct
+// with values populated from the request parameters
+func NewdbselectparamStorageTransfer(r *http.Request, f func(string) (string, error)) (*dbselectparamStorageTransfer, *AppError) {
+
+	var (
+		err  error
+		aerr *AppError
+		dsp  *dbselectparam
+		dspt dbselectparamStorageTransfer
+	)
+
+	// init defaults
+	dspt.Entity = -1
+	if dsp, aerr = Newdbselectparam(r, f); aerr != nil {
+		return nil, aerr
+	}
+	dspt.dbselectparam = *dsp
+
+	if r != nil {
+		if o, ok := r.URL.Query()["sort"]; ok {
+			dspt.OrderBy = o[0]
+		} else {
+			dspt.OrderBy = "storagetransfer_id"
+		}
+		if entityid, ok := r.URL.Query()["entity"]; ok {
+			if dspt.Entity, err = strconv.Atoi(entityid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "entity atoi conversion",
+				}
+			}
+		}
+		if status, ok := r.URL.Query()["status"]; ok {
+			dspt.Status = status[0]
+		}
+	}
+	return &dspt, nil
+
+}
+
+// NewdbselectparamReservation returns a dbselectparamReservation struct
+// initialized with the request parameters
+func NewdbselectparamReservation(r *http.Request, f func(string) (string, error)) (*dbselectparamReservation, *AppError) {
+
+	var (
+		err  error
+		aerr *AppError
+		dsp  *dbselectparam
+		dspr dbselectparamReservation
+	)
+
+	// init defaults
+	dspr.Storage = -1
+	dspr.Product = -1
+	dspr.Entity = -1
+	if dsp, aerr = Newdbselectparam(r, f); aerr != nil {
+		return nil, aerr
+	}
+	dspr.dbselectparam = *dsp
+
+	if r != nil {
+		if o, ok := r.URL.Query()["sort"]; ok {
+			dspr.OrderBy = o[0]
+		} else {
+			dspr.OrderBy = "reservation_startdate"
+		}
+		if storageid, ok := r.URL.Query()["storage"]; ok {
+			if dspr.Storage, err = strconv.Atoi(storageid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "storage atoi conversion",
+				}
+			}
+		}
+		if productid, ok := r.URL.Query()["product"]; ok {
+			if dspr.Product, err = strconv.Atoi(productid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "product atoi conversion",
+				}
+			}
+		}
+		if entityid, ok := r.URL.Query()["entity"]; ok {
+			if dspr.Entity, err = strconv.Atoi(entityid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "entity atoi conversion",
+				}
+			}
+		}
+		if active, ok := r.URL.Query()["active"]; ok {
+			if dspr.Active, err = strconv.ParseBool(active[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "active bool conversion",
+				}
+			}
+		}
+	}
+	return &dspr, nil
+
+}
+
+// NewdbselectparamPurchaseRequest returns a dbselectparamPurchaseRequest struct
+// with values populated from the request parameters
+func NewdbselectparamPurchaseRequest(r *http.Request, f func(string) (string, error)) (*dbselectparamPurchaseRequest, *AppError) {
+
+	var (
+		err  error
+		aerr *AppError
+		dsp  *dbselectparam
+		dspp dbselectparamPurchaseRequest
+	)
+
+	// init defaults
+	dspp.Entity = -1
+	dspp.Product = -1
+	if dsp, aerr = Newdbselectparam(r, f); aerr != nil {
+		return nil, aerr
+	}
+	dspp.dbselectparam = *dsp
+
+	if r != nil {
+		if o, ok := r.URL.Query()["sort"]; ok {
+			dspp.OrderBy = o[0]
+		} else {
+			dspp.OrderBy = "purchaserequest_id"
+		}
+		if entityid, ok := r.URL.Query()["entity"]; ok {
+			if dspp.Entity, err = strconv.Atoi(entityid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "entity atoi conversion",
+				}
+			}
+		}
+		if productid, ok := r.URL.Query()["product"]; ok {
+			if dspp.Product, err = strconv.Atoi(productid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "product atoi conversion",
+				}
+			}
+		}
+		if status, ok := r.URL.Query()["status"]; ok {
+			dspp.Status = status[0]
+		}
+	}
+	return &dspp, nil
+
+}
+
+// NewdbselectparamStockThreshold returns a dbselectparamStockThreshold struct
+// with values populated from the request parameters
+func NewdbselectparamStockThreshold(r *http.Request, f func(string) (string, error)) (*dbselectparamStockThreshold, *AppError) {
+
+	var (
+		err  error
+		aerr *AppError
+		dsp  *dbselectparam
+		dsps dbselectparamStockThreshold
+	)
+
+	// init defaults
+	dsps.Entity = -1
+	dsps.Product = -1
+	if dsp, aerr = Newdbselectparam(r, f); aerr != nil {
+		return nil, aerr
+	}
+	dsps.dbselectparam = *dsp
+
+	if r != nil {
+		if o, ok := r.URL.Query()["sort"]; ok {
+			dsps.OrderBy = o[0]
+		} else {
+			dsps.OrderBy = "name.name_label"
+		}
+		if entityid, ok := r.URL.Query()["entity"]; ok {
+			if dsps.Entity, err = strconv.Atoi(entityid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "entity atoi conversion",
+				}
+			}
+		}
+		if productid, ok := r.URL.Query()["product"]; ok {
+			if dsps.Product, err = strconv.Atoi(productid[0]); err != nil {
+				return nil, &AppError{
+					Error:   err,
+					Code:    http.StatusInternalServerError,
+					Message: "product atoi conversion",
+				}
+			}
+		}
+	}
+	return &dsps, nil
+
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Sensor is an environmental probe of a store location.
+// Sensors authenticate their readings with a token
+// only returned at their creation.
+type Sensor struct {
+	SensorID      int    `db:"sensor_id" json:"sensor_id" schema:"sensor_id"`
+	SensorLabel   string `db:"sensor_label" json:"sensor_label" schema:"sensor_label"`
+	StoreLocation `db:"storelocation" json:"storelocation" schema:"storelocation"`
+
+	SensorToken string `db:"-" json:"sensor_token,omitempty" schema:"-"`
+}
+
+// SensorMeasure is a reading sent by a sensor.
+// The reading date is the reception date if not set.
+type SensorMeasure struct {
+	Date        *time.Time `json:"date"`
+	Temperature *float64   `json:"temperature"` // Celsius
+	Humidity    *float64   `json:"humidity"`    // relative humidity percentage
+}
+
+// SensorReading is a recorded sensor reading of a store location.
+type SensorReading struct {
+	SensorReadingID          int             `db:"sensorreading_id" json:"sensorreading_id" schema:"sensorreading_id"`
+	SensorReadingDate        time.Time       `db:"sensorreading_date" json:"sensorreading_date" schema:"sensorreading_date"`
+	SensorReadingTemperature sql.NullFloat64 `db:"sensorreading_temperature" json:"sensorreading_temperature" schema:"sensorreading_temperature"`
+	SensorReadingHumidity    sql.NullFloat64 `db:"sensorreading_humidity" json:"sensorreading_humidity" schema:"sensorreading_humidity"`
+	Sensor                   `db:"sensor" json:"sensor" schema:"sensor"`
+}
+
+// SensorAlert is raised by the first reading of a store location
+// out of its temperature range.
+// Storages are the current storages of the store location
+// and its children at the time of the reading.
+type SensorAlert struct {
+	SensorAlertID     int           `db:"sensoralert_id" json:"sensoralert_id" schema:"sensoralert_id"`
+	SensorAlertReason string        `db:"sensoralert_reason" json:"sensoralert_reason" schema:"sensoralert_reason"`
+	SensorReading     SensorReading `db:"sensorreading" json:"sensorreading" schema:"sensorreading"`
+
+	Storages []Storage `db:"-" json:"storages" schema:"-"`
+}
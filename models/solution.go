@@ -0,0 +1,33 @@
+package models
+
+import "database/sql"
+
+// SolutionSource is a source storage quantity used to prepare a solution.
+type SolutionSource struct {
+	StorageID int `json:"storage_id"`
+	// withdrawn quantity, in the storage quantity unit
+	Quantity float64 `json:"quantity"`
+}
+
+// Solution is a request to prepare a solution from source storages.
+// Sources of the solution product are the solutes, the other ones the solvents.
+type Solution struct {
+	Sources         []SolutionSource `json:"sources"`
+	StoreLocationID int              `json:"storelocation_id"`
+	// solution product, the first source product if not set
+	ProductID int `json:"product_id"`
+	// solution volume, the sum of the sources volumes if not set
+	Quantity     sql.NullFloat64 `json:"quantity"`
+	UnitQuantity sql.NullInt64   `json:"unit_quantity"`
+	// concentration unit, chosen from the solutes concentrations if not set
+	UnitConcentration sql.NullInt64  `json:"unit_concentration"`
+	ExpirationDate    sql.NullTime   `json:"expiration_date"`
+	Comment           sql.NullString `json:"comment"`
+}
+
+// StorageSource is a source storage of a prepared solution
+// with the quantity withdrawn from it.
+type StorageSource struct {
+	Storage
+	StorageSourceQuantity float64 `db:"storagesource_quantity" json:"storagesource_quantity"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// Spending report groupings
+const (
+	SpendingByEntity   = "entity"
+	SpendingBySupplier = "supplier"
+	SpendingByCategory = "category"
+	SpendingByPeriod   = "period" // month of the storage entry date
+)
+
+// SpendingFilter contains the parameters of a spending report
+type SpendingFilter struct {
+	GroupBy string
+	// entities of the report, all of them if nil
+	Entities []int
+	// storage entry dates boundaries as 2006-01-02, ignored if empty
+	From string
+	To   string
+}
+
+// SpendingLine is a spending report line, for a group and a currency.
+// Storages are valued at their purchase price, or at the unit price
+// of their supplier reference when not set.
+type SpendingLine struct {
+	SpendingGroup    string `db:"spending_group" json:"spending_group"`
+	SpendingCurrency string `db:"spending_currency" json:"spending_currency"`
+	// storages entered in the period, and the ones without price
+	SpendingStorageCount  int `db:"spending_storagecount" json:"spending_storagecount"`
+	SpendingUnpricedCount int `db:"spending_unpricedcount" json:"spending_unpricedcount"`
+	// value of all the storages, of the ones still in stock
+	// and of the ones disposed (storage_todestroy)
+	SpendingTotal         float64 `db:"spending_total" json:"spending_total"`
+	SpendingStockValue    float64 `db:"spending_stockvalue" json:"spending_stockvalue"`
+	SpendingDisposedValue float64 `db:"spending_disposedvalue" json:"spending_disposedvalue"`
+}
+
+// WriteSpendingsCSV writes into w the spending report lines
+func WriteSpendingsCSV(w io.Writer, lines []SpendingLine) error {
+
+	formatPrice := func(p float64) string {
+		return strconv.FormatFloat(p, 'f', 2, 64)
+	}
+
+	csvwr := csv.NewWriter(w)
+
+	if err := csvwr.Write([]string{"group", "currency", "storages", "unpriced_storages", "total", "stock_value", "disposed_value"}); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if err := csvwr.Write([]string{
+			l.SpendingGroup,
+			l.SpendingCurrency,
+			strconv.Itoa(l.SpendingStorageCount),
+			strconv.Itoa(l.SpendingUnpricedCount),
+			formatPrice(l.SpendingTotal),
+			formatPrice(l.SpendingStockValue),
+			formatPrice(l.SpendingDisposedValue),
+		}); err != nil {
+			return err
+		}
+	}
+
+	csvwr.Flush()
+	return csvwr.Error()
+
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+// Stock trend periods
+const (
+	StockTrendByDay   = "day"
+	StockTrendByMonth = "month"
+	StockTrendByYear  = "year"
+)
+
+// StockTrendFilter contains the parameters of a stock trend
+type StockTrendFilter struct {
+	Product int
+	// entities of the trend, all of them if nil
+	Entities []int
+	// store location of the trend, with its children, ignored if -1
+	StoreLocation int
+	Period        string
+	// snapshot dates boundaries as 2006-01-02, ignored if empty
+	From string
+	To   string
+}
+
+// StockTrend is the stock history of a product for a reference unit,
+// or for the storages without unit if the unit is not valid.
+type StockTrend struct {
+	Unit   Unit              `json:"unit"`
+	Points []StockTrendPoint `json:"points"`
+}
+
+// StockTrendPoint is the stock of a product at the last snapshot
+// of a period, in the reference unit of the trend.
+type StockTrendPoint struct {
+	StockTrendPointPeriod       string  `json:"stocktrendpoint_period"`
+	StockTrendPointDate         string  `json:"stocktrendpoint_date"` // snapshot date
+	StockTrendPointQuantity     float64 `json:"stocktrendpoint_quantity"`
+	StockTrendPointStorageCount int     `json:"stocktrendpoint_storagecount"`
+}
+
+// WriteStockTrendsCSV writes into w the stock trends points
+func WriteStockTrendsCSV(w io.Writer, trends []StockTrend) error {
+
+	csvwr := csv.NewWriter(w)
+
+	if err := csvwr.Write([]string{"period", "date", "unit", "quantity", "storages"}); err != nil {
+		return err
+	}
+	for _, t := range trends {
+		for _, p := range t.Points {
+			if err := csvwr.Write([]string{
+				p.StockTrendPointPeriod,
+				p.StockTrendPointDate,
+				t.Unit.UnitLabel.String,
+				strconv.FormatFloat(p.StockTrendPointQuantity, 'f', -1, 64),
+				strconv.Itoa(p.StockTrendPointStorageCount),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	csvwr.Flush()
+	return csvwr.Error()
+
+}
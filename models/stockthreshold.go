@@ -0,0 +1,19 @@
+package models
+
+// StockThreshold is the minimum stock of a product in an entity.
+// A threshold with a unit is compared to the stock of the storages
+// with a unit converted into the threshold unit, a threshold without unit
+// to the number of items (consumables units and storages without unit).
+type StockThreshold struct {
+	StockThresholdID       int     `db:"stockthreshold_id" json:"stockthreshold_id" schema:"stockthreshold_id"`
+	StockThresholdQuantity float64 `db:"stockthreshold_quantity" json:"stockthreshold_quantity" schema:"stockthreshold_quantity"`
+	Entity                 `db:"entity" json:"entity" schema:"entity"`
+	Product                Product `db:"product" json:"product" schema:"product"`
+	UnitQuantity           Unit    `db:"unit_quantity" json:"unit_quantity" schema:"unit_quantity"`
+	// current stock expressed in the threshold unit,
+	// computed for the alerts
+	StockThresholdStock float64 `db:"-" json:"stockthreshold_stock" schema:"-"`
+	// reason why a part of the stock could not be converted
+	// into the threshold unit
+	StockThresholdNotConvertible string `db:"-" json:"stockthreshold_notconvertible,omitempty" schema:"-"`
+}
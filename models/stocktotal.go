@@ -0,0 +1,40 @@
+package models
+
+// Quantity unit dimensions
+const (
+	UnitDimensionMass   = "mass"
+	UnitDimensionVolume = "volume"
+	UnitDimensionMoles  = "moles"
+	UnitDimensionLength = "length"
+)
+
+// StockTotals is the stock of a product normalised per unit dimension.
+type StockTotals struct {
+	Product Product `json:"product"`
+	// one total per dimension
+	Totals []StockTotal `json:"totals"`
+	// the stock of the storages with a unit in mass, volume and moles
+	Converted []ConvertedQuantity `json:"converted"`
+	// storages without unit, their quantity can not be normalised
+	NoUnit StockTotalItem `json:"nounit"`
+	// storages without quantity
+	StockTotalUnquantifiedCount int `json:"stocktotal_unquantifiedcount"`
+}
+
+// StockTotal is the stock of a product for a dimension,
+// expressed in the reference unit of the dimension.
+type StockTotal struct {
+	StockTotalDimension string  `json:"stocktotal_dimension"`
+	StockTotalUnit      Unit    `json:"stocktotal_unit"` // reference unit
+	StockTotalTotal     float64 `json:"stocktotal_total"`
+	// the quantities per storage unit
+	Breakdown []StockTotalItem `json:"breakdown"`
+}
+
+// StockTotalItem is the stock of a product for a storage unit.
+type StockTotalItem struct {
+	StockTotalItemUnit         Unit    `json:"stocktotalitem_unit"`
+	StockTotalItemStorageCount int     `json:"stocktotalitem_storagecount"`
+	StockTotalItemQuantity     float64 `json:"stocktotalitem_quantity"` // in the storage unit
+	StockTotalItemTotal        float64 `json:"stocktotalitem_total"`    // in the reference unit
+}
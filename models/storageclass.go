@@ -0,0 +1,32 @@
+package models
+
+// StorageClass is a segregation class of products
+// that must not be stored with the products of its incompatible classes.
+// Unless set explicitly, the classes of a product are derived from
+// its hazard statements and classes of compounds.
+type StorageClass struct {
+	StorageClassID          int    `db:"storageclass_id" json:"storageclass_id" schema:"storageclass_id"`
+	StorageClassLabel       string `db:"storageclass_label" json:"storageclass_label" schema:"storageclass_label"`
+	StorageClassDescription string `db:"storageclass_description" json:"storageclass_description" schema:"storageclass_description"`
+
+	Incompatibilities []StorageClass `db:"-" json:"incompatibilities,omitempty" schema:"incompatibilities"`
+}
+
+// ProductStorageClasses are the storage classes of a product.
+// Derived is true when they are derived from the product
+// hazard statements and classes of compounds.
+type ProductStorageClasses struct {
+	ProductID      int            `json:"product_id"`
+	Derived        bool           `json:"derived"`
+	StorageClasses []StorageClass `json:"storageclasses"`
+}
+
+// StorageClassConflict is a product stored in a store location
+// with a product of an incompatible storage class.
+type StorageClassConflict struct {
+	StoreLocation           StoreLocation `db:"storelocation" json:"storelocation"`
+	Product                 Product       `db:"product" json:"product"`
+	StorageClass            StorageClass  `db:"storageclass" json:"storageclass"`
+	ConflictingProduct      Product       `db:"conflictingproduct" json:"conflictingproduct"`
+	ConflictingStorageClass StorageClass  `db:"conflictingstorageclass" json:"conflictingstorageclass"`
+}
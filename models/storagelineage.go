@@ -0,0 +1,25 @@
+package models
+
+// StorageSplit is a request to split a storage into aliquots.
+type StorageSplit struct {
+	// aliquots quantities, in the storage quantity unit
+	Quantities []float64 `json:"quantities"`
+}
+
+// StorageLineageNode is a storage of a lineage
+// with its distance to the lineage storage.
+type StorageLineageNode struct {
+	Storage
+	// negative for the ancestors, positive for the descendants
+	Depth int `db:"depth" json:"depth"`
+}
+
+// StorageLineage is a storage with the storages it has been split from
+// and the storages split from it, recursively.
+type StorageLineage struct {
+	Storage Storage `json:"storage"`
+	// from the parent up to the root storage
+	Ancestors []StorageLineageNode `json:"ancestors"`
+	// ordered by depth
+	Descendants []StorageLineageNode `json:"descendants"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Storage transfer statuses
+const (
+	StorageTransferPending   = "pending"
+	StorageTransferAccepted  = "accepted"
+	StorageTransferRefused   = "refused"
+	StorageTransferCancelled = "cancelled"
+)
+
+// StorageTransfer is a request to move a storage into a store location
+// of another entity, accepted or refused by the target entity managers.
+// Transfers are kept as an audit trail.
+type StorageTransfer struct {
+	StorageTransferID           int            `db:"storagetransfer_id" json:"storagetransfer_id" schema:"storagetransfer_id"`
+	StorageTransferCreationDate time.Time      `db:"storagetransfer_creationdate" json:"storagetransfer_creationdate" schema:"storagetransfer_creationdate"`
+	StorageTransferStatus       string         `db:"storagetransfer_status" json:"storagetransfer_status" schema:"storagetransfer_status"`
+	StorageTransferComment      sql.NullString `db:"storagetransfer_comment" json:"storagetransfer_comment" schema:"storagetransfer_comment"`
+	StorageTransferDecisionDate sql.NullTime   `db:"storagetransfer_decisiondate" json:"storagetransfer_decisiondate" schema:"storagetransfer_decisiondate"`
+	Storage                     Storage        `db:"storage" json:"storage" schema:"storage"`
+	// requester
+	Person `db:"person" json:"person" schema:"person"`
+	// storage store location and entity at the request time
+	SourceStoreLocation StoreLocation `db:"source_storelocation" json:"source_storelocation" schema:"source_storelocation"`
+	SourceEntity        Entity        `db:"source_entity" json:"source_entity" schema:"source_entity"`
+	// target store location and entity
+	StoreLocation StoreLocation `db:"storelocation" json:"storelocation" schema:"storelocation"`
+	Entity        `db:"entity" json:"entity" schema:"entity"`
+	// manager who accepted or refused the transfer
+	DecisionPerson Person `db:"decision_person" json:"decision_person" schema:"decision_person"`
+}
+
+// IsPending returns true if the transfer has not been accepted, refused or cancelled yet
+func (t StorageTransfer) IsPending() bool {
+	return t.StorageTransferStatus == StorageTransferPending
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// StorageFieldChange is a storage field modified between two versions.
+// Values are nil when not set.
+type StorageFieldChange struct {
+	Field string  `json:"field"`
+	Old   *string `json:"old"`
+	New   *string `json:"new"`
+}
+
+// StorageVersion is a version of a storage, an history storage or the current one,
+// with its changes from the previous version.
+type StorageVersion struct {
+	StorageVersionID        int                  `json:"storageversion_id"`
+	StorageVersionCurrent   bool                 `json:"storageversion_current"`
+	StorageModificationDate time.Time            `json:"storage_modificationdate"`
+	Person                  Person               `json:"person"`
+	Changes                 []StorageFieldChange `json:"changes"`
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+)
+
+// Store location hierarchy levels
+const (
+	StoreLocationLevelSite     = "site"
+	StoreLocationLevelBuilding = "building"
+	StoreLocationLevelFloor    = "floor"
+	StoreLocationLevelRoom     = "room"
+	StoreLocationLevelCabinet  = "cabinet"
+	StoreLocationLevelShelf    = "shelf"
+)
+
+// StoreLocationLevels are the store location hierarchy levels, from the top.
+var StoreLocationLevels = []string{
+	StoreLocationLevelSite,
+	StoreLocationLevelBuilding,
+	StoreLocationLevelFloor,
+	StoreLocationLevelRoom,
+	StoreLocationLevelCabinet,
+	StoreLocationLevelShelf,
+}
+
+// StoreLocationLevelDepth returns the depth of the level l in the hierarchy
+// and false if it is unknown.
+func StoreLocationLevelDepth(l string) (int, bool) {
+
+	for i, level := range StoreLocationLevels {
+		if l == level {
+			return i, true
+		}
+	}
+
+	return 0, false
+
+}
+
+// ValidateStoreLocationLevel returns an error if the level of the store location s
+// is unknown or if it is not below the level of its parent
+// or above the levels of its children.
+// Store locations without level are not checked.
+func ValidateStoreLocationLevel(s StoreLocation, parent *StoreLocation, children []StoreLocation) error {
+
+	if !s.StoreLocationLevel.Valid || s.StoreLocationLevel.String == "" {
+		return nil
+	}
+
+	depth, ok := StoreLocationLevelDepth(s.StoreLocationLevel.String)
+	if !ok {
+		return errors.New("unknown store location level " + s.StoreLocationLevel.String)
+	}
+	if parent != nil && parent.StoreLocationLevel.Valid {
+		if parentDepth, ok := StoreLocationLevelDepth(parent.StoreLocationLevel.String); ok && parentDepth >= depth {
+			return errors.New("a " + s.StoreLocationLevel.String + " can not be in a " + parent.StoreLocationLevel.String)
+		}
+	}
+	for _, c := range children {
+		if !c.StoreLocationLevel.Valid {
+			continue
+		}
+		if childDepth, ok := StoreLocationLevelDepth(c.StoreLocationLevel.String); ok && childDepth <= depth {
+			return errors.New("a " + s.StoreLocationLevel.String + " can not contain a " + c.StoreLocationLevel.String)
+		}
+	}
+
+	return nil
+
+}
+
+// StoreLocationRollup is the stock and hazards of the current storages
+// of a store location and its children.
+type StoreLocationRollup struct {
+	StoreLocation StoreLocation `json:"storelocation"`
+	StorageCount  int           `json:"storagecount"`
+	// stock per dimension in its reference unit
+	Totals []ConvertedQuantity `json:"totals"`
+	// storages whose quantity could not be converted, not included in the totals
+	NotConvertibleCount int `json:"notconvertiblecount"`
+	// storages count per GHS symbol
+	Symbols []StoreLocationRollupSymbol `json:"symbols"`
+	// storages of CMR products
+	CMRCount int `json:"cmrcount"`
+}
+
+// StoreLocationRollupSymbol is the count of storages of products with a symbol.
+type StoreLocationRollupSymbol struct {
+	Symbol       Symbol `db:"symbol" json:"symbol"`
+	StorageCount int    `db:"storagecount" json:"storagecount"`
+}
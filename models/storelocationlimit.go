@@ -0,0 +1,32 @@
+package models
+
+// StoreLocationLimit is a regulatory maximum quantity, in a mass, volume
+// or moles unit, of the products matching its criteria in a store location
+// and its children.
+// A product matches if it has one of the hazard statements (if any),
+// one of the symbols (if any) and the physical state (if set).
+// Writes of storages exceeding a hard limit are refused,
+// the other limits only raise warnings.
+type StoreLocationLimit struct {
+	StoreLocationLimitID       int     `db:"storelocationlimit_id" json:"storelocationlimit_id" schema:"storelocationlimit_id"`
+	StoreLocationLimitLabel    string  `db:"storelocationlimit_label" json:"storelocationlimit_label" schema:"storelocationlimit_label"`
+	StoreLocationLimitQuantity float64 `db:"storelocationlimit_quantity" json:"storelocationlimit_quantity" schema:"storelocationlimit_quantity"`
+	StoreLocationLimitHard     bool    `db:"storelocationlimit_hard" json:"storelocationlimit_hard" schema:"storelocationlimit_hard"`
+	StoreLocation              `db:"storelocation" json:"storelocation" schema:"storelocation"`
+	Unit                       Unit          `db:"unit" json:"unit" schema:"unit"`
+	PhysicalState              PhysicalState `db:"physicalstate" json:"physicalstate" schema:"physicalstate"`
+
+	HazardStatements []HazardStatement `db:"-" json:"hazardstatements" schema:"hazardstatements"`
+	Symbols          []Symbol          `db:"-" json:"symbols" schema:"symbols"`
+}
+
+// StoreLocationLimitStatus is the stock of the products matching a limit,
+// expressed in the limit unit.
+type StoreLocationLimitStatus struct {
+	Limit StoreLocationLimit `json:"limit"`
+	Stock float64            `json:"stock"`
+	// matching storages whose quantity could not be converted
+	// into the limit unit, not included in the stock
+	NotConvertibleCount int  `json:"notconvertiblecount"`
+	Exceeded            bool `json:"exceeded"`
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Store location types
+const (
+	StoreLocationTypeAmbient           = "ambient"
+	StoreLocationTypeFridge            = "fridge"
+	StoreLocationTypeFreezer           = "freezer"
+	StoreLocationTypeVentilatedCabinet = "ventilated cabinet"
+	StoreLocationTypeFlammablesCabinet = "flammables cabinet"
+)
+
+// StoreLocationTypes are the allowed store location types
+var StoreLocationTypes = []string{
+	StoreLocationTypeAmbient,
+	StoreLocationTypeFridge,
+	StoreLocationTypeFreezer,
+	StoreLocationTypeVentilatedCabinet,
+	StoreLocationTypeFlammablesCabinet,
+}
+
+// TemperatureMismatch is a storage whose product temperature
+// is out of the temperature range of its store location.
+type TemperatureMismatch struct {
+	StorageID       sql.NullInt64  `db:"storage_id" json:"storage_id"`
+	StorageBarecode sql.NullString `db:"storage_barecode" json:"storage_barecode"`
+	StoreLocation   StoreLocation  `db:"storelocation" json:"storelocation"`
+	Product         Product        `db:"product" json:"product"`
+	// product temperature in Celsius
+	Temperature float64 `db:"-" json:"temperature"`
+	Reason      string  `db:"-" json:"reason"`
+}
+
+// ValidateStoreLocationTemperature returns an error if the type of the store location s
+// is unknown or if its temperature range is empty.
+func ValidateStoreLocationTemperature(s StoreLocation) error {
+
+	if s.StoreLocationType.Valid && s.StoreLocationType.String != "" {
+		known := false
+		for _, t := range StoreLocationTypes {
+			if s.StoreLocationType.String == t {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errors.New("unknown store location type " + s.StoreLocationType.String)
+		}
+	}
+	if s.StoreLocationMinTemperature.Valid && s.StoreLocationMaxTemperature.Valid &&
+		s.StoreLocationMinTemperature.Float64 > s.StoreLocationMaxTemperature.Float64 {
+		return errors.New("store location minimum temperature above the maximum temperature")
+	}
+
+	return nil
+
+}
+
+// CelsiusTemperature returns the temperature t in the temperature unit
+// with label "unitLabel" in Celsius, Celsius being assumed without unit.
+// It returns false for an unknown unit.
+func CelsiusTemperature(t float64, unitLabel sql.NullString) (float64, bool) {
+
+	if !unitLabel.Valid {
+		return t, true
+	}
+
+	switch unitLabel.String {
+	case "°C", "":
+		return t, true
+	case "°F":
+		return (t - 32) * 5 / 9, true
+	case "°K", "K":
+		return t - 273.15, true
+	}
+
+	return 0, false
+
+}
+
+// temperatureOutOfRange returns why the temperature t in Celsius, described as "what",
+// is out of the store location s range, or an empty string if it is in range.
+func (s StoreLocation) temperatureOutOfRange(what string, t float64) string {
+
+	switch {
+	case s.StoreLocationMinTemperature.Valid && t < s.StoreLocationMinTemperature.Float64:
+		return fmt.Sprintf("%s %s°C below the %s minimum %s°C",
+			what,
+			strconv.FormatFloat(t, 'f', -1, 64),
+			s.StoreLocationFullPath,
+			strconv.FormatFloat(s.StoreLocationMinTemperature.Float64, 'f', -1, 64))
+	case s.StoreLocationMaxTemperature.Valid && t > s.StoreLocationMaxTemperature.Float64:
+		return fmt.Sprintf("%s %s°C above the %s maximum %s°C",
+			what,
+			strconv.FormatFloat(t, 'f', -1, 64),
+			s.StoreLocationFullPath,
+			strconv.FormatFloat(s.StoreLocationMaxTemperature.Float64, 'f', -1, 64))
+	}
+
+	return ""
+
+}
+
+// TemperatureMismatch returns why the product p can not be stored in the store location s,
+// or an empty string if its temperature is in the store location range.
+// Products without temperature and store locations without range always match.
+func (s StoreLocation) TemperatureMismatch(p Product) (float64, string) {
+
+	if !p.ProductTemperature.Valid {
+		return 0, ""
+	}
+	t, ok := CelsiusTemperature(float64(p.ProductTemperature.Int64), p.UnitTemperature.UnitLabel)
+	if !ok {
+		return 0, ""
+	}
+
+	return t, s.temperatureOutOfRange("product temperature", t)
+
+}
+
+// TemperatureExcursion returns why the measured temperature t in Celsius
+// is out of the store location s range, or an empty string if it is in range.
+func (s StoreLocation) TemperatureExcursion(t float64) string {
+
+	return s.temperatureOutOfRange("temperature", t)
+
+}
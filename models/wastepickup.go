@@ -0,0 +1,253 @@
+package models
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Waste hazard classes, by decreasing disposal priority.
+// A storage is classified in the first matching class.
+const (
+	WasteClassRadioactive   = "radioactive"
+	WasteClassExplosive     = "explosive"
+	WasteClassPyrophoric    = "pyrophoric"
+	WasteClassWaterReactive = "waterreactive"
+	WasteClassOxidizing     = "oxidizing"
+	WasteClassCMR           = "cmr"
+	WasteClassToxic         = "toxic"
+	WasteClassFlammable     = "flammable"
+	WasteClassCorrosive     = "corrosive"
+	WasteClassEnvironment   = "environment"
+	WasteClassNonHazardous  = "nonhazardous"
+)
+
+// Waste physical states
+const (
+	WasteStateSolid   = "solid"
+	WasteStateLiquid  = "liquid"
+	WasteStateGas     = "gas"
+	WasteStateUnknown = "unknown"
+)
+
+// wasteClasses are the hazard classes with their hazard statements reference prefixes
+var wasteClasses = []struct {
+	class      string
+	references []string
+}{
+	{WasteClassExplosive, []string{"H200", "H201", "H202", "H203", "H204", "H205", "H240", "H241"}},
+	{WasteClassPyrophoric, []string{"H250", "H251", "H252"}},
+	{WasteClassWaterReactive, []string{"H260", "H261", "EUH014"}},
+	{WasteClassOxidizing, []string{"H270", "H271", "H272"}},
+	{WasteClassCMR, []string{"H340", "H341", "H350", "H351", "H360", "H361", "H362"}},
+	{WasteClassToxic, []string{"H300", "H301", "H310", "H311", "H330", "H331", "H370", "H372"}},
+	{WasteClassFlammable, []string{"H220", "H221", "H222", "H223", "H224", "H225", "H226", "H228", "H242"}},
+	{WasteClassCorrosive, []string{"H290", "H314"}},
+	{WasteClassEnvironment, []string{"H400", "H410", "H411", "H412", "H413"}},
+}
+
+// wasteStates are the physical state label keywords (english and french)
+// and hazard statements references giving a waste physical state
+var wasteStates = []struct {
+	state      string
+	keywords   []string
+	references []string
+}{
+	{WasteStateGas, []string{"gas", "gaz"}, []string{"H220", "H221", "H270", "H280", "H281"}},
+	{WasteStateLiquid, []string{"liquid", "liquide", "solution"}, []string{"H224", "H225", "H226"}},
+	{WasteStateSolid, []string{"solid", "solide", "powder", "poudre"}, []string{"H228"}},
+}
+
+// hasHazardStatement returns true if one of the hazard statements hs
+// starts with one of the references
+func hasHazardStatement(hs []HazardStatement, references []string) bool {
+	for _, h := range hs {
+		for _, r := range references {
+			// strictly match numbers, H360 matches H360FD but not H3600
+			if strings.HasPrefix(h.HazardStatementReference, r) &&
+				(len(h.HazardStatementReference) == len(r) || h.HazardStatementReference[len(r)] > '9') {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WasteState returns the waste physical state of the product p
+// from its physical state label or its hazard statements
+func WasteState(p Product) string {
+
+	label := strings.ToLower(p.PhysicalState.PhysicalStateLabel.String)
+	for _, s := range wasteStates {
+		for _, k := range s.keywords {
+			if strings.Contains(label, k) {
+				return s.state
+			}
+		}
+	}
+	for _, s := range wasteStates {
+		if hasHazardStatement(p.HazardStatements, s.references) {
+			return s.state
+		}
+	}
+
+	return WasteStateUnknown
+
+}
+
+// WasteClass returns the waste hazard class of the product p
+// from its hazard statements
+func WasteClass(p Product) string {
+
+	if p.ProductRadioactive.Valid && p.ProductRadioactive.Bool {
+		return WasteClassRadioactive
+	}
+	for _, c := range wasteClasses {
+		if c.class == WasteClassCMR {
+			for _, h := range p.HazardStatements {
+				if h.HazardStatementCMR.Valid && h.HazardStatementCMR.String != "" {
+					return WasteClassCMR
+				}
+			}
+		}
+		if hasHazardStatement(p.HazardStatements, c.references) {
+			return c.class
+		}
+	}
+
+	return WasteClassNonHazardous
+
+}
+
+// WasteCategory returns the waste category of the product p,
+// its hazard class and physical state, for example "flammable_liquid"
+func WasteCategory(p Product) string {
+	return WasteClass(p) + "_" + WasteState(p)
+}
+
+// wasteCategoryRank returns the disposal priority of the category c
+func wasteCategoryRank(c string) int {
+	class := strings.SplitN(c, "_", 2)[0]
+	if class == WasteClassRadioactive {
+		return 0
+	}
+	for i, wc := range wasteClasses {
+		if wc.class == class {
+			return i + 1
+		}
+	}
+	return len(wasteClasses) + 1
+}
+
+// WastePickup is a pickup request of storages to destroy in an entity
+// by a waste disposal contractor
+type WastePickup struct {
+	WastePickupID             int            `db:"wastepickup_id" json:"wastepickup_id" schema:"wastepickup_id"`
+	WastePickupCreationDate   time.Time      `db:"wastepickup_creationdate" json:"wastepickup_creationdate" schema:"wastepickup_creationdate"`
+	WastePickupDate           sql.NullTime   `db:"wastepickup_date" json:"wastepickup_date" schema:"wastepickup_date"`
+	WastePickupContractor     sql.NullString `db:"wastepickup_contractor" json:"wastepickup_contractor" schema:"wastepickup_contractor"`
+	WastePickupCompletionDate sql.NullTime   `db:"wastepickup_completiondate" json:"wastepickup_completiondate" schema:"wastepickup_completiondate"`
+	Person                    `db:"person" json:"person" schema:"person"`
+	Entity                    `db:"entity" json:"entity" schema:"entity"`
+
+	// waste categories of the pickup storages
+	// on creation the categories to pick up, all if empty
+	WastePickupCategories []string `db:"-" json:"wastepickup_categories" schema:"wastepickup_categories"`
+	// disposal records of the pickup storages
+	WastePickupStorages []WastePickupStorage `db:"-" json:"wastepickup_storages" schema:"wastepickup_storages"`
+
+	// storage count
+	WastePickupSC int `db:"wastepickup_sc" json:"wastepickup_sc" schema:"wastepickup_sc"` // not in db but sqlx requires the "db" entry
+}
+
+// IsCompleted returns true if the storages have been picked up
+func (w WastePickup) IsCompleted() bool {
+	return w.WastePickupCompletionDate.Valid
+}
+
+// WastePickupStorage is the disposal record of a storage picked up.
+// The storage values are copied at the pickup request creation
+// and kept for regulatory retention.
+type WastePickupStorage struct {
+	WastePickupStorageID int             `db:"wastepickupstorage_id" json:"wastepickupstorage_id" schema:"wastepickupstorage_id"`
+	Category             string          `db:"wastepickupstorage_category" json:"wastepickupstorage_category" schema:"wastepickupstorage_category"`
+	Barecode             sql.NullString  `db:"wastepickupstorage_barecode" json:"wastepickupstorage_barecode" schema:"wastepickupstorage_barecode"`
+	ProductName          string          `db:"wastepickupstorage_productname" json:"wastepickupstorage_productname" schema:"wastepickupstorage_productname"`
+	CasNumber            sql.NullString  `db:"wastepickupstorage_casnumber" json:"wastepickupstorage_casnumber" schema:"wastepickupstorage_casnumber"`
+	PhysicalState        sql.NullString  `db:"wastepickupstorage_physicalstate" json:"wastepickupstorage_physicalstate" schema:"wastepickupstorage_physicalstate"`
+	HazardStatements     sql.NullString  `db:"wastepickupstorage_hazardstatements" json:"wastepickupstorage_hazardstatements" schema:"wastepickupstorage_hazardstatements"`
+	Quantity             sql.NullFloat64 `db:"wastepickupstorage_quantity" json:"wastepickupstorage_quantity" schema:"wastepickupstorage_quantity"`
+	Unit                 sql.NullString  `db:"wastepickupstorage_unit" json:"wastepickupstorage_unit" schema:"wastepickupstorage_unit"`
+	StoreLocation        sql.NullString  `db:"wastepickupstorage_storelocation" json:"wastepickupstorage_storelocation" schema:"wastepickupstorage_storelocation"`
+	WastePickupID        int             `db:"wastepickup" json:"wastepickup" schema:"wastepickup"`
+	StorageID            int             `db:"storage" json:"storage" schema:"storage"`
+}
+
+// WasteQuantity is a total quantity in a unit
+type WasteQuantity struct {
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+}
+
+// WasteManifestCategory are the quantities of a waste category to pick up
+type WasteManifestCategory struct {
+	Category string `json:"category"`
+	// number of containers
+	Count      int             `json:"count"`
+	Quantities []WasteQuantity `json:"quantities"`
+}
+
+// WasteManifest is the waste manifest of a pickup request
+type WasteManifest struct {
+	WastePickup WastePickup             `json:"wastepickup"`
+	Categories  []WasteManifestCategory `json:"categories"`
+}
+
+// Manifest returns the waste manifest of the pickup w
+// with the quantities per category and unit.
+// Categories are sorted by disposal priority.
+func (w WastePickup) Manifest() WasteManifest {
+
+	var (
+		m        = WasteManifest{WastePickup: w}
+		category = make(map[string]int) // category index in m.Categories
+	)
+
+	for _, s := range w.WastePickupStorages {
+		i, ok := category[s.Category]
+		if !ok {
+			i = len(m.Categories)
+			category[s.Category] = i
+			m.Categories = append(m.Categories, WasteManifestCategory{Category: s.Category})
+		}
+		c := &m.Categories[i]
+		c.Count++
+
+		if !s.Quantity.Valid {
+			continue
+		}
+		found := false
+		for j := range c.Quantities {
+			if c.Quantities[j].Unit == s.Unit.String {
+				c.Quantities[j].Quantity += s.Quantity.Float64
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.Quantities = append(c.Quantities, WasteQuantity{Quantity: s.Quantity.Float64, Unit: s.Unit.String})
+		}
+	}
+
+	sort.SliceStable(m.Categories, func(i, j int) bool {
+		ri, rj := wasteCategoryRank(m.Categories[i].Category), wasteCategoryRank(m.Categories[j].Category)
+		if ri != rj {
+			return ri < rj
+		}
+		return m.Categories[i].Category < m.Categories[j].Category
+	})
+
+	return m
+
+}
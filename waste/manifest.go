@@ -0,0 +1,157 @@
+package waste
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// dateFormat is the manifest dates format
+const dateFormat = "2006-01-02"
+
+// formatQuantity returns the quantity q without trailing zeros
+func formatQuantity(q float64) string {
+	return strconv.FormatFloat(q, 'f', -1, 64)
+}
+
+// formatQuantities returns the quantities qs as "2.5 L + 100 g"
+func formatQuantities(qs []models.WasteQuantity) string {
+	var s []string
+	for _, q := range qs {
+		s = append(s, strings.TrimSpace(formatQuantity(q.Quantity)+" "+q.Unit))
+	}
+	return strings.Join(s, " + ")
+}
+
+// WriteCSV writes into w the CSV waste manifest m,
+// one line per category and unit
+func WriteCSV(w io.Writer, m models.WasteManifest) error {
+
+	csvwr := csv.NewWriter(w)
+
+	if err := csvwr.Write([]string{"category", "containers", "quantity", "unit"}); err != nil {
+		return err
+	}
+	for _, c := range m.Categories {
+		// containers without quantity
+		if len(c.Quantities) == 0 {
+			if err := csvwr.Write([]string{c.Category, strconv.Itoa(c.Count), "", ""}); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, q := range c.Quantities {
+			if err := csvwr.Write([]string{c.Category, strconv.Itoa(c.Count), formatQuantity(q.Quantity), q.Unit}); err != nil {
+				return err
+			}
+		}
+	}
+
+	csvwr.Flush()
+	return csvwr.Error()
+
+}
+
+// WritePDF writes into w the PDF waste manifest m
+// with the quantities per category and the list of the containers
+func WritePDF(w io.Writer, m models.WasteManifest) error {
+
+	var (
+		p          = m.WastePickup
+		lineHeight = 6.0
+	)
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pdf.AddPage()
+
+	// header
+	pdf.SetFont("Helvetica", "B", 16)
+	pdf.CellFormat(0, 10, tr(fmt.Sprintf("Waste manifest #%d", p.WastePickupID)), "", 1, "L", false, 0, "")
+
+	pdf.SetFont("Helvetica", "", 10)
+	header := [][2]string{
+		{"Entity", p.EntityName},
+		{"Requested by", p.PersonEmail},
+		{"Request date", p.WastePickupCreationDate.Format(dateFormat)},
+		{"Contractor", p.WastePickupContractor.String},
+		{"Pickup date", ""},
+		{"Completion date", ""},
+	}
+	if p.WastePickupDate.Valid {
+		header[4][1] = p.WastePickupDate.Time.Format(dateFormat)
+	}
+	if p.WastePickupCompletionDate.Valid {
+		header[5][1] = p.WastePickupCompletionDate.Time.Format(dateFormat)
+	}
+	for _, h := range header {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.CellFormat(40, lineHeight, tr(h[0]), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.CellFormat(0, lineHeight, tr(h[1]), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(lineHeight)
+
+	// quantities per category
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(0, 8, "Quantities per category", "", 1, "L", false, 0, "")
+
+	widths := []float64{70, 30, 80}
+	pdf.SetFont("Helvetica", "B", 10)
+	for i, h := range []string{"Category", "Containers", "Quantity"} {
+		pdf.CellFormat(widths[i], lineHeight, h, "1", 0, "L", false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 10)
+	for _, c := range m.Categories {
+		pdf.CellFormat(widths[0], lineHeight, tr(c.Category), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], lineHeight, strconv.Itoa(c.Count), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], lineHeight, tr(formatQuantities(c.Quantities)), "1", 1, "L", false, 0, "")
+	}
+	pdf.Ln(lineHeight)
+
+	// containers
+	pdf.SetFont("Helvetica", "B", 12)
+	pdf.CellFormat(0, 8, "Containers", "", 1, "L", false, 0, "")
+
+	widths = []float64{38, 25, 62, 22, 33}
+	pdf.SetFont("Helvetica", "B", 8)
+	for i, h := range []string{"Category", "Barecode", "Product", "CAS", "Quantity"} {
+		pdf.CellFormat(widths[i], lineHeight, h, "1", 0, "L", false, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont("Helvetica", "", 8)
+	for _, s := range p.WastePickupStorages {
+		quantity := ""
+		if s.Quantity.Valid {
+			quantity = strings.TrimSpace(formatQuantity(s.Quantity.Float64) + " " + s.Unit.String)
+		}
+		for i, text := range []string{s.Category, s.Barecode.String, s.ProductName, s.CasNumber.String, quantity} {
+			pdf.CellFormat(widths[i], lineHeight, fit(pdf, tr(text), widths[i]-2), "1", 0, "L", false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+
+	if pdf.Err() {
+		return pdf.Error()
+	}
+
+	return pdf.Output(w)
+
+}
+
+// fit cuts the (already translated) text to fit in width with the current font
+func fit(pdf *gofpdf.Fpdf, text string, width float64) string {
+	for len(text) > 0 && pdf.GetStringWidth(text) > width {
+		text = text[:len(text)-1]
+	}
+	return text
+}